@@ -1,7 +1,10 @@
 package main
 
 import (
+	"github.com/heathcliff26/go-wol/pkg/hosts"
+	"github.com/heathcliff26/go-wol/pkg/relay"
 	"github.com/heathcliff26/go-wol/pkg/server"
+	"github.com/heathcliff26/go-wol/pkg/storage"
 	"github.com/heathcliff26/go-wol/pkg/version"
 	"github.com/heathcliff26/go-wol/pkg/wol"
 	"github.com/spf13/cobra"
@@ -26,7 +29,10 @@ func NewRootCommand() *cobra.Command {
 
 	rootCmd.AddCommand(
 		wolCMD,
+		hosts.NewCommand(),
+		relay.NewCommand(),
 		server.NewCommand(),
+		storage.NewCommand(),
 		version.NewCommand(),
 	)
 
@@ -0,0 +1,273 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/leases"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/format"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+)
+
+const DEFAULT_TIMEOUT = 30 * time.Second
+
+const apiPath = "/api/v1"
+
+// Client for the v1 API of a go-wol server.
+type Client struct {
+	server string
+	token  string
+
+	// The http client used for all requests, can be replaced to configure e.g. TLS or timeouts.
+	// Defaults to a client with DEFAULT_TIMEOUT.
+	HTTPClient *http.Client
+}
+
+// Error response returned by the server.
+type Error struct {
+	StatusCode int
+	Reason     string
+}
+
+// Response body of the server, mirrors the API response.
+type response struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// Create a new client for the server at the given url.
+// The token is optional, if set it will be send as bearer token with every request.
+func NewClient(server, token string) (*Client, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server url '%s': %w", server, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid server url '%s': scheme needs to be http or https", server)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid server url '%s': missing host", server)
+	}
+
+	return &Client{
+		server: strings.TrimSuffix(u.String(), "/"),
+		token:  token,
+		HTTPClient: &http.Client{
+			Timeout: DEFAULT_TIMEOUT,
+		},
+	}, nil
+}
+
+func (e *Error) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("server responded with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("server responded with status %d: %s", e.StatusCode, e.Reason)
+}
+
+// Export all hosts in the given format.
+func (c *Client) ExportHosts(ctx context.Context, f string) ([]byte, error) {
+	query := url.Values{}
+	query.Set("format", f)
+
+	res, err := c.do(ctx, http.MethodGet, "/hosts/export", query, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, parseError(res)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return data, nil
+}
+
+// Import the given hosts file in the given format.
+// Validation errors are returned as part of the result.
+func (c *Client) ImportHosts(ctx context.Context, data []byte, f string, mode types.ImportMode, dryRun bool) (types.ImportResult, error) {
+	query := url.Values{}
+	query.Set("format", f)
+	query.Set("mode", string(mode))
+	query.Set("dry-run", strconv.FormatBool(dryRun))
+
+	res, err := c.do(ctx, http.MethodPost, "/hosts/import", query, bytes.NewReader(data), format.ContentType(f))
+	if err != nil {
+		return types.ImportResult{}, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return types.ImportResult{}, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var result types.ImportResult
+	if res.StatusCode == http.StatusOK || res.StatusCode == http.StatusBadRequest {
+		err = json.Unmarshal(body, &result)
+		if err == nil && (res.StatusCode == http.StatusOK || len(result.Errors) > 0) {
+			return result, nil
+		}
+	}
+	return types.ImportResult{}, errorFromBody(res.StatusCode, body)
+}
+
+// Return all known hosts.
+func (c *Client) GetHosts(ctx context.Context) ([]types.Host, error) {
+	res, err := c.do(ctx, http.MethodGet, "/hosts", nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, parseError(res)
+	}
+
+	var hosts []types.Host
+	err = json.NewDecoder(res.Body).Decode(&hosts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return hosts, nil
+}
+
+// Add a new host or overwrite the name and address of an existing one.
+func (c *Client) AddHost(ctx context.Context, host types.Host) error {
+	body, err := json.Marshal(host)
+	if err != nil {
+		return fmt.Errorf("failed to encode host: %w", err)
+	}
+
+	res, err := c.do(ctx, http.MethodPut, "/hosts", nil, bytes.NewReader(body), "application/json")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return parseError(res)
+	}
+	return nil
+}
+
+// Remove the host with the given MAC address.
+func (c *Client) RemoveHost(ctx context.Context, mac string) error {
+	res, err := c.do(ctx, http.MethodDelete, "/hosts/"+url.PathEscape(mac), nil, nil, "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return parseError(res)
+	}
+	return nil
+}
+
+// Return the status of all hosts with an address.
+func (c *Client) HostStatus(ctx context.Context) ([]types.HostStatus, error) {
+	res, err := c.do(ctx, http.MethodGet, "/hosts/status", nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, parseError(res)
+	}
+
+	var status []types.HostStatus
+	err = json.NewDecoder(res.Body).Decode(&status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return status, nil
+}
+
+// Ask the server to wake the host with the given MAC address.
+// Hosts on remote sites are woken through the relay configured on the server.
+func (c *Client) Wake(ctx context.Context, mac string) error {
+	res, err := c.do(ctx, http.MethodGet, "/wake/"+url.PathEscape(mac), nil, nil, "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return parseError(res)
+	}
+	return nil
+}
+
+// Return the hosts proposed from the lease sources configured on the server.
+func (c *Client) Leases(ctx context.Context) ([]leases.Proposal, error) {
+	res, err := c.do(ctx, http.MethodGet, "/hosts/leases", nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, parseError(res)
+	}
+
+	var proposals []leases.Proposal
+	err = json.NewDecoder(res.Body).Decode(&proposals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return proposals, nil
+}
+
+// Send a request to the given path of the API.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	u := c.server + apiPath + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to server: %w", err)
+	}
+	return res, nil
+}
+
+// Read the error from the response body.
+func parseError(res *http.Response) error {
+	body, _ := io.ReadAll(res.Body)
+	return errorFromBody(res.StatusCode, body)
+}
+
+func errorFromBody(statusCode int, body []byte) error {
+	var r response
+	_ = json.Unmarshal(body, &r)
+	return &Error{
+		StatusCode: statusCode,
+		Reason:     r.Reason,
+	}
+}
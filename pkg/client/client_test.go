@@ -0,0 +1,291 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/heathcliff26/go-wol/pkg/client"
+	"github.com/heathcliff26/go-wol/pkg/leases"
+	api "github.com/heathcliff26/go-wol/pkg/server/api/v1"
+	"github.com/heathcliff26/go-wol/pkg/server/storage"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/file"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/format"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testHosts = []types.Host{
+	{MAC: "00:00:00:00:00:11", Name: "Host1"},
+	{MAC: "00:00:00:00:00:22", Name: "Host2", Address: "192.0.2.2"},
+}
+
+// Start a go-wol API server backed by a new file storage containing testHosts
+func newTestServer(t *testing.T, readonly bool, leaseSources []leases.Source) (*client.Client, *storage.Storage) {
+	t.Helper()
+
+	cfg := storage.StorageConfig{
+		Type: "file",
+		File: file.FileBackendConfig{
+			Path: t.TempDir() + "/hosts.yaml",
+		},
+	}
+	s, err := storage.NewStorage(cfg)
+	require.NoError(t, err, "Should create storage")
+	for _, host := range testHosts {
+		require.NoError(t, s.AddHost(t.Context(), host), "Should add host")
+	}
+	if readonly {
+		cfg.Readonly = true
+		s, err = storage.NewStorage(cfg)
+		require.NoError(t, err, "Should create readonly storage")
+	}
+
+	router := http.NewServeMux()
+	router.Handle("/api/v1/", http.StripPrefix("/api/v1", api.NewRouter(s, api.Options{Leases: leaseSources})))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	c, err := client.NewClient(server.URL+"/", "")
+	require.NoError(t, err, "Should create client")
+	return c, s
+}
+
+func TestNewClient(t *testing.T) {
+	tMatrix := []struct {
+		Name, Server string
+		Valid        bool
+	}{
+		{"HTTP", "http://localhost:8080", true},
+		{"HTTPS", "https://wol.example.org/", true},
+		{"MissingScheme", "wol.example.org", false},
+		{"InvalidScheme", "ftp://wol.example.org", false},
+		{"MissingHost", "https://", false},
+		{"InvalidURL", "http://[::1", false},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			c, err := client.NewClient(tCase.Server, "token")
+			if tCase.Valid {
+				assert.NoError(t, err, "Should create client")
+				assert.NotNil(t, c, "Should return client")
+			} else {
+				assert.Error(t, err, "Should not create client")
+				assert.Nil(t, c, "Should not return client")
+			}
+		})
+	}
+}
+
+func TestToken(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		authorization = req.Header.Get("Authorization")
+		res.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+
+	c, err := client.NewClient(server.URL, "secret")
+	require.NoError(t, err, "Should create client")
+
+	_, err = c.ExportHosts(t.Context(), format.FormatYAML)
+	assert.Equal(t, "Bearer secret", authorization, "Should send token")
+
+	var clientErr *client.Error
+	require.ErrorAs(t, err, &clientErr, "Should return server error")
+	assert.Equal(t, http.StatusUnauthorized, clientErr.StatusCode, "Should return status code")
+}
+
+func TestHTTPClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+		res.WriteHeader(http.StatusOK)
+		_, _ = res.Write([]byte("[]"))
+	}))
+	t.Cleanup(server.Close)
+
+	c, err := client.NewClient(server.URL, "")
+	require.NoError(t, err, "Should create client")
+
+	_, err = c.GetHosts(t.Context())
+	assert.Error(t, err, "Should not trust the server with the default client")
+
+	c.HTTPClient = server.Client()
+	hosts, err := c.GetHosts(t.Context())
+	assert.NoError(t, err, "Should use the given http client")
+	assert.Empty(t, hosts, "Should return hosts")
+}
+
+func TestCanceledContext(t *testing.T) {
+	c, _ := newTestServer(t, false, nil)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, err := c.GetHosts(ctx)
+	assert.ErrorIs(t, err, context.Canceled, "Should stop the request")
+}
+
+func TestExportHosts(t *testing.T) {
+	c, _ := newTestServer(t, false, nil)
+
+	for _, f := range format.Formats {
+		t.Run(f, func(t *testing.T) {
+			data, err := c.ExportHosts(t.Context(), f)
+			require.NoError(t, err, "Should export hosts")
+
+			hosts, err := format.Decode(bytes.NewReader(data), f)
+			require.NoError(t, err, "Should decode exported hosts")
+			assert.Equal(t, testHosts, hosts, "Should export all hosts")
+		})
+	}
+
+	t.Run("UnknownFormat", func(t *testing.T) {
+		data, err := c.ExportHosts(t.Context(), "xml")
+		assert.Nil(t, data, "Should not return data")
+		assert.ErrorContains(t, err, "Unknown format", "Should return reason")
+	})
+}
+
+func TestImportHosts(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		c, s := newTestServer(t, false, nil)
+
+		result, err := c.ImportHosts(t.Context(), []byte("mac,name\n00:00:00:00:00:33,Host3\n"), format.FormatCSV, types.ImportModeReplace, false)
+		require.NoError(err, "Should import hosts")
+		assert.Equal([]string{"00:00:00:00:00:33"}, result.Added, "Should add host")
+		assert.Equal([]string{"00:00:00:00:00:11", "00:00:00:00:00:22"}, result.Removed, "Should remove hosts")
+
+		hosts, err := s.GetHosts(t.Context())
+		require.NoError(err, "Should get hosts")
+		assert.Equal([]types.Host{{MAC: "00:00:00:00:00:33", Name: "Host3"}}, hosts, "Should have replaced hosts")
+	})
+
+	t.Run("ValidationErrors", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		c, _ := newTestServer(t, false, nil)
+
+		result, err := c.ImportHosts(t.Context(), []byte(`[{"mac": "not-a-mac", "name": "Host3"}]`), format.FormatJSON, types.ImportModeMerge, false)
+		require.NoError(err, "Validation errors should be returned in the result")
+		require.Len(result.Errors, 1, "Should return validation error")
+		assert.Equal(1, result.Errors[0].Row, "Should return row of invalid host")
+	})
+
+	t.Run("Readonly", func(t *testing.T) {
+		c, _ := newTestServer(t, true, nil)
+
+		_, err := c.ImportHosts(t.Context(), []byte("hosts: []"), format.FormatYAML, types.ImportModeMerge, false)
+		assert.ErrorContains(t, err, "Storage is readonly", "Should return reason")
+	})
+
+	t.Run("InvalidBody", func(t *testing.T) {
+		c, _ := newTestServer(t, false, nil)
+
+		_, err := c.ImportHosts(t.Context(), []byte("not json"), format.FormatJSON, types.ImportModeMerge, false)
+		assert.ErrorContains(t, err, "Failed to parse hosts", "Should return reason")
+	})
+}
+
+func TestGetHosts(t *testing.T) {
+	c, _ := newTestServer(t, false, nil)
+
+	hosts, err := c.GetHosts(t.Context())
+	require.NoError(t, err, "Should get hosts")
+	assert.Equal(t, testHosts, hosts, "Should return all hosts")
+}
+
+func TestAddHost(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		c, s := newTestServer(t, false, nil)
+
+		host := types.Host{MAC: "00:00:00:00:00:33", Name: "Host3"}
+		require.NoError(t, c.AddHost(t.Context(), host), "Should add host")
+
+		hosts, err := s.GetHosts(t.Context())
+		require.NoError(t, err, "Should get hosts")
+		assert.Contains(t, hosts, host, "Should have added host")
+	})
+	t.Run("InvalidHost", func(t *testing.T) {
+		c, _ := newTestServer(t, false, nil)
+
+		var clientErr *client.Error
+		require.ErrorAs(t, c.AddHost(t.Context(), types.Host{MAC: "not-a-mac", Name: "Host3"}), &clientErr, "Should fail")
+		assert.Equal(t, http.StatusBadRequest, clientErr.StatusCode, "Should return status code")
+	})
+}
+
+func TestLeases(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		c, _ := newTestServer(t, false, []leases.Source{{Path: "testdata/dnsmasq.leases"}})
+
+		proposals, err := c.Leases(t.Context())
+		require.NoError(t, err, "Should get leases")
+		assert.Equal(t, []leases.Proposal{
+			{Host: types.Host{MAC: "00:00:00:00:00:11", Name: "Host1", Address: "192.0.2.1"}, Known: true},
+			{Host: types.Host{MAC: "00:00:00:00:00:33", Name: "Host3", Address: "192.0.2.3"}},
+		}, proposals, "Should return proposals")
+	})
+	t.Run("Error", func(t *testing.T) {
+		c, _ := newTestServer(t, false, []leases.Source{{Path: "testdata/not-a-file", Format: leases.FormatARP}})
+
+		proposals, err := c.Leases(t.Context())
+		assert.Nil(t, proposals, "Should not return proposals")
+		assert.ErrorContains(t, err, "Failed to read leases", "Should return reason")
+	})
+}
+
+func TestRemoveHost(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		c, s := newTestServer(t, false, nil)
+
+		require.NoError(t, c.RemoveHost(t.Context(), "00:00:00:00:00:11"), "Should remove host")
+
+		hosts, err := s.GetHosts(t.Context())
+		require.NoError(t, err, "Should get hosts")
+		assert.Equal(t, testHosts[1:], hosts, "Should have removed host")
+	})
+	t.Run("Readonly", func(t *testing.T) {
+		c, _ := newTestServer(t, true, nil)
+
+		assert.ErrorContains(t, c.RemoveHost(t.Context(), "00:00:00:00:00:11"), "Storage is readonly", "Should return reason")
+	})
+}
+
+func TestHostStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v1/hosts/status" {
+			res.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = res.Write([]byte(`[{"mac":"00:00:00:00:00:22","address":"192.0.2.2","online":true}]`))
+	}))
+	t.Cleanup(server.Close)
+
+	c, err := client.NewClient(server.URL, "")
+	require.NoError(t, err, "Should create client")
+
+	status, err := c.HostStatus(t.Context())
+	require.NoError(t, err, "Should get status")
+	assert.Equal(t, []types.HostStatus{{MAC: "00:00:00:00:00:22", Address: "192.0.2.2", Online: true}}, status, "Should return status")
+}
+
+func TestWake(t *testing.T) {
+	c, s := newTestServer(t, false, nil)
+	require.NoError(t, s.AddHost(t.Context(), types.Host{MAC: "00:00:00:00:00:33", Name: "Host3", Site: "building-b"}), "Should add host")
+
+	assert.NoError(t, c.Wake(t.Context(), "ff:ff:ff:ff:ff:ff"), "Should wake host")
+
+	var clientErr *client.Error
+	require.ErrorAs(t, c.Wake(t.Context(), "not-a-mac"), &clientErr, "Should fail for invalid MAC")
+	assert.Equal(t, http.StatusBadRequest, clientErr.StatusCode, "Should return status code")
+
+	assert.ErrorContains(t, c.Wake(t.Context(), "00:00:00:00:00:33"), "No relay agent available for site 'building-b'", "Should return the reason of the server")
+}
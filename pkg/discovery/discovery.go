@@ -0,0 +1,354 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/leases"
+	probing "github.com/prometheus-community/pro-bing"
+)
+
+const (
+	DEFAULT_CACHE_TTL      = 5 * time.Minute
+	DEFAULT_MIN_INTERVAL   = time.Minute
+	DEFAULT_NEIGHBOR_TABLE = "/proc/net/arp"
+
+	// Maximum number of addresses in a single network
+	MAX_NETWORK_SIZE = 4096
+)
+
+const (
+	pingTimeout     = 200 * time.Millisecond
+	pingConcurrency = 64
+	lookupTimeout   = 2 * time.Second
+)
+
+// Returned when a new scan is requested before the minimum interval has passed.
+var ErrRateLimited = errors.New("scan is rate limited")
+
+type Config struct {
+	// Enable network discovery
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Networks in CIDR notation to scan
+	Networks []string `yaml:"networks,omitempty"`
+	// How long the result of a scan is cached
+	CacheTTL time.Duration `yaml:"cache-ttl,omitempty"`
+	// Minimum time between two scans
+	MinInterval time.Duration `yaml:"min-interval,omitempty"`
+	// Neighbor table to read after the ping sweep, defaults to /proc/net/arp
+	Neighbors leases.Source `yaml:"neighbors,omitempty"`
+}
+
+// Source for the MAC addresses of the hosts on the network
+type NeighborSource interface {
+	Neighbors() ([]leases.Lease, error)
+}
+
+// Host found on the network
+type Candidate struct {
+	MAC      string `json:"mac"`
+	Address  string `json:"address"`
+	Hostname string `json:"hostname,omitempty"`
+	// Proposed name for the host, the hostname, the address or a name based on the MAC
+	Name string `json:"name"`
+}
+
+// Result of a scan
+type Result struct {
+	Time  time.Time   `json:"time"`
+	Hosts []Candidate `json:"hosts"`
+}
+
+// Scans the configured networks for hosts.
+// Results are cached and new scans are rate limited.
+type Scanner struct {
+	networks    []*net.IPNet
+	neighbors   NeighborSource
+	ttl         time.Duration
+	minInterval time.Duration
+
+	ping       func(addresses []string)
+	lookupAddr func(ctx context.Context, addr string) ([]string, error)
+	now        func() time.Time
+
+	lock     sync.Mutex
+	lastScan time.Time
+	result   Result
+	// Error of the last scan, returned instead of the result until the minimum interval has passed
+	lastErr error
+	// The scan currently running, callers requesting a scan in the meantime wait for its result
+	running *scan
+}
+
+// A single run of the scanner, done is closed once result and err are set
+type scan struct {
+	done   chan struct{}
+	result Result
+	err    error
+}
+
+// Neighbor tables and lease files read from disk
+type sourceNeighbors []leases.Source
+
+// Create a new scanner from the config.
+// If neighbors is nil, the neighbor table from the config is used.
+func NewScanner(cfg Config, neighbors NeighborSource) (*Scanner, error) {
+	if len(cfg.Networks) == 0 {
+		return nil, fmt.Errorf("no networks to scan configured")
+	}
+
+	networks := make([]*net.IPNet, 0, len(cfg.Networks))
+	for _, cidr := range cfg.Networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network '%s': %w", cidr, err)
+		}
+		if tooLarge(network) {
+			return nil, fmt.Errorf("network '%s' is too large, it may contain at most %d addresses", cidr, MAX_NETWORK_SIZE)
+		}
+		networks = append(networks, network)
+	}
+
+	if neighbors == nil {
+		source := cfg.Neighbors
+		if source.Path == "" {
+			source.Path = DEFAULT_NEIGHBOR_TABLE
+		}
+		if source.Format == "" {
+			source.Format = leases.DetectFormat(source.Path)
+		}
+		if !leases.Valid(source.Format) {
+			return nil, fmt.Errorf("unknown format '%s' for neighbor table '%s'", source.Format, source.Path)
+		}
+		neighbors = sourceNeighbors{source}
+	}
+
+	ttl := cfg.CacheTTL
+	if ttl <= 0 {
+		ttl = DEFAULT_CACHE_TTL
+	}
+	minInterval := cfg.MinInterval
+	if minInterval <= 0 {
+		minInterval = DEFAULT_MIN_INTERVAL
+	}
+
+	return &Scanner{
+		networks:    networks,
+		neighbors:   neighbors,
+		ttl:         ttl,
+		minInterval: minInterval,
+		ping:        pingSweep,
+		lookupAddr:  net.DefaultResolver.LookupAddr,
+		now:         time.Now,
+	}, nil
+}
+
+func (s sourceNeighbors) Neighbors() ([]leases.Lease, error) {
+	return leases.ReadSources(s)
+}
+
+// Return the hosts found on the network.
+// Returns the cached result unless it is expired or refresh is set.
+// Returns ErrRateLimited when a refresh is requested before the minimum interval has passed.
+// A failed scan is not cached, but its error is returned until the minimum interval has passed.
+// While a scan is running, all callers wait for its result instead of starting another one.
+// Canceling ctx only stops waiting, the scan continues for the other callers.
+func (s *Scanner) Scan(ctx context.Context, refresh bool) (Result, error) {
+	s.lock.Lock()
+	current := s.running
+	if current == nil {
+		if !s.lastScan.IsZero() {
+			age := s.now().Sub(s.lastScan)
+			if age < s.minInterval {
+				s.lock.Unlock()
+				if refresh {
+					return Result{}, ErrRateLimited
+				}
+				if s.lastErr != nil {
+					return Result{}, s.lastErr
+				}
+				return s.result, nil
+			}
+			if !refresh && age < s.ttl && s.lastErr == nil {
+				s.lock.Unlock()
+				return s.result, nil
+			}
+		}
+
+		current = &scan{done: make(chan struct{})}
+		s.running = current
+		go s.run(current, s.now())
+	}
+	s.lock.Unlock()
+
+	select {
+	case <-current.done:
+		return current.result, current.err
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+}
+
+// Ping the networks and read the neighbor table, the result is cached when successful.
+func (s *Scanner) run(current *scan, started time.Time) {
+	current.result, current.err = s.scan(started)
+
+	s.lock.Lock()
+	s.lastScan = started
+	s.lastErr = current.err
+	if current.err == nil {
+		s.result = current.result
+	}
+	s.running = nil
+	s.lock.Unlock()
+
+	close(current.done)
+}
+
+func (s *Scanner) scan(started time.Time) (Result, error) {
+	slog.Debug("Scanning networks for hosts", slog.Int("networks", len(s.networks)))
+	s.ping(s.addresses())
+
+	neighbors, err := s.neighbors.Neighbors()
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read neighbor table: %w", err)
+	}
+
+	hosts := make([]Candidate, 0, len(neighbors))
+	for _, neighbor := range neighbors {
+		ip := net.ParseIP(neighbor.Address)
+		if ip == nil || !s.contains(ip) {
+			continue
+		}
+		if slices.ContainsFunc(hosts, func(c Candidate) bool { return c.MAC == neighbor.MAC }) {
+			continue
+		}
+		hosts = append(hosts, Candidate{
+			MAC:     neighbor.MAC,
+			Address: neighbor.Address,
+		})
+	}
+	s.resolveHostnames(hosts)
+
+	slices.SortFunc(hosts, func(a, b Candidate) int {
+		return bytes.Compare(net.ParseIP(a.Address).To16(), net.ParseIP(b.Address).To16())
+	})
+
+	slog.Debug("Finished network scan", slog.Int("hosts", len(hosts)))
+	return Result{
+		Time:  started,
+		Hosts: hosts,
+	}, nil
+}
+
+// Check if the ip is part of one of the networks
+func (s *Scanner) contains(ip net.IP) bool {
+	for _, network := range s.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return all host addresses of the networks.
+// Skips the network and broadcast address for IPv4 networks larger than /31.
+func (s *Scanner) addresses() []string {
+	var addresses []string
+	for _, network := range s.networks {
+		ones, bits := network.Mask.Size()
+		skipEdges := bits == 8*net.IPv4len && bits-ones > 1
+
+		ip := slices.Clone(network.IP)
+		for ; network.Contains(ip); incrementIP(ip) {
+			if skipEdges && (ip.Equal(network.IP) || isBroadcast(ip, network)) {
+				continue
+			}
+			addresses = append(addresses, ip.String())
+		}
+	}
+	return addresses
+}
+
+// Lookup the hostname for every candidate and set the proposed name
+func (s *Scanner) resolveHostnames(hosts []Candidate) {
+	var wg sync.WaitGroup
+	for i := range hosts {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+			defer cancel()
+
+			names, err := s.lookupAddr(ctx, hosts[i].Address)
+			if err == nil && len(names) > 0 {
+				hosts[i].Hostname = strings.TrimSuffix(names[0], ".")
+			}
+			hosts[i].Name = leases.Lease{
+				MAC:      hosts[i].MAC,
+				Address:  hosts[i].Address,
+				Hostname: hosts[i].Hostname,
+			}.Host().Name
+		})
+	}
+	wg.Wait()
+}
+
+// Check if the network contains more than MAX_NETWORK_SIZE addresses
+func tooLarge(network *net.IPNet) bool {
+	ones, bits := network.Mask.Size()
+	hostBits := bits - ones
+	// Avoid overflowing the shift for large IPv6 networks
+	return hostBits >= 31 || 1<<hostBits > MAX_NETWORK_SIZE
+}
+
+func incrementIP(ip net.IP) {
+	for i := len(ip) - 1; i >= 0; i-- {
+		ip[i]++
+		if ip[i] != 0 {
+			return
+		}
+	}
+}
+
+func isBroadcast(ip net.IP, network *net.IPNet) bool {
+	for i := range ip {
+		if ip[i]|network.Mask[i] != 0xff {
+			return false
+		}
+	}
+	return true
+}
+
+// Ping all addresses once, so the kernel adds them to the neighbor table.
+// The results are ignored, as only the neighbor table is of interest.
+func pingSweep(addresses []string) {
+	sem := make(chan struct{}, pingConcurrency)
+	var wg sync.WaitGroup
+	for _, address := range addresses {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+
+			pinger, err := probing.NewPinger(address)
+			if err != nil {
+				slog.Debug("Failed to create pinger", slog.String("address", address), "error", err)
+				return
+			}
+			pinger.Count = 1
+			pinger.Timeout = pingTimeout
+
+			err = pinger.Run()
+			if err != nil {
+				slog.Debug("Failed to ping address", slog.String("address", address), "error", err)
+			}
+		})
+	}
+	wg.Wait()
+}
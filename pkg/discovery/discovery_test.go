@@ -0,0 +1,269 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/leases"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeNeighbors struct {
+	leases []leases.Lease
+	err    error
+	reads  atomic.Int32
+}
+
+func (f *fakeNeighbors) Neighbors() ([]leases.Lease, error) {
+	f.reads.Add(1)
+	return f.leases, f.err
+}
+
+func (f *fakeNeighbors) Reads() int {
+	return int(f.reads.Load())
+}
+
+// Create a scanner with fake ping, reverse lookup and clock
+func newTestScanner(t *testing.T, cfg Config, neighbors NeighborSource) (*Scanner, *[]string, *time.Time) {
+	t.Helper()
+
+	s, err := NewScanner(cfg, neighbors)
+	require.NoError(t, err, "Should create scanner")
+
+	var pinged []string
+	s.ping = func(addresses []string) {
+		pinged = append(pinged, addresses...)
+	}
+	s.lookupAddr = func(_ context.Context, addr string) ([]string, error) {
+		if addr == "192.168.1.10" {
+			return []string{"desktop.example.org."}, nil
+		}
+		return nil, errors.New("not found")
+	}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	return s, &pinged, &now
+}
+
+func TestNewScanner(t *testing.T) {
+	tMatrix := []struct {
+		Name  string
+		Cfg   Config
+		Error string
+	}{
+		{
+			Name:  "NoNetworks",
+			Cfg:   Config{},
+			Error: "no networks",
+		},
+		{
+			Name:  "InvalidNetwork",
+			Cfg:   Config{Networks: []string{"192.168.1.0"}},
+			Error: "invalid network",
+		},
+		{
+			Name:  "NetworkTooLarge",
+			Cfg:   Config{Networks: []string{"10.0.0.0/16"}},
+			Error: "too large",
+		},
+		{
+			Name:  "IPv6NetworkTooLarge",
+			Cfg:   Config{Networks: []string{"fd00::/64"}},
+			Error: "too large",
+		},
+		{
+			Name: "MaxNetworkSize",
+			Cfg:  Config{Networks: []string{"10.0.0.0/20"}},
+		},
+		{
+			Name:  "UnknownNeighborFormat",
+			Cfg:   Config{Networks: []string{"192.168.1.0/24"}, Neighbors: leases.Source{Path: "/tmp/table"}},
+			Error: "unknown format",
+		},
+		{
+			Name: "Defaults",
+			Cfg:  Config{Networks: []string{"192.168.1.0/24", "fd00::/120"}},
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			s, err := NewScanner(tCase.Cfg, nil)
+			if tCase.Error != "" {
+				assert.ErrorContains(t, err, tCase.Error, "Should fail")
+				assert.Nil(t, s, "Should not return scanner")
+				return
+			}
+			require.NoError(t, err, "Should create scanner")
+			assert.Equal(t, DEFAULT_CACHE_TTL, s.ttl, "Should use default cache ttl")
+			assert.Equal(t, DEFAULT_MIN_INTERVAL, s.minInterval, "Should use default interval")
+			assert.Equal(t, sourceNeighbors{{Path: DEFAULT_NEIGHBOR_TABLE, Format: leases.FormatARP}}, s.neighbors, "Should read the kernel neighbor table")
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	neighbors := &fakeNeighbors{
+		leases: []leases.Lease{
+			{MAC: "AA:BB:CC:DD:EE:02", Address: "192.168.1.20"},
+			{MAC: "AA:BB:CC:DD:EE:01", Address: "192.168.1.10"},
+			{MAC: "AA:BB:CC:DD:EE:03", Address: "10.0.0.1"},
+			{MAC: "AA:BB:CC:DD:EE:01", Address: "192.168.1.11"},
+		},
+	}
+	s, pinged, _ := newTestScanner(t, Config{Networks: []string{"192.168.1.0/27"}}, neighbors)
+
+	result, err := s.Scan(t.Context(), false)
+	require.NoError(err, "Should scan")
+
+	require.Len(*pinged, 30, "Should ping all host addresses of the network")
+	assert.Equal("192.168.1.1", (*pinged)[0], "Should skip the network address")
+	assert.Equal("192.168.1.30", (*pinged)[29], "Should skip the broadcast address")
+	assert.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), result.Time, "Should set time of scan")
+	assert.Equal([]Candidate{
+		{MAC: "AA:BB:CC:DD:EE:01", Address: "192.168.1.10", Hostname: "desktop.example.org", Name: "desktop.example.org"},
+		{MAC: "AA:BB:CC:DD:EE:02", Address: "192.168.1.20", Name: "192.168.1.20"},
+	}, result.Hosts, "Should only return unique hosts in the network sorted by address")
+}
+
+func TestScanCache(t *testing.T) {
+	assert := assert.New(t)
+
+	neighbors := &fakeNeighbors{}
+	s, _, now := newTestScanner(t, Config{
+		Networks:    []string{"192.168.1.0/24"},
+		CacheTTL:    5 * time.Minute,
+		MinInterval: time.Minute,
+	}, neighbors)
+
+	_, err := s.Scan(t.Context(), false)
+	assert.NoError(err, "Should scan")
+	assert.Equal(1, neighbors.Reads(), "Should scan the network")
+
+	_, err = s.Scan(t.Context(), false)
+	assert.NoError(err, "Should return cached result")
+	assert.Equal(1, neighbors.Reads(), "Should use the cache")
+
+	_, err = s.Scan(t.Context(), true)
+	assert.ErrorIs(err, ErrRateLimited, "Should rate limit refresh")
+	assert.Equal(1, neighbors.Reads(), "Should not scan again")
+
+	*now = now.Add(2 * time.Minute)
+	_, err = s.Scan(t.Context(), false)
+	assert.NoError(err, "Should return cached result")
+	assert.Equal(1, neighbors.Reads(), "Should still use the cache")
+
+	_, err = s.Scan(t.Context(), true)
+	assert.NoError(err, "Should refresh after the minimum interval")
+	assert.Equal(2, neighbors.Reads(), "Should scan again")
+
+	*now = now.Add(6 * time.Minute)
+	_, err = s.Scan(t.Context(), false)
+	assert.NoError(err, "Should scan after the cache expired")
+	assert.Equal(3, neighbors.Reads(), "Should scan again")
+}
+
+func TestScanConcurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	neighbors := &fakeNeighbors{leases: []leases.Lease{{MAC: "AA:BB:CC:DD:EE:01", Address: "192.168.1.10"}}}
+	s, _, _ := newTestScanner(t, Config{Networks: []string{"192.168.1.0/24"}}, neighbors)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s.ping = func(_ []string) {
+		close(started)
+		<-release
+	}
+
+	type scanResult struct {
+		result Result
+		err    error
+	}
+	results := make(chan scanResult, 2)
+	go func() {
+		result, err := s.Scan(t.Context(), false)
+		results <- scanResult{result, err}
+	}()
+	<-started
+
+	// Other callers join the running scan instead of starting another one
+	go func() {
+		result, err := s.Scan(t.Context(), false)
+		results <- scanResult{result, err}
+	}()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	_, err := s.Scan(ctx, false)
+	assert.ErrorIs(err, context.Canceled, "Should stop waiting when the context is canceled")
+
+	close(release)
+	first, second := <-results, <-results
+	assert.NoError(first.err, "Should scan")
+	assert.NoError(second.err, "Should join the scan")
+	assert.Equal(first.result, second.result, "Should return the same result")
+	assert.Len(first.result.Hosts, 1, "Should find the host")
+	assert.Equal(1, neighbors.Reads(), "Should only scan once")
+}
+
+func TestScanNeighborError(t *testing.T) {
+	assert := assert.New(t)
+
+	neighbors := &fakeNeighbors{err: errors.New("permission denied")}
+	s, _, now := newTestScanner(t, Config{
+		Networks:    []string{"192.168.1.0/24"},
+		CacheTTL:    5 * time.Minute,
+		MinInterval: time.Minute,
+	}, neighbors)
+
+	_, err := s.Scan(t.Context(), false)
+	assert.ErrorContains(err, "failed to read neighbor table", "Should fail")
+
+	_, err = s.Scan(t.Context(), false)
+	assert.ErrorContains(err, "failed to read neighbor table", "Should return the error until the minimum interval has passed")
+	assert.Equal(1, neighbors.Reads(), "Should not scan again")
+
+	_, err = s.Scan(t.Context(), true)
+	assert.ErrorIs(err, ErrRateLimited, "Should rate limit refresh")
+
+	neighbors.err = nil
+	*now = now.Add(2 * time.Minute)
+	_, err = s.Scan(t.Context(), false)
+	assert.NoError(err, "Should scan again after the minimum interval instead of caching the failure")
+	assert.Equal(2, neighbors.Reads(), "Should scan again")
+}
+
+func TestAddresses(t *testing.T) {
+	tMatrix := []struct {
+		Network string
+		Result  []string
+	}{
+		{"192.168.1.0/30", []string{"192.168.1.1", "192.168.1.2"}},
+		{"192.168.1.4/31", []string{"192.168.1.4", "192.168.1.5"}},
+		{"192.168.1.7/32", []string{"192.168.1.7"}},
+		{"fd00::/126", []string{"fd00::", "fd00::1", "fd00::2", "fd00::3"}},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Network, func(t *testing.T) {
+			s, err := NewScanner(Config{Networks: []string{tCase.Network}}, &fakeNeighbors{})
+			require.NoError(t, err, "Should create scanner")
+			assert.Equal(t, tCase.Result, s.addresses(), "Should return all host addresses")
+		})
+	}
+
+	t.Run("MaxSize", func(t *testing.T) {
+		s, err := NewScanner(Config{Networks: []string{"10.0.0.0/20"}}, &fakeNeighbors{})
+		require.NoError(t, err, "Should create scanner")
+		assert.Len(t, s.addresses(), MAX_NETWORK_SIZE-2, "Should return all host addresses")
+	})
+}
@@ -0,0 +1,165 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/leases"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+)
+
+const DEFAULT_REFRESH_INTERVAL = 5 * time.Minute
+
+type RefreshConfig struct {
+	// Enable the automatic refresh of host addresses
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Time between two refreshes
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Neighbor tables and lease files to match the hosts against, defaults to /proc/net/arp.
+	// Later sources take precedence over earlier ones.
+	Sources []leases.Source `yaml:"sources,omitempty"`
+}
+
+// Storage the hosts are read from and updated in
+type HostStorage interface {
+	GetHosts(ctx context.Context) ([]types.Host, error)
+	// Returns an empty host if it does not exist
+	GetHost(ctx context.Context, mac string) (types.Host, error)
+	AddHost(ctx context.Context, host types.Host) error
+}
+
+// Periodically matches the MAC addresses of the stored hosts against the neighbor table
+// and updates their address when it changed.
+// Only addresses that are empty or an IP are updated, hostnames are kept as they are.
+type Refresher struct {
+	storage   HostStorage
+	neighbors NeighborSource
+	interval  time.Duration
+}
+
+// Create a new refresher from the config.
+// If neighbors is nil, the sources from the config are used.
+func NewRefresher(cfg RefreshConfig, storage HostStorage, neighbors NeighborSource) (*Refresher, error) {
+	if neighbors == nil {
+		sources := slices.Clone(cfg.Sources)
+		if len(sources) == 0 {
+			sources = []leases.Source{{Path: DEFAULT_NEIGHBOR_TABLE}}
+		}
+		for i, source := range sources {
+			if source.Format == "" {
+				sources[i].Format = leases.DetectFormat(source.Path)
+			}
+			if !leases.Valid(sources[i].Format) {
+				return nil, fmt.Errorf("unknown format '%s' for source '%s'", sources[i].Format, source.Path)
+			}
+		}
+		neighbors = sourceNeighbors(sources)
+	}
+
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = DEFAULT_REFRESH_INTERVAL
+	}
+
+	return &Refresher{
+		storage:   storage,
+		neighbors: neighbors,
+		interval:  interval,
+	}, nil
+}
+
+// Refresh the addresses until the context is cancelled
+func (r *Refresher) Run(ctx context.Context) {
+	slog.Info("Starting automatic refresh of host addresses", slog.String("interval", r.interval.String()))
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := r.Refresh(ctx)
+		if err != nil {
+			slog.Error("Failed to refresh host addresses", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Update the address of all hosts found in the neighbor table.
+// Returns the updated hosts.
+func (r *Refresher) Refresh(ctx context.Context) ([]types.Host, error) {
+	neighbors, err := r.neighbors.Neighbors()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read neighbor table: %w", err)
+	}
+	addresses := make(map[string][]net.IP, len(neighbors))
+	for _, neighbor := range neighbors {
+		ip := net.ParseIP(neighbor.Address)
+		if ip == nil || ip.IsLinkLocalUnicast() {
+			continue
+		}
+		addresses[neighbor.MAC] = append(addresses[neighbor.MAC], ip)
+	}
+
+	hosts, err := r.storage.GetHosts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hosts: %w", err)
+	}
+
+	var updated []types.Host
+	for _, host := range hosts {
+		var current net.IP
+		if host.Address != "" {
+			current = net.ParseIP(host.Address)
+			if current == nil {
+				continue
+			}
+		}
+
+		ip := selectAddress(current, addresses[host.MAC])
+		if ip == nil || ip.Equal(current) {
+			continue
+		}
+
+		// Re-read the host right before writing, so changes made since the snapshot are not overwritten
+		fresh, err := r.storage.GetHost(ctx, host.MAC)
+		if err != nil {
+			return updated, fmt.Errorf("failed to get host '%s': %w", host.MAC, err)
+		}
+		if fresh.MAC == "" || fresh.Address != host.Address {
+			slog.Debug("Host changed during refresh, skipping it", slog.String("mac", host.MAC))
+			continue
+		}
+
+		fresh.Address = ip.String()
+		err = r.storage.AddHost(ctx, fresh)
+		if err != nil {
+			return updated, fmt.Errorf("failed to update address of host '%s': %w", host.MAC, err)
+		}
+		slog.Info("Updated address of host", slog.String("mac", fresh.MAC), slog.String("name", fresh.Name), slog.String("old", host.Address), slog.String("new", fresh.Address))
+		updated = append(updated, fresh)
+	}
+	return updated, nil
+}
+
+// Return the last address of the same IP family as the current one.
+// Prefers IPv4 if there is no current address.
+func selectAddress(current net.IP, addresses []net.IP) net.IP {
+	ipv4 := current == nil || current.To4() != nil
+
+	var result net.IP
+	for _, ip := range addresses {
+		if (ip.To4() != nil) == ipv4 {
+			result = ip
+		}
+	}
+	return result
+}
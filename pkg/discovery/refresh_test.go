@@ -0,0 +1,212 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/leases"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStorage struct {
+	hosts []types.Host
+	err   error
+	// Called by GetHost, to simulate changes made during a refresh
+	onGetHost func(f *fakeStorage)
+}
+
+func (f *fakeStorage) GetHosts(_ context.Context) ([]types.Host, error) {
+	return append([]types.Host(nil), f.hosts...), nil
+}
+
+func (f *fakeStorage) GetHost(_ context.Context, mac string) (types.Host, error) {
+	if f.onGetHost != nil {
+		f.onGetHost(f)
+	}
+	for _, host := range f.hosts {
+		if host.MAC == mac {
+			return host, nil
+		}
+	}
+	return types.Host{}, nil
+}
+
+func (f *fakeStorage) AddHost(_ context.Context, host types.Host) error {
+	if f.err != nil {
+		return f.err
+	}
+	for i := range f.hosts {
+		if f.hosts[i].MAC == host.MAC {
+			f.hosts[i] = host
+			return nil
+		}
+	}
+	f.hosts = append(f.hosts, host)
+	return nil
+}
+
+func TestNewRefresher(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		r, err := NewRefresher(RefreshConfig{}, &fakeStorage{}, nil)
+		require.NoError(t, err, "Should create refresher")
+		assert.Equal(t, DEFAULT_REFRESH_INTERVAL, r.interval, "Should use default interval")
+		assert.Equal(t, sourceNeighbors{{Path: DEFAULT_NEIGHBOR_TABLE, Format: leases.FormatARP}}, r.neighbors, "Should read the kernel neighbor table")
+	})
+	t.Run("Sources", func(t *testing.T) {
+		cfg := RefreshConfig{
+			Interval: time.Minute,
+			Sources:  []leases.Source{{Path: "/var/lib/misc/dnsmasq.leases"}, {Path: "/proc/net/arp"}},
+		}
+		r, err := NewRefresher(cfg, &fakeStorage{}, nil)
+		require.NoError(t, err, "Should create refresher")
+		assert.Equal(t, time.Minute, r.interval, "Should use interval from config")
+		assert.Equal(t, sourceNeighbors{{Path: "/var/lib/misc/dnsmasq.leases", Format: leases.FormatDnsmasq}, {Path: "/proc/net/arp", Format: leases.FormatARP}}, r.neighbors, "Should detect formats")
+		assert.Empty(t, cfg.Sources[0].Format, "Should not modify the config")
+	})
+	t.Run("UnknownFormat", func(t *testing.T) {
+		r, err := NewRefresher(RefreshConfig{Sources: []leases.Source{{Path: "/tmp/table"}}}, &fakeStorage{}, nil)
+		assert.ErrorContains(t, err, "unknown format", "Should fail")
+		assert.Nil(t, r, "Should not return refresher")
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	storage := &fakeStorage{
+		hosts: []types.Host{
+			{MAC: "AA:BB:CC:DD:EE:01", Name: "changed", Address: "192.168.1.10"},
+			{MAC: "AA:BB:CC:DD:EE:02", Name: "unchanged", Address: "192.168.1.20"},
+			{MAC: "AA:BB:CC:DD:EE:03", Name: "hostname", Address: "host.example.org"},
+			{MAC: "AA:BB:CC:DD:EE:04", Name: "empty"},
+			{MAC: "AA:BB:CC:DD:EE:05", Name: "ipv6", Address: "fd00::5"},
+			{MAC: "AA:BB:CC:DD:EE:06", Name: "missing", Address: "192.168.1.60"},
+		},
+	}
+	neighbors := &fakeNeighbors{
+		leases: []leases.Lease{
+			{MAC: "AA:BB:CC:DD:EE:01", Address: "192.168.1.9"},
+			{MAC: "AA:BB:CC:DD:EE:01", Address: "192.168.1.11"},
+			{MAC: "AA:BB:CC:DD:EE:02", Address: "192.168.1.20"},
+			{MAC: "AA:BB:CC:DD:EE:03", Address: "192.168.1.30"},
+			{MAC: "AA:BB:CC:DD:EE:04", Address: "fe80::4"},
+			{MAC: "AA:BB:CC:DD:EE:04", Address: "192.168.1.40"},
+			{MAC: "AA:BB:CC:DD:EE:04", Address: "fd00::4"},
+			{MAC: "AA:BB:CC:DD:EE:05", Address: "192.168.1.50"},
+			{MAC: "AA:BB:CC:DD:EE:05", Address: "fd00::55"},
+		},
+	}
+
+	r, err := NewRefresher(RefreshConfig{}, storage, neighbors)
+	require.NoError(err, "Should create refresher")
+
+	updated, err := r.Refresh(t.Context())
+	require.NoError(err, "Should refresh addresses")
+
+	expected := []types.Host{
+		{MAC: "AA:BB:CC:DD:EE:01", Name: "changed", Address: "192.168.1.11"},
+		{MAC: "AA:BB:CC:DD:EE:04", Name: "empty", Address: "192.168.1.40"},
+		{MAC: "AA:BB:CC:DD:EE:05", Name: "ipv6", Address: "fd00::55"},
+	}
+	assert.Equal(expected, updated, "Should return updated hosts")
+	assert.Equal([]types.Host{
+		expected[0],
+		{MAC: "AA:BB:CC:DD:EE:02", Name: "unchanged", Address: "192.168.1.20"},
+		{MAC: "AA:BB:CC:DD:EE:03", Name: "hostname", Address: "host.example.org"},
+		expected[1],
+		expected[2],
+		{MAC: "AA:BB:CC:DD:EE:06", Name: "missing", Address: "192.168.1.60"},
+	}, storage.hosts, "Should update the storage")
+
+	updated, err = r.Refresh(t.Context())
+	require.NoError(err, "Should refresh addresses")
+	assert.Empty(updated, "Should not update hosts again")
+}
+
+func TestRefreshConcurrentChanges(t *testing.T) {
+	neighbors := &fakeNeighbors{leases: []leases.Lease{
+		{MAC: "AA:BB:CC:DD:EE:01", Address: "192.168.1.11"},
+		{MAC: "AA:BB:CC:DD:EE:02", Address: "192.168.1.21"},
+		{MAC: "AA:BB:CC:DD:EE:03", Address: "192.168.1.31"},
+	}}
+	storage := &fakeStorage{
+		hosts: []types.Host{
+			{MAC: "AA:BB:CC:DD:EE:01", Name: "renamed", Address: "192.168.1.10"},
+			{MAC: "AA:BB:CC:DD:EE:02", Name: "moved", Address: "192.168.1.20"},
+			{MAC: "AA:BB:CC:DD:EE:03", Name: "removed", Address: "192.168.1.30"},
+		},
+	}
+	// Edit the hosts after the snapshot has been taken
+	storage.onGetHost = func(f *fakeStorage) {
+		f.onGetHost = nil
+		f.hosts = []types.Host{
+			{MAC: "AA:BB:CC:DD:EE:01", Name: "new-name", Address: "192.168.1.10", Tags: []string{"edited"}},
+			{MAC: "AA:BB:CC:DD:EE:02", Name: "moved", Address: "192.168.1.99"},
+		}
+	}
+
+	r, err := NewRefresher(RefreshConfig{}, storage, neighbors)
+	require.NoError(t, err, "Should create refresher")
+
+	updated, err := r.Refresh(t.Context())
+	require.NoError(t, err, "Should refresh addresses")
+
+	expected := types.Host{MAC: "AA:BB:CC:DD:EE:01", Name: "new-name", Address: "192.168.1.11", Tags: []string{"edited"}}
+	assert.Equal(t, []types.Host{expected}, updated, "Should only update the host with an unchanged address")
+	assert.Equal(t, []types.Host{
+		expected,
+		{MAC: "AA:BB:CC:DD:EE:02", Name: "moved", Address: "192.168.1.99"},
+	}, storage.hosts, "Should keep the changes and not re-add removed hosts")
+}
+
+func TestRefreshErrors(t *testing.T) {
+	t.Run("Neighbors", func(t *testing.T) {
+		r, err := NewRefresher(RefreshConfig{}, &fakeStorage{}, &fakeNeighbors{err: errors.New("permission denied")})
+		require.NoError(t, err, "Should create refresher")
+
+		_, err = r.Refresh(t.Context())
+		assert.ErrorContains(t, err, "failed to read neighbor table", "Should fail")
+	})
+	t.Run("Storage", func(t *testing.T) {
+		storage := &fakeStorage{
+			hosts: []types.Host{{MAC: "AA:BB:CC:DD:EE:01", Name: "host", Address: "192.168.1.10"}},
+			err:   errors.New("storage is readonly"),
+		}
+		neighbors := &fakeNeighbors{leases: []leases.Lease{{MAC: "AA:BB:CC:DD:EE:01", Address: "192.168.1.11"}}}
+
+		r, err := NewRefresher(RefreshConfig{}, storage, neighbors)
+		require.NoError(t, err, "Should create refresher")
+
+		_, err = r.Refresh(t.Context())
+		assert.ErrorContains(t, err, "failed to update address of host", "Should fail")
+	})
+}
+
+func TestRefresherRun(t *testing.T) {
+	neighbors := &fakeNeighbors{}
+	r, err := NewRefresher(RefreshConfig{Interval: 10 * time.Millisecond}, &fakeStorage{}, neighbors)
+	require.NoError(t, err, "Should create refresher")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return neighbors.Reads() >= 2
+	}, time.Second, 5*time.Millisecond, "Should refresh periodically")
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Should stop when the context is cancelled")
+	}
+}
@@ -0,0 +1,94 @@
+package hosts
+
+import (
+	"fmt"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/heathcliff26/go-wol/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+const (
+	flagNameAddress     = "address"
+	flagNameDisplayName = "display-name"
+	flagNameDescription = "description"
+	flagNameIcon        = "icon"
+	flagNameSite        = "site"
+	flagNameLabel       = "label"
+)
+
+func newAddCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add <mac> <name>",
+		Short: "Add a new host or overwrite an existing one",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := runAdd(cmd, args[0], args[1])
+			if err != nil {
+				exitError(cmd, err)
+			}
+		},
+	}
+
+	cmd.Flags().String(flagNameAddress, "", "IP address or hostname used to check if the host is online")
+	cmd.Flags().String(flagNameDisplayName, "", "Name shown instead of the hostname")
+	cmd.Flags().String(flagNameDescription, "", "Description of the host")
+	cmd.Flags().StringSlice(flagNameTag, nil, "Tags of the host")
+	cmd.Flags().String(flagNameIcon, "", "Icon of the host")
+	cmd.Flags().String(flagNameLocation, "", "Location of the host")
+	cmd.Flags().String(flagNameSite, "", "Site of the host, wakes are forwarded to the relay of the site")
+	cmd.Flags().StringToString(flagNameLabel, nil, "Labels of the host as key=value")
+
+	return cmd
+}
+
+func runAdd(cmd *cobra.Command, mac, name string) error {
+	host := types.Host{MAC: mac, Name: name}
+	for flag, value := range map[string]*string{
+		flagNameAddress:     &host.Address,
+		flagNameDisplayName: &host.DisplayName,
+		flagNameDescription: &host.Description,
+		flagNameIcon:        &host.Icon,
+		flagNameLocation:    &host.Location,
+		flagNameSite:        &host.Site,
+	} {
+		var err error
+		*value, err = cmd.Flags().GetString(flag)
+		if err != nil {
+			return fmt.Errorf("failed to get %s flag: %w", flag, err)
+		}
+	}
+	var err error
+	host.Tags, err = cmd.Flags().GetStringSlice(flagNameTag)
+	if err != nil {
+		return fmt.Errorf("failed to get %s flag: %w", flagNameTag, err)
+	}
+	host.Labels, err = cmd.Flags().GetStringToString(flagNameLabel)
+	if err != nil {
+		return fmt.Errorf("failed to get %s flag: %w", flagNameLabel, err)
+	}
+	if len(host.Tags) == 0 {
+		host.Tags = nil
+	}
+	if len(host.Labels) == 0 {
+		host.Labels = nil
+	}
+
+	err = utils.ValidateHost(host)
+	if err != nil {
+		return err
+	}
+
+	t, err := newTarget(cmd)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	err = t.AddHost(cmd.Context(), host)
+	if err != nil {
+		return fmt.Errorf("failed to add host: %w", err)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Added host %s (%s)\n", host.Name, host.MAC)
+	return nil
+}
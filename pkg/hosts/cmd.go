@@ -0,0 +1,50 @@
+package hosts
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	flagNameConfig = "config"
+	flagNameEnv    = "env"
+	flagNameServer = "server"
+	flagNameToken  = "token"
+)
+
+// Create new command for managing the known hosts
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hosts",
+		Short: "Manage the known hosts, either directly in the storage or via a remote server",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.Help()
+		},
+	}
+
+	cmd.PersistentFlags().StringP(flagNameConfig, "c", "", "Config file of the server, the storage is used directly. Required unless --server is given")
+	cmd.PersistentFlags().Bool(flagNameEnv, false, "Expand enviroment variables in the config file")
+	cmd.PersistentFlags().StringP(flagNameServer, "s", "", "URL of a remote server to use instead of the local storage")
+	cmd.PersistentFlags().String(flagNameToken, "", "Bearer token for authenticating against the remote server")
+
+	cmd.AddCommand(
+		newListCommand(),
+		newAddCommand(),
+		newRemoveCommand(),
+		newStatusCommand(),
+		newWakeCommand(),
+		newExportCommand(),
+		newImportCommand(),
+		newLeasesCommand(),
+	)
+
+	return cmd
+}
+
+// Print the error information on stderr and exit with code 1
+func exitError(cmd *cobra.Command, err error) {
+	fmt.Fprintln(cmd.Root().ErrOrStderr(), "Fatal: "+err.Error())
+	os.Exit(1)
+}
@@ -0,0 +1,523 @@
+package hosts
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/heathcliff26/go-wol/pkg/server/api/v1"
+	"github.com/heathcliff26/go-wol/pkg/server/storage"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testHostsYAML = `hosts:
+  - mac: "00:00:00:00:00:11"
+    name: Host1
+  - mac: "00:00:00:00:00:22"
+    name: Host2
+    address: 192.0.2.2
+`
+
+// Create a config using a file storage in a temporary directory.
+// Returns the path of the config and the storage file.
+func newTestConfig(t *testing.T, hosts string) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	storagePath := filepath.Join(dir, "hosts.yaml")
+	configPath := filepath.Join(dir, "config.yaml")
+
+	require.NoError(t, os.WriteFile(storagePath, []byte(hosts), 0644), "Should write storage file")
+	cfg := "storage:\n  type: file\n  file:\n    path: " + storagePath + "\n"
+	require.NoError(t, os.WriteFile(configPath, []byte(cfg), 0644), "Should write config file")
+
+	return configPath, storagePath
+}
+
+// Find the subcommand for the given args and parse the flags, without executing it.
+// Sets the context of the test, as it is only set by cobra when executing.
+func parseCommand(t *testing.T, args ...string) (*cobra.Command, *bytes.Buffer) {
+	t.Helper()
+
+	root := NewCommand()
+	cmd, flags, err := root.Find(args)
+	require.NoError(t, err, "Should find command")
+	require.NoError(t, cmd.ParseFlags(flags), "Should parse flags")
+	cmd.SetContext(t.Context())
+
+	out := &bytes.Buffer{}
+	root.SetOut(out)
+	root.SetErr(out)
+	return cmd, out
+}
+
+func TestCMD(t *testing.T) {
+	tMatrix := []struct {
+		Name          string
+		Args          []string
+		ExitWithError bool
+	}{
+		{
+			Name: "Help",
+		},
+		{
+			Name: "ExportHelp",
+			Args: []string{"export", "--help"},
+		},
+		{
+			Name:          "ExportUnknownFormat",
+			Args:          []string{"export", "--format", "xml"},
+			ExitWithError: true,
+		},
+		{
+			Name:          "ImportMissingFile",
+			Args:          []string{"import", "not-a-file.yaml"},
+			ExitWithError: true,
+		},
+		{
+			Name:          "ImportTooManyArgs",
+			Args:          []string{"import", "a.yaml", "b.yaml"},
+			ExitWithError: true,
+		},
+		{
+			Name:          "ListUnknownOutput",
+			Args:          []string{"list", "--output", "xml"},
+			ExitWithError: true,
+		},
+		{
+			Name:          "AddMissingName",
+			Args:          []string{"add", "00:00:00:00:00:33"},
+			ExitWithError: true,
+		},
+		{
+			Name:          "AddInvalidMAC",
+			Args:          []string{"add", "not-a-mac", "Host3"},
+			ExitWithError: true,
+		},
+		{
+			Name:          "RemoveMissingHost",
+			Args:          []string{"remove"},
+			ExitWithError: true,
+		},
+		{
+			Name:          "StatusUnknownOutput",
+			Args:          []string{"status", "-o", "xml"},
+			ExitWithError: true,
+		},
+		{
+			Name:          "WakeMissingHost",
+			Args:          []string{"wake"},
+			ExitWithError: true,
+		},
+		{
+			Name:          "WakeUnknownServer",
+			Args:          []string{"wake", "--server", "not-a-url", "Host1"},
+			ExitWithError: true,
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			if os.Getenv("RUN_CRASH_TEST") == "1" {
+				cmd := NewCommand()
+				cmd.SetArgs(tCase.Args)
+
+				err := cmd.Execute()
+				if err != nil {
+					t.Logf("Execute failed: %v", err)
+					os.Exit(2)
+				}
+
+				os.Exit(0)
+			}
+			execExitTest(t, "TestCMD/"+tCase.Name, tCase.ExitWithError)
+		})
+	}
+}
+
+func TestTargetRequired(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	cmd, _ := parseCommand(t, "list")
+	assert.ErrorContains(t, runList(cmd), "either --config or --server is required", "Should not use the default config")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "Should not create any files")
+}
+
+func TestExport(t *testing.T) {
+	t.Run("Stdout", func(t *testing.T) {
+		configPath, _ := newTestConfig(t, testHostsYAML)
+
+		cmd, out := parseCommand(t, "export", "--config", configPath)
+		require.NoError(t, runExport(cmd), "Should export hosts")
+		assert.Equal(t, testHostsYAML, out.String(), "Should write hosts to stdout")
+	})
+
+	t.Run("OutputFile", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		configPath, _ := newTestConfig(t, testHostsYAML)
+		output := filepath.Join(t.TempDir(), "hosts.csv")
+
+		cmd, _ := parseCommand(t, "export", "-c", configPath, "-o", output)
+		require.NoError(runExport(cmd), "Should export hosts")
+
+		data, err := os.ReadFile(output)
+		require.NoError(err, "Should create output file")
+		assert.Equal("mac,name,address,display-name,description,tags,icon,location,site\n00:00:00:00:00:11,Host1,,,,,,,\n00:00:00:00:00:22,Host2,192.0.2.2,,,,,,\n", string(data), "Should use format from file extension")
+	})
+
+	t.Run("InvalidServer", func(t *testing.T) {
+		cmd, _ := parseCommand(t, "export", "--server", "not-a-url")
+		assert.Error(t, runExport(cmd), "Should fail to create client")
+	})
+}
+
+func TestImport(t *testing.T) {
+	t.Run("Merge", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		configPath, storagePath := newTestConfig(t, testHostsYAML)
+		input := filepath.Join(t.TempDir(), "import.csv")
+		require.NoError(os.WriteFile(input, []byte("mac,name\n00:00:00:00:00:22,Renamed\n00:00:00:00:00:33,Host3\n"), 0644))
+
+		cmd, out := parseCommand(t, "import", "-c", configPath)
+		require.NoError(runImport(cmd, input), "Should import hosts")
+		assert.Contains(out.String(), "1 added, 1 updated, 0 unchanged, 0 removed", "Should print summary")
+
+		data, err := os.ReadFile(storagePath)
+		require.NoError(err)
+		assert.Contains(string(data), "Renamed", "Should update host")
+		assert.Contains(string(data), "Host3", "Should add host")
+	})
+
+	t.Run("DryRunStdin", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		configPath, storagePath := newTestConfig(t, testHostsYAML)
+
+		cmd, out := parseCommand(t, "import", "-c", configPath, "--mode", "replace", "--dry-run")
+		cmd.SetIn(bytes.NewBufferString(`[{"mac": "00:00:00:00:00:33", "name": "Host3"}]`))
+		require.NoError(cmd.Flags().Set(flagNameFormat, "json"))
+		require.NoError(runImport(cmd, "-"), "Should import hosts")
+		assert.Contains(out.String(), "Dry run", "Should print dry run")
+		assert.Contains(out.String(), "1 added, 0 updated, 0 unchanged, 2 removed", "Should print summary")
+
+		data, err := os.ReadFile(storagePath)
+		require.NoError(err)
+		assert.Equal(testHostsYAML, string(data), "Should not change the storage")
+	})
+
+	t.Run("ValidationErrors", func(t *testing.T) {
+		assert := assert.New(t)
+
+		configPath, _ := newTestConfig(t, testHostsYAML)
+
+		cmd, out := parseCommand(t, "import", "-c", configPath, "-f", "csv")
+		cmd.SetIn(bytes.NewBufferString("mac,name\nnot-a-mac,Host3\n"))
+		err := runImport(cmd, "-")
+		assert.ErrorContains(err, "found 1 invalid hosts", "Should fail")
+		assert.Contains(out.String(), "Row 1 (not-a-mac)", "Should print the row of the invalid host")
+	})
+
+	t.Run("UnknownMode", func(t *testing.T) {
+		cmd, _ := parseCommand(t, "import", "--mode", "append")
+		assert.ErrorContains(t, runImport(cmd, "-"), "unknown import mode", "Should fail")
+	})
+}
+
+func TestLeases(t *testing.T) {
+	t.Run("List", func(t *testing.T) {
+		assert := assert.New(t)
+
+		configPath, _ := newTestConfig(t, testHostsYAML)
+
+		cmd, out := parseCommand(t, "leases", "-c", configPath)
+		require.NoError(t, runLeases(cmd, []string{"testdata/dnsmasq.leases"}), "Should list leases")
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		require.Len(t, lines, 4, "Should print header and all proposals")
+		assert.Equal([]string{"00:00:00:00:00:11", "Host1", "192.0.2.1", "true"}, strings.Fields(lines[1]), "Should mark known host")
+		assert.Equal([]string{"00:00:00:00:00:44", "192.0.2.4", "192.0.2.4", "false"}, strings.Fields(lines[3]), "Should use address as name")
+	})
+
+	t.Run("AddAll", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		configPath, storagePath := newTestConfig(t, testHostsYAML)
+
+		cmd, out := parseCommand(t, "leases", "-c", configPath, "--add", "all")
+		require.NoError(runLeases(cmd, []string{"testdata/dnsmasq.leases"}), "Should add hosts")
+		assert.Equal("Added host Host3 (00:00:00:00:00:33)\nAdded host 192.0.2.4 (00:00:00:00:00:44)\n", out.String(), "Should only add new hosts")
+
+		data, err := os.ReadFile(storagePath)
+		require.NoError(err)
+		assert.Contains(string(data), "Host3", "Should add host")
+	})
+
+	t.Run("AddSelected", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		configPath, storagePath := newTestConfig(t, testHostsYAML)
+
+		cmd, _ := parseCommand(t, "leases", "-c", configPath, "--add", "00:00:00:00:00:44")
+		require.NoError(runLeases(cmd, []string{"testdata/dnsmasq.leases"}), "Should add host")
+
+		data, err := os.ReadFile(storagePath)
+		require.NoError(err)
+		assert.Contains(string(data), "192.0.2.4", "Should add selected host")
+		assert.NotContains(string(data), "Host3", "Should not add other hosts")
+	})
+
+	t.Run("AddUnknown", func(t *testing.T) {
+		configPath, _ := newTestConfig(t, testHostsYAML)
+
+		cmd, _ := parseCommand(t, "leases", "-c", configPath, "--add", "00:00:00:00:00:99")
+		assert.ErrorContains(t, runLeases(cmd, []string{"testdata/dnsmasq.leases"}), "no lease found", "Should fail")
+	})
+
+	t.Run("ConfiguredSources", func(t *testing.T) {
+		configPath, _ := newTestConfig(t, testHostsYAML)
+		f, err := os.OpenFile(configPath, os.O_APPEND|os.O_WRONLY, 0644)
+		require.NoError(t, err)
+		_, err = f.WriteString("server:\n  leases:\n    - path: testdata/dnsmasq.leases\n")
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		cmd, out := parseCommand(t, "leases", "-c", configPath)
+		require.NoError(t, runLeases(cmd, nil), "Should list leases")
+		assert.Contains(t, out.String(), "Host3", "Should read configured sources")
+	})
+
+	t.Run("UnknownFormat", func(t *testing.T) {
+		cmd, _ := parseCommand(t, "leases", "-f", "xml")
+		assert.ErrorContains(t, runLeases(cmd, nil), "unknown format", "Should fail")
+	})
+}
+
+func TestList(t *testing.T) {
+	const hostsYAML = testHostsYAML + `  - mac: "00:00:00:00:00:33"
+    name: Host3
+    displayName: Gaming PC
+    tags: [gaming]
+    location: Living room
+`
+
+	t.Run("Table", func(t *testing.T) {
+		assert := assert.New(t)
+
+		configPath, _ := newTestConfig(t, hostsYAML)
+
+		cmd, out := parseCommand(t, "list", "-c", configPath)
+		require.NoError(t, runList(cmd), "Should list hosts")
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		require.Len(t, lines, 4, "Should print header and all hosts")
+		assert.Equal([]string{"MAC", "NAME", "DISPLAY", "NAME", "ADDRESS", "LOCATION", "SITE", "TAGS"}, strings.Fields(lines[0]), "Should print header")
+		assert.Equal([]string{"00:00:00:00:00:22", "Host2", "192.0.2.2"}, strings.Fields(lines[2]), "Should print host")
+		assert.Contains(lines[3], "Gaming PC", "Should print display name")
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+		configPath, _ := newTestConfig(t, hostsYAML)
+
+		cmd, out := parseCommand(t, "list", "-c", configPath, "--tag", "Gaming", "--location", "living room", "-o", "json")
+		require.NoError(t, runList(cmd), "Should list hosts")
+		assert.JSONEq(t, `[{"mac":"00:00:00:00:00:33","name":"Host3","displayName":"Gaming PC","tags":["gaming"],"location":"Living room"}]`, out.String(), "Should only list matching hosts")
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		configPath, _ := newTestConfig(t, testHostsYAML)
+
+		cmd, out := parseCommand(t, "list", "-c", configPath, "-o", "yaml", "-q", "192.0.2")
+		require.NoError(t, runList(cmd), "Should list hosts")
+		assert.Equal(t, "hosts:\n  - mac: \"00:00:00:00:00:22\"\n    name: Host2\n    address: 192.0.2.2\n", out.String(), "Should print hosts in the format of the hosts file")
+	})
+}
+
+func TestAdd(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		configPath, storagePath := newTestConfig(t, testHostsYAML)
+
+		cmd, out := parseCommand(t, "add", "-c", configPath, "--address", "192.0.2.3", "--tag", "nas,storage", "--label", "rack=a1", "--site", "building-b")
+		require.NoError(runAdd(cmd, "00:00:00:00:00:33", "Host3"), "Should add host")
+		assert.Equal("Added host Host3 (00:00:00:00:00:33)\n", out.String())
+
+		data, err := os.ReadFile(storagePath)
+		require.NoError(err)
+		assert.Contains(string(data), "Host3", "Should add host")
+		assert.Contains(string(data), "rack: a1", "Should add labels")
+		assert.Contains(string(data), "site: building-b", "Should add site")
+	})
+
+	t.Run("InvalidHostname", func(t *testing.T) {
+		configPath, _ := newTestConfig(t, testHostsYAML)
+
+		cmd, _ := parseCommand(t, "add", "-c", configPath)
+		assert.ErrorContains(t, runAdd(cmd, "00:00:00:00:00:33", "not a hostname"), "invalid hostname", "Should validate the host")
+	})
+
+	t.Run("InvalidMetadata", func(t *testing.T) {
+		configPath, _ := newTestConfig(t, testHostsYAML)
+
+		cmd, _ := parseCommand(t, "add", "-c", configPath, "--icon", "toaster")
+		assert.ErrorContains(t, runAdd(cmd, "00:00:00:00:00:33", "Host3"), "unknown icon", "Should validate the metadata")
+	})
+}
+
+func TestRemove(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		configPath, storagePath := newTestConfig(t, testHostsYAML)
+
+		cmd, out := parseCommand(t, "remove", "-c", configPath)
+		require.NoError(runRemove(cmd, []string{"host1"}), "Should remove host by name")
+		assert.Equal("Removed host Host1 (00:00:00:00:00:11)\n", out.String())
+
+		data, err := os.ReadFile(storagePath)
+		require.NoError(err)
+		assert.NotContains(string(data), "Host1", "Should remove host")
+		assert.Contains(string(data), "Host2", "Should keep other hosts")
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		configPath, storagePath := newTestConfig(t, testHostsYAML)
+
+		cmd, _ := parseCommand(t, "remove", "-c", configPath)
+		assert.ErrorContains(t, runRemove(cmd, []string{"00-00-00-00-00-22", "00:00:00:00:00:99"}), "no known host '00:00:00:00:00:99'", "Should fail for unknown hosts")
+
+		data, err := os.ReadFile(storagePath)
+		require.NoError(t, err)
+		assert.Equal(t, testHostsYAML, string(data), "Should not remove any host")
+	})
+}
+
+func TestStatus(t *testing.T) {
+	configPath, _ := newTestConfig(t, testHostsYAML)
+
+	cmd, out := parseCommand(t, "status", "-c", configPath, "-o", "json")
+	require.NoError(t, runStatus(cmd), "Should get status")
+
+	var status []hostStatus
+	require.NoError(t, json.Unmarshal(out.Bytes(), &status), "Should print json")
+	require.Len(t, status, 1, "Should only check hosts with an address")
+	assert.Equal(t, "Host2", status[0].Name, "Should add the name of the host")
+	assert.Equal(t, "192.0.2.2", status[0].Address)
+
+	t.Run("Table", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		lastSeen := time.Date(2026, 1, 2, 3, 4, 5, 0, time.Local)
+		require.NoError(t, printStatus(out, []hostStatus{
+			{MAC: "00:00:00:00:00:22", Name: "Host2", Address: "192.0.2.2", Online: true, LastSeen: lastSeen},
+			{MAC: "00:00:00:00:00:33", Name: "Host3", Address: "192.0.2.3", Error: "timeout"},
+		}))
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		require.Len(t, lines, 3, "Should print header and all hosts")
+		assert.Equal(t, []string{"00:00:00:00:00:22", "Host2", "192.0.2.2", "online", "2026-01-02", "03:04:05"}, strings.Fields(lines[1]))
+		assert.Equal(t, []string{"00:00:00:00:00:33", "Host3", "192.0.2.3", "error:", "timeout"}, strings.Fields(lines[2]))
+	})
+}
+
+func TestWake(t *testing.T) {
+	const hostsYAML = testHostsYAML + `  - mac: "00:00:00:00:00:33"
+    name: Host3
+    site: building-b
+`
+
+	t.Run("Local", func(t *testing.T) {
+		configPath, _ := newTestConfig(t, hostsYAML)
+
+		cmd, out := parseCommand(t, "wake", "-c", configPath)
+		require.NoError(t, runWake(cmd, []string{"host1", "ff:ff:ff:ff:ff:ff"}), "Should wake hosts")
+		assert.Equal(t, "Magic packet sent to Host1 (00:00:00:00:00:11)\nMagic packet sent to FF:FF:FF:FF:FF:FF\n", out.String())
+	})
+
+	t.Run("PartialFailure", func(t *testing.T) {
+		configPath, _ := newTestConfig(t, hostsYAML)
+
+		cmd, out := parseCommand(t, "wake", "-c", configPath)
+		err := runWake(cmd, []string{"Host3", "Host1"})
+		assert.ErrorContains(t, err, "failed to wake 1 of 2 hosts", "Should fail")
+		assert.Contains(t, out.String(), "Failed to wake Host3 (00:00:00:00:00:33): no relay agent available for site 'building-b'", "Should print the error")
+		assert.Contains(t, out.String(), "Magic packet sent to Host1 (00:00:00:00:00:11)", "Should still wake the other hosts")
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		configPath, _ := newTestConfig(t, hostsYAML)
+
+		cmd, _ := parseCommand(t, "wake", "-c", configPath)
+		assert.ErrorContains(t, runWake(cmd, []string{"server"}), "no known host 'server'", "Should fail for unknown names")
+	})
+}
+
+func TestRemote(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s, err := storage.NewStorage(storage.StorageConfig{Type: "memory"})
+	require.NoError(err, "Should create storage")
+	require.NoError(s.AddHost(t.Context(), types.Host{MAC: "00:00:00:00:00:11", Name: "Host1"}))
+	require.NoError(s.AddHost(t.Context(), types.Host{MAC: "00:00:00:00:00:33", Name: "Host3", Site: "building-b"}))
+
+	router := http.NewServeMux()
+	router.Handle("/api/v1/", http.StripPrefix("/api/v1", api.NewRouter(s, api.Options{})))
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	cmd, out := parseCommand(t, "add", "--server", server.URL, "--tag", "nas")
+	require.NoError(runAdd(cmd, "00:00:00:00:00:22", "Host2"), "Should add host")
+
+	cmd, out = parseCommand(t, "list", "--server", server.URL, "--tag", "nas")
+	require.NoError(runList(cmd), "Should list hosts")
+	assert.Contains(out.String(), "Host2", "Should list the added host")
+	assert.NotContains(out.String(), "Host1", "Should filter hosts")
+
+	cmd, out = parseCommand(t, "wake", "--server", server.URL)
+	assert.ErrorContains(runWake(cmd, []string{"Host1", "Host3"}), "failed to wake 1 of 2 hosts", "Should fail for the host on the remote site")
+	assert.Contains(out.String(), "Magic packet sent to Host1 (00:00:00:00:00:11)")
+	assert.Contains(out.String(), "No relay agent available for site 'building-b'", "Should print the reason of the server")
+
+	cmd, _ = parseCommand(t, "remove", "--server", server.URL)
+	require.NoError(runRemove(cmd, []string{"Host2"}), "Should remove host")
+	host, err := s.GetHost(t.Context(), "00:00:00:00:00:22")
+	require.NoError(err)
+	assert.Empty(host.MAC, "Should have removed the host")
+}
+
+func execExitTest(t *testing.T, test string, exitsError bool) {
+	cmd := exec.Command(os.Args[0], "-test.run="+test)
+	cmd.Env = append(os.Environ(), "RUN_CRASH_TEST=1")
+	err := cmd.Run()
+	if exitsError && err == nil {
+		t.Fatal("Process exited without error")
+	} else if !exitsError && err == nil {
+		return
+	}
+	if e, ok := err.(*exec.ExitError); ok && !e.Success() {
+		return
+	}
+	t.Fatalf("process ran with err %v, want exit status 1", err)
+}
@@ -0,0 +1,76 @@
+package hosts
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/format"
+	"github.com/spf13/cobra"
+)
+
+const (
+	flagNameFormat = "format"
+	flagNameOutput = "output"
+)
+
+func newExportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export all hosts as yaml, json or csv",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			err := runExport(cmd)
+			if err != nil {
+				exitError(cmd, err)
+			}
+		},
+	}
+
+	cmd.Flags().StringP(flagNameFormat, "f", "", "Format of the export (yaml, json, csv), defaults to the extension of the output file or yaml")
+	cmd.Flags().StringP(flagNameOutput, "o", "", "File to write the hosts to, defaults to stdout")
+
+	return cmd
+}
+
+func runExport(cmd *cobra.Command) error {
+	f, err := cmd.Flags().GetString(flagNameFormat)
+	if err != nil {
+		return fmt.Errorf("failed to get format flag: %w", err)
+	}
+	output, err := cmd.Flags().GetString(flagNameOutput)
+	if err != nil {
+		return fmt.Errorf("failed to get output flag: %w", err)
+	}
+
+	if f == "" {
+		f = format.FromFilename(output)
+	}
+	if f == "" {
+		f = format.FormatYAML
+	}
+	if !format.Valid(f) {
+		return fmt.Errorf("unknown format '%s'", f)
+	}
+
+	t, err := newTarget(cmd)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	data, err := t.ExportHosts(cmd.Context(), f)
+	if err != nil {
+		return fmt.Errorf("failed to export hosts: %w", err)
+	}
+
+	if output == "" {
+		_, err = cmd.OutOrStdout().Write(data)
+		return err
+	}
+
+	err = os.WriteFile(output, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write file '%s': %w", output, err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package hosts
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/format"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/spf13/cobra"
+)
+
+const (
+	flagNameMode   = "mode"
+	flagNameDryRun = "dry-run"
+)
+
+func newImportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import [file]",
+		Short: "Import hosts from a yaml, json or csv file, use - or omit the file to read from stdin",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			input := "-"
+			if len(args) > 0 {
+				input = args[0]
+			}
+
+			err := runImport(cmd, input)
+			if err != nil {
+				exitError(cmd, err)
+			}
+		},
+	}
+
+	cmd.Flags().StringP(flagNameFormat, "f", "", "Format of the file (yaml, json, csv), defaults to the file extension or yaml")
+	cmd.Flags().StringP(flagNameMode, "m", string(types.ImportModeMerge), "Merge with or replace the existing hosts (merge, replace)")
+	cmd.Flags().Bool(flagNameDryRun, false, "Only show the changes without applying them")
+
+	return cmd
+}
+
+func runImport(cmd *cobra.Command, input string) error {
+	f, err := cmd.Flags().GetString(flagNameFormat)
+	if err != nil {
+		return fmt.Errorf("failed to get format flag: %w", err)
+	}
+	mode, err := cmd.Flags().GetString(flagNameMode)
+	if err != nil {
+		return fmt.Errorf("failed to get mode flag: %w", err)
+	}
+	dryRun, err := cmd.Flags().GetBool(flagNameDryRun)
+	if err != nil {
+		return fmt.Errorf("failed to get dry-run flag: %w", err)
+	}
+
+	if f == "" && input != "-" {
+		f = format.FromFilename(input)
+	}
+	if f == "" {
+		f = format.FormatYAML
+	}
+	if !format.Valid(f) {
+		return fmt.Errorf("unknown format '%s'", f)
+	}
+	if mode != string(types.ImportModeMerge) && mode != string(types.ImportModeReplace) {
+		return fmt.Errorf("unknown import mode '%s'", mode)
+	}
+
+	var data []byte
+	if input == "-" {
+		data, err = io.ReadAll(cmd.InOrStdin())
+	} else {
+		// #nosec G304 -- Local users can decide on their file path themselves.
+		data, err = os.ReadFile(input)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read hosts: %w", err)
+	}
+
+	t, err := newTarget(cmd)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	result, err := t.ImportHosts(cmd.Context(), data, f, types.ImportMode(mode), dryRun)
+	if err != nil {
+		return fmt.Errorf("failed to import hosts: %w", err)
+	}
+
+	if len(result.Errors) > 0 {
+		out := cmd.ErrOrStderr()
+		for _, e := range result.Errors {
+			if e.MAC != "" {
+				fmt.Fprintf(out, "Row %d (%s): %s\n", e.Row, e.MAC, e.Error)
+			} else {
+				fmt.Fprintf(out, "Row %d: %s\n", e.Row, e.Error)
+			}
+		}
+		return fmt.Errorf("found %d invalid hosts, no changes have been made", len(result.Errors))
+	}
+
+	printImportResult(cmd.OutOrStdout(), result)
+	return nil
+}
+
+// Print a summary of the changes
+func printImportResult(out io.Writer, result types.ImportResult) {
+	if result.DryRun {
+		fmt.Fprintln(out, "Dry run, no changes have been made")
+	}
+	for _, change := range []struct {
+		Name string
+		MACs []string
+	}{
+		{"Added", result.Added},
+		{"Updated", result.Updated},
+		{"Removed", result.Removed},
+	} {
+		if len(change.MACs) > 0 {
+			fmt.Fprintf(out, "%s: %s\n", change.Name, strings.Join(change.MACs, ", "))
+		}
+	}
+	fmt.Fprintf(out, "%d added, %d updated, %d unchanged, %d removed\n", len(result.Added), len(result.Updated), len(result.Unchanged), len(result.Removed))
+}
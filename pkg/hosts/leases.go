@@ -0,0 +1,133 @@
+package hosts
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/heathcliff26/go-wol/pkg/leases"
+	"github.com/spf13/cobra"
+)
+
+const flagNameAdd = "add"
+
+// Value for the add flag to add all new hosts
+const addAll = "all"
+
+func newLeasesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "leases [file...]",
+		Short: "Propose hosts from DHCP lease files and neighbor tables",
+		Long: "Propose hosts from DHCP lease files and neighbor tables.\n" +
+			"Reads the given files, or the lease sources configured for the server if none are given.\n" +
+			"Supported formats: " + strings.Join(leases.Formats, ", "),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := runLeases(cmd, args)
+			if err != nil {
+				exitError(cmd, err)
+			}
+		},
+	}
+
+	cmd.Flags().StringP(flagNameFormat, "f", "", "Format of the given files, detected from the file name if empty")
+	cmd.Flags().StringSlice(flagNameAdd, nil, "MAC addresses of the proposed hosts to add, use \""+addAll+"\" to add all new hosts")
+
+	return cmd
+}
+
+func runLeases(cmd *cobra.Command, files []string) error {
+	f, err := cmd.Flags().GetString(flagNameFormat)
+	if err != nil {
+		return fmt.Errorf("failed to get format flag: %w", err)
+	}
+	add, err := cmd.Flags().GetStringSlice(flagNameAdd)
+	if err != nil {
+		return fmt.Errorf("failed to get add flag: %w", err)
+	}
+
+	if f != "" && !leases.Valid(f) {
+		return fmt.Errorf("unknown format '%s'", f)
+	}
+
+	t, err := newTarget(cmd)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	var proposals []leases.Proposal
+	if len(files) > 0 {
+		sources := make([]leases.Source, 0, len(files))
+		for _, file := range files {
+			sources = append(sources, leases.Source{Path: file, Format: f})
+		}
+		l, err := leases.ReadSources(sources)
+		if err != nil {
+			return fmt.Errorf("failed to read leases: %w", err)
+		}
+		hosts, err := t.GetHosts(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to get hosts: %w", err)
+		}
+		proposals = leases.Proposals(l, hosts)
+	} else {
+		proposals, err = t.Leases(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to read leases: %w", err)
+		}
+	}
+
+	if len(add) == 0 {
+		return printProposals(cmd.OutOrStdout(), proposals)
+	}
+
+	selected, err := selectProposals(proposals, add)
+	if err != nil {
+		return err
+	}
+	for _, proposal := range selected {
+		err = t.AddHost(cmd.Context(), proposal.Host)
+		if err != nil {
+			return fmt.Errorf("failed to add host '%s': %w", proposal.MAC, err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Added host %s (%s)\n", proposal.Name, proposal.MAC)
+	}
+	return nil
+}
+
+// Return the proposals for the given MAC addresses, or all new hosts if "all" is given
+func selectProposals(proposals []leases.Proposal, macs []string) ([]leases.Proposal, error) {
+	if slices.Contains(macs, addAll) {
+		selected := make([]leases.Proposal, 0, len(proposals))
+		for _, proposal := range proposals {
+			if !proposal.Known {
+				selected = append(selected, proposal)
+			}
+		}
+		return selected, nil
+	}
+
+	selected := make([]leases.Proposal, 0, len(macs))
+	for _, mac := range macs {
+		i := slices.IndexFunc(proposals, func(p leases.Proposal) bool {
+			return strings.EqualFold(p.MAC, mac)
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("no lease found for '%s'", mac)
+		}
+		selected = append(selected, proposals[i])
+	}
+	return selected, nil
+}
+
+// Print the proposals as table
+func printProposals(out io.Writer, proposals []leases.Proposal) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MAC\tNAME\tADDRESS\tKNOWN")
+	for _, proposal := range proposals {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", proposal.MAC, proposal.Name, proposal.Address, proposal.Known)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,87 @@
+package hosts
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/format"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/spf13/cobra"
+)
+
+const (
+	flagNameSearch   = "search"
+	flagNameTag      = "tag"
+	flagNameLocation = "location"
+)
+
+func newListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the known hosts, optionally searched and filtered by their metadata",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			err := runList(cmd)
+			if err != nil {
+				exitError(cmd, err)
+			}
+		},
+	}
+
+	addOutputFlag(cmd)
+	cmd.Flags().StringP(flagNameSearch, "q", "", "Only list hosts whose name, display name, MAC or address contain the text")
+	cmd.Flags().StringSlice(flagNameTag, nil, "Only list hosts with all of the tags")
+	cmd.Flags().String(flagNameLocation, "", "Only list hosts at the location")
+
+	return cmd
+}
+
+func runList(cmd *cobra.Command) error {
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	var filter types.HostFilter
+	filter.Search, err = cmd.Flags().GetString(flagNameSearch)
+	if err != nil {
+		return fmt.Errorf("failed to get search flag: %w", err)
+	}
+	filter.Tags, err = cmd.Flags().GetStringSlice(flagNameTag)
+	if err != nil {
+		return fmt.Errorf("failed to get tag flag: %w", err)
+	}
+	filter.Location, err = cmd.Flags().GetString(flagNameLocation)
+	if err != nil {
+		return fmt.Errorf("failed to get location flag: %w", err)
+	}
+
+	t, err := newTarget(cmd)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	hosts, err := t.GetHosts(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("failed to get hosts: %w", err)
+	}
+	hosts = types.FilterHosts(hosts, filter)
+
+	if output == outputTable {
+		return printHosts(cmd.OutOrStdout(), hosts)
+	}
+	// Use the same format as the export, so the output can be imported again
+	return format.Encode(cmd.OutOrStdout(), hosts, output)
+}
+
+// Print the hosts as table
+func printHosts(out io.Writer, hosts []types.Host) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MAC\tNAME\tDISPLAY NAME\tADDRESS\tLOCATION\tSITE\tTAGS")
+	for _, host := range hosts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", host.MAC, host.Name, host.DisplayName, host.Address, host.Location, host.Site, strings.Join(host.Tags, ","))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,58 @@
+package hosts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+// Output formats of the list and status commands
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+var outputFormats = []string{outputTable, outputJSON, outputYAML}
+
+// Add the output flag to the command
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP(flagNameOutput, "o", outputTable, "Output format ("+strings.Join(outputFormats, ", ")+")")
+}
+
+// Return the output format from the flags
+func getOutputFormat(cmd *cobra.Command) (string, error) {
+	output, err := cmd.Flags().GetString(flagNameOutput)
+	if err != nil {
+		return "", fmt.Errorf("failed to get output flag: %w", err)
+	}
+	if !slices.Contains(outputFormats, output) {
+		return "", fmt.Errorf("unknown output format '%s', needs to be one of %s", output, strings.Join(outputFormats, ", "))
+	}
+	return output, nil
+}
+
+// Write the value as json or yaml
+func printValue(out io.Writer, output string, value any) error {
+	switch output {
+	case outputJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case outputYAML:
+		encoder := yaml.NewEncoder(out)
+		encoder.SetIndent(2)
+		err := encoder.Encode(value)
+		if err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("unknown output format '%s'", output)
+	}
+}
@@ -0,0 +1,46 @@
+package hosts
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func newRemoveCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "remove <mac|name>...",
+		Short: "Remove the given hosts",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := runRemove(cmd, args)
+			if err != nil {
+				exitError(cmd, err)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func runRemove(cmd *cobra.Command, args []string) error {
+	t, err := newTarget(cmd)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	// Resolve all hosts first, so nothing is removed when one of them is unknown
+	hosts, err := resolveHosts(cmd.Context(), t, args, false)
+	if err != nil {
+		return err
+	}
+
+	for _, host := range hosts {
+		err = t.RemoveHost(cmd.Context(), host.MAC)
+		if err != nil {
+			return fmt.Errorf("failed to remove host '%s': %w", host.MAC, err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Removed host %s (%s)\n", host.Name, host.MAC)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package hosts
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/spf13/cobra"
+)
+
+// Status of a host as printed by the status command
+type hostStatus struct {
+	MAC      string    `json:"mac" yaml:"mac"`
+	Name     string    `json:"name" yaml:"name"`
+	Address  string    `json:"address" yaml:"address"`
+	Online   bool      `json:"online" yaml:"online"`
+	LastSeen time.Time `json:"lastSeen,omitzero" yaml:"lastSeen,omitempty"`
+	Error    string    `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func newStatusCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Check which of the hosts with an address are online",
+		Long: "Check which of the hosts with an address are online.\n" +
+			"When using a remote server, the hosts are pinged by the server.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			err := runStatus(cmd)
+			if err != nil {
+				exitError(cmd, err)
+			}
+		},
+	}
+
+	addOutputFlag(cmd)
+
+	return cmd
+}
+
+func runStatus(cmd *cobra.Command) error {
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+
+	t, err := newTarget(cmd)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	hosts, err := t.GetHosts(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("failed to get hosts: %w", err)
+	}
+	status, err := t.HostStatus(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("failed to get host status: %w", err)
+	}
+
+	result := joinStatus(hosts, status)
+	if output == outputTable {
+		return printStatus(cmd.OutOrStdout(), result)
+	}
+	return printValue(cmd.OutOrStdout(), output, result)
+}
+
+// Add the names of the hosts to their status, keeping the order of the hosts
+func joinStatus(hosts []types.Host, status []types.HostStatus) []hostStatus {
+	byMAC := make(map[string]types.HostStatus, len(status))
+	for _, s := range status {
+		byMAC[s.MAC] = s
+	}
+
+	result := make([]hostStatus, 0, len(status))
+	for _, host := range hosts {
+		s, ok := byMAC[host.MAC]
+		if !ok {
+			continue
+		}
+		result = append(result, hostStatus{
+			MAC:      s.MAC,
+			Name:     host.Title(),
+			Address:  s.Address,
+			Online:   s.Online,
+			LastSeen: s.LastSeen,
+			Error:    s.Error,
+		})
+	}
+	return result
+}
+
+// Print the status as table
+func printStatus(out io.Writer, status []hostStatus) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MAC\tNAME\tADDRESS\tSTATUS\tLAST SEEN")
+	for _, s := range status {
+		state := "offline"
+		if s.Online {
+			state = "online"
+		} else if s.Error != "" {
+			state = "error: " + s.Error
+		}
+		lastSeen := ""
+		if !s.LastSeen.IsZero() {
+			lastSeen = s.LastSeen.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.MAC, s.Name, s.Address, state, lastSeen)
+	}
+	return w.Flush()
+}
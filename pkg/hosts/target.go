@@ -0,0 +1,220 @@
+package hosts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/heathcliff26/go-wol/pkg/client"
+	"github.com/heathcliff26/go-wol/pkg/leases"
+	"github.com/heathcliff26/go-wol/pkg/ping"
+	"github.com/heathcliff26/go-wol/pkg/relay"
+	"github.com/heathcliff26/go-wol/pkg/server/config"
+	"github.com/heathcliff26/go-wol/pkg/server/storage"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/format"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/heathcliff26/go-wol/pkg/utils"
+	"github.com/heathcliff26/go-wol/pkg/wol"
+	"github.com/spf13/cobra"
+)
+
+// The hosts commands either work on the storage directly or on a remote server
+type target interface {
+	GetHosts(ctx context.Context) ([]types.Host, error)
+	AddHost(ctx context.Context, host types.Host) error
+	RemoveHost(ctx context.Context, mac string) error
+	HostStatus(ctx context.Context) ([]types.HostStatus, error)
+	Wake(ctx context.Context, mac string) error
+	Leases(ctx context.Context) ([]leases.Proposal, error)
+	ExportHosts(ctx context.Context, f string) ([]byte, error)
+	ImportHosts(ctx context.Context, data []byte, f string, mode types.ImportMode, dryRun bool) (types.ImportResult, error)
+	// Release the storage, needs to be called once the command is done
+	Close()
+}
+
+// Work on a remote server through its API
+type remoteTarget struct {
+	*client.Client
+}
+
+// Work directly on the storage of the server
+type localTarget struct {
+	storage *storage.Storage
+	leases  []leases.Source
+	relay   relay.Config
+}
+
+// Create the target from the persistent flags.
+// Uses the remote server when given, otherwise the storage from the config.
+// Fails when neither is given, instead of creating a hosts file with the default config in the current directory.
+func newTarget(cmd *cobra.Command) (target, error) {
+	server, err := cmd.Flags().GetString(flagNameServer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server flag: %w", err)
+	}
+	if server != "" {
+		token, err := cmd.Flags().GetString(flagNameToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get token flag: %w", err)
+		}
+		c, err := client.NewClient(server, token)
+		if err != nil {
+			return nil, err
+		}
+		return remoteTarget{c}, nil
+	}
+
+	configPath, err := cmd.Flags().GetString(flagNameConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config flag: %w", err)
+	}
+	if configPath == "" {
+		return nil, fmt.Errorf("either --config or --server is required")
+	}
+	env, err := cmd.Flags().GetBool(flagNameEnv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get env flag: %w", err)
+	}
+
+	cfg, err := config.LoadConfig(configPath, env, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	s, err := storage.NewStorage(cfg.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage: %w", err)
+	}
+	return &localTarget{
+		storage: s,
+		leases:  cfg.Server.Leases,
+		relay:   cfg.Server.Relay,
+	}, nil
+}
+
+func (remoteTarget) Close() {}
+
+func (t *localTarget) Close() {
+	t.storage.Close()
+}
+
+func (t *localTarget) GetHosts(ctx context.Context) ([]types.Host, error) {
+	return t.storage.GetHosts(ctx)
+}
+
+func (t *localTarget) AddHost(ctx context.Context, host types.Host) error {
+	return t.storage.AddHost(ctx, host)
+}
+
+func (t *localTarget) RemoveHost(ctx context.Context, mac string) error {
+	return t.storage.RemoveHost(ctx, mac)
+}
+
+// Ping all hosts with an address
+func (t *localTarget) HostStatus(ctx context.Context) ([]types.HostStatus, error) {
+	hosts, err := t.storage.GetHosts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hosts: %w", err)
+	}
+
+	hostsToCheck := make([]types.Host, 0, len(hosts))
+	for _, host := range hosts {
+		if host.Address != "" {
+			hostsToCheck = append(hostsToCheck, host)
+		}
+	}
+	return ping.PingHosts(hostsToCheck), nil
+}
+
+// Send the magic packet locally, or through the relay of the server config for hosts on remote sites.
+// Agents only registering themselves with a running server are not known here.
+func (t *localTarget) Wake(ctx context.Context, mac string) error {
+	packet, err := wol.CreatePacket(mac)
+	if err != nil {
+		return fmt.Errorf("invalid MAC address '%s': %w", mac, err)
+	}
+
+	host, err := t.storage.GetHost(ctx, mac)
+	if err != nil {
+		return err
+	}
+	if host.Site == "" {
+		err = packet.Send("")
+		if err != nil {
+			return fmt.Errorf("failed to send magic packet: %w", err)
+		}
+		return nil
+	}
+
+	r, err := relay.NewRelay(t.relay)
+	if err != nil {
+		return fmt.Errorf("failed to create relay: %w", err)
+	}
+	if r == nil {
+		return fmt.Errorf("no relay agent available for site '%s', the relay is disabled", host.Site)
+	}
+	err = r.Wake(ctx, host.Site, host.MAC)
+	if err != nil {
+		return fmt.Errorf("failed to wake host on site '%s': %w", host.Site, err)
+	}
+	return nil
+}
+
+func (t *localTarget) Leases(ctx context.Context) ([]leases.Proposal, error) {
+	l, err := leases.ReadSources(t.leases)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := t.storage.GetHosts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hosts: %w", err)
+	}
+	return leases.Proposals(l, hosts), nil
+}
+
+func (t *localTarget) ExportHosts(ctx context.Context, f string) ([]byte, error) {
+	hosts, err := t.storage.GetHosts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hosts: %w", err)
+	}
+
+	var buf bytes.Buffer
+	err = format.Encode(&buf, hosts, f)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (t *localTarget) ImportHosts(ctx context.Context, data []byte, f string, mode types.ImportMode, dryRun bool) (types.ImportResult, error) {
+	hosts, err := format.Decode(bytes.NewReader(data), f)
+	if err != nil {
+		return types.ImportResult{}, fmt.Errorf("failed to parse hosts: %w", err)
+	}
+	return t.storage.ImportHosts(ctx, hosts, mode, dryRun)
+}
+
+// Find the hosts for the given MAC addresses or names.
+// With allowUnknown, valid MAC addresses of unknown hosts are returned as hosts without a name.
+func resolveHosts(ctx context.Context, t target, args []string, allowUnknown bool) ([]types.Host, error) {
+	hosts, err := t.GetHosts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hosts: %w", err)
+	}
+
+	result := make([]types.Host, 0, len(args))
+	for _, arg := range args {
+		host, ok := types.FindHost(hosts, arg)
+		if !ok {
+			hwAddr, err := net.ParseMAC(arg)
+			if !allowUnknown || err != nil || !utils.ValidateMACAddress(arg) {
+				return nil, fmt.Errorf("no known host '%s'", arg)
+			}
+			host = types.Host{MAC: strings.ToUpper(hwAddr.String())}
+		}
+		result = append(result, host)
+	}
+	return result, nil
+}
@@ -0,0 +1,61 @@
+package hosts
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func newWakeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "wake <mac|name>...",
+		Short: "Wake the given hosts",
+		Long: "Wake the given hosts, known hosts can be given by name.\n" +
+			"When using a remote server, the magic packets are sent by the server.\n" +
+			"Otherwise they are sent locally, or through the relay configured for the site of the host.",
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			err := runWake(cmd, args)
+			if err != nil {
+				exitError(cmd, err)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func runWake(cmd *cobra.Command, args []string) error {
+	t, err := newTarget(cmd)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	hosts, err := resolveHosts(cmd.Context(), t, args, true)
+	if err != nil {
+		return err
+	}
+
+	// Try to wake all hosts, even if some of them fail
+	failed := 0
+	for _, host := range hosts {
+		name := host.MAC
+		if host.Name != "" {
+			name = fmt.Sprintf("%s (%s)", host.Title(), host.MAC)
+		}
+
+		err = t.Wake(cmd.Context(), host.MAC)
+		if err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Failed to wake %s: %v\n", name, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Magic packet sent to %s\n", name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to wake %d of %d hosts", failed, len(hosts))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package leases
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Parse an ISC dhcpd.leases file.
+// The file contains blocks in the format:
+//
+//	lease <address> {
+//	  hardware ethernet <mac>;
+//	  client-hostname "<hostname>";
+//	}
+//
+// Leases without a hardware address are skipped.
+func parseDhcpd(r io.Reader) ([]Lease, error) {
+	var leases []Lease
+	var current *Lease
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if current == nil {
+			fields := strings.Fields(line)
+			if len(fields) == 3 && fields[0] == "lease" && fields[2] == "{" {
+				current = &Lease{Address: fields[1]}
+			}
+			continue
+		}
+
+		if line == "}" {
+			if current.MAC != "" {
+				leases = append(leases, *current)
+			}
+			current = nil
+			continue
+		}
+
+		line = strings.TrimSuffix(line, ";")
+		switch {
+		case strings.HasPrefix(line, "hardware ethernet "):
+			mac, ok := normalizeMAC(strings.TrimSpace(strings.TrimPrefix(line, "hardware ethernet ")))
+			if ok {
+				current.MAC = mac
+			}
+		case strings.HasPrefix(line, "client-hostname "):
+			current.Hostname = strings.Trim(strings.TrimPrefix(line, "client-hostname "), `"`)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dhcpd leases: %w", err)
+	}
+	if current != nil {
+		return nil, fmt.Errorf("unterminated lease block for '%s'", current.Address)
+	}
+	return leases, nil
+}
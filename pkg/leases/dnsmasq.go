@@ -0,0 +1,43 @@
+package leases
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Parse a dnsmasq lease file.
+// Each line has the format: <expiry> <mac> <address> <hostname> <client-id>
+// IPv6 leases contain a DUID instead of a MAC and are skipped.
+func parseDnsmasq(r io.Reader) ([]Lease, error) {
+	var leases []Lease
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[0] == "duid" {
+			continue
+		}
+
+		mac, ok := normalizeMAC(fields[1])
+		if !ok {
+			continue
+		}
+
+		hostname := fields[3]
+		if hostname == "*" {
+			hostname = ""
+		}
+
+		leases = append(leases, Lease{
+			MAC:      mac,
+			Address:  fields[2],
+			Hostname: hostname,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dnsmasq leases: %w", err)
+	}
+	return leases, nil
+}
@@ -0,0 +1,77 @@
+package leases
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	keaColumnAddress  = "address"
+	keaColumnHWAddr   = "hwaddr"
+	keaColumnHostname = "hostname"
+	keaColumnState    = "state"
+
+	// Lease has been declined by the client
+	keaStateDeclined = "1"
+)
+
+// Parse a Kea memfile lease CSV.
+// The columns are mapped by the header, declined leases and leases without a hardware address are skipped.
+func parseKea(r io.Reader) ([]Lease, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read kea header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{keaColumnAddress, keaColumnHWAddr} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column '%s'", name)
+		}
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var leases []Lease
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read kea leases: %w", err)
+		}
+
+		if field(record, keaColumnState) == keaStateDeclined {
+			continue
+		}
+		mac, ok := normalizeMAC(field(record, keaColumnHWAddr))
+		if !ok {
+			continue
+		}
+
+		leases = append(leases, Lease{
+			MAC:      mac,
+			Address:  field(record, keaColumnAddress),
+			Hostname: field(record, keaColumnHostname),
+		})
+	}
+	return leases, nil
+}
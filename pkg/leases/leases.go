@@ -0,0 +1,187 @@
+package leases
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/heathcliff26/go-wol/pkg/utils"
+)
+
+const (
+	FormatDnsmasq = "dnsmasq"
+	FormatDhcpd   = "dhcpd"
+	FormatKea     = "kea"
+	FormatARP     = "arp"
+	FormatNeigh   = "neigh"
+)
+
+// All supported formats
+var Formats = []string{FormatDnsmasq, FormatDhcpd, FormatKea, FormatARP, FormatNeigh}
+
+// File to read leases from.
+type Source struct {
+	// Path to the file
+	Path string `yaml:"path"`
+	// Format of the file, detected from the path if empty
+	Format string `yaml:"format,omitempty"`
+}
+
+// A single entry from a lease file or neighbor table.
+type Lease struct {
+	MAC      string
+	Address  string
+	Hostname string
+}
+
+// Host proposed from the leases.
+type Proposal struct {
+	types.Host
+	// If a host with the MAC address is already known
+	Known bool `json:"known"`
+}
+
+// Check if the given format is supported
+func Valid(format string) bool {
+	return slices.Contains(Formats, format)
+}
+
+// Guess the format from the path, returns an empty string if the format can't be determined
+func DetectFormat(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case path == "/proc/net/arp" || name == "arp":
+		return FormatARP
+	case strings.Contains(name, "dnsmasq"):
+		return FormatDnsmasq
+	case strings.Contains(name, "dhcpd"):
+		return FormatDhcpd
+	case strings.Contains(name, "kea") || filepath.Ext(name) == ".csv":
+		return FormatKea
+	case strings.Contains(name, "neigh"):
+		return FormatNeigh
+	default:
+		return ""
+	}
+}
+
+// Parse leases in the given format
+func Parse(r io.Reader, format string) ([]Lease, error) {
+	switch format {
+	case FormatDnsmasq:
+		return parseDnsmasq(r)
+	case FormatDhcpd:
+		return parseDhcpd(r)
+	case FormatKea:
+		return parseKea(r)
+	case FormatARP:
+		return parseARP(r)
+	case FormatNeigh:
+		return parseNeigh(r)
+	default:
+		return nil, fmt.Errorf("unknown format '%s'", format)
+	}
+}
+
+// Read and parse the leases from the given source
+func (s Source) Read() ([]Lease, error) {
+	format := s.Format
+	if format == "" {
+		format = DetectFormat(s.Path)
+	}
+	if format == "" {
+		return nil, fmt.Errorf("could not detect format of '%s'", s.Path)
+	}
+
+	// #nosec G304 -- The sources are configured by the admin.
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open '%s': %w", s.Path, err)
+	}
+	defer f.Close()
+
+	leases, err := Parse(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse '%s' as %s: %w", s.Path, format, err)
+	}
+	return leases, nil
+}
+
+// Read all sources and return the combined leases
+func ReadSources(sources []Source) ([]Lease, error) {
+	var leases []Lease
+	for _, source := range sources {
+		l, err := source.Read()
+		if err != nil {
+			return nil, err
+		}
+		leases = append(leases, l...)
+	}
+	return leases, nil
+}
+
+// Convert the lease into a host.
+// Uses the address as name if the lease has no valid hostname.
+// Falls back to a name based on the MAC when the address is no valid name either, e.g. for IPv6 addresses.
+func (l Lease) Host() types.Host {
+	name := strings.TrimSuffix(l.Hostname, ".")
+	if !utils.ValidateHostname(name) {
+		name = l.Address
+	}
+	if !utils.ValidateHostname(name) {
+		name = "host-" + strings.ToLower(strings.NewReplacer(":", "", "-", "").Replace(l.MAC))
+	}
+	return types.Host{
+		MAC:     l.MAC,
+		Name:    name,
+		Address: l.Address,
+	}
+}
+
+// Create a host proposal for every MAC address in the leases.
+// Later leases overwrite earlier ones, but a hostname is never replaced with an empty one.
+// Hosts already contained in known are marked as such.
+func Proposals(leases []Lease, known []types.Host) []Proposal {
+	merged := make([]Lease, 0, len(leases))
+	index := make(map[string]int, len(leases))
+	for _, lease := range leases {
+		i, ok := index[lease.MAC]
+		if !ok {
+			index[lease.MAC] = len(merged)
+			merged = append(merged, lease)
+			continue
+		}
+		if lease.Hostname == "" {
+			lease.Hostname = merged[i].Hostname
+		}
+		if lease.Address == "" {
+			lease.Address = merged[i].Address
+		}
+		merged[i] = lease
+	}
+
+	proposals := make([]Proposal, 0, len(merged))
+	for _, lease := range merged {
+		proposals = append(proposals, Proposal{
+			Host: lease.Host(),
+			Known: slices.ContainsFunc(known, func(host types.Host) bool {
+				return strings.EqualFold(host.MAC, lease.MAC)
+			}),
+		})
+	}
+	return proposals
+}
+
+// Normalize the MAC address, returns false if it is not a valid MAC address or all zero
+func normalizeMAC(mac string) (string, bool) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) != 6 || slices.Equal(hw, make(net.HardwareAddr, 6)) {
+		return "", false
+	}
+	return strings.ToUpper(hw.String()), true
+}
@@ -0,0 +1,212 @@
+package leases
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tMatrix := []struct {
+		Name, Path, Format string
+		Result             []Lease
+	}{
+		{
+			Name:   "Dnsmasq",
+			Path:   "testdata/dnsmasq.leases",
+			Format: FormatDnsmasq,
+			Result: []Lease{
+				{MAC: "AA:BB:CC:DD:EE:01", Address: "192.168.1.10", Hostname: "desktop"},
+				{MAC: "AA:BB:CC:DD:EE:02", Address: "192.168.1.11"},
+			},
+		},
+		{
+			Name:   "Dhcpd",
+			Path:   "testdata/dhcpd.leases",
+			Format: FormatDhcpd,
+			Result: []Lease{
+				{MAC: "AA:BB:CC:DD:EE:11", Address: "192.168.1.20", Hostname: "nas"},
+				{MAC: "AA:BB:CC:DD:EE:12", Address: "192.168.1.21"},
+			},
+		},
+		{
+			Name:   "Kea",
+			Path:   "testdata/kea-leases4.csv",
+			Format: FormatKea,
+			Result: []Lease{
+				{MAC: "AA:BB:CC:DD:EE:21", Address: "192.168.1.30", Hostname: "server.example.org."},
+				{MAC: "AA:BB:CC:DD:EE:22", Address: "192.168.1.31"},
+			},
+		},
+		{
+			Name:   "ARP",
+			Path:   "testdata/arp",
+			Format: FormatARP,
+			Result: []Lease{
+				{MAC: "AA:BB:CC:DD:EE:31", Address: "192.168.1.1"},
+				{MAC: "AA:BB:CC:DD:EE:32", Address: "192.168.1.40"},
+			},
+		},
+		{
+			Name:   "Neigh",
+			Path:   "testdata/neigh.txt",
+			Format: FormatNeigh,
+			Result: []Lease{
+				{MAC: "AA:BB:CC:DD:EE:31", Address: "192.168.1.1"},
+				{MAC: "AA:BB:CC:DD:EE:41", Address: "192.168.1.50"},
+				{MAC: "AA:BB:CC:DD:EE:31", Address: "fe80::1"},
+			},
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			assert.Equal(tCase.Format, DetectFormat(tCase.Path), "Should detect format from path")
+
+			leases, err := Source{Path: tCase.Path}.Read()
+			assert.NoError(err, "Should parse file")
+			assert.Equal(tCase.Result, leases, "Should return leases")
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tMatrix := []struct {
+		Name, Format, Input, Error string
+	}{
+		{"UnknownFormat", "xml", "", "unknown format"},
+		{"DhcpdUnterminated", FormatDhcpd, "lease 192.168.1.1 {\n  hardware ethernet aa:bb:cc:dd:ee:ff;\n", "unterminated lease block"},
+		{"KeaMissingColumn", FormatKea, "address,hostname\n192.168.1.1,host\n", "missing column 'hwaddr'"},
+		{"KeaInvalidCSV", FormatKea, "address,hwaddr\n\"192.168.1.1,aa:bb:cc:dd:ee:ff\n", "failed to read kea leases"},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			leases, err := Parse(strings.NewReader(tCase.Input), tCase.Format)
+			assert.Nil(t, leases, "Should not return leases")
+			assert.ErrorContains(t, err, tCase.Error, "Should return error")
+		})
+	}
+
+	t.Run("EmptyKea", func(t *testing.T) {
+		leases, err := Parse(strings.NewReader(""), FormatKea)
+		assert.NoError(t, err, "Should accept empty file")
+		assert.Empty(t, leases, "Should not return leases")
+	})
+}
+
+func TestSourceRead(t *testing.T) {
+	t.Run("ExplicitFormat", func(t *testing.T) {
+		leases, err := Source{Path: "testdata/kea-leases4.csv", Format: FormatKea}.Read()
+		assert.NoError(t, err, "Should parse file")
+		assert.Len(t, leases, 2, "Should return leases")
+	})
+	t.Run("UnknownFormat", func(t *testing.T) {
+		_, err := Source{Path: "testdata/leases.txt"}.Read()
+		assert.ErrorContains(t, err, "could not detect format", "Should fail")
+	})
+	t.Run("MissingFile", func(t *testing.T) {
+		_, err := Source{Path: "testdata/not-a-file", Format: FormatARP}.Read()
+		assert.ErrorIs(t, err, os.ErrNotExist, "Should fail")
+	})
+	t.Run("ParseError", func(t *testing.T) {
+		_, err := Source{Path: "testdata/kea-missing-column.csv"}.Read()
+		assert.ErrorContains(t, err, "missing column", "Should fail")
+	})
+	t.Run("ReadSources", func(t *testing.T) {
+		require := require.New(t)
+
+		leases, err := ReadSources([]Source{{Path: "testdata/dnsmasq.leases"}, {Path: "testdata/arp"}})
+		require.NoError(err, "Should read all sources")
+		require.Len(leases, 4, "Should combine leases")
+
+		_, err = ReadSources([]Source{{Path: "testdata/dnsmasq.leases"}, {Path: "testdata/not-a-file"}})
+		require.Error(err, "Should fail if any source fails")
+	})
+}
+
+func TestDetectFormat(t *testing.T) {
+	tMatrix := map[string]string{
+		"/proc/net/arp":                      FormatARP,
+		"/var/lib/misc/dnsmasq.leases":       FormatDnsmasq,
+		"/var/lib/dhcp/dhcpd.leases":         FormatDhcpd,
+		"/var/lib/kea/kea-leases4.csv":       FormatKea,
+		"/tmp/leases.csv":                    FormatKea,
+		"/tmp/ip-neigh.txt":                  FormatNeigh,
+		"/var/lib/misc/unknown-lease-format": "",
+	}
+
+	for path, format := range tMatrix {
+		t.Run(path, func(t *testing.T) {
+			assert.Equal(t, format, DetectFormat(path), "Should detect format")
+		})
+	}
+}
+
+func TestLeaseHost(t *testing.T) {
+	tMatrix := []struct {
+		Name   string
+		Lease  Lease
+		Result types.Host
+	}{
+		{
+			Name:   "Hostname",
+			Lease:  Lease{MAC: "AA:BB:CC:DD:EE:FF", Address: "192.168.1.10", Hostname: "desktop"},
+			Result: types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "desktop", Address: "192.168.1.10"},
+		},
+		{
+			Name:   "FQDN",
+			Lease:  Lease{MAC: "AA:BB:CC:DD:EE:FF", Address: "192.168.1.10", Hostname: "desktop.example.org."},
+			Result: types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "desktop.example.org", Address: "192.168.1.10"},
+		},
+		{
+			Name:   "NoHostname",
+			Lease:  Lease{MAC: "AA:BB:CC:DD:EE:FF", Address: "192.168.1.10"},
+			Result: types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "192.168.1.10", Address: "192.168.1.10"},
+		},
+		{
+			Name:   "InvalidHostname",
+			Lease:  Lease{MAC: "AA:BB:CC:DD:EE:FF", Address: "192.168.1.10", Hostname: "my_pc"},
+			Result: types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "192.168.1.10", Address: "192.168.1.10"},
+		},
+		{
+			Name:   "IPv6",
+			Lease:  Lease{MAC: "AA:BB:CC:DD:EE:FF", Address: "fd00::10"},
+			Result: types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "host-aabbccddeeff", Address: "fd00::10"},
+		},
+		{
+			Name:   "NoAddress",
+			Lease:  Lease{MAC: "AA:BB:CC:DD:EE:FF"},
+			Result: types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "host-aabbccddeeff"},
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert.Equal(t, tCase.Result, tCase.Lease.Host(), "Should convert lease to host")
+		})
+	}
+}
+
+func TestProposals(t *testing.T) {
+	leases := []Lease{
+		{MAC: "AA:BB:CC:DD:EE:01", Address: "192.168.1.10", Hostname: "desktop"},
+		{MAC: "AA:BB:CC:DD:EE:02", Address: "192.168.1.11"},
+		{MAC: "AA:BB:CC:DD:EE:01", Address: "192.168.1.12"},
+		{MAC: "AA:BB:CC:DD:EE:02", Hostname: "laptop"},
+	}
+	known := []types.Host{{MAC: "aa:bb:cc:dd:ee:02", Name: "laptop"}}
+
+	result := Proposals(leases, known)
+
+	assert.Equal(t, []Proposal{
+		{Host: types.Host{MAC: "AA:BB:CC:DD:EE:01", Name: "desktop", Address: "192.168.1.12"}},
+		{Host: types.Host{MAC: "AA:BB:CC:DD:EE:02", Name: "laptop", Address: "192.168.1.11"}, Known: true},
+	}, result, "Should merge leases by MAC address")
+}
@@ -0,0 +1,70 @@
+package leases
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ARP entry is incomplete
+const arpFlagIncomplete = "0x0"
+
+// Parse the content of /proc/net/arp.
+// The first line is a header, each following line has the format:
+// <address> <hw type> <flags> <mac> <mask> <device>
+// Incomplete entries are skipped.
+func parseARP(r io.Reader) ([]Lease, error) {
+	var leases []Lease
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[2] == arpFlagIncomplete {
+			continue
+		}
+
+		mac, ok := normalizeMAC(fields[3])
+		if !ok {
+			continue
+		}
+		leases = append(leases, Lease{
+			MAC:     mac,
+			Address: fields[0],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read arp table: %w", err)
+	}
+	return leases, nil
+}
+
+// Parse the output of "ip neigh".
+// Each line has the format: <address> dev <device> lladdr <mac> [router] <state>
+// Entries without a link layer address are skipped.
+func parseNeigh(r io.Reader) ([]Lease, error) {
+	var leases []Lease
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		i := slices.Index(fields, "lladdr")
+		if len(fields) == 0 || i < 0 || i+1 >= len(fields) || slices.Contains(fields, "FAILED") {
+			continue
+		}
+
+		mac, ok := normalizeMAC(fields[i+1])
+		if !ok {
+			continue
+		}
+		leases = append(leases, Lease{
+			MAC:     mac,
+			Address: fields[0],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read neighbor table: %w", err)
+	}
+	return leases, nil
+}
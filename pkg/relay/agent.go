@@ -0,0 +1,239 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/wol"
+)
+
+const DEFAULT_AGENT_ADDR = ":8443"
+
+// Options of a relay agent
+type AgentOptions struct {
+	// URL of the go-wol server to register with, needs to use https.
+	// The agent needs to be configured on the server when empty.
+	Server string
+	// The CA certificate(s) used to verify the server, defaults to the system trust store
+	CAFile string
+	// Token shared with the server, used for registering and for authenticating wake requests
+	Token string
+	// The site the agent wakes hosts for
+	Site string
+	// URL the server can reach the agent at, needs to use https
+	URL string
+	// Address to listen on
+	Addr string
+	// Certificate and key for serving https
+	Cert string
+	Key  string
+	// The broadcast address to send magic packets to
+	Broadcast string
+}
+
+// Relay agent, sends magic packets into its local network on behalf of the server
+type Agent struct {
+	opts   AgentOptions
+	client *http.Client
+	send   func(mac, bcAddr string) error
+}
+
+// Response of the agent, mirrors the response of the API
+type response struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// Create a new relay agent, checking that the options are complete
+func NewAgent(opts AgentOptions) (*Agent, error) {
+	if opts.Token == "" {
+		return nil, fmt.Errorf("missing token")
+	}
+	if opts.Cert == "" || opts.Key == "" {
+		return nil, fmt.Errorf("missing certificate or key, the agent only serves https")
+	}
+	if opts.Addr == "" {
+		opts.Addr = DEFAULT_AGENT_ADDR
+	}
+	if opts.Broadcast == "" {
+		opts.Broadcast = wol.DEFAULT_BROADCAST_ADDRESS
+	}
+
+	if opts.Server != "" {
+		u, err := url.Parse(opts.Server)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server url '%s': %w", opts.Server, err)
+		}
+		// The token is sent with every registration, so it must not be sent in cleartext
+		if u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("invalid server url '%s': needs to be an absolute https url", opts.Server)
+		}
+		opts.Server = strings.TrimSuffix(opts.Server, "/")
+
+		err = validateAgent(opts.Site, opts.URL)
+		if err != nil {
+			return nil, fmt.Errorf("can't register with the server: %w", err)
+		}
+	}
+
+	tlsConfig, err := newTLSConfig(opts.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Agent{
+		opts: opts,
+		client: &http.Client{
+			Timeout:   requestTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+		send: sendMagicPacket,
+	}, nil
+}
+
+func sendMagicPacket(mac, bcAddr string) error {
+	packet, err := wol.CreatePacket(mac)
+	if err != nil {
+		return err
+	}
+	return packet.Send(bcAddr)
+}
+
+// Return the handler serving the wake requests of the server
+func (a *Agent) Handler() http.Handler {
+	router := http.NewServeMux()
+	router.HandleFunc("POST /wake", a.wakeHandler)
+	return router
+}
+
+func (a *Agent) wakeHandler(res http.ResponseWriter, req *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(a.opts.Token), []byte(BearerToken(req))) != 1 {
+		slog.Warn("Rejected wake request with invalid token", slog.String("remote", req.RemoteAddr))
+		sendResponse(res, http.StatusUnauthorized, "Invalid token")
+		return
+	}
+
+	var wakeReq WakeRequest
+	err := json.NewDecoder(req.Body).Decode(&wakeReq)
+	if err != nil {
+		sendResponse(res, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if _, err = wol.CreatePacket(wakeReq.MAC); err != nil {
+		sendResponse(res, http.StatusBadRequest, "Invalid MAC address")
+		return
+	}
+
+	err = a.send(wakeReq.MAC, a.opts.Broadcast)
+	if err != nil {
+		slog.Info("Failed to send magic packet", slog.String("mac", wakeReq.MAC), slog.Any("error", err))
+		sendResponse(res, http.StatusInternalServerError, "Failed to send magic packet")
+		return
+	}
+
+	slog.Info("Sent magic packet on behalf of the server", slog.String("mac", wakeReq.MAC))
+	sendResponse(res, http.StatusOK, "")
+}
+
+func sendResponse(res http.ResponseWriter, statusCode int, reason string) {
+	r := response{
+		Status: "error",
+		Reason: reason,
+	}
+	if reason == "" {
+		r.Status = "ok"
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(statusCode)
+	err := json.NewEncoder(res).Encode(r)
+	if err != nil {
+		slog.Error("Failed to send response to server", "err", err)
+	}
+}
+
+// Register the agent with the server
+func (a *Agent) register(ctx context.Context) error {
+	body, err := json.Marshal(RegisterRequest{Site: a.opts.Site, URL: a.opts.URL})
+	if err != nil {
+		return fmt.Errorf("failed to marshal registration: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, a.opts.Server+"/api/v1/agents", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+a.opts.Token)
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request to server: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var r response
+		_ = json.NewDecoder(res.Body).Decode(&r)
+		return fmt.Errorf("server responded with status %d: %s", res.StatusCode, r.Reason)
+	}
+	return nil
+}
+
+// Renew the registration with the server every RegisterInterval until the context is canceled
+func (a *Agent) registerLoop(ctx context.Context) {
+	ticker := time.NewTicker(RegisterInterval)
+	defer ticker.Stop()
+
+	registered := false
+	for {
+		err := a.register(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("Failed to register with the server", slog.String("server", a.opts.Server), "err", err)
+			registered = false
+		} else if err == nil && !registered {
+			slog.Info("Registered with the server", slog.String("server", a.opts.Server), slog.String("site", a.opts.Site))
+			registered = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Serve wake requests and keep the registration with the server up to date until the context is canceled
+func (a *Agent) Run(ctx context.Context) error {
+	if a.opts.Server != "" {
+		go a.registerLoop(ctx)
+	}
+
+	server := http.Server{
+		Addr:        a.opts.Addr,
+		Handler:     a.Handler(),
+		ReadTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	slog.Info("Starting relay agent", slog.String("addr", a.opts.Addr), slog.String("site", a.opts.Site), slog.String("broadcast", a.opts.Broadcast))
+	err := server.ListenAndServeTLS(a.opts.Cert, a.opts.Key)
+	if errors.Is(err, http.ErrServerClosed) {
+		slog.Info("Relay agent closed, exiting")
+		return nil
+	}
+	return fmt.Errorf("failed to start relay agent: %w", err)
+}
@@ -0,0 +1,134 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAgent(t *testing.T) {
+	tMatrix := []struct {
+		Name  string
+		Opts  AgentOptions
+		Error string
+	}{
+		{"WithoutServer", AgentOptions{Token: "token", Cert: "tls.crt", Key: "tls.key"}, ""},
+		{"WithServer", AgentOptions{Server: "https://wol.example.org/", Token: "token", Site: "building-b", URL: "https://agent.example.org:8443", Cert: "tls.crt", Key: "tls.key"}, ""},
+		{"MissingToken", AgentOptions{Cert: "tls.crt", Key: "tls.key"}, "missing token"},
+		{"MissingCert", AgentOptions{Token: "token", Key: "tls.key"}, "missing certificate or key"},
+		{"InvalidServer", AgentOptions{Server: "wol.example.org", Token: "token", Cert: "tls.crt", Key: "tls.key"}, "invalid server url"},
+		{"MissingSite", AgentOptions{Server: "https://wol.example.org", Token: "token", URL: "https://agent.example.org", Cert: "tls.crt", Key: "tls.key"}, "invalid site"},
+		{"HTTPServer", AgentOptions{Server: "http://wol.example.org", Token: "token", Site: "building-b", URL: "https://agent.example.org", Cert: "tls.crt", Key: "tls.key"}, "invalid server url 'http://wol.example.org': needs to be an absolute https url"},
+		{"MissingCAFile", AgentOptions{Server: "https://wol.example.org", CAFile: "/not/existing/ca.crt", Token: "token", Site: "building-b", URL: "https://agent.example.org", Cert: "tls.crt", Key: "tls.key"}, "failed to read ca file"},
+		{"HTTPURL", AgentOptions{Server: "https://wol.example.org", Token: "token", Site: "building-b", URL: "http://agent.example.org", Cert: "tls.crt", Key: "tls.key"}, "needs to be an absolute https url"},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			a, err := NewAgent(tCase.Opts)
+			if tCase.Error != "" {
+				assert.ErrorContains(t, err, tCase.Error, "Should fail to create agent")
+				return
+			}
+			require.NoError(t, err, "Should create agent")
+			assert.Equal(t, DEFAULT_AGENT_ADDR, a.opts.Addr, "Should set default address")
+			assert.NotEmpty(t, a.opts.Broadcast, "Should set default broadcast address")
+			assert.False(t, strings.HasSuffix(a.opts.Server, "/"), "Should trim trailing slash of the server")
+		})
+	}
+}
+
+func TestAgentWakeHandler(t *testing.T) {
+	a, err := NewAgent(AgentOptions{Token: "token", Cert: "tls.crt", Key: "tls.key", Broadcast: "192.0.2.255"})
+	require.NoError(t, err, "Should create agent")
+
+	var sent []string
+	a.send = func(mac, bcAddr string) error {
+		if mac == "22:22:22:22:22:22" {
+			return errors.New("network unreachable")
+		}
+		sent = append(sent, mac+"@"+bcAddr)
+		return nil
+	}
+
+	tMatrix := []struct {
+		Name, Token, Body string
+		Status            int
+		Reason            string
+	}{
+		{"Success", "token", `{"mac":"11:11:11:11:11:11"}`, http.StatusOK, ""},
+		{"MissingToken", "", `{"mac":"11:11:11:11:11:11"}`, http.StatusUnauthorized, "Invalid token"},
+		{"WrongToken", "other", `{"mac":"11:11:11:11:11:11"}`, http.StatusUnauthorized, "Invalid token"},
+		{"InvalidBody", "token", `not json`, http.StatusBadRequest, "Invalid request body"},
+		{"InvalidMAC", "token", `{"mac":"not-a-mac"}`, http.StatusBadRequest, "Invalid MAC address"},
+		{"SendFailed", "token", `{"mac":"22:22:22:22:22:22"}`, http.StatusInternalServerError, "Failed to send magic packet"},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			req := httptest.NewRequest(http.MethodPost, "/wake", strings.NewReader(tCase.Body))
+			if tCase.Token != "" {
+				req.Header.Set("Authorization", "Bearer "+tCase.Token)
+			}
+			rr := httptest.NewRecorder()
+
+			a.Handler().ServeHTTP(rr, req)
+
+			assert.Equal(tCase.Status, rr.Code, "Should return correct status code")
+			var res response
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res), "Response should be json")
+			assert.Equal(tCase.Reason, res.Reason, "Should return correct reason")
+		})
+	}
+
+	assert.Equal(t, []string{"11:11:11:11:11:11@192.0.2.255"}, sent, "Should only send the valid request to the broadcast address")
+}
+
+func TestAgentRegister(t *testing.T) {
+	var received []RegisterRequest
+	srv, caFile := newTLSServer(t, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPut || req.URL.Path != "/api/v1/agents" || req.Header.Get("Authorization") != "Bearer token" {
+			res.WriteHeader(http.StatusUnauthorized)
+			_, _ = res.Write([]byte(`{"status":"error","reason":"Invalid token"}`))
+			return
+		}
+		var registration RegisterRequest
+		_ = json.NewDecoder(req.Body).Decode(&registration)
+		received = append(received, registration)
+		_, _ = res.Write([]byte(`{"status":"ok"}`))
+	}))
+
+	opts := AgentOptions{Server: srv.URL, CAFile: caFile, Token: "token", Site: "building-b", URL: "https://agent.example.org:8443", Cert: "tls.crt", Key: "tls.key"}
+
+	t.Run("Success", func(t *testing.T) {
+		a, err := NewAgent(opts)
+		require.NoError(t, err, "Should create agent")
+
+		assert.NoError(t, a.register(t.Context()), "Should register")
+		assert.Equal(t, []RegisterRequest{{Site: "building-b", URL: "https://agent.example.org:8443"}}, received, "Server should receive site and url")
+	})
+	t.Run("WrongToken", func(t *testing.T) {
+		opts := opts
+		opts.Token = "other"
+		a, err := NewAgent(opts)
+		require.NoError(t, err, "Should create agent")
+
+		assert.ErrorContains(t, a.register(t.Context()), "server responded with status 401: Invalid token", "Should return the error of the server")
+	})
+	t.Run("UntrustedServer", func(t *testing.T) {
+		opts := opts
+		opts.CAFile = ""
+		a, err := NewAgent(opts)
+		require.NoError(t, err, "Should create agent")
+
+		assert.ErrorContains(t, a.register(t.Context()), "certificate", "Should verify the certificate of the server")
+	})
+}
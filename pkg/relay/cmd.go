@@ -0,0 +1,106 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/heathcliff26/go-wol/pkg/wol"
+	"github.com/spf13/cobra"
+)
+
+const (
+	flagNameServer    = "server"
+	flagNameCAFile    = "ca-file"
+	flagNameToken     = "token"
+	flagNameTokenFile = "token-file"
+	flagNameSite      = "site"
+	flagNameURL       = "url"
+	flagNameAddr      = "addr"
+	flagNameCert      = "cert"
+	flagNameKey       = "key"
+	flagNameBroadcast = "broadcast"
+)
+
+// Create new command for running a relay agent
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Run a relay agent, sending magic packets into its local network on behalf of a server",
+		Long: "Run a relay agent, sending magic packets into its local network on behalf of a server.\n" +
+			"Wakes for hosts assigned to the site of the agent are forwarded to it by the server.\n" +
+			"With --server the agent registers itself, otherwise it needs to be configured on the server.",
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			opts, err := agentOptionsFromFlags(cmd)
+			if err != nil {
+				exitError(cmd, err)
+			}
+
+			agent, err := NewAgent(opts)
+			if err != nil {
+				exitError(cmd, fmt.Errorf("failed to create relay agent: %w", err))
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			err = agent.Run(ctx)
+			if err != nil {
+				exitError(cmd, err)
+			}
+		},
+	}
+
+	cmd.Flags().StringP(flagNameServer, "s", "", "URL of the server to register with, needs to use https")
+	cmd.Flags().String(flagNameCAFile, "", "CA certificate(s) to verify the server with, defaults to the system trust store")
+	cmd.Flags().String(flagNameToken, "", "Token shared with the server")
+	cmd.Flags().String(flagNameTokenFile, "", "Read the token from a file instead")
+	cmd.Flags().String(flagNameSite, "", "The site the agent wakes hosts for")
+	cmd.Flags().String(flagNameURL, "", "URL the server can reach the agent at, needs to use https")
+	cmd.Flags().String(flagNameAddr, DEFAULT_AGENT_ADDR, "Address to listen on")
+	cmd.Flags().String(flagNameCert, "", "Certificate for serving https")
+	cmd.Flags().String(flagNameKey, "", "Key for serving https")
+	cmd.Flags().StringP(flagNameBroadcast, "b", wol.DEFAULT_BROADCAST_ADDRESS, "The broadcast ip address to use")
+
+	return cmd
+}
+
+func agentOptionsFromFlags(cmd *cobra.Command) (AgentOptions, error) {
+	var opts AgentOptions
+	for name, value := range map[string]*string{
+		flagNameServer:    &opts.Server,
+		flagNameCAFile:    &opts.CAFile,
+		flagNameToken:     &opts.Token,
+		flagNameSite:      &opts.Site,
+		flagNameURL:       &opts.URL,
+		flagNameAddr:      &opts.Addr,
+		flagNameCert:      &opts.Cert,
+		flagNameKey:       &opts.Key,
+		flagNameBroadcast: &opts.Broadcast,
+	} {
+		var err error
+		*value, err = cmd.Flags().GetString(name)
+		if err != nil {
+			return AgentOptions{}, fmt.Errorf("failed to get %s flag: %w", name, err)
+		}
+	}
+
+	tokenFile, err := cmd.Flags().GetString(flagNameTokenFile)
+	if err != nil {
+		return AgentOptions{}, fmt.Errorf("failed to get %s flag: %w", flagNameTokenFile, err)
+	}
+	opts.Token, err = Config{Token: opts.Token, TokenFile: tokenFile}.token()
+	if err != nil {
+		return AgentOptions{}, err
+	}
+	return opts, nil
+}
+
+// Print the error information on stderr and exit with code 1
+func exitError(cmd *cobra.Command, err error) {
+	fmt.Fprintln(cmd.Root().ErrOrStderr(), "Fatal: "+err.Error())
+	os.Exit(1)
+}
@@ -0,0 +1,55 @@
+package relay
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/heathcliff26/go-wol/pkg/wol"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentOptionsFromFlags(t *testing.T) {
+	t.Run("Flags", func(t *testing.T) {
+		cmd := NewCommand()
+		require.NoError(t, cmd.ParseFlags([]string{
+			"--server", "https://wol.example.org",
+			"--ca-file", "ca.crt",
+			"--token", "token",
+			"--site", "building-b",
+			"--url", "https://agent.example.org:8443",
+			"--cert", "tls.crt",
+			"--key", "tls.key",
+		}), "Should parse flags")
+
+		opts, err := agentOptionsFromFlags(cmd)
+		require.NoError(t, err, "Should read options")
+		assert.Equal(t, AgentOptions{
+			Server:    "https://wol.example.org",
+			CAFile:    "ca.crt",
+			Token:     "token",
+			Site:      "building-b",
+			URL:       "https://agent.example.org:8443",
+			Addr:      DEFAULT_AGENT_ADDR,
+			Cert:      "tls.crt",
+			Key:       "tls.key",
+			Broadcast: wol.DEFAULT_BROADCAST_ADDRESS,
+		}, opts)
+	})
+	t.Run("TokenFile", func(t *testing.T) {
+		tokenFile := filepath.Join(t.TempDir(), "token")
+		require.NoError(t, os.WriteFile(tokenFile, []byte("file-token\n"), 0600), "Should write token file")
+
+		cmd := NewCommand()
+		require.NoError(t, cmd.ParseFlags([]string{"--token-file", tokenFile}), "Should parse flags")
+
+		opts, err := agentOptionsFromFlags(cmd)
+		require.NoError(t, err, "Should read options")
+		assert.Equal(t, "file-token", opts.Token, "Should read the token from the file")
+
+		require.NoError(t, cmd.ParseFlags([]string{"--token", "token"}), "Should parse flags")
+		_, err = agentOptionsFromFlags(cmd)
+		assert.ErrorContains(t, err, "only one of token and token-file", "Should not accept both token and token file")
+	})
+}
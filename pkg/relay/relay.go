@@ -0,0 +1,451 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/utils"
+)
+
+const (
+	// Registered agents are forgotten when they did not register again within this time
+	AgentTTL = 90 * time.Second
+	// Interval in which agents renew their registration
+	RegisterInterval = 30 * time.Second
+
+	requestTimeout = 10 * time.Second
+)
+
+// How the wakes for a site are delivered
+const (
+	RouteTypeAgent     = "agent"
+	RouteTypeUpstream  = "upstream"
+	RouteTypeBroadcast = "broadcast"
+)
+
+var (
+	// Returned by Wake when there is no agent, upstream or broadcast for the site
+	ErrNoAgent = errors.New("no relay agent available for the site")
+	// Returned by Register when the token is not allowed to register for the site
+	ErrUnauthorized = errors.New("invalid token")
+	// Returned by Register when another agent is registered for the site and the shared token is used
+	ErrSiteRegistered = errors.New("another agent is registered for the site")
+)
+
+// Configuration of the relay on the server
+type Config struct {
+	// Enable forwarding wakes to relay agents
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Token shared by all agents for registering, it is also sent to registered agents when forwarding wakes.
+	// Agents can only register for sites with their own token when it is empty.
+	Token string `yaml:"token,omitempty"`
+	// Read the token from a file instead, e.g. a mounted secret. Can't be combined with token
+	TokenFile string `yaml:"token-file,omitempty"`
+	// Tokens of single sites, by site. A site with its own token does not accept the shared token.
+	Tokens map[string]string `yaml:"tokens,omitempty"`
+	// Agents configured on the server instead of registering themselves
+	Agents []AgentConfig `yaml:"agents,omitempty"`
+	// Other go-wol servers the wakes of a site are sent to through their API
+	Upstreams []UpstreamConfig `yaml:"upstreams,omitempty"`
+	// Directed broadcasts sent from the server into the network of a site
+	Broadcasts []BroadcastConfig `yaml:"broadcasts,omitempty"`
+	// The CA certificate(s) used to verify the agents and upstreams, defaults to the system trust store
+	CAFile string `yaml:"ca-file,omitempty"`
+}
+
+// Agent configured on the server
+type AgentConfig struct {
+	Site string `yaml:"site"`
+	URL  string `yaml:"url"`
+	// Token expected by the agent, defaults to the token of the site or the shared token
+	Token string `yaml:"token,omitempty"`
+}
+
+// Request of an agent to register for a site
+type RegisterRequest struct {
+	Site string `json:"site" example:"building-b"`
+	// URL the server can reach the agent at, needs to use https
+	URL string `json:"url" example:"https://wol.building-b.example.org:8443"`
+}
+
+// Request to an agent to wake a host
+type WakeRequest struct {
+	MAC string `json:"mac" example:"AA:BB:CC:DD:EE:FF"`
+}
+
+// Agent, upstream or broadcast known to the server
+type AgentStatus struct {
+	Site string `json:"site" example:"building-b"`
+	// One of agent, upstream or broadcast
+	Type string `json:"type" example:"agent"`
+	// URL of the agent or upstream, unset for broadcasts
+	URL string `json:"url,omitempty" example:"https://wol.building-b.example.org:8443"`
+	// Broadcast address, only set for broadcasts
+	Address string `json:"address,omitempty" example:"192.168.2.255"`
+	// If the route is configured on the server instead of the agent registering itself
+	Static bool `json:"static"`
+	// When the registration of the agent expires, unset for static agents
+	Expires time.Time `json:"expires,omitzero"`
+	// Result of the last health check, only set for upstreams
+	Healthy   *bool     `json:"healthy,omitempty"`
+	LastCheck time.Time `json:"lastCheck,omitzero"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type agent struct {
+	url     string
+	token   string
+	expires time.Time
+}
+
+// Forwards wakes for hosts on remote sites to the relay agent, upstream or broadcast address of the site
+type Relay struct {
+	token  string
+	tokens map[string]string
+	client *http.Client
+	// Without a timeout, the upstreams set their own per attempt
+	upstreamClient *http.Client
+
+	lock       sync.RWMutex
+	static     map[string]agent
+	registered map[string]agent
+	upstreams  map[string]*upstream
+	broadcasts map[string]string
+
+	send func(mac, bcAddr string) error
+}
+
+// Create a new relay from the config, returns nil when the relay is disabled
+func NewRelay(cfg Config) (*Relay, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	token, err := cfg.token()
+	if err != nil {
+		return nil, err
+	}
+
+	for site, siteToken := range cfg.Tokens {
+		if !utils.ValidateSite(site) {
+			return nil, fmt.Errorf("invalid site '%s' in tokens, needs to be alphanumeric with '-', '_' or '.' in between and at most 63 characters", site)
+		}
+		if siteToken == "" {
+			return nil, fmt.Errorf("empty token for site '%s'", site)
+		}
+	}
+
+	static := make(map[string]agent, len(cfg.Agents))
+	for _, a := range cfg.Agents {
+		err := validateAgent(a.Site, a.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid agent for site '%s': %w", a.Site, err)
+		}
+		if _, ok := static[a.Site]; ok {
+			return nil, fmt.Errorf("multiple agents configured for site '%s'", a.Site)
+		}
+		if a.Token == "" {
+			a.Token = cfg.Tokens[a.Site]
+		}
+		if a.Token == "" {
+			a.Token = token
+		}
+		if a.Token == "" {
+			return nil, fmt.Errorf("missing token for the agent of site '%s'", a.Site)
+		}
+		static[a.Site] = agent{url: strings.TrimSuffix(a.URL, "/"), token: a.Token}
+	}
+
+	upstreams := make(map[string]*upstream, len(cfg.Upstreams))
+	for _, u := range cfg.Upstreams {
+		up, err := newUpstream(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream for site '%s': %w", u.Site, err)
+		}
+		if _, ok := static[u.Site]; ok {
+			return nil, fmt.Errorf("site '%s' has both an agent and an upstream configured", u.Site)
+		}
+		if _, ok := upstreams[u.Site]; ok {
+			return nil, fmt.Errorf("multiple upstreams configured for site '%s'", u.Site)
+		}
+		upstreams[u.Site] = up
+	}
+
+	broadcasts := make(map[string]string, len(cfg.Broadcasts))
+	for _, b := range cfg.Broadcasts {
+		err := validateBroadcast(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid broadcast for site '%s': %w", b.Site, err)
+		}
+		if _, ok := static[b.Site]; ok {
+			return nil, fmt.Errorf("site '%s' has both an agent and a broadcast configured", b.Site)
+		}
+		if _, ok := upstreams[b.Site]; ok {
+			return nil, fmt.Errorf("site '%s' has both an upstream and a broadcast configured", b.Site)
+		}
+		if _, ok := broadcasts[b.Site]; ok {
+			return nil, fmt.Errorf("multiple broadcasts configured for site '%s'", b.Site)
+		}
+		broadcasts[b.Site] = b.Address
+	}
+
+	tlsConfig, err := newTLSConfig(cfg.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig: tlsConfig,
+	}
+	return &Relay{
+		token:  token,
+		tokens: maps.Clone(cfg.Tokens),
+		client: &http.Client{
+			Timeout:   requestTimeout,
+			Transport: transport,
+		},
+		upstreamClient: &http.Client{
+			Transport: transport,
+		},
+		static:     static,
+		registered: make(map[string]agent),
+		upstreams:  upstreams,
+		broadcasts: broadcasts,
+		send:       sendMagicPacket,
+	}, nil
+}
+
+// Return the TLS config for verifying servers with the CA certificate(s) in the file,
+// uses the system trust store when the file is empty.
+func newTLSConfig(caFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates found in ca file '%s'", caFile)
+		}
+	}
+	return tlsConfig, nil
+}
+
+// Return the configured token, read from the token file if given.
+func (cfg Config) token() (string, error) {
+	if cfg.TokenFile == "" {
+		return cfg.Token, nil
+	}
+	if cfg.Token != "" {
+		return "", fmt.Errorf("only one of token and token-file can be set")
+	}
+
+	data, err := os.ReadFile(cfg.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Check that the site is valid and the url is an absolute https url
+func validateAgent(site, agentURL string) error {
+	if !utils.ValidateSite(site) {
+		return fmt.Errorf("invalid site '%s', needs to be alphanumeric with '-', '_' or '.' in between and at most 63 characters", site)
+	}
+	u, err := url.Parse(agentURL)
+	if err != nil {
+		return fmt.Errorf("invalid url '%s': %w", agentURL, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid url '%s': needs to be an absolute https url", agentURL)
+	}
+	return nil
+}
+
+// Check if the token allows registering for the site.
+// Sites with their own token only accept it, all other sites the shared token.
+// Always fails when there is no token for the site.
+func (r *Relay) Authorized(site, token string) bool {
+	expected, _ := r.siteToken(site)
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1
+}
+
+// Return the token agents need to register for the site with, and if it is the token of the site.
+func (r *Relay) siteToken(site string) (string, bool) {
+	if token, ok := r.tokens[site]; ok {
+		return token, true
+	}
+	return r.token, false
+}
+
+// Register the agent for the site, renewing the registration of the same agent.
+// Returns ErrUnauthorized when the token is not allowed to register for the site.
+// An agent registered with a different URL can only be replaced with the token of the site,
+// or after its registration expired, otherwise ErrSiteRegistered is returned.
+// The registration expires after AgentTTL, agents need to renew it regularly.
+func (r *Relay) Register(token string, req RegisterRequest) error {
+	if !r.Authorized(req.Site, token) {
+		return ErrUnauthorized
+	}
+	err := validateAgent(req.Site, req.URL)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	_, isStatic := r.static[req.Site]
+	_, isUpstream := r.upstreams[req.Site]
+	_, isBroadcast := r.broadcasts[req.Site]
+	if isStatic || isUpstream || isBroadcast {
+		return fmt.Errorf("site '%s' is configured on the server, registrations are not allowed", req.Site)
+	}
+
+	previous, ok := r.registered[req.Site]
+	active := ok && previous.expires.After(time.Now())
+	agentURL := strings.TrimSuffix(req.URL, "/")
+	if active && previous.url != agentURL {
+		if _, scoped := r.siteToken(req.Site); !scoped {
+			return fmt.Errorf("%w at '%s', it can only be replaced with the token of the site or after the registration expired", ErrSiteRegistered, previous.url)
+		}
+	}
+	if !active || previous.url != agentURL {
+		slog.Info("Registered relay agent", slog.String("site", req.Site), slog.String("url", agentURL))
+	}
+	r.registered[req.Site] = agent{
+		url:     agentURL,
+		token:   token,
+		expires: time.Now().Add(AgentTTL),
+	}
+	return nil
+}
+
+// Return all known agents, upstreams and broadcasts sorted by site, without expired registrations
+func (r *Relay) Agents() []AgentStatus {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	now := time.Now()
+	result := make([]AgentStatus, 0, len(r.static)+len(r.registered)+len(r.upstreams)+len(r.broadcasts))
+	for site, a := range r.static {
+		result = append(result, AgentStatus{Site: site, Type: RouteTypeAgent, URL: a.url, Static: true})
+	}
+	for site, a := range r.registered {
+		if a.expires.After(now) {
+			result = append(result, AgentStatus{Site: site, Type: RouteTypeAgent, URL: a.url, Expires: a.expires})
+		}
+	}
+	for site, up := range r.upstreams {
+		result = append(result, up.status(site))
+	}
+	for site, address := range r.broadcasts {
+		result = append(result, AgentStatus{Site: site, Type: RouteTypeBroadcast, Address: address, Static: true})
+	}
+	slices.SortFunc(result, func(a, b AgentStatus) int {
+		return strings.Compare(a.Site, b.Site)
+	})
+	return result
+}
+
+// Return the agent of the site, static agents take precedence over registered ones
+func (r *Relay) agent(site string) (agent, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if a, ok := r.static[site]; ok {
+		return a, true
+	}
+	a, ok := r.registered[site]
+	if !ok || a.expires.Before(time.Now()) {
+		return agent{}, false
+	}
+	return a, true
+}
+
+// Ask the agent or upstream of the site to send a magic packet to the MAC address,
+// or send it to the broadcast address of the site.
+// Returns ErrNoAgent if there is nothing configured for the site.
+// Errors returned by an upstream are returned as *UpstreamError.
+func (r *Relay) Wake(ctx context.Context, site, mac string) error {
+	a, ok := r.agent(site)
+	if ok {
+		return r.wakeAgent(ctx, a, mac)
+	}
+	if up, ok := r.upstreams[site]; ok {
+		return up.wake(ctx, r.upstreamClient, mac)
+	}
+	if address, ok := r.broadcasts[site]; ok {
+		err := r.send(mac, address)
+		if err != nil {
+			return fmt.Errorf("failed to send magic packet to '%s': %w", address, err)
+		}
+		return nil
+	}
+	return ErrNoAgent
+}
+
+func (r *Relay) wakeAgent(ctx context.Context, a agent, mac string) error {
+	body, err := json.Marshal(WakeRequest{MAC: mac})
+	if err != nil {
+		return fmt.Errorf("failed to marshal wake request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url+"/wake", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+a.token)
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request to agent: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var response struct {
+			Reason string `json:"reason"`
+		}
+		data, _ := io.ReadAll(res.Body)
+		_ = json.Unmarshal(data, &response)
+		return fmt.Errorf("agent responded with status %d: %s", res.StatusCode, response.Reason)
+	}
+	return nil
+}
+
+// Check the health of the upstreams until the context is canceled
+func (r *Relay) Run(ctx context.Context) {
+	for _, up := range r.upstreams {
+		go up.healthCheckLoop(ctx, r.upstreamClient)
+	}
+}
+
+// Return the bearer token from the Authorization header of the request, empty if there is none
+func BearerToken(req *http.Request) string {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return token
+}
@@ -0,0 +1,215 @@
+package relay
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Start a TLS server and return the path to a ca file for verifying it
+func newTLSServer(t *testing.T, handler http.Handler) (*httptest.Server, string) {
+	t.Helper()
+
+	srv := httptest.NewTLSServer(handler)
+	t.Cleanup(srv.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600), "Should write ca file")
+	return srv, caFile
+}
+
+func TestNewRelay(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("file-token\n"), 0600), "Should write token file")
+	invalidCAFile := filepath.Join(t.TempDir(), "invalid.crt")
+	require.NoError(t, os.WriteFile(invalidCAFile, []byte("not a certificate"), 0600), "Should write ca file")
+
+	tMatrix := []struct {
+		Name   string
+		Config Config
+		Error  string
+	}{
+		{"TokenOnly", Config{Enabled: true, Token: "token"}, ""},
+		{"TokenFile", Config{Enabled: true, TokenFile: tokenFile}, ""},
+		{"StaticAgent", Config{Enabled: true, Agents: []AgentConfig{{Site: "building-b", URL: "https://agent.example.org", Token: "agent-token"}}}, ""},
+		{"TokenAndTokenFile", Config{Enabled: true, Token: "token", TokenFile: tokenFile}, "only one of token and token-file"},
+		{"MissingTokenFile", Config{Enabled: true, TokenFile: filepath.Join(t.TempDir(), "missing")}, "failed to read token file"},
+		{"InvalidSite", Config{Enabled: true, Token: "token", Agents: []AgentConfig{{Site: "building b", URL: "https://agent.example.org"}}}, "invalid site"},
+		{"HTTPAgent", Config{Enabled: true, Token: "token", Agents: []AgentConfig{{Site: "building-b", URL: "http://agent.example.org"}}}, "needs to be an absolute https url"},
+		{"DuplicateSite", Config{Enabled: true, Token: "token", Agents: []AgentConfig{{Site: "a", URL: "https://a.example.org"}, {Site: "a", URL: "https://b.example.org"}}}, "multiple agents configured for site 'a'"},
+		{"MissingAgentToken", Config{Enabled: true, Agents: []AgentConfig{{Site: "a", URL: "https://a.example.org"}}}, "missing token for the agent of site 'a'"},
+		{"MissingCAFile", Config{Enabled: true, Token: "token", CAFile: filepath.Join(t.TempDir(), "missing")}, "failed to read ca file"},
+		{"InvalidCAFile", Config{Enabled: true, Token: "token", CAFile: invalidCAFile}, "no valid certificates found"},
+		{"Upstream", Config{Enabled: true, Upstreams: []UpstreamConfig{{Site: "building-c", URL: "http://wol.example.org"}}}, ""},
+		{"Broadcast", Config{Enabled: true, Broadcasts: []BroadcastConfig{{Site: "building-d", Address: "192.168.2.255"}}}, ""},
+		{"InvalidUpstreamURL", Config{Enabled: true, Upstreams: []UpstreamConfig{{Site: "building-c", URL: "wol.example.org"}}}, "needs to be an absolute http or https url"},
+		{"UpstreamTokenOverHTTP", Config{Enabled: true, Upstreams: []UpstreamConfig{{Site: "building-c", URL: "http://wol.example.org", Token: "token"}}}, "needs to be an https url when a token is configured"},
+		{"UpstreamTokenOverHTTPS", Config{Enabled: true, Upstreams: []UpstreamConfig{{Site: "building-c", URL: "https://wol.example.org", Token: "token"}}}, ""},
+		{"NegativeUpstreamTimeout", Config{Enabled: true, Upstreams: []UpstreamConfig{{Site: "building-c", URL: "http://wol.example.org", Timeout: -1}}}, "can't be negative"},
+		{"InvalidBroadcastAddress", Config{Enabled: true, Broadcasts: []BroadcastConfig{{Site: "building-d", Address: "fe80::1"}}}, "needs to be an IPv4 address"},
+		{"AgentAndUpstream", Config{Enabled: true, Token: "token", Agents: []AgentConfig{{Site: "a", URL: "https://a.example.org"}}, Upstreams: []UpstreamConfig{{Site: "a", URL: "http://wol.example.org"}}}, "both an agent and an upstream"},
+		{"UpstreamAndBroadcast", Config{Enabled: true, Upstreams: []UpstreamConfig{{Site: "a", URL: "http://wol.example.org"}}, Broadcasts: []BroadcastConfig{{Site: "a", Address: "192.168.2.255"}}}, "both an upstream and a broadcast"},
+		{"SiteTokens", Config{Enabled: true, Tokens: map[string]string{"building-b": "b-token"}}, ""},
+		{"InvalidSiteTokenSite", Config{Enabled: true, Tokens: map[string]string{"building b": "b-token"}}, "invalid site 'building b' in tokens"},
+		{"EmptySiteToken", Config{Enabled: true, Tokens: map[string]string{"building-b": ""}}, "empty token for site 'building-b'"},
+		{"DuplicateBroadcast", Config{Enabled: true, Broadcasts: []BroadcastConfig{{Site: "a", Address: "192.168.2.255"}, {Site: "a", Address: "192.168.3.255"}}}, "multiple broadcasts configured for site 'a'"},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			r, err := NewRelay(tCase.Config)
+			if tCase.Error == "" {
+				assert.NoError(t, err, "Should create relay")
+				assert.NotNil(t, r, "Should return relay")
+			} else {
+				assert.ErrorContains(t, err, tCase.Error, "Should fail to create relay")
+			}
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		r, err := NewRelay(Config{Token: "token"})
+		assert.NoError(t, err, "Should not fail")
+		assert.Nil(t, r, "Should not create a relay when disabled")
+	})
+	t.Run("ReadTokenFile", func(t *testing.T) {
+		r, err := NewRelay(Config{Enabled: true, TokenFile: tokenFile})
+		require.NoError(t, err, "Should create relay")
+		assert.True(t, r.Authorized("building-b", "file-token"), "Should use the token from the file without trailing newline")
+	})
+}
+
+func TestAuthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	r, err := NewRelay(Config{Enabled: true, Token: "token", Tokens: map[string]string{"building-b": "b-token"}})
+	require.NoError(t, err, "Should create relay")
+
+	assert.True(r.Authorized("building-a", "token"), "Should accept the shared token")
+	assert.False(r.Authorized("building-a", "other"), "Should reject other tokens")
+	assert.False(r.Authorized("building-a", ""), "Should reject an empty token")
+	assert.False(r.Authorized("building-a", "b-token"), "Should not accept the token of another site")
+	assert.True(r.Authorized("building-b", "b-token"), "Should accept the token of the site")
+	assert.False(r.Authorized("building-b", "token"), "Should not accept the shared token for a site with its own token")
+
+	r, err = NewRelay(Config{Enabled: true, Agents: []AgentConfig{{Site: "a", URL: "https://a.example.org", Token: "agent-token"}}})
+	require.NoError(t, err, "Should create relay")
+	assert.False(r.Authorized("b", ""), "Should reject registrations without a token configured")
+}
+
+func TestRegister(t *testing.T) {
+	assert := assert.New(t)
+
+	r, err := NewRelay(Config{Enabled: true, Token: "token", Agents: []AgentConfig{{Site: "building-a", URL: "https://a.example.org/"}}})
+	require.NoError(t, err, "Should create relay")
+
+	assert.ErrorIs(r.Register("wrong", RegisterRequest{Site: "building-b", URL: "https://b.example.org"}), ErrUnauthorized, "Should require a valid token")
+	assert.ErrorContains(r.Register("token", RegisterRequest{Site: "building-a", URL: "https://other.example.org"}), "configured on the server", "Should not replace static agents")
+	assert.ErrorContains(r.Register("token", RegisterRequest{Site: "", URL: "https://b.example.org"}), "invalid site", "Should require a site")
+	assert.ErrorContains(r.Register("token", RegisterRequest{Site: "building-b", URL: "b.example.org"}), "https url", "Should require an absolute url")
+
+	require.NoError(t, r.Register("token", RegisterRequest{Site: "building-b", URL: "https://b.example.org/"}), "Should register agent")
+
+	agents := r.Agents()
+	require.Len(t, agents, 2, "Should return both agents")
+	assert.Equal(AgentStatus{Site: "building-a", Type: RouteTypeAgent, URL: "https://a.example.org", Static: true}, agents[0], "Should return static agent first")
+	assert.Equal("https://b.example.org", agents[1].URL, "Should trim the trailing slash")
+	assert.WithinDuration(time.Now().Add(AgentTTL), agents[1].Expires, time.Second, "Should expire after the ttl")
+
+	a, ok := r.agent("building-b")
+	assert.True(ok, "Should find registered agent")
+	assert.Equal("token", a.token, "Should use the relay token for registered agents")
+
+	// Let the registration expire
+	r.registered["building-b"] = agent{url: "https://b.example.org", token: "token", expires: time.Now().Add(-time.Second)}
+	_, ok = r.agent("building-b")
+	assert.False(ok, "Should ignore expired registrations")
+	assert.Len(r.Agents(), 1, "Should not list expired registrations")
+}
+
+func TestRegisterTakeover(t *testing.T) {
+	assert := assert.New(t)
+
+	r, err := NewRelay(Config{Enabled: true, Token: "token", Tokens: map[string]string{"building-b": "b-token"}})
+	require.NoError(t, err, "Should create relay")
+
+	require.NoError(t, r.Register("token", RegisterRequest{Site: "building-a", URL: "https://a.example.org"}), "Should register agent with the shared token")
+	assert.NoError(r.Register("token", RegisterRequest{Site: "building-a", URL: "https://a.example.org/"}), "Should renew the registration")
+	assert.ErrorIs(r.Register("token", RegisterRequest{Site: "building-a", URL: "https://attacker.example.org"}), ErrSiteRegistered, "Should not replace an active agent with the shared token")
+	a, _ := r.agent("building-a")
+	assert.Equal("https://a.example.org", a.url, "Should keep the original agent")
+
+	r.registered["building-a"] = agent{url: "https://a.example.org", token: "token", expires: time.Now().Add(-time.Second)}
+	assert.NoError(r.Register("token", RegisterRequest{Site: "building-a", URL: "https://new-a.example.org"}), "Should replace an expired registration")
+
+	assert.ErrorIs(r.Register("token", RegisterRequest{Site: "building-b", URL: "https://attacker.example.org"}), ErrUnauthorized, "Should not accept the shared token for a site with its own token")
+	require.NoError(t, r.Register("b-token", RegisterRequest{Site: "building-b", URL: "https://b.example.org"}), "Should register with the token of the site")
+	assert.NoError(r.Register("b-token", RegisterRequest{Site: "building-b", URL: "https://b2.example.org"}), "Should allow replacing the agent with the token of the site")
+	a, _ = r.agent("building-b")
+	assert.Equal(agent{url: "https://b2.example.org", token: "b-token", expires: a.expires}, a, "Should send the token of the site to the agent")
+	assert.ErrorIs(r.Register("b-token", RegisterRequest{Site: "building-c", URL: "https://c.example.org"}), ErrUnauthorized, "Should not accept the token of a site for other sites")
+}
+
+func TestWake(t *testing.T) {
+	var received []WakeRequest
+	srv, caFile := newTLSServer(t, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Path != "/wake" || req.Header.Get("Authorization") != "Bearer agent-token" {
+			res.WriteHeader(http.StatusUnauthorized)
+			_, _ = res.Write([]byte(`{"status":"error","reason":"Invalid token"}`))
+			return
+		}
+		var wakeReq WakeRequest
+		_ = json.NewDecoder(req.Body).Decode(&wakeReq)
+		received = append(received, wakeReq)
+		_, _ = res.Write([]byte(`{"status":"ok"}`))
+	}))
+
+	t.Run("Success", func(t *testing.T) {
+		r, err := NewRelay(Config{Enabled: true, Agents: []AgentConfig{{Site: "building-b", URL: srv.URL, Token: "agent-token"}}, CAFile: caFile})
+		require.NoError(t, err, "Should create relay")
+
+		assert.NoError(t, r.Wake(t.Context(), "building-b", "AA:BB:CC:DD:EE:FF"), "Should forward wake")
+		assert.Equal(t, []WakeRequest{{MAC: "AA:BB:CC:DD:EE:FF"}}, received, "Agent should receive the MAC")
+	})
+	t.Run("NoAgent", func(t *testing.T) {
+		r, err := NewRelay(Config{Enabled: true, Token: "token"})
+		require.NoError(t, err, "Should create relay")
+
+		assert.ErrorIs(t, r.Wake(t.Context(), "building-b", "AA:BB:CC:DD:EE:FF"), ErrNoAgent, "Should fail without agent")
+	})
+	t.Run("WrongToken", func(t *testing.T) {
+		r, err := NewRelay(Config{Enabled: true, Token: "token", CAFile: caFile})
+		require.NoError(t, err, "Should create relay")
+		require.NoError(t, r.Register("token", RegisterRequest{Site: "building-b", URL: srv.URL}), "Should register agent")
+
+		err = r.Wake(t.Context(), "building-b", "AA:BB:CC:DD:EE:FF")
+		assert.ErrorContains(t, err, "agent responded with status 401: Invalid token", "Should return the error of the agent")
+	})
+	t.Run("UntrustedCertificate", func(t *testing.T) {
+		r, err := NewRelay(Config{Enabled: true, Agents: []AgentConfig{{Site: "building-b", URL: srv.URL, Token: "agent-token"}}})
+		require.NoError(t, err, "Should create relay")
+
+		assert.ErrorContains(t, r.Wake(t.Context(), "building-b", "AA:BB:CC:DD:EE:FF"), "failed to send request to agent", "Should verify the certificate of the agent")
+	})
+}
+
+func TestBearerToken(t *testing.T) {
+	assert := assert.New(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Empty(BearerToken(req), "Should return empty without header")
+
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	assert.Empty(BearerToken(req), "Should ignore other schemes")
+
+	req.Header.Set("Authorization", "Bearer token")
+	assert.Equal("token", BearerToken(req), "Should return the token")
+}
@@ -0,0 +1,269 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/utils"
+)
+
+const (
+	DEFAULT_UPSTREAM_TIMEOUT               = 5 * time.Second
+	DEFAULT_UPSTREAM_ATTEMPTS              = 3
+	DEFAULT_UPSTREAM_HEALTH_CHECK_INTERVAL = 30 * time.Second
+)
+
+// Header set on wakes forwarded to an upstream.
+// The upstream does not forward these wakes again, which prevents loops between servers.
+const ForwardedHeader = "X-Go-Wol-Forwarded"
+
+// Delay before the first retry of a failed wake, doubled for every further retry
+var retryDelay = 500 * time.Millisecond
+
+// Another go-wol server, wakes for the site are sent through its API
+type UpstreamConfig struct {
+	Site string `yaml:"site"`
+	// URL of the go-wol server, without the /api/v1 prefix
+	URL string `yaml:"url"`
+	// Sent as bearer token, e.g. for a reverse proxy in front of the server. Requires an https url.
+	Token string `yaml:"token,omitempty"`
+	// Timeout of a single attempt, defaults to 5s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// How often a wake is tried before giving up, defaults to 3
+	Attempts int `yaml:"attempts,omitempty"`
+	// Interval in which the server checks if the upstream is reachable, defaults to 30s
+	HealthCheckInterval time.Duration `yaml:"health-check-interval,omitempty"`
+}
+
+// Directed broadcast into the network of the site, needs to be routed by the network
+type BroadcastConfig struct {
+	Site string `yaml:"site"`
+	// The broadcast address of the remote network, e.g. 192.168.2.255
+	Address string `yaml:"address"`
+}
+
+// Returned by Wake when the upstream server responded with an error
+type UpstreamError struct {
+	StatusCode int
+	Reason     string
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("upstream responded with status %d: %s", e.StatusCode, e.Reason)
+}
+
+type upstream struct {
+	url      string
+	token    string
+	timeout  time.Duration
+	attempts int
+	interval time.Duration
+
+	lock      sync.RWMutex
+	healthy   bool
+	lastCheck time.Time
+	lastError string
+}
+
+// Check the upstream config and fill in the defaults
+func newUpstream(cfg UpstreamConfig) (*upstream, error) {
+	if !utils.ValidateSite(cfg.Site) {
+		return nil, fmt.Errorf("invalid site '%s', needs to be alphanumeric with '-', '_' or '.' in between and at most 63 characters", cfg.Site)
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url '%s': %w", cfg.URL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url '%s': needs to be an absolute http or https url", cfg.URL)
+	}
+	if cfg.Token != "" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid url '%s': needs to be an https url when a token is configured", cfg.URL)
+	}
+	if cfg.Timeout < 0 || cfg.Attempts < 0 || cfg.HealthCheckInterval < 0 {
+		return nil, fmt.Errorf("timeout, attempts and health-check-interval can't be negative")
+	}
+
+	up := &upstream{
+		url:      strings.TrimSuffix(cfg.URL, "/"),
+		token:    cfg.Token,
+		timeout:  cfg.Timeout,
+		attempts: cfg.Attempts,
+		interval: cfg.HealthCheckInterval,
+		// Assume the upstream is reachable until the first check says otherwise
+		healthy: true,
+	}
+	if up.timeout == 0 {
+		up.timeout = DEFAULT_UPSTREAM_TIMEOUT
+	}
+	if up.attempts == 0 {
+		up.attempts = DEFAULT_UPSTREAM_ATTEMPTS
+	}
+	if up.interval == 0 {
+		up.interval = DEFAULT_UPSTREAM_HEALTH_CHECK_INTERVAL
+	}
+	return up, nil
+}
+
+// Check that the site is valid and the address is an IPv4 address
+func validateBroadcast(cfg BroadcastConfig) error {
+	if !utils.ValidateSite(cfg.Site) {
+		return fmt.Errorf("invalid site '%s', needs to be alphanumeric with '-', '_' or '.' in between and at most 63 characters", cfg.Site)
+	}
+	ip := net.ParseIP(cfg.Address)
+	if ip == nil || ip.To4() == nil {
+		return fmt.Errorf("invalid broadcast address '%s', needs to be an IPv4 address", cfg.Address)
+	}
+	return nil
+}
+
+// Send the wake through the API of the upstream.
+// Network errors and server errors are retried, client errors and detected loops are returned directly.
+// When the upstream failed its last health check, the wake is only tried once.
+func (up *upstream) wake(ctx context.Context, client *http.Client, mac string) error {
+	attempts := up.attempts
+	if !up.isHealthy() {
+		attempts = 1
+	}
+
+	delay := retryDelay
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		err = up.wakeOnce(ctx, client, mac)
+		var upstreamErr *UpstreamError
+		if err == nil || ctx.Err() != nil || (errors.As(err, &upstreamErr) && (upstreamErr.StatusCode < http.StatusInternalServerError || upstreamErr.StatusCode == http.StatusLoopDetected)) {
+			return err
+		}
+		slog.Debug("Failed to send wake to upstream", slog.String("url", up.url), slog.Int("attempt", attempt), "err", err)
+	}
+	return err
+}
+
+func (up *upstream) wakeOnce(ctx context.Context, client *http.Client, mac string) error {
+	ctx, cancel := context.WithTimeout(ctx, up.timeout)
+	defer cancel()
+
+	res, err := up.get(ctx, client, "/api/v1/wake/"+url.PathEscape(mac))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var response struct {
+			Reason string `json:"reason"`
+		}
+		data, _ := io.ReadAll(res.Body)
+		_ = json.Unmarshal(data, &response)
+		return &UpstreamError{StatusCode: res.StatusCode, Reason: response.Reason}
+	}
+	return nil
+}
+
+// Check if the API of the upstream is reachable and remember the result
+func (up *upstream) check(ctx context.Context, client *http.Client) {
+	checkCtx, cancel := context.WithTimeout(ctx, up.timeout)
+	defer cancel()
+
+	res, err := up.get(checkCtx, client, "/api/v1/hosts?limit=1")
+	if err == nil {
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			err = fmt.Errorf("upstream responded with status %d", res.StatusCode)
+		}
+	}
+	// Don't mark the upstream as unhealthy because the server is shutting down
+	if ctx.Err() != nil {
+		return
+	}
+
+	up.lock.Lock()
+	defer up.lock.Unlock()
+
+	if err != nil && up.healthy {
+		slog.Warn("Upstream failed the health check", slog.String("url", up.url), "err", err)
+	} else if err == nil && !up.healthy {
+		slog.Info("Upstream is healthy again", slog.String("url", up.url))
+	}
+	up.healthy = err == nil
+	up.lastCheck = time.Now()
+	up.lastError = ""
+	if err != nil {
+		up.lastError = err.Error()
+	}
+}
+
+// Check the upstream every health check interval until the context is canceled
+func (up *upstream) healthCheckLoop(ctx context.Context, client *http.Client) {
+	ticker := time.NewTicker(up.interval)
+	defer ticker.Stop()
+
+	for {
+		up.check(ctx, client)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (up *upstream) get(ctx context.Context, client *http.Client, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, up.url+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if up.token != "" {
+		req.Header.Set("Authorization", "Bearer "+up.token)
+	}
+	req.Header.Set(ForwardedHeader, "1")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to upstream: %w", err)
+	}
+	return res, nil
+}
+
+func (up *upstream) isHealthy() bool {
+	up.lock.RLock()
+	defer up.lock.RUnlock()
+	return up.healthy
+}
+
+// Return the status of the upstream for the list of relays
+func (up *upstream) status(site string) AgentStatus {
+	up.lock.RLock()
+	defer up.lock.RUnlock()
+
+	healthy := up.healthy
+	return AgentStatus{
+		Site:      site,
+		Type:      RouteTypeUpstream,
+		URL:       up.url,
+		Static:    true,
+		Healthy:   &healthy,
+		LastCheck: up.lastCheck,
+		Error:     up.lastError,
+	}
+}
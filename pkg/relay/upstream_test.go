@@ -0,0 +1,180 @@
+package relay
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamWake(t *testing.T) {
+	oldRetryDelay := retryDelay
+	retryDelay = time.Millisecond
+	t.Cleanup(func() {
+		retryDelay = oldRetryDelay
+	})
+
+	var requests atomic.Int32
+	srv, caFile := newTLSServer(t, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		if req.Header.Get("Authorization") != "Bearer upstream-token" {
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.Header.Get(ForwardedHeader) == "" {
+			res.WriteHeader(http.StatusInternalServerError)
+			_, _ = res.Write([]byte(`{"status":"error","reason":"Missing forwarded header"}`))
+			return
+		}
+		switch req.URL.Path {
+		case "/api/v1/wake/33:33:33:33:33:33":
+			res.WriteHeader(http.StatusLoopDetected)
+			_, _ = res.Write([]byte(`{"status":"error","reason":"Wake has already been forwarded"}`))
+		case "/api/v1/wake/AA:BB:CC:DD:EE:FF":
+			_, _ = res.Write([]byte(`{"status":"ok"}`))
+		case "/api/v1/wake/11:11:11:11:11:11":
+			res.WriteHeader(http.StatusInternalServerError)
+			_, _ = res.Write([]byte(`{"status":"error","reason":"Failed to send magic packet"}`))
+		case "/api/v1/wake/22:22:22:22:22:22":
+			time.Sleep(200 * time.Millisecond)
+			_, _ = res.Write([]byte(`{"status":"ok"}`))
+		default:
+			res.WriteHeader(http.StatusBadRequest)
+			_, _ = res.Write([]byte(`{"status":"error","reason":"Invalid MAC address"}`))
+		}
+	}))
+
+	newTestRelay := func(t *testing.T, cfg UpstreamConfig) *Relay {
+		cfg.Site = "building-c"
+		if cfg.URL == "" {
+			cfg.URL = srv.URL + "/"
+		}
+		cfg.Token = "upstream-token"
+		r, err := NewRelay(Config{Enabled: true, CAFile: caFile, Upstreams: []UpstreamConfig{cfg}})
+		require.NoError(t, err, "Should create relay")
+		requests.Store(0)
+		return r
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		r := newTestRelay(t, UpstreamConfig{})
+
+		assert.NoError(t, r.Wake(t.Context(), "building-c", "AA:BB:CC:DD:EE:FF"), "Should wake through the upstream")
+		assert.Equal(t, int32(1), requests.Load(), "Should only send one request")
+	})
+	t.Run("RetryServerError", func(t *testing.T) {
+		r := newTestRelay(t, UpstreamConfig{})
+
+		err := r.Wake(t.Context(), "building-c", "11:11:11:11:11:11")
+		var upstreamErr *UpstreamError
+		require.ErrorAs(t, err, &upstreamErr, "Should return the error of the upstream")
+		assert.Equal(t, &UpstreamError{StatusCode: http.StatusInternalServerError, Reason: "Failed to send magic packet"}, upstreamErr)
+		assert.Equal(t, int32(DEFAULT_UPSTREAM_ATTEMPTS), requests.Load(), "Should retry server errors")
+	})
+	t.Run("NoRetryClientError", func(t *testing.T) {
+		r := newTestRelay(t, UpstreamConfig{})
+
+		err := r.Wake(t.Context(), "building-c", "not-a-mac")
+		var upstreamErr *UpstreamError
+		require.ErrorAs(t, err, &upstreamErr, "Should return the error of the upstream")
+		assert.Equal(t, http.StatusBadRequest, upstreamErr.StatusCode)
+		assert.Equal(t, "Invalid MAC address", upstreamErr.Reason)
+		assert.Equal(t, int32(1), requests.Load(), "Should not retry client errors")
+	})
+	t.Run("NoRetryLoop", func(t *testing.T) {
+		r := newTestRelay(t, UpstreamConfig{})
+
+		err := r.Wake(t.Context(), "building-c", "33:33:33:33:33:33")
+		var upstreamErr *UpstreamError
+		require.ErrorAs(t, err, &upstreamErr, "Should return the error of the upstream")
+		assert.Equal(t, http.StatusLoopDetected, upstreamErr.StatusCode)
+		assert.Equal(t, int32(1), requests.Load(), "Should not retry a loop")
+	})
+	t.Run("Timeout", func(t *testing.T) {
+		r := newTestRelay(t, UpstreamConfig{Timeout: 50 * time.Millisecond, Attempts: 2})
+
+		err := r.Wake(t.Context(), "building-c", "22:22:22:22:22:22")
+		assert.ErrorContains(t, err, "failed to send request to upstream", "Should time out")
+		assert.Equal(t, int32(2), requests.Load(), "Should retry after a timeout")
+	})
+	t.Run("Unreachable", func(t *testing.T) {
+		unreachable := httptest.NewTLSServer(http.NotFoundHandler())
+		unreachable.Close()
+		r := newTestRelay(t, UpstreamConfig{URL: unreachable.URL, Attempts: 2})
+
+		err := r.Wake(t.Context(), "building-c", "AA:BB:CC:DD:EE:FF")
+		assert.ErrorContains(t, err, "failed to send request to upstream", "Should fail to reach the upstream")
+	})
+	t.Run("Unhealthy", func(t *testing.T) {
+		r := newTestRelay(t, UpstreamConfig{})
+		r.upstreams["building-c"].healthy = false
+
+		_ = r.Wake(t.Context(), "building-c", "11:11:11:11:11:11")
+		assert.Equal(t, int32(1), requests.Load(), "Should only try an unhealthy upstream once")
+	})
+}
+
+func TestUpstreamHealthCheck(t *testing.T) {
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if !healthy.Load() || req.URL.Path != "/api/v1/hosts" {
+			res.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = res.Write([]byte(`[]`))
+	}))
+	t.Cleanup(srv.Close)
+
+	r, err := NewRelay(Config{Enabled: true, Upstreams: []UpstreamConfig{{Site: "building-c", URL: srv.URL}}})
+	require.NoError(t, err, "Should create relay")
+	up := r.upstreams["building-c"]
+
+	assert := assert.New(t)
+
+	status := r.Agents()[0]
+	require.NotNil(t, status.Healthy)
+	assert.True(*status.Healthy, "Should be healthy before the first check")
+	assert.True(status.LastCheck.IsZero(), "Should not have been checked yet")
+
+	up.check(t.Context(), r.upstreamClient)
+	status = r.Agents()[0]
+	assert.False(*status.Healthy, "Should be unhealthy after a failed check")
+	assert.Equal("upstream responded with status 503", status.Error)
+	assert.WithinDuration(time.Now(), status.LastCheck, time.Second, "Should update the time of the last check")
+
+	healthy.Store(true)
+	up.check(t.Context(), r.upstreamClient)
+	status = r.Agents()[0]
+	assert.True(*status.Healthy, "Should be healthy again")
+	assert.Empty(status.Error, "Should clear the error")
+
+	healthy.Store(false)
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	up.check(ctx, r.upstreamClient)
+	assert.True(*r.Agents()[0].Healthy, "Should not mark the upstream as unhealthy when shutting down")
+}
+
+func TestBroadcastWake(t *testing.T) {
+	assert := assert.New(t)
+
+	r, err := NewRelay(Config{Enabled: true, Token: "token", Broadcasts: []BroadcastConfig{{Site: "building-d", Address: "192.168.2.255"}}})
+	require.NoError(t, err, "Should create relay")
+
+	var sent []string
+	r.send = func(mac, bcAddr string) error {
+		sent = append(sent, mac+"@"+bcAddr)
+		return nil
+	}
+
+	assert.NoError(r.Wake(t.Context(), "building-d", "AA:BB:CC:DD:EE:FF"), "Should send the magic packet")
+	assert.Equal([]string{"AA:BB:CC:DD:EE:FF@192.168.2.255"}, sent, "Should send to the broadcast address of the site")
+
+	assert.ErrorContains(r.Register("token", RegisterRequest{Site: "building-d", URL: "https://d.example.org"}), "configured on the server", "Should not allow agents to register for the site")
+	assert.Equal([]AgentStatus{{Site: "building-d", Type: RouteTypeBroadcast, Address: "192.168.2.255", Static: true}}, r.Agents(), "Should list the broadcast")
+}
@@ -12,50 +12,113 @@ package v1
 //	@produce	json
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/heathcliff26/go-wol/pkg/discovery"
+	"github.com/heathcliff26/go-wol/pkg/leases"
 	"github.com/heathcliff26/go-wol/pkg/ping"
+	"github.com/heathcliff26/go-wol/pkg/relay"
 	"github.com/heathcliff26/go-wol/pkg/server/storage"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/format"
 	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
 	"github.com/heathcliff26/go-wol/pkg/utils"
 	"github.com/heathcliff26/go-wol/pkg/wol"
 )
 
+// Interval for sending comments on idle event streams, so proxies do not close the connection
+const eventsKeepAliveInterval = 30 * time.Second
+
 type Response struct {
 	Status string `json:"status"`
 	Reason string `json:"reason"`
 }
 
+// Request to change the order of the hosts.
+// Either order or mac has to be set, if both are set order takes precedence.
+type HostOrderRequest struct {
+	// Full list of MAC addresses in the new order.
+	// Hosts not contained in the list keep their relative order after the listed hosts.
+	Order []string `json:"order,omitempty" validate:"optional" example:"AA:BB:CC:DD:EE:FF,11:22:33:44:55:66"`
+	// MAC address of a single host to move.
+	MAC string `json:"mac,omitempty" validate:"optional" example:"AA:BB:CC:DD:EE:FF"`
+	// The new index of the host given by mac.
+	Index int `json:"index,omitempty" validate:"optional" example:"0"`
+}
+
+// Optional features of the API
+type Options struct {
+	// Lease files and neighbor tables to propose hosts from
+	Leases []leases.Source
+	// Scanner for the network discovery, discovery is disabled when nil
+	Discovery *discovery.Scanner
+	// Relay for waking hosts on remote sites, relaying is disabled when nil
+	Relay *relay.Relay
+}
+
 type apiHandler struct {
-	storage *storage.Storage
+	storage   *storage.Storage
+	leases    []leases.Source
+	discovery *discovery.Scanner
+	relay     *relay.Relay
+	status    *statusCache
 }
 
-func NewRouter(storage *storage.Storage) *http.ServeMux {
+func NewRouter(storage *storage.Storage, opts Options) *http.ServeMux {
 	handler := &apiHandler{
-		storage: storage,
+		storage:   storage,
+		leases:    opts.Leases,
+		discovery: opts.Discovery,
+		relay:     opts.Relay,
+		status:    newStatusCache(),
 	}
+	// Stops when the storage is closed
+	events, _ := storage.Subscribe()
+	go handler.status.watch(events)
 
 	router := http.NewServeMux()
-	router.HandleFunc("GET /wake/{macAddr}", WakeHandler)
+	router.HandleFunc("GET /wake/{macAddr}", handler.WakeHandler)
 	router.HandleFunc("GET /hosts", handler.GetHostsHandler)
 	router.HandleFunc("PUT /hosts", handler.AddHostHandler)
+	router.HandleFunc("PUT /hosts/order", handler.HostOrderHandler)
 	router.HandleFunc("DELETE /hosts/{macAddr}", handler.RemoveHostHandler)
 	router.HandleFunc("GET /hosts/status", handler.HostStatusHandler)
+	router.HandleFunc("GET /hosts/export", handler.ExportHostsHandler)
+	router.HandleFunc("POST /hosts/import", handler.ImportHostsHandler)
+	router.HandleFunc("GET /hosts/leases", handler.LeasesHandler)
+	router.HandleFunc("GET /hosts/discover", handler.DiscoverHandler)
+	router.HandleFunc("GET /events", handler.EventsHandler)
+	router.HandleFunc("GET /agents", handler.GetAgentsHandler)
+	router.HandleFunc("PUT /agents", handler.RegisterAgentHandler)
 	return router
 }
 
 // @Summary		Wake up host
-// @Description	Send a magic packet to the specified MAC address
+// @Description	Send a magic packet to the specified MAC address.
+// @Description	For known hosts assigned to a site, the relay agent of the site sends the magic packet instead.
+// @Description	Sites can also be configured with an upstream go-wol server or with a directed broadcast address.
+// @Description	Wakes forwarded to an upstream carry the X-Go-Wol-Forwarded header and are not forwarded again.
 //
 // @Produce		json
 // @Param			macAddr	path		string		true	"MAC address of the host"
 // @Success		200		{object}	Response	"ok"
 // @Failure		400		{object}	Response	"Invalid MAC address"
 // @Failure		500		{object}	Response	"Failed to send magic packet"
+// @Failure		502		{object}	Response	"Failed to forward the wake to the relay agent or upstream"
+// @Failure		503		{object}	Response	"No relay agent available for the site of the host"
+// @Failure		508		{object}	Response	"Wake has already been forwarded by another server"
 // @Router			/wake/{macAddr} [get]
-func WakeHandler(res http.ResponseWriter, req *http.Request) {
+func (h *apiHandler) WakeHandler(res http.ResponseWriter, req *http.Request) {
 	macAddr := req.PathValue("macAddr")
 
 	packet, err := wol.CreatePacket(macAddr)
@@ -66,6 +129,16 @@ func WakeHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	host, err := h.storage.GetHost(req.Context(), normalizeMAC(macAddr))
+	if err != nil {
+		// Unknown hosts are woken locally as well, so continue instead of failing
+		slog.Warn("Failed to look up the site of the host, sending magic packet locally", slog.String("mac", macAddr), "err", err)
+	}
+	if host.Site != "" {
+		h.relayWake(res, req, host)
+		return
+	}
+
 	err = packet.Send("")
 	if err != nil {
 		slog.Info("Failed to send magic packet", slog.String("mac", macAddr), slog.Any("error", err))
@@ -78,15 +151,95 @@ func WakeHandler(res http.ResponseWriter, req *http.Request) {
 	sendResponse(res, "")
 }
 
+// Forward the wake to the relay agent, upstream or broadcast address of the site of the host
+func (h *apiHandler) relayWake(res http.ResponseWriter, req *http.Request, host types.Host) {
+	if h.relay == nil {
+		slog.Info("Can't wake host on remote site, the relay is disabled", slog.String("mac", host.MAC), slog.String("site", host.Site))
+		res.WriteHeader(http.StatusServiceUnavailable)
+		sendResponse(res, fmt.Sprintf("No relay agent available for site '%s'", host.Site))
+		return
+	}
+
+	if req.Header.Get(relay.ForwardedHeader) != "" {
+		slog.Warn("Rejected wake forwarded by another server, the upstreams of the site form a loop", slog.String("mac", host.MAC), slog.String("site", host.Site))
+		res.WriteHeader(http.StatusLoopDetected)
+		sendResponse(res, fmt.Sprintf("Wake has already been forwarded by another server, not forwarding it to site '%s' again", host.Site))
+		return
+	}
+
+	err := h.relay.Wake(req.Context(), host.Site, host.MAC)
+	var upstreamErr *relay.UpstreamError
+	if errors.As(err, &upstreamErr) {
+		slog.Info("Upstream failed to wake host", slog.String("mac", host.MAC), slog.String("site", host.Site), "err", err)
+		// Only an invalid MAC address is the fault of the client, everything else is an error of the upstream
+		if upstreamErr.StatusCode == http.StatusBadRequest {
+			res.WriteHeader(http.StatusBadRequest)
+			sendResponse(res, upstreamErr.Reason)
+			return
+		}
+		reason := fmt.Sprintf("Upstream of site '%s' responded with status %d", host.Site, upstreamErr.StatusCode)
+		if upstreamErr.Reason != "" {
+			reason += ": " + upstreamErr.Reason
+		}
+		res.WriteHeader(http.StatusBadGateway)
+		sendResponse(res, reason)
+		return
+	} else if errors.Is(err, relay.ErrNoAgent) {
+		slog.Info("No relay agent available for the site of the host", slog.String("mac", host.MAC), slog.String("site", host.Site))
+		res.WriteHeader(http.StatusServiceUnavailable)
+		sendResponse(res, fmt.Sprintf("No relay agent available for site '%s'", host.Site))
+		return
+	} else if err != nil {
+		slog.Warn("Failed to forward wake to relay agent", slog.String("mac", host.MAC), slog.String("site", host.Site), "err", err)
+		res.WriteHeader(http.StatusBadGateway)
+		sendResponse(res, fmt.Sprintf("Failed to forward the wake to the relay agent of site '%s'", host.Site))
+		return
+	}
+
+	slog.Info("Forwarded magic packet to relay agent", slog.String("mac", host.MAC), slog.String("site", host.Site))
+	sendResponse(res, "")
+}
+
 // @Summary		Get hosts
-// @Description	Fetch all known hosts
+// @Description	Fetch all known hosts, optionally searched, filtered by their metadata, sorted and paginated
 //
 // @Produce		json
-// @Success		200	{object}	[]types.Host	"List of all known hosts"
-// @Failure		500	{object}	Response		"Failed to retrieve hosts from storage"
+// @Param			q			query		string			false	"Only return hosts with the text in their name, display name, MAC or address, case insensitive"
+// @Param			tag			query		[]string		false	"Only return hosts with all of the tags, case insensitive"	collectionFormat(multi)
+// @Param			location	query		string			false	"Only return hosts in the location, case insensitive"
+// @Param			group		query		string			false	"Only return hosts in the group, which are the locations and tags of the hosts, case insensitive"
+// @Param			label		query		[]string		false	"Only return hosts with all of the labels, given as key=value to match the value, key= to match an empty value or only key to match any value"	collectionFormat(multi)
+// @Param			sort		query		string			false	"Sort the hosts instead of returning them in the configured order. Status and last-seen only use the status checks of this instance, hosts not checked yet are sorted last"	Enums(name, status, last-seen)
+// @Param			limit		query		int				false	"Maximum number of hosts to return, 0 returns all"	minimum(0)
+// @Param			offset		query		int				false	"Number of hosts to skip"	minimum(0)
+// @Success		200			{object}	[]types.Host	"List of all known hosts"
+// @Header			200			{integer}	X-Total-Count	"Number of hosts matching the search and filters, before pagination"
+// @Failure		400			{object}	Response		"Invalid sort, limit or offset"
+// @Failure		500			{object}	Response		"Failed to retrieve hosts from storage"
 // @Router			/hosts [get]
 func (h *apiHandler) GetHostsHandler(res http.ResponseWriter, req *http.Request) {
-	hosts, err := h.storage.GetHosts()
+	query := req.URL.Query()
+
+	sortBy := query.Get("sort")
+	if sortBy != "" && !slices.Contains([]string{SortByName, SortByStatus, SortByLastSeen}, sortBy) {
+		res.WriteHeader(http.StatusBadRequest)
+		sendResponse(res, "Invalid sort, needs to be one of name, status, last-seen")
+		return
+	}
+	limit, err := nonNegativeQueryInt(query.Get("limit"))
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		sendResponse(res, "Invalid limit, needs to be a non-negative number")
+		return
+	}
+	offset, err := nonNegativeQueryInt(query.Get("offset"))
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		sendResponse(res, "Invalid offset, needs to be a non-negative number")
+		return
+	}
+
+	hosts, err := h.storage.GetHosts(req.Context())
 	if err != nil {
 		slog.Error("Failed to fetch hosts", "error", err)
 		res.WriteHeader(http.StatusInternalServerError)
@@ -94,6 +247,15 @@ func (h *apiHandler) GetHostsHandler(res http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	hosts = types.FilterHosts(hosts, hostFilterFromQuery(req))
+	h.status.sortHosts(hosts, sortBy)
+
+	res.Header().Set("X-Total-Count", strconv.Itoa(len(hosts)))
+	hosts = hosts[min(offset, len(hosts)):]
+	if limit > 0 && limit < len(hosts) {
+		hosts = hosts[:limit]
+	}
+
 	sendJSONResponse(res, hosts)
 }
 
@@ -104,7 +266,7 @@ func (h *apiHandler) GetHostsHandler(res http.ResponseWriter, req *http.Request)
 // @Produce		json
 // @Param			payload	body		types.Host	true	"New host to add"
 // @Success		200		{object}	Response	"ok"
-// @Failure		400		{object}	Response	"Invalid MAC address or hostname"
+// @Failure		400		{object}	Response	"Invalid MAC address, hostname or metadata"
 // @Failure		403		{object}	Response	"Storage is readonly"
 // @Failure		500		{object}	Response	"Failed to add host"
 // @Router			/hosts [put]
@@ -139,7 +301,15 @@ func (h *apiHandler) AddHostHandler(res http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	err = h.storage.AddHost(host)
+	err = utils.ValidateHostMetadata(host)
+	if err != nil {
+		slog.Debug("Client send invalid host metadata", slog.String("mac", host.MAC), "error", err)
+		res.WriteHeader(http.StatusBadRequest)
+		sendResponse(res, "Invalid host metadata: "+err.Error())
+		return
+	}
+
+	err = h.storage.AddHost(req.Context(), host)
 	if err != nil {
 		slog.Error("Failed to add host", "host", host, "error", err)
 		res.WriteHeader(http.StatusInternalServerError)
@@ -178,7 +348,7 @@ func (h *apiHandler) RemoveHostHandler(res http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	err := h.storage.RemoveHost(macAddr)
+	err := h.storage.RemoveHost(req.Context(), macAddr)
 	if err != nil {
 		slog.Error("Failed to remove host", "mac", macAddr, "error", err)
 		res.WriteHeader(http.StatusInternalServerError)
@@ -190,15 +360,86 @@ func (h *apiHandler) RemoveHostHandler(res http.ResponseWriter, req *http.Reques
 	sendResponse(res, "")
 }
 
+// @Summary		Change host order
+// @Description	Move a single host to a new index or set the order of all hosts
+//
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		HostOrderRequest	true	"The new order"
+// @Success		200		{object}	Response			"ok"
+// @Failure		400		{object}	Response			"Invalid request or MAC address"
+// @Failure		403		{object}	Response			"Storage is readonly"
+// @Failure		404		{object}	Response			"Host not found"
+// @Failure		500		{object}	Response			"Failed to change order of hosts"
+// @Router			/hosts/order [put]
+func (h *apiHandler) HostOrderHandler(res http.ResponseWriter, req *http.Request) {
+	var order HostOrderRequest
+	err := json.NewDecoder(req.Body).Decode(&order)
+	if err != nil {
+		slog.Debug("Client sent invalid order json", "error", err)
+		res.WriteHeader(http.StatusBadRequest)
+		sendResponse(res, "Request body must be a valid order JSON object")
+		return
+	}
+
+	if h.storage.Readonly() {
+		slog.Debug("Client tried to change order of hosts while storage is readonly")
+		res.WriteHeader(http.StatusForbidden)
+		sendResponse(res, "Storage is readonly")
+		return
+	}
+
+	macs := order.Order
+	if len(macs) == 0 {
+		macs = []string{order.MAC}
+	}
+	seen := make(map[string]bool, len(macs))
+	for _, mac := range macs {
+		if !utils.ValidateMACAddress(mac) {
+			slog.Debug("Client send invalid MAC address", slog.String("mac", mac))
+			res.WriteHeader(http.StatusBadRequest)
+			sendResponse(res, "Invalid MAC address")
+			return
+		}
+		if seen[strings.ToUpper(mac)] {
+			slog.Debug("Client send duplicate MAC address", slog.String("mac", mac))
+			res.WriteHeader(http.StatusBadRequest)
+			sendResponse(res, "Duplicate MAC address")
+			return
+		}
+		seen[strings.ToUpper(mac)] = true
+	}
+
+	if len(order.Order) > 0 {
+		err = h.storage.ReorderHosts(req.Context(), order.Order)
+	} else {
+		err = h.storage.MoveHost(req.Context(), order.MAC, order.Index)
+	}
+	if errors.Is(err, types.ErrHostNotFound) {
+		slog.Debug("Client tried to change order of unknown host", "order", order, "error", err)
+		res.WriteHeader(http.StatusNotFound)
+		sendResponse(res, "Host not found")
+		return
+	} else if err != nil {
+		slog.Error("Failed to change order of hosts", "order", order, "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		sendResponse(res, "Failed to change order of hosts")
+		return
+	}
+
+	slog.Info("Changed order of hosts", "order", order)
+	sendResponse(res, "")
+}
+
 // @Summary		Get host status
-// @Description	Get the status of all hosts with an address to check if they are online
+// @Description	Get the status of all hosts with an address to check if they are online and when they were last seen online
 //
 // @Produce		json
 // @Success		200	{object}	[]types.HostStatus	"List of host statuses"
 // @Failure		500	{object}	Response			"Failed to fetch or ping hosts"
 // @Router			/hosts/status [get]
 func (h *apiHandler) HostStatusHandler(res http.ResponseWriter, req *http.Request) {
-	hosts, err := h.storage.GetHosts()
+	hosts, err := h.storage.GetHosts(req.Context())
 	if err != nil {
 		slog.Error("Failed to fetch hosts", "error", err)
 		res.WriteHeader(http.StatusInternalServerError)
@@ -213,7 +454,369 @@ func (h *apiHandler) HostStatusHandler(res http.ResponseWriter, req *http.Reques
 		}
 	}
 
-	sendJSONResponse(res, ping.PingHosts(hostsToCheck))
+	sendJSONResponse(res, h.status.update(ping.PingHosts(hostsToCheck)))
+}
+
+// @Summary		Export hosts
+// @Description	Download all known hosts as yaml, json or csv
+//
+// @Produce		application/yaml,json,text/csv
+// @Param			format	query		string		false	"Format of the export"	Enums(yaml, json, csv)	default(yaml)
+// @Success		200		{object}	[]types.Host	"List of all known hosts"
+// @Failure		400		{object}	Response		"Unknown format"
+// @Failure		500		{object}	Response		"Failed to export hosts"
+// @Router			/hosts/export [get]
+func (h *apiHandler) ExportHostsHandler(res http.ResponseWriter, req *http.Request) {
+	f := req.URL.Query().Get("format")
+	if f == "" {
+		f = format.FormatYAML
+	}
+	if !format.Valid(f) {
+		slog.Debug("Client requested unknown export format", slog.String("format", f))
+		res.WriteHeader(http.StatusBadRequest)
+		sendResponse(res, "Unknown format")
+		return
+	}
+
+	hosts, err := h.storage.GetHosts(req.Context())
+	if err != nil {
+		slog.Error("Failed to fetch hosts", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		sendResponse(res, "Failed to export hosts")
+		return
+	}
+
+	var buf bytes.Buffer
+	err = format.Encode(&buf, hosts, f)
+	if err != nil {
+		slog.Error("Failed to encode hosts", slog.String("format", f), "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		sendResponse(res, "Failed to export hosts")
+		return
+	}
+
+	res.Header().Set("Content-Type", format.ContentType(f))
+	res.Header().Set("Content-Disposition", "attachment; filename=\"hosts."+f+"\"")
+	_, err = res.Write(buf.Bytes())
+	if err != nil {
+		slog.Error("Failed to send export to client", "err", err)
+	}
+}
+
+// @Summary		Import hosts
+// @Description	Import hosts from a yaml, json or csv file.
+// @Description	All hosts are validated before any changes are made, if any of them is invalid the errors are returned per row.
+//
+// @Accept			application/yaml,json,text/csv
+// @Produce		json
+// @Param			format	query		string				false	"Format of the body, defaults to the content type or yaml"	Enums(yaml, json, csv)
+// @Param			mode	query		string				false	"Merge with or replace the existing hosts"					Enums(merge, replace)	default(merge)
+// @Param			dry-run	query		bool				false	"Only validate and return the changes without applying them"
+// @Param			payload	body		[]types.Host		true	"Hosts to import"
+// @Success		200		{object}	types.ImportResult	"Result of the import"
+// @Failure		400		{object}	types.ImportResult	"Invalid request or hosts"
+// @Failure		403		{object}	Response			"Storage is readonly"
+// @Failure		500		{object}	Response			"Failed to import hosts"
+// @Router			/hosts/import [post]
+func (h *apiHandler) ImportHostsHandler(res http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	f := query.Get("format")
+	if f == "" {
+		f = format.FromContentType(req.Header.Get("Content-Type"))
+	}
+	if f == "" {
+		f = format.FormatYAML
+	}
+	if !format.Valid(f) {
+		slog.Debug("Client requested unknown import format", slog.String("format", f))
+		res.WriteHeader(http.StatusBadRequest)
+		sendResponse(res, "Unknown format")
+		return
+	}
+
+	mode := types.ImportMode(query.Get("mode"))
+	if mode == "" {
+		mode = types.ImportModeMerge
+	}
+	if mode != types.ImportModeMerge && mode != types.ImportModeReplace {
+		slog.Debug("Client requested unknown import mode", slog.String("mode", string(mode)))
+		res.WriteHeader(http.StatusBadRequest)
+		sendResponse(res, "Unknown import mode")
+		return
+	}
+
+	dryRun := false
+	if value := query.Get("dry-run"); value != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			slog.Debug("Client sent invalid dry-run parameter", slog.String("dry-run", value))
+			res.WriteHeader(http.StatusBadRequest)
+			sendResponse(res, "Invalid dry-run parameter")
+			return
+		}
+	}
+
+	if h.storage.Readonly() && !dryRun {
+		slog.Debug("Client tried to import hosts while storage is readonly")
+		res.WriteHeader(http.StatusForbidden)
+		sendResponse(res, "Storage is readonly")
+		return
+	}
+
+	hosts, err := format.Decode(req.Body, f)
+	if err != nil {
+		slog.Debug("Client sent invalid hosts file", slog.String("format", f), "error", err)
+		res.WriteHeader(http.StatusBadRequest)
+		sendResponse(res, "Failed to parse hosts")
+		return
+	}
+
+	result, err := h.storage.ImportHosts(req.Context(), hosts, mode, dryRun)
+	if err != nil {
+		slog.Error("Failed to import hosts", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		sendResponse(res, "Failed to import hosts")
+		return
+	}
+	if len(result.Errors) > 0 {
+		slog.Debug("Client tried to import invalid hosts", "errors", result.Errors)
+		res.WriteHeader(http.StatusBadRequest)
+		sendJSONResponse(res, result)
+		return
+	}
+
+	if !dryRun {
+		slog.Info("Imported hosts", slog.String("mode", string(mode)), slog.Int("added", len(result.Added)), slog.Int("updated", len(result.Updated)), slog.Int("removed", len(result.Removed)))
+	}
+	sendJSONResponse(res, result)
+}
+
+// @Summary		Get hosts from leases
+// @Description	Read the configured DHCP lease files and neighbor tables and propose hosts from them.
+// @Description	Hosts that are already known are marked as such, new hosts can be added via PUT /hosts or POST /hosts/import.
+//
+// @Produce		json
+// @Success		200	{object}	[]leases.Proposal	"List of proposed hosts"
+// @Failure		500	{object}	Response			"Failed to read leases"
+// @Router			/hosts/leases [get]
+func (h *apiHandler) LeasesHandler(res http.ResponseWriter, req *http.Request) {
+	l, err := leases.ReadSources(h.leases)
+	if err != nil {
+		slog.Error("Failed to read leases", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		sendResponse(res, "Failed to read leases")
+		return
+	}
+
+	hosts, err := h.storage.GetHosts(req.Context())
+	if err != nil {
+		slog.Error("Failed to fetch hosts", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		sendResponse(res, "Failed to fetch hosts")
+		return
+	}
+
+	sendJSONResponse(res, leases.Proposals(l, hosts))
+}
+
+// @Summary		Discover hosts
+// @Description	Scan the configured networks for hosts that are not yet known.
+// @Description	The result of the scan is cached, new scans are rate limited.
+//
+// @Produce		json
+// @Param			refresh	query		bool				false	"Scan the network again instead of returning the cached result"
+// @Success		200		{object}	discovery.Result	"Hosts found on the network"
+// @Failure		400		{object}	Response			"Invalid refresh parameter"
+// @Failure		404		{object}	Response			"Discovery is not enabled"
+// @Failure		429		{object}	Response			"Scan is rate limited"
+// @Failure		500		{object}	Response			"Failed to discover hosts"
+// @Router			/hosts/discover [get]
+func (h *apiHandler) DiscoverHandler(res http.ResponseWriter, req *http.Request) {
+	if h.discovery == nil {
+		res.WriteHeader(http.StatusNotFound)
+		sendResponse(res, "Discovery is not enabled")
+		return
+	}
+
+	refresh := false
+	if value := req.URL.Query().Get("refresh"); value != "" {
+		var err error
+		refresh, err = strconv.ParseBool(value)
+		if err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			sendResponse(res, "Invalid refresh parameter")
+			return
+		}
+	}
+
+	result, err := h.discovery.Scan(req.Context(), refresh)
+	if errors.Is(err, discovery.ErrRateLimited) {
+		res.WriteHeader(http.StatusTooManyRequests)
+		sendResponse(res, "Scan is rate limited")
+		return
+	} else if req.Context().Err() != nil {
+		// The client is gone, the scan continues for other callers
+		return
+	} else if err != nil {
+		slog.Error("Failed to discover hosts", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		sendResponse(res, "Failed to discover hosts")
+		return
+	}
+
+	hosts, err := h.storage.GetHosts(req.Context())
+	if err != nil {
+		slog.Error("Failed to fetch hosts", "error", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		sendResponse(res, "Failed to fetch hosts")
+		return
+	}
+
+	candidates := make([]discovery.Candidate, 0, len(result.Hosts))
+	for _, candidate := range result.Hosts {
+		known := slices.ContainsFunc(hosts, func(host types.Host) bool {
+			return strings.EqualFold(host.MAC, candidate.MAC)
+		})
+		if !known {
+			candidates = append(candidates, candidate)
+		}
+	}
+	result.Hosts = candidates
+
+	sendJSONResponse(res, result)
+}
+
+// @Summary		Stream changes
+// @Description	Server-sent events for every change to the hosts, including the changes made by other instances sharing the storage.
+// @Description	The name of each event is its type, the data contains the event as JSON.
+//
+// @Produce		text/event-stream
+// @Success		200	{object}	types.Event	"Stream of events"
+// @Failure		500	{object}	Response	"Streaming is not supported"
+// @Router			/events [get]
+func (h *apiHandler) EventsHandler(res http.ResponseWriter, req *http.Request) {
+	rc := http.NewResponseController(res)
+
+	events, unsubscribe := h.storage.Subscribe()
+	defer unsubscribe()
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	// Disable buffering in nginx
+	res.Header().Set("X-Accel-Buffering", "no")
+	err := rc.Flush()
+	if err != nil {
+		slog.Error("Failed to start event stream", "error", err)
+		res.Header().Del("Content-Type")
+		res.WriteHeader(http.StatusInternalServerError)
+		sendResponse(res, "Streaming is not supported")
+		return
+	}
+
+	ticker := time.NewTicker(eventsKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+			_, err = io.WriteString(res, ": keep-alive\n\n")
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			var data []byte
+			data, err = json.Marshal(event)
+			if err != nil {
+				slog.Error("Failed to marshal event", "error", err)
+				continue
+			}
+			_, err = fmt.Fprintf(res, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			slog.Debug("Failed to write to event stream, closing it", "error", err)
+			return
+		}
+	}
+}
+
+// @Summary		Get relay agents
+// @Description	List the relay agents configured on the server and the ones that are currently registered,
+// @Description	as well as the configured upstreams with the result of their last health check and the broadcasts.
+//
+// @Produce		json
+// @Success		200	{object}	[]relay.AgentStatus	"List of relay agents"
+// @Failure		404	{object}	Response			"Relay is disabled"
+// @Router			/agents [get]
+func (h *apiHandler) GetAgentsHandler(res http.ResponseWriter, _ *http.Request) {
+	if h.relay == nil {
+		res.WriteHeader(http.StatusNotFound)
+		sendResponse(res, "Relay is disabled")
+		return
+	}
+	sendJSONResponse(res, h.relay.Agents())
+}
+
+// @Summary		Register relay agent
+// @Description	Register a relay agent for a site, wakes for hosts of the site are forwarded to it.
+// @Description	The registration expires after 90s and needs to be renewed regularly.
+//
+// @Accept			json
+// @Produce		json
+// @Param			Authorization	header		string					true	"Bearer token of the site or the shared token of the relay"
+// @Param			payload			body		relay.RegisterRequest	true	"Site and URL of the agent"
+// @Success		200				{object}	Response				"ok"
+// @Failure		400				{object}	Response				"Invalid site or URL"
+// @Failure		401				{object}	Response				"Invalid token"
+// @Failure		404				{object}	Response				"Relay is disabled"
+// @Failure		409				{object}	Response				"Another agent is registered for the site"
+// @Router			/agents [put]
+func (h *apiHandler) RegisterAgentHandler(res http.ResponseWriter, req *http.Request) {
+	if h.relay == nil {
+		res.WriteHeader(http.StatusNotFound)
+		sendResponse(res, "Relay is disabled")
+		return
+	}
+	token := relay.BearerToken(req)
+	if token == "" {
+		res.WriteHeader(http.StatusUnauthorized)
+		sendResponse(res, "Invalid token")
+		return
+	}
+
+	var registration relay.RegisterRequest
+	err := json.NewDecoder(req.Body).Decode(&registration)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		sendResponse(res, "Invalid request body")
+		return
+	}
+
+	err = h.relay.Register(token, registration)
+	switch {
+	case errors.Is(err, relay.ErrUnauthorized):
+		slog.Warn("Rejected relay agent registration with invalid token", slog.String("site", registration.Site), slog.String("remote", req.RemoteAddr))
+		res.WriteHeader(http.StatusUnauthorized)
+		sendResponse(res, "Invalid token")
+		return
+	case errors.Is(err, relay.ErrSiteRegistered):
+		slog.Warn("Rejected relay agent registration for a site with another agent", slog.String("site", registration.Site), slog.String("remote", req.RemoteAddr), "err", err)
+		res.WriteHeader(http.StatusConflict)
+		sendResponse(res, "Invalid registration: "+err.Error())
+		return
+	case err != nil:
+		slog.Info("Rejected relay agent registration", slog.String("site", registration.Site), "err", err)
+		res.WriteHeader(http.StatusBadRequest)
+		sendResponse(res, "Invalid registration: "+err.Error())
+		return
+	}
+	sendResponse(res, "")
 }
 
 func sendResponse(rw http.ResponseWriter, reason string) {
@@ -243,3 +846,52 @@ func sendJSONResponse(rw http.ResponseWriter, data any) {
 		slog.Error("Failed to send response to client", "err", err)
 	}
 }
+
+// Read the filter for hosts from the query parameters q, tag, location, group and label.
+// Labels are given as key=value, where key= matches an empty value, or only the key to match any value.
+func hostFilterFromQuery(req *http.Request) types.HostFilter {
+	query := req.URL.Query()
+
+	filter := types.HostFilter{
+		Search:   query.Get("q"),
+		Tags:     query["tag"],
+		Location: query.Get("location"),
+		Group:    query.Get("group"),
+	}
+	for _, label := range query["label"] {
+		key, value, ok := strings.Cut(label, "=")
+		if !ok {
+			filter.LabelKeys = append(filter.LabelKeys, key)
+			continue
+		}
+		if filter.Labels == nil {
+			filter.Labels = make(map[string]string)
+		}
+		filter.Labels[key] = value
+	}
+	return filter
+}
+
+// Parse an optional non-negative number from a query parameter, returns 0 if it is empty
+func nonNegativeQueryInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 {
+		return 0, fmt.Errorf("needs to be non-negative, got %d", i)
+	}
+	return i, nil
+}
+
+// Format a valid MAC address the way it is stored, uppercase and separated by colons
+func normalizeMAC(mac string) string {
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil {
+		return mac
+	}
+	return strings.ToUpper(hwAddr.String())
+}
@@ -1,15 +1,25 @@
 package v1
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/heathcliff26/go-wol/pkg/discovery"
+	"github.com/heathcliff26/go-wol/pkg/leases"
+	"github.com/heathcliff26/go-wol/pkg/relay"
 	"github.com/heathcliff26/go-wol/pkg/server/storage"
 	"github.com/heathcliff26/go-wol/pkg/server/storage/file"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/format"
 	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
 	"github.com/heathcliff26/go-wol/pkg/server/storage/valkey"
 
@@ -19,8 +29,63 @@ import (
 )
 
 func TestWakeHandler(t *testing.T) {
+	agent := httptest.NewTLSServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var wakeReq relay.WakeRequest
+		_ = json.NewDecoder(req.Body).Decode(&wakeReq)
+		if req.URL.Path != "/wake" || req.Header.Get("Authorization") != "Bearer test-token" || wakeReq.MAC == "22:22:22:22:22:22" {
+			res.WriteHeader(http.StatusInternalServerError)
+		}
+		_, _ = res.Write([]byte(`{"status":"ok"}`))
+	}))
+	t.Cleanup(agent.Close)
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: agent.Certificate().Raw}), 0600), "Should write ca file")
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/v1/wake/44:44:44:44:44:44":
+			res.WriteHeader(http.StatusInternalServerError)
+			_, _ = res.Write([]byte(`{"status":"error","reason":"Failed to send magic packet"}`))
+			return
+		case "/api/v1/wake/66:66:66:66:66:66":
+			res.WriteHeader(http.StatusBadRequest)
+			_, _ = res.Write([]byte(`{"status":"error","reason":"Invalid MAC address"}`))
+			return
+		case "/api/v1/wake/77:77:77:77:77:77":
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = res.Write([]byte(`{"status":"ok"}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	relayEnabled, err := relay.NewRelay(relay.Config{
+		Enabled:   true,
+		Token:     "test-token",
+		Agents:    []relay.AgentConfig{{Site: "building-b", URL: agent.URL}},
+		Upstreams: []relay.UpstreamConfig{{Site: "building-d", URL: upstream.URL, Attempts: 1}},
+		CAFile:    caFile,
+	})
+	require.NoError(t, err, "Should create relay")
+
+	storageBackend, err := storage.NewStorage(storage.StorageConfig{Type: "memory"})
+	require.NoError(t, err, "Should create memory backend without error")
+	for _, host := range []types.Host{
+		{MAC: "11:11:11:11:11:11", Name: "remote", Site: "building-b"},
+		{MAC: "22:22:22:22:22:22", Name: "failing", Site: "building-b"},
+		{MAC: "33:33:33:33:33:33", Name: "no-agent", Site: "building-c"},
+		{MAC: "44:44:44:44:44:44", Name: "upstream-failing", Site: "building-d"},
+		{MAC: "55:55:55:55:55:55", Name: "upstream", Site: "building-d"},
+		{MAC: "66:66:66:66:66:66", Name: "upstream-invalid", Site: "building-d"},
+		{MAC: "77:77:77:77:77:77", Name: "upstream-unauthorized", Site: "building-d"},
+	} {
+		require.NoError(t, storageBackend.AddHost(t.Context(), host), "Should add host")
+	}
+
 	tMatrix := []struct {
 		Name, MAC string
+		Relay     *relay.Relay
+		Forwarded bool
 		Status    int
 		Response  Response
 	}{
@@ -41,19 +106,118 @@ func TestWakeHandler(t *testing.T) {
 				Reason: "Invalid MAC address",
 			},
 		},
+		{
+			Name:   "Relay",
+			MAC:    "11-11-11-11-11-11",
+			Relay:  relayEnabled,
+			Status: http.StatusOK,
+			Response: Response{
+				Status: "ok",
+			},
+		},
+		{
+			Name:   "RelayDisabled",
+			MAC:    "11:11:11:11:11:11",
+			Status: http.StatusServiceUnavailable,
+			Response: Response{
+				Status: "error",
+				Reason: "No relay agent available for site 'building-b'",
+			},
+		},
+		{
+			Name:   "NoAgentForSite",
+			MAC:    "33:33:33:33:33:33",
+			Relay:  relayEnabled,
+			Status: http.StatusServiceUnavailable,
+			Response: Response{
+				Status: "error",
+				Reason: "No relay agent available for site 'building-c'",
+			},
+		},
+		{
+			Name:   "AgentError",
+			MAC:    "22:22:22:22:22:22",
+			Relay:  relayEnabled,
+			Status: http.StatusBadGateway,
+			Response: Response{
+				Status: "error",
+				Reason: "Failed to forward the wake to the relay agent of site 'building-b'",
+			},
+		},
+		{
+			Name:   "Upstream",
+			MAC:    "55:55:55:55:55:55",
+			Relay:  relayEnabled,
+			Status: http.StatusOK,
+			Response: Response{
+				Status: "ok",
+			},
+		},
+		{
+			Name:   "UpstreamError",
+			MAC:    "44:44:44:44:44:44",
+			Relay:  relayEnabled,
+			Status: http.StatusBadGateway,
+			Response: Response{
+				Status: "error",
+				Reason: "Upstream of site 'building-d' responded with status 500: Failed to send magic packet",
+			},
+		},
+		{
+			Name:   "UpstreamUnauthorized",
+			MAC:    "77:77:77:77:77:77",
+			Relay:  relayEnabled,
+			Status: http.StatusBadGateway,
+			Response: Response{
+				Status: "error",
+				Reason: "Upstream of site 'building-d' responded with status 401",
+			},
+		},
+		{
+			Name:   "UpstreamInvalidMAC",
+			MAC:    "66:66:66:66:66:66",
+			Relay:  relayEnabled,
+			Status: http.StatusBadRequest,
+			Response: Response{
+				Status: "error",
+				Reason: "Invalid MAC address",
+			},
+		},
+		{
+			Name:      "ForwardedLoop",
+			MAC:       "55:55:55:55:55:55",
+			Relay:     relayEnabled,
+			Forwarded: true,
+			Status:    http.StatusLoopDetected,
+			Response: Response{
+				Status: "error",
+				Reason: "Wake has already been forwarded by another server, not forwarding it to site 'building-d' again",
+			},
+		},
+		{
+			Name:      "ForwardedLocal",
+			MAC:       "ff:ff:ff:ff:ff:ff",
+			Forwarded: true,
+			Status:    http.StatusOK,
+			Response: Response{
+				Status: "ok",
+			},
+		},
 	}
 
 	for _, tCase := range tMatrix {
 		t.Run(tCase.Name, func(t *testing.T) {
 			assert := assert.New(t)
 
-			mux := http.NewServeMux()
-			mux.HandleFunc("GET /api/{macAddr}", WakeHandler)
+			router := NewRouter(storageBackend, Options{Relay: tCase.Relay})
 
-			req := httptest.NewRequest(http.MethodGet, "/api/"+tCase.MAC, nil)
+			req := httptest.NewRequest(http.MethodGet, "/wake/"+tCase.MAC, nil)
+			if tCase.Forwarded {
+				req.Header.Set(relay.ForwardedHeader, "1")
+			}
 			rr := httptest.NewRecorder()
 
-			mux.ServeHTTP(rr, req)
+			router.ServeHTTP(rr, req)
 
 			assert.Equal(tCase.Status, rr.Result().StatusCode, "Should return correct status code")
 
@@ -66,6 +230,94 @@ func TestWakeHandler(t *testing.T) {
 	}
 }
 
+func TestAgentsHandler(t *testing.T) {
+	storageBackend, err := storage.NewStorage(storage.StorageConfig{Type: "memory"})
+	require.NoError(t, err, "Should create memory backend without error")
+	relayEnabled, err := relay.NewRelay(relay.Config{
+		Enabled: true,
+		Token:   "test-token",
+		Tokens:  map[string]string{"building-c": "c-token"},
+		Agents:  []relay.AgentConfig{{Site: "building-a", URL: "https://agent-a.example.org"}},
+	})
+	require.NoError(t, err, "Should create relay")
+
+	register := func(router http.Handler, token, body string) (int, Response) {
+		req := httptest.NewRequest(http.MethodPut, "/agents", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var res Response
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res), "Response should be json")
+		return rr.Result().StatusCode, res
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		assert := assert.New(t)
+
+		router := NewRouter(storageBackend, Options{})
+
+		status, res := register(router, "test-token", `{"site":"building-b","url":"https://agent-b.example.org"}`)
+		assert.Equal(http.StatusNotFound, status, "Should not register without relay")
+		assert.Equal("Relay is disabled", res.Reason)
+
+		req := httptest.NewRequest(http.MethodGet, "/agents", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(http.StatusNotFound, rr.Result().StatusCode, "Should not list agents without relay")
+	})
+	t.Run("Register", func(t *testing.T) {
+		assert := assert.New(t)
+
+		router := NewRouter(storageBackend, Options{Relay: relayEnabled})
+
+		status, res := register(router, "", `{"site":"building-b","url":"https://agent-b.example.org"}`)
+		assert.Equal(http.StatusUnauthorized, status, "Should require a token")
+		assert.Equal("Invalid token", res.Reason)
+
+		status, _ = register(router, "wrong-token", `{"site":"building-b","url":"https://agent-b.example.org"}`)
+		assert.Equal(http.StatusUnauthorized, status, "Should reject a wrong token")
+
+		status, _ = register(router, "test-token", `not json`)
+		assert.Equal(http.StatusBadRequest, status, "Should reject an invalid body")
+
+		status, res = register(router, "test-token", `{"site":"building-b","url":"http://agent-b.example.org"}`)
+		assert.Equal(http.StatusBadRequest, status, "Should require https")
+		assert.Contains(res.Reason, "needs to be an absolute https url")
+
+		status, res = register(router, "test-token", `{"site":"building-a","url":"https://agent-b.example.org"}`)
+		assert.Equal(http.StatusBadRequest, status, "Should not replace static agents")
+		assert.Contains(res.Reason, "configured on the server")
+
+		status, res = register(router, "test-token", `{"site":"building-b","url":"https://agent-b.example.org"}`)
+		assert.Equal(http.StatusOK, status, "Should register agent")
+		assert.Equal("ok", res.Status)
+
+		status, res = register(router, "test-token", `{"site":"building-b","url":"https://attacker.example.org"}`)
+		assert.Equal(http.StatusConflict, status, "Should not replace the agent of the site with the shared token")
+		assert.Contains(res.Reason, "another agent is registered for the site")
+
+		status, _ = register(router, "test-token", `{"site":"building-c","url":"https://agent-c.example.org"}`)
+		assert.Equal(http.StatusUnauthorized, status, "Should require the token of the site")
+		status, _ = register(router, "c-token", `{"site":"building-b","url":"https://agent-c.example.org"}`)
+		assert.Equal(http.StatusUnauthorized, status, "Should not accept the token of another site")
+
+		req := httptest.NewRequest(http.MethodGet, "/agents", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Result().StatusCode, "Should list agents")
+
+		var agents []relay.AgentStatus
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &agents), "Response should be json")
+		require.Len(t, agents, 2, "Should list static and registered agents")
+		assert.Equal(relay.AgentStatus{Site: "building-a", Type: relay.RouteTypeAgent, URL: "https://agent-a.example.org", Static: true}, agents[0])
+		assert.Equal("building-b", agents[1].Site)
+		assert.False(agents[1].Expires.IsZero(), "Should show when the registration expires")
+	})
+}
+
 func TestGetHostsHandler(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		assert := assert.New(t)
@@ -99,6 +351,89 @@ func TestGetHostsHandler(t *testing.T) {
 			assert.NotEmpty(host.MAC, "Host MAC should not be empty")
 		}
 	})
+	t.Run("Filter", func(t *testing.T) {
+		storageBackend, err := storage.NewStorage(storage.StorageConfig{Type: "memory"})
+		require.NoError(t, err, "Should create memory backend without error")
+		for _, host := range []types.Host{
+			{MAC: "AA:BB:CC:DD:EE:FF", Name: "desktop", Tags: []string{"gaming", "windows"}, Location: "Living room", Labels: map[string]string{"owner": "alice"}},
+			{MAC: "11:22:33:44:55:66", Name: "nas", Tags: []string{"storage"}, Location: "Basement", Labels: map[string]string{"owner": "bob", "rack": "1"}},
+			{MAC: "77:88:99:AA:BB:CC", Name: "laptop", Tags: []string{"windows"}, Labels: map[string]string{"owner": ""}},
+		} {
+			require.NoError(t, storageBackend.AddHost(t.Context(), host), "Should add host")
+		}
+		router := NewRouter(storageBackend, Options{})
+
+		tMatrix := []struct {
+			Name, Query string
+			Result      []string
+			Total       int
+		}{
+			{"None", "", []string{"desktop", "nas", "laptop"}, 3},
+			{"Tag", "?tag=Windows", []string{"desktop", "laptop"}, 2},
+			{"MultipleTags", "?tag=windows&tag=gaming", []string{"desktop"}, 1},
+			{"Location", "?location=living%20room", []string{"desktop"}, 1},
+			{"Label", "?label=owner=bob", []string{"nas"}, 1},
+			{"LabelKey", "?label=owner", []string{"desktop", "nas", "laptop"}, 3},
+			{"LabelEmptyValue", "?label=owner=", []string{"laptop"}, 1},
+			{"GroupLocation", "?group=basement", []string{"nas"}, 1},
+			{"GroupTag", "?group=Windows", []string{"desktop", "laptop"}, 2},
+			{"Combined", "?tag=windows&label=owner=alice", []string{"desktop"}, 1},
+			{"NoMatch", "?tag=unknown", []string{}, 0},
+			{"Search", "?q=TOP", []string{"desktop", "laptop"}, 2},
+			{"SearchMAC", "?q=44-55", []string{"nas"}, 1},
+			{"SortByName", "?sort=name", []string{"desktop", "laptop", "nas"}, 3},
+			{"Limit", "?sort=name&limit=2", []string{"desktop", "laptop"}, 3},
+			{"Offset", "?sort=name&limit=2&offset=2", []string{"nas"}, 3},
+			{"OffsetAfterEnd", "?offset=5", []string{}, 3},
+			{"FilterAndLimit", "?tag=windows&limit=1", []string{"desktop"}, 2},
+		}
+
+		for _, tCase := range tMatrix {
+			t.Run(tCase.Name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "/hosts"+tCase.Query, nil)
+				rr := httptest.NewRecorder()
+
+				router.ServeHTTP(rr, req)
+
+				require.Equal(t, http.StatusOK, rr.Result().StatusCode, "Should return status code 200")
+				var res []types.Host
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res), "Response should be json")
+				names := []string{}
+				for _, host := range res {
+					names = append(names, host.Name)
+				}
+				assert.Equal(t, tCase.Result, names, "Should return the matching hosts")
+				assert.Equal(t, strconv.Itoa(tCase.Total), rr.Header().Get("X-Total-Count"), "Should return the number of matching hosts")
+			})
+		}
+	})
+	t.Run("InvalidQuery", func(t *testing.T) {
+		storageBackend, err := storage.NewStorage(storage.StorageConfig{Type: "memory"})
+		require.NoError(t, err, "Should create memory backend without error")
+		router := NewRouter(storageBackend, Options{})
+
+		tMatrix := map[string]string{
+			"?sort=size":  "Invalid sort, needs to be one of name, status, last-seen",
+			"?limit=-1":   "Invalid limit, needs to be a non-negative number",
+			"?limit=ten":  "Invalid limit, needs to be a non-negative number",
+			"?offset=-5":  "Invalid offset, needs to be a non-negative number",
+			"?offset=1.5": "Invalid offset, needs to be a non-negative number",
+		}
+
+		for query, reason := range tMatrix {
+			t.Run(query, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "/hosts"+query, nil)
+				rr := httptest.NewRecorder()
+
+				router.ServeHTTP(rr, req)
+
+				assert.Equal(t, http.StatusBadRequest, rr.Result().StatusCode, "Should return status code 400")
+				var res Response
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &res), "Response should be json")
+				assert.Equal(t, Response{Status: "error", Reason: reason}, res, "Should explain the error")
+			})
+		}
+	})
 	t.Run("StorageError", func(t *testing.T) {
 		t.Parallel()
 		assert := assert.New(t)
@@ -118,7 +453,7 @@ func TestGetHostsHandler(t *testing.T) {
 		// Close miniredis to simulate storage error
 		mr.Close()
 
-		router := NewRouter(storageBackend)
+		router := NewRouter(storageBackend, Options{})
 
 		req := httptest.NewRequest(http.MethodGet, "/hosts", nil)
 		rr := httptest.NewRecorder()
@@ -127,6 +462,33 @@ func TestGetHostsHandler(t *testing.T) {
 
 		assert.Equal(http.StatusInternalServerError, rr.Result().StatusCode, "Should return status code 500")
 	})
+	t.Run("CanceledRequest", func(t *testing.T) {
+		t.Parallel()
+		assert := assert.New(t)
+
+		mr := miniredis.RunT(t)
+
+		cfg := storage.StorageConfig{
+			Type: "valkey",
+			Valkey: valkey.ValkeyConfig{
+				Addrs: []string{mr.Addr()},
+			},
+		}
+
+		storageBackend, err := storage.NewStorage(cfg)
+		require.NoError(t, err, "Should create valkey backend without error")
+
+		router := NewRouter(storageBackend, Options{})
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/hosts", nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(http.StatusInternalServerError, rr.Result().StatusCode, "Should not query the storage for canceled requests")
+	})
 }
 
 func TestAddHostHandler(t *testing.T) {
@@ -172,6 +534,34 @@ func TestAddHostHandler(t *testing.T) {
 				Reason: "Invalid hostname",
 			},
 		},
+		{
+			Name: "Metadata",
+			Host: types.Host{
+				MAC:         "00:11:22:33:44:55",
+				Name:        "TestHost",
+				DisplayName: "Living room PC",
+				Tags:        []string{"gaming"},
+				Icon:        "desktop",
+				Labels:      map[string]string{"owner": "alice"},
+			},
+			Status: http.StatusOK,
+			Response: Response{
+				Status: "ok",
+			},
+		},
+		{
+			Name: "InvalidMetadata",
+			Host: types.Host{
+				MAC:  "00:11:22:33:44:55",
+				Name: "TestHost",
+				Icon: "toaster",
+			},
+			Status: http.StatusBadRequest,
+			Response: Response{
+				Status: "error",
+				Reason: "Invalid host metadata: unknown icon 'toaster', needs to be one of desktop, laptop, server, nas, router, tv, console, printer",
+			},
+		},
 		{
 			Name: "ReadonlyStorage",
 			Host: types.Host{
@@ -204,7 +594,7 @@ func TestAddHostHandler(t *testing.T) {
 			storageBackend, err := storage.NewStorage(cfg)
 			require.NoError(err, "Should create file backend without error")
 
-			router := NewRouter(storageBackend)
+			router := NewRouter(storageBackend, Options{})
 
 			body, err := json.Marshal(tCase.Host)
 			require.NoError(err, "Should encode host to JSON")
@@ -237,7 +627,7 @@ func TestAddHostHandler(t *testing.T) {
 		storageBackend, err := storage.NewStorage(cfg)
 		require.NoError(err, "Should create file backend without error")
 
-		router := NewRouter(storageBackend)
+		router := NewRouter(storageBackend, Options{})
 
 		req := httptest.NewRequest(http.MethodPut, "/hosts", bytes.NewReader([]byte("This is a text, not a JSON object")))
 		rr := httptest.NewRecorder()
@@ -406,11 +796,11 @@ func TestHostStatusHandler(t *testing.T) {
 			require.NoError(t, err, "Should create file backend without error")
 
 			for _, host := range tCase.Hosts {
-				err := storageBackend.AddHost(host)
+				err := storageBackend.AddHost(t.Context(), host)
 				require.NoError(t, err, "Should add host without error")
 			}
 
-			router := NewRouter(storageBackend)
+			router := NewRouter(storageBackend, Options{})
 
 			req := httptest.NewRequest(http.MethodGet, "/hosts/status", nil)
 			rr := httptest.NewRecorder()
@@ -448,7 +838,7 @@ func TestHostStatusHandler(t *testing.T) {
 		// Close miniredis to simulate storage error
 		mr.Close()
 
-		router := NewRouter(storageBackend)
+		router := NewRouter(storageBackend, Options{})
 
 		req := httptest.NewRequest(http.MethodGet, "/hosts/status", nil)
 		rr := httptest.NewRecorder()
@@ -474,7 +864,7 @@ func TestStorageErrors(t *testing.T) {
 
 	require.NoError(t, os.Chmod(hostsFile, 0444), "Should set file permissions without error")
 
-	router := NewRouter(storageBackend)
+	router := NewRouter(storageBackend, Options{})
 
 	t.Run("AddHost", func(t *testing.T) {
 		assert := assert.New(t)
@@ -525,3 +915,588 @@ func TestStorageErrors(t *testing.T) {
 		assert.Equal(expectedResponse, res, "Response should match")
 	})
 }
+
+func TestHostOrderHandler(t *testing.T) {
+	hosts := []types.Host{
+		{MAC: "00:00:00:00:00:11", Name: "Host1"},
+		{MAC: "00:00:00:00:00:22", Name: "Host2"},
+		{MAC: "00:00:00:00:00:33", Name: "Host3"},
+	}
+
+	tMatrix := []struct {
+		Name     string
+		Body     string
+		Readonly bool
+		Status   int
+		Response Response
+		Order    []string
+	}{
+		{
+			Name:     "MoveHost",
+			Body:     `{"mac": "00:00:00:00:00:33", "index": 0}`,
+			Status:   http.StatusOK,
+			Response: Response{Status: "ok"},
+			Order:    []string{"00:00:00:00:00:33", "00:00:00:00:00:11", "00:00:00:00:00:22"},
+		},
+		{
+			Name:     "MoveHostDefaultIndex",
+			Body:     `{"mac": "00:00:00:00:00:22"}`,
+			Status:   http.StatusOK,
+			Response: Response{Status: "ok"},
+			Order:    []string{"00:00:00:00:00:22", "00:00:00:00:00:11", "00:00:00:00:00:33"},
+		},
+		{
+			Name:     "ReorderHosts",
+			Body:     `{"order": ["00:00:00:00:00:22", "00:00:00:00:00:33", "00:00:00:00:00:11"]}`,
+			Status:   http.StatusOK,
+			Response: Response{Status: "ok"},
+			Order:    []string{"00:00:00:00:00:22", "00:00:00:00:00:33", "00:00:00:00:00:11"},
+		},
+		{
+			Name:     "OrderTakesPrecedence",
+			Body:     `{"order": ["00:00:00:00:00:22"], "mac": "00:00:00:00:00:33", "index": 0}`,
+			Status:   http.StatusOK,
+			Response: Response{Status: "ok"},
+			Order:    []string{"00:00:00:00:00:22", "00:00:00:00:00:11", "00:00:00:00:00:33"},
+		},
+		{
+			Name:     "InvalidBody",
+			Body:     "This is a text, not a JSON object",
+			Status:   http.StatusBadRequest,
+			Response: Response{Status: "error", Reason: "Request body must be a valid order JSON object"},
+		},
+		{
+			Name:     "EmptyRequest",
+			Body:     `{}`,
+			Status:   http.StatusBadRequest,
+			Response: Response{Status: "error", Reason: "Invalid MAC address"},
+		},
+		{
+			Name:     "InvalidMAC",
+			Body:     `{"order": ["00:00:00:00:00:22", "not-a-mac"]}`,
+			Status:   http.StatusBadRequest,
+			Response: Response{Status: "error", Reason: "Invalid MAC address"},
+		},
+		{
+			Name:     "UnknownHost",
+			Body:     `{"mac": "00:00:00:00:00:44", "index": 0}`,
+			Status:   http.StatusNotFound,
+			Response: Response{Status: "error", Reason: "Host not found"},
+		},
+		{
+			Name:     "DuplicateHost",
+			Body:     `{"order": ["00:00:00:00:00:22", "00:00:00:00:00:22"]}`,
+			Status:   http.StatusBadRequest,
+			Response: Response{Status: "error", Reason: "Duplicate MAC address"},
+		},
+		{
+			Name:     "ReadonlyStorage",
+			Body:     `{"mac": "00:00:00:00:00:33", "index": 0}`,
+			Readonly: true,
+			Status:   http.StatusForbidden,
+			Response: Response{Status: "error", Reason: "Storage is readonly"},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			cfg := storage.StorageConfig{
+				Type: "file",
+				File: file.FileBackendConfig{
+					Path: tmpDir + "/" + tCase.Name + "-hosts.yaml",
+				},
+			}
+			storageBackend, err := storage.NewStorage(cfg)
+			require.NoError(err, "Should create file backend without error")
+
+			for _, host := range hosts {
+				require.NoError(storageBackend.AddHost(t.Context(), host), "Should add host without error")
+			}
+
+			if tCase.Readonly {
+				cfg.Readonly = true
+				storageBackend, err = storage.NewStorage(cfg)
+				require.NoError(err, "Should create readonly file backend without error")
+			}
+
+			router := NewRouter(storageBackend, Options{})
+
+			req := httptest.NewRequest(http.MethodPut, "/hosts/order", bytes.NewReader([]byte(tCase.Body)))
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(tCase.Status, rr.Result().StatusCode, "Should return correct status code")
+
+			var res Response
+			err = json.Unmarshal(rr.Body.Bytes(), &res)
+			assert.NoError(err, "Response should be json")
+			assert.Equal(tCase.Response, res, "Response should match")
+
+			if tCase.Order == nil {
+				return
+			}
+
+			result, err := storageBackend.GetHosts(t.Context())
+			require.NoError(err, "Should get hosts")
+			order := make([]string, 0, len(result))
+			for _, host := range result {
+				order = append(order, host.MAC)
+			}
+			assert.Equal(tCase.Order, order, "Hosts should be in the new order")
+		})
+	}
+}
+
+func TestExportHostsHandler(t *testing.T) {
+	cfg := storage.StorageConfig{
+		Type: "file",
+		File: file.FileBackendConfig{
+			Path: "testdata/hosts.yaml",
+		},
+		Readonly: true,
+	}
+	storageBackend, err := storage.NewStorage(cfg)
+	require.NoError(t, err, "Should create file backend without error")
+
+	router := NewRouter(storageBackend, Options{})
+
+	tMatrix := []struct {
+		Name, Query, Format string
+	}{
+		{"Default", "", format.FormatYAML},
+		{"YAML", "?format=yaml", format.FormatYAML},
+		{"JSON", "?format=json", format.FormatJSON},
+		{"CSV", "?format=csv", format.FormatCSV},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			req := httptest.NewRequest(http.MethodGet, "/hosts/export"+tCase.Query, nil)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(http.StatusOK, rr.Result().StatusCode, "Should return status code 200")
+			assert.Equal(format.ContentType(tCase.Format), rr.Header().Get("Content-Type"), "Should set content type")
+			assert.Contains(rr.Header().Get("Content-Disposition"), "hosts."+tCase.Format, "Should set file name")
+
+			hosts, err := format.Decode(rr.Body, tCase.Format)
+			assert.NoError(err, "Should decode exported hosts")
+			assert.Len(hosts, 2, "Should export all hosts")
+		})
+	}
+
+	t.Run("UnknownFormat", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/hosts/export?format=xml", nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Result().StatusCode, "Should return status code 400")
+	})
+}
+
+func TestImportHostsHandler(t *testing.T) {
+	existingHosts := []types.Host{
+		{MAC: "00:00:00:00:00:11", Name: "Host1"},
+		{MAC: "00:00:00:00:00:22", Name: "Host2"},
+	}
+
+	tMatrix := []struct {
+		Name        string
+		Query       string
+		ContentType string
+		Body        string
+		Readonly    bool
+		Status      int
+		Hosts       []string
+	}{
+		{
+			Name:   "MergeYAML",
+			Body:   "hosts:\n  - mac: 00:00:00:00:00:33\n    name: Host3\n",
+			Status: http.StatusOK,
+			Hosts:  []string{"00:00:00:00:00:11", "00:00:00:00:00:22", "00:00:00:00:00:33"},
+		},
+		{
+			Name:   "ReplaceJSON",
+			Query:  "?format=json&mode=replace",
+			Body:   `[{"mac": "00:00:00:00:00:33", "name": "Host3"}, {"mac": "00:00:00:00:00:11", "name": "Host1"}]`,
+			Status: http.StatusOK,
+			Hosts:  []string{"00:00:00:00:00:33", "00:00:00:00:00:11"},
+		},
+		{
+			Name:        "CSVFromContentType",
+			ContentType: "text/csv",
+			Body:        "mac,name\n00:00:00:00:00:33,Host3\n",
+			Status:      http.StatusOK,
+			Hosts:       []string{"00:00:00:00:00:11", "00:00:00:00:00:22", "00:00:00:00:00:33"},
+		},
+		{
+			Name:   "DryRun",
+			Query:  "?mode=replace&dry-run=true",
+			Body:   "hosts:\n  - mac: 00:00:00:00:00:33\n    name: Host3\n",
+			Status: http.StatusOK,
+			Hosts:  []string{"00:00:00:00:00:11", "00:00:00:00:00:22"},
+		},
+		{
+			Name:     "DryRunReadonly",
+			Query:    "?dry-run=true",
+			Body:     "hosts:\n  - mac: 00:00:00:00:00:33\n    name: Host3\n",
+			Readonly: true,
+			Status:   http.StatusOK,
+			Hosts:    []string{"00:00:00:00:00:11", "00:00:00:00:00:22"},
+		},
+		{
+			Name:     "Readonly",
+			Body:     "hosts:\n  - mac: 00:00:00:00:00:33\n    name: Host3\n",
+			Readonly: true,
+			Status:   http.StatusForbidden,
+			Hosts:    []string{"00:00:00:00:00:11", "00:00:00:00:00:22"},
+		},
+		{
+			Name:   "InvalidHosts",
+			Body:   "hosts:\n  - mac: 00:00:00:00:00:33\n    name: Host3\n  - mac: not-a-mac\n    name: Host4\n",
+			Status: http.StatusBadRequest,
+			Hosts:  []string{"00:00:00:00:00:11", "00:00:00:00:00:22"},
+		},
+		{
+			Name:   "InvalidBody",
+			Query:  "?format=json",
+			Body:   "This is a text, not a JSON object",
+			Status: http.StatusBadRequest,
+			Hosts:  []string{"00:00:00:00:00:11", "00:00:00:00:00:22"},
+		},
+		{
+			Name:   "UnknownFormat",
+			Query:  "?format=xml",
+			Status: http.StatusBadRequest,
+			Hosts:  []string{"00:00:00:00:00:11", "00:00:00:00:00:22"},
+		},
+		{
+			Name:   "UnknownMode",
+			Query:  "?mode=append",
+			Status: http.StatusBadRequest,
+			Hosts:  []string{"00:00:00:00:00:11", "00:00:00:00:00:22"},
+		},
+		{
+			Name:   "InvalidDryRun",
+			Query:  "?dry-run=maybe",
+			Status: http.StatusBadRequest,
+			Hosts:  []string{"00:00:00:00:00:11", "00:00:00:00:00:22"},
+		},
+	}
+
+	tmpDir := t.TempDir()
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			cfg := storage.StorageConfig{
+				Type: "file",
+				File: file.FileBackendConfig{
+					Path: tmpDir + "/" + tCase.Name + "-hosts.yaml",
+				},
+			}
+			storageBackend, err := storage.NewStorage(cfg)
+			require.NoError(err, "Should create file backend without error")
+			for _, host := range existingHosts {
+				require.NoError(storageBackend.AddHost(t.Context(), host), "Should add host without error")
+			}
+			if tCase.Readonly {
+				cfg.Readonly = true
+				storageBackend, err = storage.NewStorage(cfg)
+				require.NoError(err, "Should create readonly file backend without error")
+			}
+
+			router := NewRouter(storageBackend, Options{})
+
+			req := httptest.NewRequest(http.MethodPost, "/hosts/import"+tCase.Query, bytes.NewReader([]byte(tCase.Body)))
+			if tCase.ContentType != "" {
+				req.Header.Set("Content-Type", tCase.ContentType)
+			}
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(tCase.Status, rr.Result().StatusCode, "Should return correct status code")
+
+			hosts, err := storageBackend.GetHosts(t.Context())
+			require.NoError(err, "Should get hosts")
+			macs := make([]string, 0, len(hosts))
+			for _, host := range hosts {
+				macs = append(macs, host.MAC)
+			}
+			assert.Equal(tCase.Hosts, macs, "Should have expected hosts")
+		})
+	}
+
+	t.Run("ValidationErrors", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		storageBackend, err := storage.NewStorage(storage.StorageConfig{
+			Type: "file",
+			File: file.FileBackendConfig{
+				Path: tmpDir + "/ValidationErrors-hosts.yaml",
+			},
+		})
+		require.NoError(err, "Should create file backend without error")
+
+		router := NewRouter(storageBackend, Options{})
+
+		body := "mac,name\n00:00:00:00:00:11,Host1\nnot-a-mac,Host2\n00:00:00:00:00:33,not a hostname\n"
+		req := httptest.NewRequest(http.MethodPost, "/hosts/import?format=csv", bytes.NewReader([]byte(body)))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(http.StatusBadRequest, rr.Result().StatusCode, "Should return status code 400")
+
+		var res types.ImportResult
+		require.NoError(json.Unmarshal(rr.Body.Bytes(), &res), "Response should be json")
+		require.Len(res.Errors, 2, "Should return errors for all invalid rows")
+		assert.Equal(2, res.Errors[0].Row, "Should return row of invalid host")
+		assert.Equal(3, res.Errors[1].Row, "Should return row of invalid host")
+	})
+
+	t.Run("Result", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		storageBackend, err := storage.NewStorage(storage.StorageConfig{
+			Type: "file",
+			File: file.FileBackendConfig{
+				Path: tmpDir + "/Result-hosts.yaml",
+			},
+		})
+		require.NoError(err, "Should create file backend without error")
+		for _, host := range existingHosts {
+			require.NoError(storageBackend.AddHost(t.Context(), host), "Should add host without error")
+		}
+
+		router := NewRouter(storageBackend, Options{})
+
+		body := `[{"mac": "00:00:00:00:00:22", "name": "NewName"}, {"mac": "00:00:00:00:00:33", "name": "Host3"}]`
+		req := httptest.NewRequest(http.MethodPost, "/hosts/import?format=json&mode=replace", bytes.NewReader([]byte(body)))
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(http.StatusOK, rr.Result().StatusCode, "Should return status code 200")
+
+		var res types.ImportResult
+		require.NoError(json.Unmarshal(rr.Body.Bytes(), &res), "Response should be json")
+		assert.Equal(types.ImportResult{
+			Added:     []string{"00:00:00:00:00:33"},
+			Updated:   []string{"00:00:00:00:00:22"},
+			Unchanged: []string{},
+			Removed:   []string{"00:00:00:00:00:11"},
+		}, res, "Should return result of import")
+	})
+}
+
+func TestLeasesHandler(t *testing.T) {
+	cfg := storage.StorageConfig{
+		Type: "file",
+		File: file.FileBackendConfig{
+			Path: "testdata/hosts.yaml",
+		},
+		Readonly: true,
+	}
+	storageBackend, err := storage.NewStorage(cfg)
+	require.NoError(t, err, "Should create file backend without error")
+
+	t.Run("Success", func(t *testing.T) {
+		assert := assert.New(t)
+
+		router := NewRouter(storageBackend, Options{Leases: []leases.Source{{Path: "testdata/dnsmasq.leases"}}})
+
+		req := httptest.NewRequest(http.MethodGet, "/hosts/leases", nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(http.StatusOK, rr.Result().StatusCode, "Should return status code 200")
+
+		var proposals []leases.Proposal
+		assert.NoError(json.NewDecoder(rr.Body).Decode(&proposals), "Should return proposals")
+		assert.Equal([]leases.Proposal{
+			{Host: types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost1", Address: "192.168.1.10"}, Known: true},
+			{Host: types.Host{MAC: "AA:BB:CC:DD:EE:01", Name: "desktop", Address: "192.168.1.11"}},
+		}, proposals, "Should mark known hosts")
+	})
+	t.Run("NoSources", func(t *testing.T) {
+		assert := assert.New(t)
+
+		router := NewRouter(storageBackend, Options{})
+
+		req := httptest.NewRequest(http.MethodGet, "/hosts/leases", nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(http.StatusOK, rr.Result().StatusCode, "Should return status code 200")
+		assert.Equal("[]", rr.Body.String(), "Should return empty list")
+	})
+	t.Run("SourceError", func(t *testing.T) {
+		assert := assert.New(t)
+
+		router := NewRouter(storageBackend, Options{Leases: []leases.Source{{Path: "testdata/not-a-file", Format: leases.FormatARP}}})
+
+		req := httptest.NewRequest(http.MethodGet, "/hosts/leases", nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(http.StatusInternalServerError, rr.Result().StatusCode, "Should return status code 500")
+
+		var response Response
+		assert.NoError(json.NewDecoder(rr.Body).Decode(&response), "Should return response")
+		assert.Equal("Failed to read leases", response.Reason, "Should return reason")
+	})
+}
+
+type fakeNeighbors []leases.Lease
+
+func (f fakeNeighbors) Neighbors() ([]leases.Lease, error) {
+	return f, nil
+}
+
+func TestDiscoverHandler(t *testing.T) {
+	cfg := storage.StorageConfig{
+		Type: "file",
+		File: file.FileBackendConfig{
+			Path: "testdata/hosts.yaml",
+		},
+		Readonly: true,
+	}
+	storageBackend, err := storage.NewStorage(cfg)
+	require.NoError(t, err, "Should create file backend without error")
+
+	scanner, err := discovery.NewScanner(discovery.Config{Networks: []string{"127.0.0.1/32"}}, fakeNeighbors{
+		{MAC: "AA:BB:CC:DD:EE:FF", Address: "127.0.0.1"},
+		{MAC: "AA:BB:CC:DD:EE:01", Address: "127.0.0.1"},
+	})
+	require.NoError(t, err, "Should create scanner")
+
+	router := NewRouter(storageBackend, Options{Discovery: scanner})
+
+	tMatrix := []struct {
+		Name, Query string
+		Status      int
+		Reason      string
+	}{
+		{"InvalidRefresh", "?refresh=maybe", http.StatusBadRequest, "Invalid refresh parameter"},
+		{"Scan", "", http.StatusOK, ""},
+		{"Cached", "?refresh=false", http.StatusOK, ""},
+		{"RateLimited", "?refresh=true", http.StatusTooManyRequests, "Scan is rate limited"},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			req := httptest.NewRequest(http.MethodGet, "/hosts/discover"+tCase.Query, nil)
+			rr := httptest.NewRecorder()
+
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(tCase.Status, rr.Result().StatusCode, "Should return status code")
+
+			if tCase.Status != http.StatusOK {
+				var response Response
+				assert.NoError(json.NewDecoder(rr.Body).Decode(&response), "Should return response")
+				assert.Equal(tCase.Reason, response.Reason, "Should return reason")
+				return
+			}
+
+			var result discovery.Result
+			assert.NoError(json.NewDecoder(rr.Body).Decode(&result), "Should return result")
+			require.Len(t, result.Hosts, 1, "Should only return unknown hosts")
+			assert.Equal("AA:BB:CC:DD:EE:01", result.Hosts[0].MAC, "Should return unknown host")
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		assert := assert.New(t)
+
+		router := NewRouter(storageBackend, Options{})
+
+		req := httptest.NewRequest(http.MethodGet, "/hosts/discover", nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(http.StatusNotFound, rr.Result().StatusCode, "Should return status code 404")
+	})
+}
+
+func TestEventsHandler(t *testing.T) {
+	storageBackend, err := storage.NewStorage(storage.StorageConfig{Type: "memory"})
+	require.NoError(t, err, "Should create storage backend")
+
+	router := NewRouter(storageBackend, Options{})
+
+	t.Run("Stream", func(t *testing.T) {
+		assert := assert.New(t)
+
+		srv := httptest.NewServer(router)
+		t.Cleanup(srv.Close)
+
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL+"/events", nil)
+		require.NoError(t, err)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err, "Should connect to event stream")
+		defer res.Body.Close()
+
+		assert.Equal(http.StatusOK, res.StatusCode, "Should return status code")
+		assert.Equal("text/event-stream", res.Header.Get("Content-Type"), "Should return content type")
+
+		host := types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"}
+		require.NoError(t, storageBackend.AddHost(t.Context(), host))
+
+		reader := bufio.NewReader(res.Body)
+		fields := make(map[string]string)
+		for {
+			line, err := reader.ReadString('\n')
+			require.NoError(t, err, "Should read event")
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				break
+			}
+			key, value, _ := strings.Cut(line, ": ")
+			fields[key] = value
+		}
+
+		assert.Equal(string(types.EventHostUpdated), fields["event"], "Should use the type as event name")
+		var event types.Event
+		require.NoError(t, json.Unmarshal([]byte(fields["data"]), &event), "Data should be json")
+		assert.Equal(fields["id"], event.ID, "Should use the event id")
+		assert.Equal(&host, event.Host, "Should contain the host")
+	})
+
+	t.Run("NotSupported", func(t *testing.T) {
+		assert := assert.New(t)
+
+		req := httptest.NewRequest(http.MethodGet, "/events", nil)
+		rr := httptest.NewRecorder()
+
+		// Hide the Flush method of the recorder
+		router.ServeHTTP(struct{ http.ResponseWriter }{rr}, req)
+
+		assert.Equal(http.StatusInternalServerError, rr.Result().StatusCode, "Should return status code")
+		var res Response
+		assert.NoError(json.Unmarshal(rr.Body.Bytes(), &res), "Response should be json")
+		assert.Equal("Streaming is not supported", res.Reason, "Should return reason")
+	})
+}
@@ -0,0 +1,112 @@
+package v1
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+)
+
+// Values for sorting the hosts
+const (
+	SortByName     = "name"
+	SortByStatus   = "status"
+	SortByLastSeen = "last-seen"
+)
+
+// Remembers the last known status of the hosts, so they can be sorted by it.
+// Only contains the results of the status checks of this instance.
+type statusCache struct {
+	lock     sync.RWMutex
+	statuses map[string]types.HostStatus
+}
+
+func newStatusCache() *statusCache {
+	return &statusCache{
+		statuses: make(map[string]types.HostStatus),
+	}
+}
+
+// Save the result of pinging the hosts and fill in the time the hosts were last seen online.
+// The statuses need to contain all checked hosts, hosts that are no longer checked are removed.
+func (c *statusCache) update(statuses []types.HostStatus) []types.HostStatus {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	cached := make(map[string]types.HostStatus, len(statuses))
+	for i, status := range statuses {
+		if status.Online {
+			status.LastSeen = now
+		} else {
+			status.LastSeen = c.statuses[status.MAC].LastSeen
+		}
+		cached[status.MAC] = status
+		statuses[i] = status
+	}
+	c.statuses = cached
+	return statuses
+}
+
+// Forget the status of the host
+func (c *statusCache) remove(mac string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.statuses, mac)
+}
+
+// Remove the status of hosts once they are removed, until the channel is closed.
+// Events dropped because of a slow subscriber are cleaned up by the next update.
+func (c *statusCache) watch(events <-chan types.Event) {
+	for event := range events {
+		if event.Type == types.EventHostRemoved {
+			c.remove(event.MAC)
+		}
+	}
+}
+
+// Return the last known status of the host
+func (c *statusCache) get(mac string) (types.HostStatus, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	status, ok := c.statuses[mac]
+	return status, ok
+}
+
+// Sort the hosts in place, keeping the configured order for hosts that compare equal.
+// By name sorts by the shown name, by status sorts online hosts first and hosts without known status last,
+// by last seen sorts the most recently seen hosts first and hosts that have never been seen last.
+func (c *statusCache) sortHosts(hosts []types.Host, by string) {
+	switch by {
+	case SortByName:
+		slices.SortStableFunc(hosts, func(a, b types.Host) int {
+			return strings.Compare(strings.ToLower(a.Title()), strings.ToLower(b.Title()))
+		})
+	case SortByStatus:
+		rank := func(host types.Host) int {
+			status, ok := c.get(host.MAC)
+			switch {
+			case !ok:
+				return 2
+			case status.Online:
+				return 0
+			default:
+				return 1
+			}
+		}
+		slices.SortStableFunc(hosts, func(a, b types.Host) int {
+			return cmp.Compare(rank(a), rank(b))
+		})
+	case SortByLastSeen:
+		slices.SortStableFunc(hosts, func(a, b types.Host) int {
+			statusA, _ := c.get(a.MAC)
+			statusB, _ := c.get(b.MAC)
+			return statusB.LastSeen.Compare(statusA.LastSeen)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package v1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusCacheUpdate(t *testing.T) {
+	assert := assert.New(t)
+
+	cache := newStatusCache()
+
+	before := time.Now()
+	result := cache.update([]types.HostStatus{
+		{MAC: "AA:BB:CC:DD:EE:FF", Online: true},
+		{MAC: "11:22:33:44:55:66", Online: false},
+	})
+
+	assert.False(result[0].LastSeen.Before(before), "Should set last seen for online hosts")
+	assert.True(result[1].LastSeen.IsZero(), "Should not set last seen for hosts that have never been online")
+
+	lastSeen := result[0].LastSeen
+	result = cache.update([]types.HostStatus{{MAC: "AA:BB:CC:DD:EE:FF", Online: false}})
+	assert.Equal(lastSeen, result[0].LastSeen, "Should keep last seen when the host goes offline")
+
+	status, ok := cache.get("AA:BB:CC:DD:EE:FF")
+	assert.True(ok, "Should remember the host")
+	assert.False(status.Online, "Should remember the latest status")
+	assert.Equal(lastSeen, status.LastSeen, "Should remember last seen")
+
+	_, ok = cache.get("77:88:99:AA:BB:CC")
+	assert.False(ok, "Should not know unchecked hosts")
+	_, ok = cache.get("11:22:33:44:55:66")
+	assert.False(ok, "Should forget hosts that are no longer checked")
+}
+
+func TestStatusCacheRemovedHost(t *testing.T) {
+	s, err := storage.NewStorage(storage.StorageConfig{Type: "memory"})
+	require.NoError(t, err, "Should create storage")
+	require.NoError(t, s.AddHost(t.Context(), types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "host"}))
+
+	cache := newStatusCache()
+	events, unsubscribe := s.Subscribe()
+	t.Cleanup(unsubscribe)
+	done := make(chan struct{})
+	go func() {
+		cache.watch(events)
+		close(done)
+	}()
+
+	cache.update([]types.HostStatus{{MAC: "AA:BB:CC:DD:EE:FF", Online: true}})
+	require.NoError(t, s.RemoveHost(t.Context(), "aa:bb:cc:dd:ee:ff"))
+
+	assert.Eventually(t, func() bool {
+		_, ok := cache.get("AA:BB:CC:DD:EE:FF")
+		return !ok
+	}, time.Second, 10*time.Millisecond, "Should forget the status of removed hosts")
+
+	s.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Should stop watching when the storage is closed")
+	}
+}
+
+func TestStatusCacheSortHosts(t *testing.T) {
+	now := time.Now()
+	cache := newStatusCache()
+	cache.statuses = map[string]types.HostStatus{
+		"00:00:00:00:00:01": {MAC: "00:00:00:00:00:01", Online: false, LastSeen: now.Add(-time.Hour)},
+		"00:00:00:00:00:02": {MAC: "00:00:00:00:00:02", Online: true, LastSeen: now},
+		"00:00:00:00:00:03": {MAC: "00:00:00:00:00:03", Online: false},
+	}
+	hosts := []types.Host{
+		{MAC: "00:00:00:00:00:01", Name: "charlie"},
+		{MAC: "00:00:00:00:00:02", Name: "bravo", DisplayName: "Zulu"},
+		{MAC: "00:00:00:00:00:03", Name: "Alpha"},
+		{MAC: "00:00:00:00:00:04", Name: "delta"},
+	}
+
+	tMatrix := map[string][]string{
+		"":             {"charlie", "bravo", "Alpha", "delta"},
+		SortByName:     {"Alpha", "charlie", "delta", "bravo"},
+		SortByStatus:   {"bravo", "charlie", "Alpha", "delta"},
+		SortByLastSeen: {"bravo", "charlie", "Alpha", "delta"},
+	}
+
+	for by, expected := range tMatrix {
+		t.Run(by, func(t *testing.T) {
+			sorted := append([]types.Host{}, hosts...)
+			cache.sortHosts(sorted, by)
+
+			names := make([]string, 0, len(sorted))
+			for _, host := range sorted {
+				names = append(names, host.Name)
+			}
+			assert.Equal(t, expected, names)
+		})
+	}
+}
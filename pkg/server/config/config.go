@@ -6,7 +6,11 @@ import (
 	"os"
 	"strings"
 
+	"github.com/heathcliff26/go-wol/pkg/discovery"
+	"github.com/heathcliff26/go-wol/pkg/leases"
+	"github.com/heathcliff26/go-wol/pkg/relay"
 	"github.com/heathcliff26/go-wol/pkg/server/storage"
+	"github.com/heathcliff26/go-wol/pkg/server/webhook"
 	"go.yaml.in/yaml/v3"
 )
 
@@ -37,8 +41,13 @@ type Config struct {
 }
 
 type ServerConfig struct {
-	Port int       `yaml:"port,omitempty"`
-	SSL  SSLConfig `yaml:"ssl,omitempty"`
+	Port      int                     `yaml:"port,omitempty"`
+	SSL       SSLConfig               `yaml:"ssl,omitempty"`
+	Leases    []leases.Source         `yaml:"leases,omitempty"`
+	Discovery discovery.Config        `yaml:"discovery,omitempty"`
+	Refresh   discovery.RefreshConfig `yaml:"refresh,omitempty"`
+	Webhooks  []webhook.Config        `yaml:"webhooks,omitempty"`
+	Relay     relay.Config            `yaml:"relay,omitempty"`
 }
 
 type SSLConfig struct {
@@ -95,6 +104,15 @@ func LoadConfig(path string, env bool, logLevelOverride string) (Config, error)
 		return Config{}, fmt.Errorf("incomplete SSL configuration: cert and key must be set if SSL is enabled")
 	}
 
+	for _, source := range c.Server.Leases {
+		if source.Path == "" {
+			return Config{}, fmt.Errorf("invalid lease source: path must be set")
+		}
+		if source.Format != "" && !leases.Valid(source.Format) {
+			return Config{}, fmt.Errorf("invalid lease source '%s': unknown format '%s'", source.Path, source.Format)
+		}
+	}
+
 	return c, nil
 }
 
@@ -3,9 +3,13 @@ package config
 import (
 	"log/slog"
 	"testing"
+	"time"
 
+	"github.com/heathcliff26/go-wol/pkg/discovery"
+	"github.com/heathcliff26/go-wol/pkg/leases"
 	"github.com/heathcliff26/go-wol/pkg/server/storage"
 	"github.com/heathcliff26/go-wol/pkg/server/storage/file"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/sqlite"
 	"github.com/heathcliff26/go-wol/pkg/server/storage/valkey"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -57,8 +61,10 @@ func TestValidConfigs(t *testing.T) {
 					Port: DEFAULT_SERVER_PORT,
 				},
 				Storage: storage.StorageConfig{
-					Type: "valkey",
-					File: file.NewDefaultFileBackendConfig(),
+					Type:    "valkey",
+					Timeout: storage.DEFAULT_TIMEOUT,
+					File:    file.NewDefaultFileBackendConfig(),
+					SQLite:  sqlite.NewDefaultSQLiteBackendConfig(),
 					Valkey: valkey.ValkeyConfig{
 						Addrs:     []string{"localhost:6379"},
 						Username:  "user",
@@ -71,6 +77,50 @@ func TestValidConfigs(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name: "ValidConfigLeases",
+			Path: "testdata/valid-config-leases.yaml",
+			Result: Config{
+				LogLevel: DEFAULT_LOG_LEVEL,
+				Server: ServerConfig{
+					Port: DEFAULT_SERVER_PORT,
+					Leases: []leases.Source{
+						{Path: "/var/lib/misc/dnsmasq.leases"},
+						{Path: "/proc/net/arp", Format: "arp"},
+					},
+				},
+				Storage: storage.NewDefaultStorageConfig(),
+			},
+		},
+		{
+			Name: "ValidConfigDiscovery",
+			Path: "testdata/valid-config-discovery.yaml",
+			Result: Config{
+				LogLevel: DEFAULT_LOG_LEVEL,
+				Server: ServerConfig{
+					Port: DEFAULT_SERVER_PORT,
+					Discovery: discovery.Config{
+						Enabled:     true,
+						Networks:    []string{"192.168.1.0/24", "192.168.2.0/24"},
+						CacheTTL:    10 * time.Minute,
+						MinInterval: 30 * time.Second,
+						Neighbors: leases.Source{
+							Path:   "/tmp/neigh.txt",
+							Format: "neigh",
+						},
+					},
+					Refresh: discovery.RefreshConfig{
+						Enabled:  true,
+						Interval: 2 * time.Minute,
+						Sources: []leases.Source{
+							{Path: "/var/lib/misc/dnsmasq.leases"},
+							{Path: "/proc/net/arp"},
+						},
+					},
+				},
+				Storage: storage.NewDefaultStorageConfig(),
+			},
+		},
 		{
 			Name: "ValidConfigFileBackend",
 			Path: "testdata/valid-config-file-backend.yaml",
@@ -82,9 +132,12 @@ func TestValidConfigs(t *testing.T) {
 				Storage: storage.StorageConfig{
 					Type:     "file",
 					Readonly: true,
+					Timeout:  storage.DEFAULT_TIMEOUT,
 					File: file.FileBackendConfig{
-						Path: "/data/storage",
+						Path:           "/data/storage",
+						ReloadInterval: file.DEFAULT_RELOAD_INTERVAL,
 					},
+					SQLite: sqlite.NewDefaultSQLiteBackendConfig(),
 				},
 			},
 		},
@@ -129,6 +182,16 @@ func TestInvalidConfig(t *testing.T) {
 			Path:     "testdata/invalid-config-ssl-2.yaml",
 			ErrorMsg: "incomplete SSL configuration",
 		},
+		{
+			Name:     "LeaseSourceMissingPath",
+			Path:     "testdata/invalid-config-leases-path.yaml",
+			ErrorMsg: "path must be set",
+		},
+		{
+			Name:     "LeaseSourceUnknownFormat",
+			Path:     "testdata/invalid-config-leases-format.yaml",
+			ErrorMsg: "unknown format 'xml'",
+		},
 	}
 
 	for _, tCase := range tMatrix {
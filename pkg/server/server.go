@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -9,34 +10,85 @@ import (
 	"strings"
 	"time"
 
+	"github.com/heathcliff26/go-wol/pkg/discovery"
+	"github.com/heathcliff26/go-wol/pkg/relay"
 	api "github.com/heathcliff26/go-wol/pkg/server/api/v1"
 	"github.com/heathcliff26/go-wol/pkg/server/config"
 	"github.com/heathcliff26/go-wol/pkg/server/storage"
+	"github.com/heathcliff26/go-wol/pkg/server/webhook"
 	"github.com/heathcliff26/go-wol/static"
 	"github.com/heathcliff26/simple-fileserver/pkg/middleware"
 )
 
 type Server struct {
-	addr    string
-	ssl     config.SSLConfig
-	storage *storage.Storage
+	addr      string
+	ssl       config.SSLConfig
+	storage   *storage.Storage
+	api       api.Options
+	refresher *discovery.Refresher
+	webhooks  *webhook.Sender
 }
 
-func NewServer(cfgServer config.ServerConfig, cfgStorage storage.StorageConfig) (*Server, error) {
+func NewServer(cfgServer config.ServerConfig, cfgStorage storage.StorageConfig) (_ *Server, err error) {
 	storage, err := storage.NewStorage(cfgStorage)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create storage: %w", err)
 	}
+	// Stop the background tasks of the storage when the rest of the config is invalid
+	defer func() {
+		if err != nil {
+			storage.Close()
+		}
+	}()
+
+	var scanner *discovery.Scanner
+	if cfgServer.Discovery.Enabled {
+		scanner, err = discovery.NewScanner(cfgServer.Discovery, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create discovery scanner: %w", err)
+		}
+	}
+
+	var refresher *discovery.Refresher
+	if cfgServer.Refresh.Enabled {
+		if storage.Readonly() {
+			return nil, fmt.Errorf("the automatic refresh of host addresses requires a writable storage")
+		}
+		refresher, err = discovery.NewRefresher(cfgServer.Refresh, storage, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create address refresher: %w", err)
+		}
+	}
+
+	relay, err := relay.NewRelay(cfgServer.Relay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create relay: %w", err)
+	}
+
+	var webhooks *webhook.Sender
+	if len(cfgServer.Webhooks) > 0 {
+		webhooks, err = webhook.NewSender(cfgServer.Webhooks)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create webhooks: %w", err)
+		}
+	}
 
 	return &Server{
 		addr:    ":" + strconv.Itoa(cfgServer.Port),
 		ssl:     cfgServer.SSL,
 		storage: storage,
+		api: api.Options{
+			Leases:    cfgServer.Leases,
+			Discovery: scanner,
+			Relay:     relay,
+		},
+		refresher: refresher,
+		webhooks:  webhooks,
 	}, nil
 }
 
 func (s *Server) indexHandler(res http.ResponseWriter, req *http.Request) {
-	indexHTML, indexChecksum, err := s.storage.GetIndexHTML()
+	indexHTML, indexChecksum, err := s.storage.GetIndexHTML(req.Context())
 	if err != nil {
 		slog.Error("Failed to get index.html", "err", err)
 		http.Error(res, "Internal Server Error", http.StatusInternalServerError)
@@ -61,19 +113,42 @@ func (s *Server) indexHandler(res http.ResponseWriter, req *http.Request) {
 
 // Starts the server and exits with error if that fails
 func (s *Server) Run() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer s.storage.Close()
+
+	if s.refresher != nil {
+		go s.refresher.Run(ctx)
+	}
+	if s.api.Relay != nil {
+		s.api.Relay.Run(ctx)
+	}
+	if s.webhooks != nil {
+		events, unsubscribe := s.storage.Subscribe()
+		defer unsubscribe()
+		go s.webhooks.Run(events)
+	}
+	go s.storage.Sync(ctx)
+
 	assetFS := StaticFileServer(static.Assets)
 
 	router := http.NewServeMux()
 	router.HandleFunc("GET /{$}", s.indexHandler)
 	router.HandleFunc("GET /index.html", s.indexHandler)
-	router.Handle("/api/v1/", http.StripPrefix("/api/v1", api.NewRouter(s.storage)))
+	apiRouter := http.StripPrefix("/api/v1", api.NewRouter(s.storage, s.api))
+	router.Handle("/api/v1/", apiRouter)
 	router.Handle("GET /css/", assetFS)
 	router.Handle("GET /icons/", assetFS)
 	router.Handle("GET /js/", assetFS)
 
+	handler := http.NewServeMux()
+	handler.Handle("/", middleware.Logging(router))
+	// The logging middleware does not support flushing, which is needed for streaming events
+	handler.Handle("GET /api/v1/events", apiRouter)
+
 	server := http.Server{
 		Addr:        s.addr,
-		Handler:     middleware.Logging(router),
+		Handler:     handler,
 		ReadTimeout: 10 * time.Second,
 	}
 
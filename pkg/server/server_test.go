@@ -5,6 +5,9 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/heathcliff26/go-wol/pkg/discovery"
+	"github.com/heathcliff26/go-wol/pkg/leases"
+	"github.com/heathcliff26/go-wol/pkg/relay"
 	"github.com/heathcliff26/go-wol/pkg/server/config"
 	"github.com/heathcliff26/go-wol/pkg/server/storage"
 	"github.com/heathcliff26/go-wol/static"
@@ -35,7 +38,7 @@ func TestNewServer(t *testing.T) {
 	assert.Equal(":8080", s.addr, "Server should have address set")
 	assert.Equal(cfgServer.SSL, s.ssl, "Server should have SSL Config")
 
-	indexHTML, indexChecksum, err := s.storage.GetIndexHTML()
+	indexHTML, indexChecksum, err := s.storage.GetIndexHTML(t.Context())
 	require.NoError(err, "Should create index.html")
 
 	assert.Contains(indexHTML, "testName", "Should add hostname to index.html")
@@ -44,6 +47,123 @@ func TestNewServer(t *testing.T) {
 	assert.NotEmpty(indexChecksum, "Server should have checksum of index.html")
 }
 
+func TestNewServerDiscovery(t *testing.T) {
+	cfgStorage := storage.NewDefaultStorageConfig()
+	cfgStorage.File.Path = "testdata/hosts.yaml"
+
+	t.Run("Enabled", func(t *testing.T) {
+		cfgServer := config.ServerConfig{
+			Discovery: discovery.Config{
+				Enabled:  true,
+				Networks: []string{"192.168.1.0/24"},
+			},
+		}
+
+		s, err := NewServer(cfgServer, cfgStorage)
+		require.NoError(t, err, "Should create new server")
+		assert.NotNil(t, s.api.Discovery, "Should create scanner")
+	})
+	t.Run("Disabled", func(t *testing.T) {
+		cfgServer := config.ServerConfig{
+			Discovery: discovery.Config{
+				Networks: []string{"192.168.1.0/24"},
+			},
+		}
+
+		s, err := NewServer(cfgServer, cfgStorage)
+		require.NoError(t, err, "Should create new server")
+		assert.Nil(t, s.api.Discovery, "Should not create scanner")
+	})
+	t.Run("InvalidConfig", func(t *testing.T) {
+		cfgServer := config.ServerConfig{
+			Discovery: discovery.Config{
+				Enabled: true,
+			},
+		}
+
+		s, err := NewServer(cfgServer, cfgStorage)
+		assert.ErrorContains(t, err, "failed to create discovery scanner", "Should fail")
+		assert.Nil(t, s, "Should not return server")
+	})
+}
+
+func TestNewServerRelay(t *testing.T) {
+	cfgStorage := storage.NewDefaultStorageConfig()
+	cfgStorage.File.Path = "testdata/hosts.yaml"
+
+	t.Run("Enabled", func(t *testing.T) {
+		cfgServer := config.ServerConfig{
+			Relay: relay.Config{
+				Enabled: true,
+				Token:   "token",
+			},
+		}
+
+		s, err := NewServer(cfgServer, cfgStorage)
+		require.NoError(t, err, "Should create new server")
+		assert.NotNil(t, s.api.Relay, "Should create relay")
+	})
+	t.Run("Disabled", func(t *testing.T) {
+		s, err := NewServer(config.ServerConfig{}, cfgStorage)
+		require.NoError(t, err, "Should create new server")
+		assert.Nil(t, s.api.Relay, "Should not create relay")
+	})
+	t.Run("InvalidConfig", func(t *testing.T) {
+		cfgServer := config.ServerConfig{
+			Relay: relay.Config{
+				Enabled: true,
+				Agents:  []relay.AgentConfig{{Site: "building-b", URL: "http://agent.example.org"}},
+			},
+		}
+
+		s, err := NewServer(cfgServer, cfgStorage)
+		assert.ErrorContains(t, err, "failed to create relay", "Should fail")
+		assert.Nil(t, s, "Should not return server")
+	})
+}
+
+func TestNewServerRefresh(t *testing.T) {
+	cfgStorage := storage.NewDefaultStorageConfig()
+	cfgStorage.File.Path = "testdata/hosts.yaml"
+
+	t.Run("Enabled", func(t *testing.T) {
+		cfgServer := config.ServerConfig{
+			Refresh: discovery.RefreshConfig{
+				Enabled: true,
+			},
+		}
+
+		s, err := NewServer(cfgServer, cfgStorage)
+		require.NoError(t, err, "Should create new server")
+		assert.NotNil(t, s.refresher, "Should create refresher")
+	})
+	t.Run("Readonly", func(t *testing.T) {
+		cfgServer := config.ServerConfig{
+			Refresh: discovery.RefreshConfig{
+				Enabled: true,
+			},
+		}
+		cfgStorage := cfgStorage
+		cfgStorage.Readonly = true
+
+		s, err := NewServer(cfgServer, cfgStorage)
+		assert.ErrorContains(t, err, "requires a writable storage", "Should fail")
+		assert.Nil(t, s, "Should not return server")
+	})
+	t.Run("InvalidConfig", func(t *testing.T) {
+		cfgServer := config.ServerConfig{
+			Refresh: discovery.RefreshConfig{
+				Enabled: true,
+				Sources: []leases.Source{{Path: "/tmp/table"}},
+			},
+		}
+
+		s, err := NewServer(cfgServer, cfgStorage)
+		assert.ErrorContains(t, err, "failed to create address refresher", "Should fail")
+		assert.Nil(t, s, "Should not return server")
+	})
+}
+
 func TestServer(t *testing.T) {
 	t.Run("SSL", func(t *testing.T) {
 		assert := assert.New(t)
@@ -84,7 +204,7 @@ func TestServer(t *testing.T) {
 	t.Run("IndexHandler", func(t *testing.T) {
 		assert := assert.New(t)
 
-		indexHTML, indexChecksum, err := s.storage.GetIndexHTML()
+		indexHTML, indexChecksum, err := s.storage.GetIndexHTML(t.Context())
 		require.NoError(t, err, "Should get index.html")
 
 		for _, path := range []string{"/", "/index.html"} {
@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 	"testing"
 
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
 	"github.com/heathcliff26/go-wol/pkg/version"
 	"github.com/heathcliff26/go-wol/static"
 	"github.com/stretchr/testify/assert"
@@ -57,4 +58,16 @@ func TestStaticFileServer(t *testing.T) {
 		assert.NotEmpty(res.Header().Get("Cache-Control"), "Should have Cache-Control header set")
 		assert.Equal(http.StatusOK, res.Code, "Should answer with Code 200")
 	})
+	t.Run("HostIcons", func(t *testing.T) {
+		fs := StaticFileServer(static.Assets)
+
+		for _, icon := range types.HostIcons {
+			res := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/icons/hosts/"+icon+".svg", nil)
+
+			fs.ServeHTTP(res, req)
+
+			assert.Equal(t, http.StatusOK, res.Code, "Should serve icon %s", icon)
+		}
+	})
 }
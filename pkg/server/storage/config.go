@@ -1,27 +1,39 @@
 package storage
 
 import (
+	"time"
+
 	"github.com/heathcliff26/go-wol/pkg/server/storage/file"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/kubernetes"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/postgres"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/sqlite"
 	"github.com/heathcliff26/go-wol/pkg/server/storage/valkey"
 )
 
 const (
 	DEFAULT_READONLY     = false
 	DEFAULT_BACKEND_TYPE = "file"
+	DEFAULT_TIMEOUT      = 5 * time.Second
 )
 
 type StorageConfig struct {
-	Type        string                 `yaml:"type"`
-	Readonly    bool                   `yaml:"readonly,omitempty"`
-	SeededHosts string                 `yaml:"seeded-hosts,omitempty"`
-	File        file.FileBackendConfig `yaml:"file,omitempty"`
-	Valkey      valkey.ValkeyConfig    `yaml:"valkey,omitempty"`
+	Type        string                             `yaml:"type"`
+	Readonly    bool                               `yaml:"readonly,omitempty"`
+	SeededHosts string                             `yaml:"seeded-hosts,omitempty"`
+	Timeout     time.Duration                      `yaml:"timeout,omitempty"`
+	File        file.FileBackendConfig             `yaml:"file,omitempty"`
+	SQLite      sqlite.SQLiteBackendConfig         `yaml:"sqlite,omitempty"`
+	Postgres    postgres.PostgresBackendConfig     `yaml:"postgres,omitempty"`
+	Valkey      valkey.ValkeyConfig                `yaml:"valkey,omitempty"`
+	Kubernetes  kubernetes.KubernetesBackendConfig `yaml:"kubernetes,omitempty"`
 }
 
 func NewDefaultStorageConfig() StorageConfig {
 	return StorageConfig{
 		Type:     DEFAULT_BACKEND_TYPE,
 		Readonly: DEFAULT_READONLY,
+		Timeout:  DEFAULT_TIMEOUT,
 		File:     file.NewDefaultFileBackendConfig(),
+		SQLite:   sqlite.NewDefaultSQLiteBackendConfig(),
 	}
 }
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+)
+
+// Number of events buffered for each subscriber before new events are dropped
+const subscriberBufferSize = 32
+
+// Timeout for publishing an event to other instances
+const publishTimeout = 5 * time.Second
+
+// Distributes events to all subscribers
+type broker struct {
+	lock        sync.Mutex
+	subscribers map[chan types.Event]struct{}
+}
+
+// Return a channel receiving all future changes to the hosts, including the ones made by other instances.
+// The returned function needs to be called to unsubscribe, it closes the channel.
+// Events are dropped when the subscriber is not able to keep up.
+func (s *Storage) Subscribe() (<-chan types.Event, func()) {
+	s.events.lock.Lock()
+	defer s.events.lock.Unlock()
+
+	events := make(chan types.Event, subscriberBufferSize)
+	if s.events.subscribers == nil {
+		s.events.subscribers = make(map[chan types.Event]struct{})
+	}
+	s.events.subscribers[events] = struct{}{}
+
+	return events, func() {
+		s.events.lock.Lock()
+		defer s.events.lock.Unlock()
+
+		if _, ok := s.events.subscribers[events]; ok {
+			delete(s.events.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// Close the channels of all subscribers, they receive no further events.
+func (b *broker) close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for events := range b.subscribers {
+		delete(b.subscribers, events)
+		close(events)
+	}
+}
+
+// Forward the events of other instances sharing the backend to the subscribers, until ctx is canceled.
+// Returns immediately when the backend is not shared.
+func (s *Storage) Sync(ctx context.Context) {
+	backend, ok := s.backend.(types.EventBackend)
+	if !ok {
+		return
+	}
+
+	slog.Info("Receiving changes from other instances")
+	backend.SubscribeEvents(ctx, s.deliver)
+}
+
+// Deliver the event to all subscribers and publish it to the other instances.
+func (s *Storage) publish(event types.Event) {
+	s.deliver(event)
+
+	backend, ok := s.backend.(types.EventBackend)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	err := backend.PublishEvent(ctx, event)
+	if err != nil {
+		slog.Warn("Failed to publish change to other instances", slog.String("type", string(event.Type)), "err", err)
+	}
+}
+
+// Send the event to all subscribers, without waiting for slow subscribers.
+func (s *Storage) deliver(event types.Event) {
+	s.events.lock.Lock()
+	defer s.events.lock.Unlock()
+
+	for events := range s.events.subscribers {
+		select {
+		case events <- event:
+		default:
+			slog.Debug("Subscriber is not keeping up, dropping event", slog.String("id", event.ID))
+		}
+	}
+}
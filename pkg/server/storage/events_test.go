@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Backend shared between instances, records published events and delivers the remote ones on subscription.
+type MockEventBackend struct {
+	MockBackend
+	published []types.Event
+	remote    []types.Event
+}
+
+func (m *MockEventBackend) PublishEvent(_ context.Context, event types.Event) error {
+	m.published = append(m.published, event)
+	return nil
+}
+
+func (m *MockEventBackend) SubscribeEvents(_ context.Context, handler func(types.Event)) {
+	for _, event := range m.remote {
+		handler(event)
+	}
+}
+
+func receiveEvent(t *testing.T, events <-chan types.Event) types.Event {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		require.FailNow(t, "Should receive event")
+		return types.Event{}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	mockBackend := new(MockBackend)
+	s := &Storage{backend: mockBackend}
+
+	events, unsubscribe := s.Subscribe()
+
+	t.Run("AddHost", func(t *testing.T) {
+		mockBackend.On("AddHost", mock.Anything).Return(nil).Once()
+		require.NoError(t, s.AddHost(t.Context(), types.Host{MAC: "aa:bb:cc:dd:ee:ff", Name: "TestHost"}))
+
+		event := receiveEvent(t, events)
+		assert.Equal(t, types.EventHostUpdated, event.Type)
+		assert.Equal(t, "AA:BB:CC:DD:EE:FF", event.MAC, "Should use the normalized mac")
+		assert.Equal(t, &types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"}, event.Host)
+		assert.NotEmpty(t, event.ID, "Should have an id")
+	})
+
+	t.Run("RemoveHost", func(t *testing.T) {
+		mockBackend.On("RemoveHost", "aa:bb:cc:dd:ee:ff").Return(nil).Once()
+		require.NoError(t, s.RemoveHost(t.Context(), "aa:bb:cc:dd:ee:ff"))
+
+		event := receiveEvent(t, events)
+		assert.Equal(t, types.EventHostRemoved, event.Type)
+		assert.Equal(t, "AA:BB:CC:DD:EE:FF", event.MAC)
+		assert.Nil(t, event.Host)
+	})
+
+	t.Run("MoveHost", func(t *testing.T) {
+		mockBackend.On("MoveHost", "AA:BB:CC:DD:EE:FF", 1).Return(nil).Once()
+		require.NoError(t, s.MoveHost(t.Context(), "AA:BB:CC:DD:EE:FF", 1))
+
+		event := receiveEvent(t, events)
+		assert.Equal(t, types.EventHostsReordered, event.Type)
+		assert.Equal(t, "AA:BB:CC:DD:EE:FF", event.MAC)
+	})
+
+	t.Run("ReorderHosts", func(t *testing.T) {
+		mockBackend.On("ReorderHosts", []string{"AA:BB:CC:DD:EE:FF"}).Return(nil).Once()
+		require.NoError(t, s.ReorderHosts(t.Context(), []string{"AA:BB:CC:DD:EE:FF"}))
+
+		event := receiveEvent(t, events)
+		assert.Equal(t, types.EventHostsReordered, event.Type)
+		assert.Empty(t, event.MAC)
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		mockBackend.On("RemoveHost", "11:22:33:44:55:66").Return(assert.AnError).Once()
+		require.Error(t, s.RemoveHost(t.Context(), "11:22:33:44:55:66"))
+
+		assert.Empty(t, events, "Should not send events for failed changes")
+	})
+
+	t.Run("Unsubscribe", func(t *testing.T) {
+		unsubscribe()
+		unsubscribe()
+
+		_, ok := <-events
+		assert.False(t, ok, "Should close the channel")
+
+		mockBackend.On("RemoveHost", "AA:BB:CC:DD:EE:FF").Return(nil).Once()
+		assert.NoError(t, s.RemoveHost(t.Context(), "AA:BB:CC:DD:EE:FF"), "Should not send to closed channel")
+	})
+}
+
+func TestSubscribeSlowSubscriber(t *testing.T) {
+	mockBackend := new(MockBackend)
+	mockBackend.On("RemoveHost", mock.Anything).Return(nil)
+	s := &Storage{backend: mockBackend}
+
+	events, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+
+	for range subscriberBufferSize + 1 {
+		require.NoError(t, s.RemoveHost(t.Context(), "AA:BB:CC:DD:EE:FF"), "Should not block")
+	}
+	assert.Len(t, events, subscriberBufferSize, "Should drop events when the buffer is full")
+}
+
+func TestSync(t *testing.T) {
+	remote := types.NewEvent(types.EventHostRemoved, "11:22:33:44:55:66", nil)
+	mockBackend := &MockEventBackend{remote: []types.Event{remote}}
+	mockBackend.On("AddHost", mock.Anything).Return(nil)
+	s := &Storage{backend: mockBackend}
+
+	events, unsubscribe := s.Subscribe()
+	defer unsubscribe()
+
+	require.NoError(t, s.AddHost(t.Context(), types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"}))
+	local := receiveEvent(t, events)
+	require.Len(t, mockBackend.published, 1, "Should publish the change to other instances")
+	assert.Equal(t, local, mockBackend.published[0], "Should publish the same event")
+
+	s.Sync(t.Context())
+	assert.Equal(t, remote, receiveEvent(t, events), "Should forward events of other instances")
+	assert.Len(t, mockBackend.published, 1, "Should not publish events of other instances again")
+}
@@ -0,0 +1,127 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Returned by writeFileAtomic when the file can't be replaced, e.g. because it is bind-mounted into a container.
+var errNotReplaceable = errors.New("file can't be replaced")
+
+// Functions used for writing files, replaced in tests to inject faults.
+var (
+	writeData = func(f *os.File, data []byte) error {
+		_, err := f.Write(data)
+		return err
+	}
+	syncFile = (*os.File).Sync
+	rename   = os.Rename
+)
+
+// Write the data to a temporary file in the same directory and rename it to path once it is synced to disk.
+// This ensures that path contains either the old or the new content, even when crashing mid-write.
+// If given, beforeReplace is called right before replacing the file and aborts the write on error.
+// Returns errNotReplaceable without changing the file when it can't be replaced, see writeFileInPlace.
+func writeFileAtomic(path string, data []byte, perm os.FileMode, beforeReplace func() error) error {
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+	}()
+
+	err = writeData(tmp, data)
+	if err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	err = tmp.Chmod(perm)
+	if err != nil {
+		return fmt.Errorf("failed to set permissions of temporary file: %w", err)
+	}
+	err = syncFile(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	if beforeReplace != nil {
+		err = beforeReplace()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = rename(tmpPath, path)
+	if errors.Is(err, syscall.EBUSY) {
+		// A file bind-mounted into a container can't be replaced, only written in place.
+		return fmt.Errorf("%w: %w", errNotReplaceable, err)
+	} else if err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+
+	// Persist the rename, not supported on all platforms, so ignore errors.
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+	return nil
+}
+
+// Overwrite the file with the data, for files that can't be replaced.
+// This is not atomic, a crash mid-write leaves the file incomplete, so the caller needs to keep a backup to recover from.
+func writeFileInPlace(path string, data []byte) error {
+	//#nosec G304 -- The path is given by the configuration.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	err = writeData(f, data)
+	if err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	err = syncFile(f)
+	if err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	return f.Close()
+}
+
+// Return the path of the n-th backup, starting with 0 for the most recent one.
+func backupPath(path string, n int) string {
+	if n == 0 {
+		return path + ".bak"
+	}
+	return fmt.Sprintf("%s.bak.%d", path, n)
+}
+
+// Copy the current content of path to the most recent backup, after moving the existing backups back by one.
+// Keeps at most count backups.
+func rotateBackups(path string, count int, perm os.FileMode) error {
+	//#nosec G304 -- The path is given by the configuration.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	for i := count - 1; i > 0; i-- {
+		err = os.Rename(backupPath(path, i-1), backupPath(path, i))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate backup: %w", err)
+		}
+	}
+
+	return writeFileAtomic(backupPath(path, 0), data, perm, nil)
+}
@@ -1,15 +1,26 @@
 package file
 
+import "time"
+
 const (
-	DEFAULT_FILE_PATH = "hosts.yaml"
+	DEFAULT_FILE_PATH       = "hosts.yaml"
+	DEFAULT_RELOAD_INTERVAL = 5 * time.Second
 )
 
 type FileBackendConfig struct {
+	// Path to the hosts file. Changes are coordinated through the lock file "<path>.lock" next to it,
+	// which is kept after shutting down so that all instances sharing the file lock the same one.
 	Path string `yaml:"path,omitempty"`
+	// Number of backups of the previous content to keep, disabled when 0
+	Backups int `yaml:"backups,omitempty"`
+	// How often to check the file for external changes, disabled when 0.
+	// The file is always checked before changing it.
+	ReloadInterval time.Duration `yaml:"reload-interval,omitempty"`
 }
 
 func NewDefaultFileBackendConfig() FileBackendConfig {
 	return FileBackendConfig{
-		Path: DEFAULT_FILE_PATH,
+		Path:           DEFAULT_FILE_PATH,
+		ReloadInterval: DEFAULT_RELOAD_INTERVAL,
 	}
 }
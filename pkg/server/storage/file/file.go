@@ -1,73 +1,94 @@
 package file
 
 import (
+	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
 	"go.yaml.in/yaml/v3"
 )
 
+// How often a change is retried when the file was changed concurrently
+const maxConflictRetries = 3
+
+// Returned by save when the file has been changed since it was last read
+var errConflict = errors.New("storage file has been changed externally")
+
 type FileBackend struct {
 	path    string
+	backups int
 	storage *types.HostsFile
 	lock    sync.RWMutex
+
+	// Checksum of the file content the hosts were last read from or written to
+	checksum [sha256.Size]byte
+	// The hosts have been normalized after reading the file and need to be saved
+	pending bool
+	// The file could not be parsed and the hosts have been read from the most recent backup instead
+	restored bool
+	// The file can't be replaced and is written in place, see writeFileInPlace
+	inPlace bool
+	// Last error when reloading, to avoid repeating the same warning
+	reloadErr string
+
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
 func NewFileBackend(cfg FileBackendConfig) (*FileBackend, error) {
+	if cfg.Backups < 0 {
+		return nil, fmt.Errorf("number of backups can't be negative")
+	}
+
 	fb := &FileBackend{
-		path: cfg.Path,
+		path:    cfg.Path,
+		backups: cfg.Backups,
 		storage: &types.HostsFile{
 			Hosts: []types.Host{},
 		},
+		done: make(chan struct{}),
 	}
 
 	f, err := os.ReadFile(cfg.Path)
 	if os.IsNotExist(err) {
 		slog.Info("File not found, creating new file", slog.String("path", cfg.Path))
-		err := fb.save()
+		// Another instance might create the file at the same time, in which case its content is used.
+		err := fb.modify(context.Background(), func() (bool, error) { return true, nil })
 		if err != nil {
 			return nil, fmt.Errorf("failed to create new storage file: %w", err)
 		}
-		return fb, nil
 	} else if err != nil {
 		return nil, fmt.Errorf("failed to read storage file: %w", err)
-	}
-
-	err = yaml.Unmarshal(f, fb.storage)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal storage file: %w", err)
-	}
-
-	slog.Debug("Storage file loaded", slog.String("path", cfg.Path))
-
-	// Ensure that all MAC addresses are uppercase and unique
-	macSet := make(map[string]bool, len(fb.storage.Hosts))
-	uniqueHosts := make([]types.Host, 0, len(fb.storage.Hosts))
-	changed := false
-	for _, host := range fb.storage.Hosts {
-		uppercaseMAC := strings.ToUpper(host.MAC)
-		if host.MAC != uppercaseMAC {
-			changed = true
+	} else {
+		err := fb.load(f)
+		if err != nil {
+			return nil, err
 		}
-		if !macSet[uppercaseMAC] {
-			macSet[uppercaseMAC] = true
-			host.MAC = uppercaseMAC
-			uniqueHosts = append(uniqueHosts, host)
-		} else {
-			changed = true
+		slog.Debug("Storage file loaded", slog.String("path", cfg.Path))
+
+		if fb.pending {
+			err := fb.modify(context.Background(), func() (bool, error) { return false, nil })
+			if err != nil {
+				return nil, fmt.Errorf("failed to save storage file after ensuring unique, uppercase MAC addresses: %w", err)
+			}
 		}
 	}
-	fb.storage.Hosts = uniqueHosts
 
-	if changed {
-		err := fb.save()
-		if err != nil {
-			return nil, fmt.Errorf("failed to save storage file after ensuring unique, uppercase MAC addresses: %w", err)
-		}
+	var ctx context.Context
+	ctx, fb.cancel = context.WithCancel(context.Background())
+	if cfg.ReloadInterval > 0 {
+		go fb.watch(ctx, cfg.ReloadInterval)
+	} else {
+		close(fb.done)
 	}
 
 	return fb, nil
@@ -75,39 +96,39 @@ func NewFileBackend(cfg FileBackendConfig) (*FileBackend, error) {
 
 // Add a new host, overwrite existing host name if it already exists.
 // Ensures that the MAC address is unique and uppercase.
-func (fb *FileBackend) AddHost(host types.Host) error {
-	fb.lock.Lock()
-	defer fb.lock.Unlock()
-
+func (fb *FileBackend) AddHost(ctx context.Context, host types.Host) error {
 	host.MAC = strings.ToUpper(host.MAC)
-	for i, h := range fb.storage.Hosts {
-		if h.MAC == host.MAC {
-			fb.storage.Hosts[i] = host
-			return fb.save()
+
+	return fb.modify(ctx, func() (bool, error) {
+		for i, h := range fb.storage.Hosts {
+			if h.MAC == host.MAC {
+				fb.storage.Hosts[i] = host
+				return true, nil
+			}
 		}
-	}
 
-	fb.storage.Hosts = append(fb.storage.Hosts, host)
-	return fb.save()
+		fb.storage.Hosts = append(fb.storage.Hosts, host)
+		return true, nil
+	})
 }
 
 // Remove a host, ignore if the host does not exist
-func (fb *FileBackend) RemoveHost(mac string) error {
-	fb.lock.Lock()
-	defer fb.lock.Unlock()
-
+func (fb *FileBackend) RemoveHost(ctx context.Context, mac string) error {
 	uppercaseMAC := strings.ToUpper(mac)
-	for i, host := range fb.storage.Hosts {
-		if host.MAC == uppercaseMAC {
-			fb.storage.Hosts = append(fb.storage.Hosts[:i], fb.storage.Hosts[i+1:]...)
-			return fb.save()
+
+	return fb.modify(ctx, func() (bool, error) {
+		for i, host := range fb.storage.Hosts {
+			if host.MAC == uppercaseMAC {
+				fb.storage.Hosts = append(fb.storage.Hosts[:i], fb.storage.Hosts[i+1:]...)
+				return true, nil
+			}
 		}
-	}
-	return nil
+		return false, nil
+	})
 }
 
 // Return the host name for a given MAC address, return empty if not found
-func (fb *FileBackend) GetHost(mac string) (types.Host, error) {
+func (fb *FileBackend) GetHost(_ context.Context, mac string) (types.Host, error) {
 	fb.lock.RLock()
 	defer fb.lock.RUnlock()
 
@@ -121,15 +142,42 @@ func (fb *FileBackend) GetHost(mac string) (types.Host, error) {
 }
 
 // Return all hosts
-func (fb *FileBackend) GetHosts() ([]types.Host, error) {
+func (fb *FileBackend) GetHosts(_ context.Context) ([]types.Host, error) {
 	fb.lock.RLock()
 	defer fb.lock.RUnlock()
 
 	return append([]types.Host{}, fb.storage.Hosts...), nil
 }
 
+// Move a host to the given index, the index is capped to the bounds of the list.
+// Returns ErrHostNotFound if the host does not exist.
+func (fb *FileBackend) MoveHost(ctx context.Context, mac string, index int) error {
+	return fb.modify(ctx, func() (bool, error) {
+		order, err := types.MoveToIndex(fb.macs(), mac, index)
+		if err != nil {
+			return false, err
+		}
+		fb.sortHosts(order)
+		return true, nil
+	})
+}
+
+// Sort the hosts by the given list of MAC addresses.
+// Hosts not contained in the list keep their relative order after the listed hosts.
+// Returns ErrHostNotFound if the list contains an unknown host.
+func (fb *FileBackend) ReorderHosts(ctx context.Context, macs []string) error {
+	return fb.modify(ctx, func() (bool, error) {
+		order, err := types.ApplyOrder(fb.macs(), macs)
+		if err != nil {
+			return false, err
+		}
+		fb.sortHosts(order)
+		return true, nil
+	})
+}
+
 // Check if the storage backend is readonly
-func (fb *FileBackend) Readonly() (bool, error) {
+func (fb *FileBackend) Readonly(_ context.Context) (bool, error) {
 	//#nosec G302 -- The file does not contain sensitive data, so it can be world readable. Additionally final permissions are determined by the umask.
 	f, err := os.OpenFile(fb.path, os.O_RDWR, 0644)
 	if err != nil {
@@ -139,18 +187,357 @@ func (fb *FileBackend) Readonly() (bool, error) {
 	return false, nil
 }
 
+// Stop watching the file for changes
+func (fb *FileBackend) Close() {
+	fb.cancel()
+	<-fb.done
+}
+
+// Return the MAC addresses of all hosts in their current order.
+// Caller needs to hold the lock.
+func (fb *FileBackend) macs() []string {
+	macs := make([]string, 0, len(fb.storage.Hosts))
+	for _, host := range fb.storage.Hosts {
+		macs = append(macs, host.MAC)
+	}
+	return macs
+}
+
+// Sort the hosts by the given order.
+// Caller needs to hold the lock.
+func (fb *FileBackend) sortHosts(order []string) {
+	hosts := make(map[string]types.Host, len(fb.storage.Hosts))
+	for _, host := range fb.storage.Hosts {
+		hosts[host.MAC] = host
+	}
+
+	sorted := make([]types.Host, 0, len(order))
+	for _, mac := range order {
+		sorted = append(sorted, hosts[mac])
+	}
+	fb.storage.Hosts = sorted
+}
+
+// Reload the file and apply fn to the hosts, save them afterwards if fn reports a change.
+// Holds the file lock, so other instances using the same file can't change it in between.
+// When the file is changed by someone else while saving, the change is applied again on the new content.
+// Taking the locks can't be interrupted, so ctx is checked once they are held.
+func (fb *FileBackend) modify(ctx context.Context, fn func() (bool, error)) error {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	unlock, err := fb.lockFile()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	for range maxConflictRetries {
+		err := fb.reload()
+		if err != nil {
+			return err
+		}
+
+		changed, err := fn()
+		if err != nil {
+			return err
+		}
+		if !changed && !fb.pending {
+			return nil
+		}
+
+		// On conflict the next reload replaces the hosts with the new content of the file.
+		err = fb.save()
+		if !errors.Is(err, errConflict) {
+			return err
+		}
+		slog.Warn("Storage file has been changed while saving, retrying", slog.String("path", fb.path))
+	}
+	return fmt.Errorf("failed to save storage file after %d retries: %w", maxConflictRetries, errConflict)
+}
+
+// Periodically reload the file until the context is canceled.
+func (fb *FileBackend) watch(ctx context.Context, interval time.Duration) {
+	defer close(fb.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := fb.refresh()
+
+		if ctx.Err() != nil {
+			return
+		} else if err == nil {
+			fb.reloadErr = ""
+		} else if err.Error() != fb.reloadErr {
+			fb.reloadErr = err.Error()
+			slog.Warn("Failed to reload storage file", slog.String("path", fb.path), "err", err)
+		}
+	}
+}
+
+// Read the file again if its content has changed, without taking the file lock or writing to the file.
+// The exclusive lock is only held to replace the hosts, hosts that need to be normalized are saved by the next write.
+func (fb *FileBackend) refresh() error {
+	fb.lock.RLock()
+	checksum := fb.checksum
+	fb.lock.RUnlock()
+
+	//#nosec G304 -- The path is given by the configuration.
+	data, err := os.ReadFile(fb.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read storage file: %w", err)
+	}
+	if sha256.Sum256(data) == checksum {
+		return nil
+	}
+
+	storage, changed, err := parseHostsFile(data)
+	if err != nil {
+		return err
+	}
+
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	// A write in between has already read a newer version of the file
+	if fb.checksum != checksum {
+		return nil
+	}
+	fb.storage = storage
+	fb.checksum = sha256.Sum256(data)
+	fb.pending = changed
+	slog.Info("Reloaded storage file after it has been changed", slog.String("path", fb.path))
+	return nil
+}
+
+// Read the file again if its content has changed.
+// A removed file is recreated on the next save.
+// Caller needs to hold the lock and the file lock.
+func (fb *FileBackend) reload() error {
+	//#nosec G304 -- The path is given by the configuration.
+	data, err := os.ReadFile(fb.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read storage file: %w", err)
+	}
+	if sha256.Sum256(data) == fb.checksum {
+		return nil
+	}
+
+	err = fb.load(data)
+	if err != nil {
+		return err
+	}
+	slog.Info("Reloaded storage file after it has been changed", slog.String("path", fb.path))
+	return nil
+}
+
+// Parse the content of the file and replace the hosts.
+// Ensures that all MAC addresses are uppercase and unique, marks the hosts as pending if any have been changed.
+// When the file can't be parsed, e.g. because writing it in place was interrupted, the most recent backup is used
+// and the file is overwritten with it on the next save.
+// Caller needs to hold the lock.
+func (fb *FileBackend) load(data []byte) error {
+	storage, changed, err := parseHostsFile(data)
+	if err != nil {
+		var backupErr error
+		storage, backupErr = fb.readBackup()
+		if backupErr != nil {
+			return err
+		}
+		slog.Warn("Failed to parse storage file, using the most recent backup instead", slog.String("path", fb.path), slog.String("backup", backupPath(fb.path, 0)), "err", err)
+		changed = true
+	}
+
+	fb.storage = storage
+	fb.checksum = sha256.Sum256(data)
+	fb.pending = changed
+	fb.restored = err != nil
+	return nil
+}
+
+// Read the hosts from the most recent backup
+func (fb *FileBackend) readBackup() (*types.HostsFile, error) {
+	//#nosec G304 -- The path is given by the configuration.
+	data, err := os.ReadFile(backupPath(fb.path, 0))
+	if err != nil {
+		return nil, err
+	}
+	storage, _, err := parseHostsFile(data)
+	return storage, err
+}
+
+// Parse the content of the file, ensuring that all MAC addresses are uppercase and unique.
+// Returns if any of the hosts have been changed by that.
+func parseHostsFile(data []byte) (*types.HostsFile, bool, error) {
+	storage := &types.HostsFile{}
+	err := yaml.Unmarshal(data, storage)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal storage file: %w", err)
+	}
+
+	macSet := make(map[string]bool, len(storage.Hosts))
+	uniqueHosts := make([]types.Host, 0, len(storage.Hosts))
+	changed := false
+	for _, host := range storage.Hosts {
+		uppercaseMAC := strings.ToUpper(host.MAC)
+		if host.MAC != uppercaseMAC {
+			changed = true
+		}
+		if !macSet[uppercaseMAC] {
+			macSet[uppercaseMAC] = true
+			host.MAC = uppercaseMAC
+			uniqueHosts = append(uniqueHosts, host)
+		} else {
+			changed = true
+		}
+	}
+	storage.Hosts = uniqueHosts
+	return storage, changed, nil
+}
+
+// Take the advisory lock shared by all instances using the same file, released by calling the returned function.
+// The lock is held on a separate file, as the storage file itself is replaced when saving.
+// Caller needs to hold the lock.
+func (fb *FileBackend) lockFile() (func(), error) {
+	//#nosec G302 -- The lock file does not contain any data.
+	f, err := os.OpenFile(fb.path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if errors.Is(err, fs.ErrPermission) || errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.EROFS) {
+		// Without permission to create files in the directory, the storage file can't be replaced by anyone either.
+		slog.Debug("Can't create lock file, continuing without it", slog.String("path", fb.path), "err", err)
+		return func() {}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	err = flock(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to lock storage file: %w", err)
+	}
+	return func() { _ = f.Close() }, nil
+}
+
+// Fail with errConflict if the file content differs from the one last read or written.
+// Caller needs to hold the lock.
+func (fb *FileBackend) checkUnchanged() error {
+	//#nosec G304 -- The path is given by the configuration.
+	data, err := os.ReadFile(fb.path)
+	if os.IsNotExist(err) || len(data) == 0 {
+		// Nothing that could be overwritten
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read storage file: %w", err)
+	}
+	if sha256.Sum256(data) != fb.checksum {
+		return errConflict
+	}
+	return nil
+}
+
+// Write the hosts to the file.
+// The file is replaced atomically, keeping its permissions.
+// Returns errConflict instead if the file has been changed since it was last read.
+// Caller needs to hold the lock.
 func (fb *FileBackend) save() error {
 	data, err := yaml.Marshal(fb.storage)
 	if err != nil {
 		return fmt.Errorf("failed to marshal storage data: %w", err)
 	}
 
-	// #nosec G306 -- The file does not contain sensitive data, so it can be world readable. Additionally final permissions are determined by the umask.
-	err = os.WriteFile(fb.path, data, 0644)
+	info, err := os.Stat(fb.path)
+	if os.IsNotExist(err) {
+		// Create the file first, so that the umask is applied to its permissions.
+		// #nosec G302 -- The file does not contain sensitive data, so it can be world readable. Additionally final permissions are determined by the umask.
+		var f *os.File
+		f, err = os.OpenFile(fb.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to create storage file: %w", err)
+		}
+		_ = f.Close()
+		info, err = os.Stat(fb.path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check storage file: %w", err)
+	}
+	perm := info.Mode().Perm()
+
+	// Replacing the file would ignore missing write permissions on it.
+	f, err := os.OpenFile(fb.path, os.O_WRONLY, perm)
 	if err != nil {
 		return fmt.Errorf("failed to write storage file: %w", err)
 	}
+	_ = f.Close()
+
+	// Keep the backup the hosts have been restored from, instead of replacing it with the content that can't be parsed
+	backup := info.Size() > 0 && !fb.restored
+	// Rotate the backups only after the conflict check, a conflict would otherwise rotate them again on every retry.
+	beforeReplace := func() error {
+		err := fb.checkUnchanged()
+		if err != nil {
+			return err
+		}
+		if fb.backups > 0 && backup {
+			err = rotateBackups(fb.path, fb.backups, perm)
+			if err != nil {
+				slog.Warn("Failed to create backup of storage file", slog.String("path", fb.path), "err", err)
+			} else {
+				backup = false
+			}
+		}
+		return nil
+	}
+
+	err = writeFileAtomic(fb.path, data, perm, beforeReplace)
+	if errors.Is(err, errNotReplaceable) {
+		err = fb.saveInPlace(data, perm, backup)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write storage file: %w", err)
+	}
+	fb.checksum = sha256.Sum256(data)
+	fb.pending = false
+	fb.restored = false
 
 	slog.Debug("Storage file saved", slog.String("path", fb.path))
 	return nil
 }
+
+// Write the file in place when it can't be replaced.
+// The previous content is kept as backup first, so an interrupted write can be recovered from when loading the file.
+// Caller needs to hold the lock and the file lock.
+func (fb *FileBackend) saveInPlace(data []byte, perm os.FileMode, backup bool) error {
+	if !fb.inPlace {
+		fb.inPlace = true
+		slog.Warn("Can't replace storage file, e.g. because it is bind-mounted, writing it in place instead. This is not atomic, an interrupted write is recovered from the backup", slog.String("path", fb.path), slog.String("backup", backupPath(fb.path, 0)))
+	}
+
+	err := fb.checkUnchanged()
+	if err != nil {
+		return err
+	}
+
+	if backup {
+		err = rotateBackups(fb.path, 1, perm)
+		if err != nil {
+			return fmt.Errorf("failed to create backup before writing in place: %w", err)
+		}
+	}
+	return writeFileInPlace(fb.path, data)
+}
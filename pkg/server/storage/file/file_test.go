@@ -1,8 +1,15 @@
 package file
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/heathcliff26/go-wol/pkg/server/storage/testsuite"
 	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
@@ -151,16 +158,407 @@ func TestReadonly(t *testing.T) {
 	require.NoError(err, "Failed to create file backend")
 	assert.NotNil(fb, "File backend should not be nil")
 
-	readonly, err := fb.Readonly()
+	readonly, err := fb.Readonly(t.Context())
 	assert.True(readonly, "File backend should be readonly")
 	assert.NoError(err, "Should not fail to check readonly status")
 
 	fb.path = "testdata/basic.yaml"
-	readonly, err = fb.Readonly()
+	readonly, err = fb.Readonly(t.Context())
 	assert.False(readonly, "File backend should be writable")
 	assert.NoError(err, "Should not fail to check readonly status")
 }
 
+func TestSave(t *testing.T) {
+	t.Run("KeepPermissions", func(t *testing.T) {
+		require := require.New(t)
+		path := t.TempDir() + "/hosts.yaml"
+
+		require.NoError(copyFile("testdata/basic.yaml", path, 0600), "Failed to copy file")
+
+		fb, err := NewFileBackend(FileBackendConfig{Path: path})
+		require.NoError(err, "Failed to create file backend")
+		require.NoError(fb.AddHost(t.Context(), types.Host{MAC: "77:88:99:AA:BB:CC", Name: "TestHost3"}))
+
+		info, err := os.Stat(path)
+		require.NoError(err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "Should keep the permissions of the file")
+	})
+
+	t.Run("Backups", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		path := t.TempDir() + "/hosts.yaml"
+
+		fb, err := NewFileBackend(FileBackendConfig{Path: path, Backups: 2})
+		require.NoError(err, "Failed to create file backend")
+		assert.NoFileExists(backupPath(path, 0), "Should not backup a new file")
+
+		for _, host := range basicTestHosts {
+			require.NoError(fb.AddHost(t.Context(), host))
+		}
+		require.NoError(fb.RemoveHost(t.Context(), basicTestHosts[0].MAC))
+
+		f, err := os.ReadFile(backupPath(path, 0))
+		require.NoError(err, "Should have the most recent backup")
+		assert.Contains(string(f), basicTestHosts[1].MAC, "Most recent backup should contain the previous content")
+		f, err = os.ReadFile(backupPath(path, 1))
+		require.NoError(err, "Should have an older backup")
+		assert.NotContains(string(f), basicTestHosts[1].MAC, "Older backup should contain older content")
+		assert.Contains(string(f), basicTestHosts[0].MAC, "Older backup should contain older content")
+		assert.NoFileExists(backupPath(path, 2), "Should only keep the configured number of backups")
+	})
+
+	t.Run("NegativeBackups", func(t *testing.T) {
+		fb, err := NewFileBackend(FileBackendConfig{Path: t.TempDir() + "/hosts.yaml", Backups: -1})
+		assert.Error(t, err, "Should not accept negative number of backups")
+		assert.Nil(t, fb, "File backend should be nil")
+	})
+}
+
+func TestSaveFaultInjection(t *testing.T) {
+	errInjected := errors.New("injected fault")
+
+	tMatrix := []struct {
+		Name   string
+		Inject func()
+	}{
+		{
+			Name: "DiskFull",
+			Inject: func() {
+				writeData = func(f *os.File, data []byte) error {
+					_, _ = f.Write(data[:len(data)/2])
+					return errInjected
+				}
+			},
+		},
+		{
+			Name: "SyncFailed",
+			Inject: func() {
+				syncFile = func(*os.File) error {
+					return errInjected
+				}
+			},
+		},
+		{
+			Name: "RenameFailed",
+			Inject: func() {
+				rename = func(string, string) error {
+					return errInjected
+				}
+			},
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			dir := t.TempDir()
+			path := dir + "/hosts.yaml"
+			require.NoError(copyFile("testdata/basic.yaml", path, 0644), "Failed to copy file")
+			original, err := os.ReadFile(path)
+			require.NoError(err)
+
+			fb, err := NewFileBackend(FileBackendConfig{Path: path})
+			require.NoError(err, "Failed to create file backend")
+
+			oldWriteData, oldSyncFile, oldRename := writeData, syncFile, rename
+			t.Cleanup(func() {
+				writeData, syncFile, rename = oldWriteData, oldSyncFile, oldRename
+			})
+			tCase.Inject()
+
+			err = fb.AddHost(t.Context(), types.Host{MAC: "77:88:99:AA:BB:CC", Name: "TestHost3"})
+			assert.ErrorIs(err, errInjected, "Should return the error")
+
+			f, err := os.ReadFile(path)
+			require.NoError(err)
+			assert.Equal(string(original), string(f), "Should keep the old content")
+
+			entries, err := os.ReadDir(dir)
+			require.NoError(err)
+			for _, entry := range entries {
+				assert.Contains([]string{"hosts.yaml", "hosts.yaml.lock"}, entry.Name(), "Should remove the temporary file")
+			}
+		})
+	}
+}
+
+func TestSaveInPlace(t *testing.T) {
+	oldWriteData, oldRename := writeData, rename
+	t.Cleanup(func() {
+		writeData, rename = oldWriteData, oldRename
+	})
+	rename = func(oldpath, newpath string) error {
+		if strings.HasSuffix(newpath, ".bak") {
+			return os.Rename(oldpath, newpath)
+		}
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EBUSY}
+	}
+
+	dir := t.TempDir()
+	path := dir + "/hosts.yaml"
+	require.NoError(t, copyFile("testdata/basic.yaml", path, 0644), "Failed to copy file")
+	original, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	fb, err := NewFileBackend(FileBackendConfig{Path: path})
+	require.NoError(t, err, "Failed to create file backend")
+
+	t.Run("Write", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		require.NoError(fb.AddHost(t.Context(), types.Host{MAC: "77:88:99:AA:BB:CC", Name: "TestHost3"}), "Should write the file in place")
+
+		f, err := os.ReadFile(path)
+		require.NoError(err)
+		assert.Contains(string(f), "77:88:99:AA:BB:CC", "Should write the new content")
+		f, err = os.ReadFile(backupPath(path, 0))
+		require.NoError(err, "Should create a backup before writing in place")
+		assert.Equal(string(original), string(f), "Backup should contain the previous content")
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(err)
+		for _, entry := range entries {
+			assert.Contains([]string{"hosts.yaml", "hosts.yaml.bak", "hosts.yaml.lock"}, entry.Name(), "Should remove the temporary file")
+		}
+	})
+
+	t.Run("Interrupted", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		hosts, err := fb.GetHosts(t.Context())
+		require.NoError(err)
+
+		// Only interrupt writing the file itself, not the backup
+		writeData = func(f *os.File, data []byte) error {
+			if f.Name() != path {
+				return oldWriteData(f, data)
+			}
+			_, _ = f.Write([]byte("hosts:\n  - name: TestHost1\n    mac: [AA:BB"))
+			return errors.New("injected fault")
+		}
+		assert.Error(fb.RemoveHost(t.Context(), "77:88:99:AA:BB:CC"), "Should fail to write")
+		writeData = oldWriteData
+
+		f, err := os.ReadFile(path)
+		require.NoError(err)
+		_, _, err = parseHostsFile(f)
+		require.Error(err, "Should leave an incomplete file behind")
+
+		restored, err := NewFileBackend(FileBackendConfig{Path: path, Backups: 1})
+		require.NoError(err, "Should recover from the backup")
+		restoredHosts, err := restored.GetHosts(t.Context())
+		require.NoError(err)
+		assert.Equal(hosts, restoredHosts, "Should use the content of the backup")
+
+		f, err = os.ReadFile(path)
+		require.NoError(err)
+		assert.Contains(string(f), "77:88:99:AA:BB:CC", "Should overwrite the incomplete file with the backup")
+		f, err = os.ReadFile(backupPath(path, 0))
+		require.NoError(err)
+		assert.Contains(string(f), "77:88:99:AA:BB:CC", "Should keep the backup the hosts have been restored from")
+	})
+}
+
+func TestReload(t *testing.T) {
+	newHost := types.Host{MAC: "77:88:99:AA:BB:CC", Name: "TestHost3"}
+
+	t.Run("ExternalChange", func(t *testing.T) {
+		require := require.New(t)
+		path := t.TempDir() + "/hosts.yaml"
+
+		fb, err := NewFileBackend(FileBackendConfig{Path: path, ReloadInterval: 10 * time.Millisecond})
+		require.NoError(err, "Failed to create file backend")
+		t.Cleanup(fb.Close)
+
+		require.NoError(copyFile("testdata/lowercase.yaml", path, 0644), "Failed to edit file")
+
+		assert.EventuallyWithT(t, func(c *assert.CollectT) {
+			hosts, err := fb.GetHosts(t.Context())
+			assert.NoError(c, err)
+			assert.Equal(c, basicTestHosts, hosts)
+		}, 5*time.Second, 10*time.Millisecond, "Should pick up the external change with uppercase MACs")
+
+		edited, err := os.ReadFile("testdata/lowercase.yaml")
+		require.NoError(err)
+		time.Sleep(50 * time.Millisecond)
+		f, err := os.ReadFile(path)
+		require.NoError(err)
+		assert.Equal(t, string(edited), string(f), "Should not write to the file when reloading")
+
+		require.NoError(fb.AddHost(t.Context(), newHost))
+		f, err = os.ReadFile(path)
+		require.NoError(err)
+		assert.Contains(t, string(f), "AA:BB:CC:DD:EE:FF", "Should write the normalized MACs with the next change")
+	})
+
+	t.Run("BeforeModify", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		path := t.TempDir() + "/hosts.yaml"
+
+		fb, err := NewFileBackend(FileBackendConfig{Path: path})
+		require.NoError(err, "Failed to create file backend")
+
+		require.NoError(copyFile("testdata/duplicates.yaml", path, 0644), "Failed to edit file")
+		require.NoError(fb.AddHost(t.Context(), newHost))
+
+		hosts, err := fb.GetHosts(t.Context())
+		assert.NoError(err)
+		assert.Equal(append(append([]types.Host{}, basicTestHosts...), newHost), hosts, "Should add the host to the unique hosts of the edited file")
+
+		f, err := os.ReadFile(path)
+		require.NoError(err)
+		fs := &types.HostsFile{}
+		require.NoError(yaml.Unmarshal(f, fs), "Failed to unmarshal file")
+		assert.Equal(hosts, fs.Hosts, "Should not lose the external change")
+	})
+
+	t.Run("InvalidChange", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		path := t.TempDir() + "/hosts.yaml"
+
+		require.NoError(copyFile("testdata/basic.yaml", path, 0644), "Failed to copy file")
+		fb, err := NewFileBackend(FileBackendConfig{Path: path})
+		require.NoError(err, "Failed to create file backend")
+
+		require.NoError(copyFile("testdata/not-yaml.txt", path, 0644), "Failed to edit file")
+		invalid, err := os.ReadFile(path)
+		require.NoError(err)
+
+		err = fb.AddHost(t.Context(), newHost)
+		assert.ErrorContains(err, "failed to unmarshal storage file", "Should not overwrite the invalid file")
+
+		f, err := os.ReadFile(path)
+		require.NoError(err)
+		assert.Equal(string(invalid), string(f), "Should keep the content of the file")
+
+		hosts, err := fb.GetHosts(t.Context())
+		assert.NoError(err)
+		assert.Equal(basicTestHosts, hosts, "Should keep the last valid hosts")
+	})
+
+	t.Run("RemovedFile", func(t *testing.T) {
+		require := require.New(t)
+		path := t.TempDir() + "/hosts.yaml"
+
+		require.NoError(copyFile("testdata/basic.yaml", path, 0644), "Failed to copy file")
+		fb, err := NewFileBackend(FileBackendConfig{Path: path})
+		require.NoError(err, "Failed to create file backend")
+
+		require.NoError(os.Remove(path))
+		require.NoError(fb.AddHost(t.Context(), newHost), "Should recreate the file")
+
+		f, err := os.ReadFile(path)
+		require.NoError(err)
+		fs := &types.HostsFile{}
+		require.NoError(yaml.Unmarshal(f, fs), "Failed to unmarshal file")
+		assert.Equal(t, append(append([]types.Host{}, basicTestHosts...), newHost), fs.Hosts, "Should keep the hosts in memory")
+	})
+
+	t.Run("ConcurrentChange", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		path := t.TempDir() + "/hosts.yaml"
+
+		require.NoError(copyFile("testdata/basic.yaml", path, 0644), "Failed to copy file")
+		fb, err := NewFileBackend(FileBackendConfig{Path: path, Backups: 2})
+		require.NoError(err, "Failed to create file backend")
+
+		external := types.Host{MAC: "DD:EE:FF:00:11:22", Name: "External"}
+		data, err := yaml.Marshal(&types.HostsFile{Hosts: append(append([]types.Host{}, basicTestHosts...), external)})
+		require.NoError(err)
+
+		oldWriteData := writeData
+		t.Cleanup(func() {
+			writeData = oldWriteData
+		})
+		writeData = func(f *os.File, b []byte) error {
+			// Simulate someone else writing the file while it is being saved
+			writeData = oldWriteData
+			err := os.WriteFile(path, data, 0644)
+			if err != nil {
+				return err
+			}
+			return oldWriteData(f, b)
+		}
+
+		require.NoError(fb.AddHost(t.Context(), newHost), "Should retry after the conflict")
+
+		expected := append(append([]types.Host{}, basicTestHosts...), external, newHost)
+		hosts, err := fb.GetHosts(t.Context())
+		assert.NoError(err)
+		assert.Equal(expected, hosts, "Should contain both changes")
+
+		f, err := os.ReadFile(path)
+		require.NoError(err)
+		fs := &types.HostsFile{}
+		require.NoError(yaml.Unmarshal(f, fs), "Failed to unmarshal file")
+		assert.Equal(expected, fs.Hosts, "Should not overwrite the concurrent change")
+
+		f, err = os.ReadFile(backupPath(path, 0))
+		require.NoError(err, "Should have a backup")
+		assert.Equal(string(data), string(f), "Backup should contain the content that has been replaced")
+		assert.NoFileExists(backupPath(path, 1), "Should not rotate the backups for the conflicting write")
+	})
+}
+
+func TestMultipleInstances(t *testing.T) {
+	require := require.New(t)
+	path := t.TempDir() + "/hosts.yaml"
+
+	a, err := NewFileBackend(FileBackendConfig{Path: path})
+	require.NoError(err, "Failed to create first file backend")
+	b, err := NewFileBackend(FileBackendConfig{Path: path})
+	require.NoError(err, "Failed to create second file backend")
+
+	var wg sync.WaitGroup
+	var expected []types.Host
+	for i := range 50 {
+		for j, fb := range []*FileBackend{a, b} {
+			host := types.Host{MAC: fmt.Sprintf("AA:BB:CC:DD:%02X:%02X", j, i), Name: fmt.Sprintf("TestHost-%d-%d", j, i)}
+			expected = append(expected, host)
+			wg.Go(func() {
+				assert.NoError(t, fb.AddHost(t.Context(), host), "Should add host")
+			})
+		}
+	}
+	wg.Wait()
+
+	f, err := os.ReadFile(path)
+	require.NoError(err)
+	fs := &types.HostsFile{}
+	require.NoError(yaml.Unmarshal(f, fs), "Failed to unmarshal file")
+	assert.ElementsMatch(t, expected, fs.Hosts, "Should not lose any updates")
+
+	for _, fb := range []*FileBackend{a, b} {
+		require.NoError(fb.RemoveHost(t.Context(), expected[0].MAC))
+		hosts, err := fb.GetHosts(t.Context())
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, expected[1:], hosts, "Should see the changes of the other instance")
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	fb := newStorageBackendFactory(t)(t, "hosts")
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	err := fb.AddHost(ctx, types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"})
+	assert.ErrorIs(t, err, context.Canceled, "Should not add host")
+	err = fb.RemoveHost(ctx, "AA:BB:CC:DD:EE:FF")
+	assert.ErrorIs(t, err, context.Canceled, "Should not remove host")
+
+	hosts, err := fb.GetHosts(t.Context())
+	assert.NoError(t, err, "Should get hosts")
+	assert.Empty(t, hosts, "Should not have added host")
+}
+
 func TestFileTestsuiteBasic(t *testing.T) {
 	testsuite.RunStorageBackendTests(t, newStorageBackendFactory(t))
 }
@@ -176,8 +574,9 @@ func newStorageBackendFactory(t *testing.T) testsuite.StorageBackendFactory {
 	return func(t *testing.T, name string) types.StorageBackend {
 		t.Helper()
 
-		backend, err := NewFileBackend(FileBackendConfig{Path: dir + "/" + name + ".yaml"})
+		backend, err := NewFileBackend(FileBackendConfig{Path: dir + "/" + name + ".yaml", ReloadInterval: DEFAULT_RELOAD_INTERVAL})
 		require.NoError(t, err, "Failed to prepare test backend")
+		t.Cleanup(backend.Close)
 
 		return backend
 	}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package file
+
+import (
+	"os"
+)
+
+// Advisory file locks are not supported on this platform.
+// Changes by other instances are still detected when saving, but may cause conflicts.
+func flock(_ *os.File) error {
+	return nil
+}
@@ -0,0 +1,292 @@
+package format
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"go.yaml.in/yaml/v3"
+)
+
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+const (
+	csvColumnMAC         = "mac"
+	csvColumnName        = "name"
+	csvColumnAddress     = "address"
+	csvColumnDisplayName = "display-name"
+	csvColumnDescription = "description"
+	csvColumnTags        = "tags"
+	csvColumnIcon        = "icon"
+	csvColumnLocation    = "location"
+	csvColumnSite        = "site"
+	// Every label is stored in its own column, named by the prefix followed by the key
+	csvColumnLabelPrefix = "label:"
+	// Separator of multiple tags in a single column
+	csvTagSeparator = ";"
+)
+
+// All supported formats
+var Formats = []string{FormatYAML, FormatJSON, FormatCSV}
+
+var csvHeader = []string{csvColumnMAC, csvColumnName, csvColumnAddress, csvColumnDisplayName, csvColumnDescription, csvColumnTags, csvColumnIcon, csvColumnLocation, csvColumnSite}
+
+// Check if the given format is supported
+func Valid(format string) bool {
+	return slices.Contains(Formats, format)
+}
+
+// Return the content type for the given format
+func ContentType(format string) string {
+	switch format {
+	case FormatJSON:
+		return "application/json"
+	case FormatCSV:
+		return "text/csv"
+	default:
+		return "application/yaml"
+	}
+}
+
+// Return the format for the given content type, returns an empty string if the content type is unknown
+func FromContentType(contentType string) string {
+	contentType, _, _ = strings.Cut(contentType, ";")
+	switch strings.TrimSpace(strings.ToLower(contentType)) {
+	case "application/json":
+		return FormatJSON
+	case "text/csv":
+		return FormatCSV
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return FormatYAML
+	default:
+		return ""
+	}
+}
+
+// Return the format for the given file name based on the extension, returns an empty string if the extension is unknown
+func FromFilename(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return FormatJSON
+	case ".csv":
+		return FormatCSV
+	case ".yaml", ".yml":
+		return FormatYAML
+	default:
+		return ""
+	}
+}
+
+// Write the hosts in the given format.
+// YAML is written in the same format as the hosts file, JSON as a list of hosts.
+func Encode(w io.Writer, hosts []types.Host, format string) error {
+	if hosts == nil {
+		hosts = []types.Host{}
+	}
+
+	switch format {
+	case FormatYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		err := encoder.Encode(types.HostsFile{Hosts: hosts})
+		if err != nil {
+			return fmt.Errorf("failed to encode hosts as yaml: %w", err)
+		}
+		return encoder.Close()
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err := encoder.Encode(hosts)
+		if err != nil {
+			return fmt.Errorf("failed to encode hosts as json: %w", err)
+		}
+		return nil
+	case FormatCSV:
+		return encodeCSV(w, hosts)
+	default:
+		return fmt.Errorf("unknown format '%s'", format)
+	}
+}
+
+// Read hosts in the given format.
+// YAML and JSON accept both a hosts file and a plain list of hosts.
+func Decode(r io.Reader, format string) ([]types.Host, error) {
+	switch format {
+	case FormatYAML:
+		return decodeYAML(r)
+	case FormatJSON:
+		return decodeJSON(r)
+	case FormatCSV:
+		return decodeCSV(r)
+	default:
+		return nil, fmt.Errorf("unknown format '%s'", format)
+	}
+}
+
+func decodeYAML(r io.Reader) ([]types.Host, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read yaml: %w", err)
+	}
+
+	var hostsFile types.HostsFile
+	err = yaml.Unmarshal(data, &hostsFile)
+	if err == nil {
+		return hostsFile.Hosts, nil
+	}
+
+	var hosts []types.Host
+	if yaml.Unmarshal(data, &hosts) == nil {
+		return hosts, nil
+	}
+	return nil, fmt.Errorf("failed to decode hosts from yaml: %w", err)
+}
+
+func decodeJSON(r io.Reader) ([]types.Host, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read json: %w", err)
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var hosts []types.Host
+		err = json.Unmarshal(data, &hosts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode hosts from json: %w", err)
+		}
+		return hosts, nil
+	}
+
+	var hostsFile types.HostsFile
+	err = json.Unmarshal(data, &hostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode hosts from json: %w", err)
+	}
+	return hostsFile.Hosts, nil
+}
+
+// Write hosts as csv, with a column for every label key used by any host.
+func encodeCSV(w io.Writer, hosts []types.Host) error {
+	writer := csv.NewWriter(w)
+
+	var labelKeys []string
+	for _, host := range hosts {
+		for key := range host.Labels {
+			if !slices.Contains(labelKeys, key) {
+				labelKeys = append(labelKeys, key)
+			}
+		}
+	}
+	slices.Sort(labelKeys)
+
+	header := slices.Clone(csvHeader)
+	for _, key := range labelKeys {
+		header = append(header, csvColumnLabelPrefix+key)
+	}
+	err := writer.Write(header)
+	if err != nil {
+		return fmt.Errorf("failed to write csv header: %w", err)
+	}
+	for _, host := range hosts {
+		record := []string{host.MAC, host.Name, host.Address, host.DisplayName, host.Description, strings.Join(host.Tags, csvTagSeparator), host.Icon, host.Location, host.Site}
+		for _, key := range labelKeys {
+			record = append(record, host.Labels[key])
+		}
+		err = writer.Write(record)
+		if err != nil {
+			return fmt.Errorf("failed to write host '%s' as csv: %w", host.MAC, err)
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Read hosts from csv. The first line needs to be a header naming the columns.
+// The columns mac and name are required, the order of the columns does not matter.
+// Labels are read from columns named label:<key>, empty values are skipped.
+func decodeCSV(r io.Reader) ([]types.Host, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return []types.Host{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	labelColumns := make(map[string]int)
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		if len(column) > len(csvColumnLabelPrefix) && strings.EqualFold(column[:len(csvColumnLabelPrefix)], csvColumnLabelPrefix) {
+			labelColumns[column[len(csvColumnLabelPrefix):]] = i
+			continue
+		}
+		columns[strings.ToLower(column)] = i
+	}
+	for _, column := range []string{csvColumnMAC, csvColumnName} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("csv header is missing required column '%s'", column)
+		}
+	}
+
+	get := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	hosts := []types.Host{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read csv: %w", err)
+		}
+
+		host := types.Host{
+			MAC:         get(record, csvColumnMAC),
+			Name:        get(record, csvColumnName),
+			Address:     get(record, csvColumnAddress),
+			DisplayName: get(record, csvColumnDisplayName),
+			Description: get(record, csvColumnDescription),
+			Icon:        get(record, csvColumnIcon),
+			Location:    get(record, csvColumnLocation),
+			Site:        get(record, csvColumnSite),
+		}
+		for tag := range strings.SplitSeq(get(record, csvColumnTags), csvTagSeparator) {
+			tag = strings.TrimSpace(tag)
+			if tag != "" {
+				host.Tags = append(host.Tags, tag)
+			}
+		}
+		for key, i := range labelColumns {
+			value := strings.TrimSpace(record[i])
+			if value == "" {
+				continue
+			}
+			if host.Labels == nil {
+				host.Labels = make(map[string]string)
+			}
+			host.Labels[key] = value
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
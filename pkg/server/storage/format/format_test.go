@@ -0,0 +1,179 @@
+package format
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testHosts = []types.Host{
+	{
+		MAC:  "AA:BB:CC:DD:EE:FF",
+		Name: "TestHost1",
+	},
+	{
+		MAC:     "11:22:33:44:55:66",
+		Name:    "TestHost2",
+		Address: "host2.example.org",
+	},
+}
+
+func TestDecode(t *testing.T) {
+	tMatrix := []struct {
+		Name, Path, Format string
+	}{
+		{"YAML", "testdata/hosts.yaml", FormatYAML},
+		{"YAMLList", "testdata/list.yaml", FormatYAML},
+		{"JSON", "testdata/hosts.json", FormatJSON},
+		{"JSONObject", "testdata/object.json", FormatJSON},
+		{"CSV", "testdata/hosts.csv", FormatCSV},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			f, err := os.Open(tCase.Path)
+			require.NoError(t, err, "Should open test file")
+			t.Cleanup(func() {
+				_ = f.Close()
+			})
+
+			hosts, err := Decode(f, tCase.Format)
+			assert.NoError(t, err, "Should decode hosts")
+			assert.Equal(t, testHosts, hosts, "Should return hosts from file")
+		})
+	}
+
+	failMatrix := []struct {
+		Name, Path, Format string
+	}{
+		{"InvalidYAML", "testdata/invalid.txt", FormatYAML},
+		{"InvalidJSON", "testdata/invalid.txt", FormatJSON},
+		{"CSVMissingColumn", "testdata/missing-column.csv", FormatCSV},
+		{"UnknownFormat", "testdata/hosts.yaml", "xml"},
+	}
+
+	for _, tCase := range failMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			f, err := os.Open(tCase.Path)
+			require.NoError(t, err, "Should open test file")
+			t.Cleanup(func() {
+				_ = f.Close()
+			})
+
+			hosts, err := Decode(f, tCase.Format)
+			assert.Error(t, err, "Should fail to decode hosts")
+			assert.Nil(t, hosts, "Should not return hosts")
+		})
+	}
+
+	t.Run("EmptyCSV", func(t *testing.T) {
+		hosts, err := Decode(bytes.NewReader(nil), FormatCSV)
+		assert.NoError(t, err, "Should accept empty csv")
+		assert.Empty(t, hosts, "Should not return hosts")
+	})
+}
+
+func TestEncode(t *testing.T) {
+	for _, format := range Formats {
+		t.Run(format, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			var buf bytes.Buffer
+			require.NoError(Encode(&buf, testHosts, format), "Should encode hosts")
+
+			hosts, err := Decode(&buf, format)
+			require.NoError(err, "Should decode encoded hosts")
+			assert.Equal(testHosts, hosts, "Should return the same hosts after encoding and decoding")
+		})
+	}
+
+	t.Run("EmptyJSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, Encode(&buf, nil, FormatJSON), "Should encode hosts")
+		assert.Equal(t, "[]\n", buf.String(), "Should encode empty list")
+	})
+
+	t.Run("UnknownFormat", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.Error(t, Encode(&buf, testHosts, "xml"), "Should not encode unknown format")
+	})
+}
+
+var testMetadataHosts = []types.Host{
+	{
+		MAC:         "AA:BB:CC:DD:EE:FF",
+		Name:        "living-room-pc",
+		DisplayName: "Living room PC",
+		Description: "Gaming PC, below the TV",
+		Tags:        []string{"gaming", "windows"},
+		Icon:        "desktop",
+		Location:    "Living room",
+		Labels:      map[string]string{"Owner": "alice"},
+	},
+	{
+		MAC:    "11:22:33:44:55:66",
+		Name:   "nas",
+		Labels: map[string]string{"rack": "1"},
+		Site:   "building-b",
+	},
+}
+
+func TestMetadata(t *testing.T) {
+	t.Run("DecodeCSV", func(t *testing.T) {
+		f, err := os.Open("testdata/metadata.csv")
+		require.NoError(t, err, "Should open test file")
+		t.Cleanup(func() {
+			_ = f.Close()
+		})
+
+		hosts, err := Decode(f, FormatCSV)
+		assert.NoError(t, err, "Should decode hosts")
+		assert.Equal(t, testMetadataHosts, hosts, "Should read metadata and keep the case of label keys")
+	})
+
+	for _, format := range Formats {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, Encode(&buf, testMetadataHosts, format), "Should encode hosts")
+
+			hosts, err := Decode(&buf, format)
+			require.NoError(t, err, "Should decode encoded hosts")
+			assert.Equal(t, testMetadataHosts, hosts, "Should keep the metadata")
+		})
+	}
+
+	t.Run("CSVHeader", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, Encode(&buf, testMetadataHosts, FormatCSV), "Should encode hosts")
+
+		header, _, _ := strings.Cut(buf.String(), "\n")
+		assert.Equal(t, "mac,name,address,display-name,description,tags,icon,location,site,label:Owner,label:rack", header, "Should add a sorted column for every label")
+	})
+}
+
+func TestFormatDetection(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(Valid(FormatCSV))
+	assert.False(Valid("xml"))
+
+	assert.Equal(FormatJSON, FromContentType("application/json; charset=utf-8"))
+	assert.Equal(FormatCSV, FromContentType("text/csv"))
+	assert.Equal(FormatYAML, FromContentType("application/yaml"))
+	assert.Equal("", FromContentType("text/plain"))
+
+	assert.Equal(FormatJSON, FromFilename("hosts.json"))
+	assert.Equal(FormatCSV, FromFilename("hosts.CSV"))
+	assert.Equal(FormatYAML, FromFilename("/etc/go-wol/hosts.yml"))
+	assert.Equal("", FromFilename("hosts.txt"))
+
+	for _, format := range Formats {
+		assert.Equal(format, FromContentType(ContentType(format)), "Content type should match format")
+	}
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/heathcliff26/go-wol/pkg/utils"
+)
+
+// Import the given hosts into the storage.
+// All hosts are validated first, if any of them is invalid nothing will be changed
+// and the result contains the validation errors.
+// When dryRun is set, only the result is calculated without changing the storage.
+func (s *Storage) ImportHosts(ctx context.Context, hosts []types.Host, mode types.ImportMode, dryRun bool) (types.ImportResult, error) {
+	result := types.ImportResult{
+		DryRun:    dryRun,
+		Added:     []string{},
+		Updated:   []string{},
+		Unchanged: []string{},
+		Removed:   []string{},
+	}
+
+	if mode != types.ImportModeMerge && mode != types.ImportModeReplace {
+		return result, fmt.Errorf("unknown import mode '%s'", mode)
+	}
+	if s.readonly && !dryRun {
+		return result, fmt.Errorf("storage is readonly")
+	}
+
+	imported := make(map[string]bool, len(hosts))
+	order := make([]string, 0, len(hosts))
+	for i := range hosts {
+		host := &hosts[i]
+		err := utils.ValidateHost(*host)
+		if err != nil {
+			result.Errors = append(result.Errors, types.ImportError{Row: i + 1, MAC: host.MAC, Error: err.Error()})
+			continue
+		}
+
+		host.MAC = strings.ToUpper(host.MAC)
+		if imported[host.MAC] {
+			result.Errors = append(result.Errors, types.ImportError{Row: i + 1, MAC: host.MAC, Error: "duplicate MAC address"})
+			continue
+		}
+		imported[host.MAC] = true
+		order = append(order, host.MAC)
+	}
+	if len(result.Errors) > 0 {
+		return result, nil
+	}
+
+	var existingHosts []types.Host
+	err := s.do(ctx, func(ctx context.Context) error {
+		var err error
+		existingHosts, err = s.backend.GetHosts(ctx)
+		return err
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to get hosts: %w", err)
+	}
+	existing := make(map[string]types.Host, len(existingHosts))
+	for _, host := range existingHosts {
+		existing[host.MAC] = host
+		if mode == types.ImportModeReplace && !imported[host.MAC] {
+			result.Removed = append(result.Removed, host.MAC)
+		}
+	}
+
+	changed := make([]types.Host, 0, len(hosts))
+	for _, host := range hosts {
+		oldHost, ok := existing[host.MAC]
+		switch {
+		case !ok:
+			result.Added = append(result.Added, host.MAC)
+			changed = append(changed, host)
+		case !oldHost.Equal(host):
+			result.Updated = append(result.Updated, host.MAC)
+			changed = append(changed, host)
+		default:
+			result.Unchanged = append(result.Unchanged, host.MAC)
+		}
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	for _, mac := range result.Removed {
+		err = s.do(ctx, func(ctx context.Context) error {
+			return s.backend.RemoveHost(ctx, mac)
+		})
+		if err != nil {
+			return result, fmt.Errorf("failed to remove host '%s': %w", mac, err)
+		}
+		s.publish(types.NewEvent(types.EventHostRemoved, mac, nil))
+	}
+	for _, host := range changed {
+		err = s.do(ctx, func(ctx context.Context) error {
+			return s.backend.AddHost(ctx, host)
+		})
+		if err != nil {
+			return result, fmt.Errorf("failed to add host '%s': %w", host.MAC, err)
+		}
+		s.publish(types.NewEvent(types.EventHostUpdated, host.MAC, &host))
+	}
+	if mode == types.ImportModeReplace {
+		err = s.do(ctx, func(ctx context.Context) error {
+			return s.backend.ReorderHosts(ctx, order)
+		})
+		if err != nil {
+			return result, fmt.Errorf("failed to restore order of imported hosts: %w", err)
+		}
+		s.publish(types.NewEvent(types.EventHostsReordered, "", nil))
+	}
+
+	return result, nil
+}
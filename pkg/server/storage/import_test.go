@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/file"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var importExistingHosts = []types.Host{
+	{MAC: "00:00:00:00:00:11", Name: "Host1"},
+	{MAC: "00:00:00:00:00:22", Name: "Host2"},
+	{MAC: "00:00:00:00:00:33", Name: "Host3"},
+}
+
+func newImportTestStorage(t *testing.T) *Storage {
+	t.Helper()
+
+	s, err := NewStorage(StorageConfig{
+		Type: "file",
+		File: file.FileBackendConfig{
+			Path: t.TempDir() + "/hosts.yaml",
+		},
+	})
+	require.NoError(t, err, "Should create storage")
+
+	for _, host := range importExistingHosts {
+		require.NoError(t, s.AddHost(t.Context(), host), "Should add host")
+	}
+	return s
+}
+
+func TestStorageImportHosts(t *testing.T) {
+	importedHosts := []types.Host{
+		{MAC: "00:00:00:00:00:33", Name: "Host3"},
+		{MAC: "00:00:00:00:00:22", Name: "NewName", Address: "192.0.2.2"},
+		{MAC: "00:00:00:00:00:44", Name: "Host4"},
+	}
+
+	tMatrix := []struct {
+		Name   string
+		Mode   types.ImportMode
+		DryRun bool
+		Result types.ImportResult
+		Hosts  []types.Host
+	}{
+		{
+			Name: "Merge",
+			Mode: types.ImportModeMerge,
+			Result: types.ImportResult{
+				Added:     []string{"00:00:00:00:00:44"},
+				Updated:   []string{"00:00:00:00:00:22"},
+				Unchanged: []string{"00:00:00:00:00:33"},
+				Removed:   []string{},
+			},
+			Hosts: []types.Host{importExistingHosts[0], importedHosts[1], importedHosts[0], importedHosts[2]},
+		},
+		{
+			Name: "Replace",
+			Mode: types.ImportModeReplace,
+			Result: types.ImportResult{
+				Added:     []string{"00:00:00:00:00:44"},
+				Updated:   []string{"00:00:00:00:00:22"},
+				Unchanged: []string{"00:00:00:00:00:33"},
+				Removed:   []string{"00:00:00:00:00:11"},
+			},
+			Hosts: importedHosts,
+		},
+		{
+			Name:   "DryRun",
+			Mode:   types.ImportModeReplace,
+			DryRun: true,
+			Result: types.ImportResult{
+				DryRun:    true,
+				Added:     []string{"00:00:00:00:00:44"},
+				Updated:   []string{"00:00:00:00:00:22"},
+				Unchanged: []string{"00:00:00:00:00:33"},
+				Removed:   []string{"00:00:00:00:00:11"},
+			},
+			Hosts: importExistingHosts,
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			s := newImportTestStorage(t)
+
+			result, err := s.ImportHosts(t.Context(), append([]types.Host{}, importedHosts...), tCase.Mode, tCase.DryRun)
+			require.NoError(err, "Should import hosts")
+			assert.Equal(tCase.Result, result, "Should return expected result")
+
+			hosts, err := s.GetHosts(t.Context())
+			require.NoError(err, "Should get hosts")
+			assert.Equal(tCase.Hosts, hosts, "Should have expected hosts")
+		})
+	}
+
+	t.Run("ValidationErrors", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		s := newImportTestStorage(t)
+
+		hosts := []types.Host{
+			{MAC: "00:00:00:00:00:44", Name: "Host4"},
+			{MAC: "not-a-mac", Name: "Host5"},
+			{MAC: "00:00:00:00:00:66", Name: "not a hostname"},
+			{MAC: "00:00:00:00:00:44", Name: "Duplicate"},
+		}
+
+		result, err := s.ImportHosts(t.Context(), hosts, types.ImportModeMerge, false)
+		require.NoError(err, "Validation errors should be part of the result")
+		require.Len(result.Errors, 3, "Should return an error for every invalid row")
+		assert.Equal(2, result.Errors[0].Row, "Should return the row of the invalid host")
+		assert.Equal(3, result.Errors[1].Row, "Should return the row of the invalid host")
+		assert.Equal(4, result.Errors[2].Row, "Should return the row of the duplicate host")
+		assert.Equal("duplicate MAC address", result.Errors[2].Error, "Should report duplicate")
+
+		current, err := s.GetHosts(t.Context())
+		require.NoError(err, "Should get hosts")
+		assert.Equal(importExistingHosts, current, "Should not change hosts")
+	})
+
+	t.Run("LowercaseMAC", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		s := newImportTestStorage(t)
+
+		result, err := s.ImportHosts(t.Context(), []types.Host{{MAC: "00:00:00:00:00:aa", Name: "Host"}}, types.ImportModeMerge, false)
+		require.NoError(err, "Should import hosts")
+		assert.Equal([]string{"00:00:00:00:00:AA"}, result.Added, "Should uppercase MAC")
+	})
+
+	t.Run("UnknownMode", func(t *testing.T) {
+		s := newImportTestStorage(t)
+
+		_, err := s.ImportHosts(t.Context(), importedHosts, "unknown", false)
+		assert.Error(t, err, "Should not accept unknown mode")
+	})
+
+	t.Run("Readonly", func(t *testing.T) {
+		assert := assert.New(t)
+
+		s := newImportTestStorage(t)
+		s.readonly = true
+
+		_, err := s.ImportHosts(t.Context(), importedHosts, types.ImportModeMerge, false)
+		assert.Error(err, "Should not import into readonly storage")
+
+		result, err := s.ImportHosts(t.Context(), importedHosts, types.ImportModeMerge, true)
+		assert.NoError(err, "Should allow dry-run on readonly storage")
+		assert.Equal([]string{"00:00:00:00:00:44"}, result.Added, "Should calculate result")
+	})
+}
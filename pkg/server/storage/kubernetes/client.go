@@ -0,0 +1,307 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Server side timeout for a single watch request, the watch is restarted afterwards.
+const watchTimeoutSeconds = 300
+
+var (
+	ErrNotFound = errors.New("not found")
+	// Returned when the resource version is outdated or the resource already exists
+	ErrConflict = errors.New("conflict")
+)
+
+// The parts of a ConfigMap used by the backend
+type ConfigMap struct {
+	APIVersion string            `json:"apiVersion,omitempty"`
+	Kind       string            `json:"kind,omitempty"`
+	Metadata   ObjectMeta        `json:"metadata"`
+	Data       map[string]string `json:"data,omitempty"`
+}
+
+type ObjectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+}
+
+// Event of a watch request.
+// For events of type ERROR the object is a status and the message is set.
+type WatchEvent struct {
+	Type   string
+	Object ConfigMap
+	// Message of the status for events of type ERROR
+	Message string
+}
+
+// Client for the ConfigMaps in a single namespace
+type Client interface {
+	// Returns ErrNotFound if the ConfigMap does not exist
+	GetConfigMap(ctx context.Context, name string) (*ConfigMap, error)
+	// Returns ErrConflict if the ConfigMap already exists
+	CreateConfigMap(ctx context.Context, cm *ConfigMap) (*ConfigMap, error)
+	// Set a single key of the data with a merge patch, the rest of the ConfigMap is left untouched.
+	// Returns ErrConflict if the resource version is outdated.
+	PatchConfigMapData(ctx context.Context, name string, resourceVersion string, key string, value string) (*ConfigMap, error)
+	// Watch for changes to the ConfigMap after the given resource version.
+	// The channel is closed when the watch ends.
+	WatchConfigMap(ctx context.Context, name string, resourceVersion string) (<-chan WatchEvent, error)
+	// Check if the client is allowed to perform the verb on the ConfigMap
+	CanI(ctx context.Context, verb string, name string) (bool, error)
+}
+
+type restClient struct {
+	server    string
+	namespace string
+	tokenFile string
+	http      *http.Client
+}
+
+// Status returned by the API server for failed requests
+type status struct {
+	Message string `json:"message"`
+}
+
+type selfSubjectAccessReview struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		ResourceAttributes struct {
+			Namespace string `json:"namespace"`
+			Verb      string `json:"verb"`
+			Resource  string `json:"resource"`
+			Name      string `json:"name,omitempty"`
+		} `json:"resourceAttributes"`
+	} `json:"spec"`
+	Status struct {
+		Allowed bool `json:"allowed"`
+	} `json:"status"`
+}
+
+func newRESTClient(cfg KubernetesBackendConfig) (*restClient, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if cfg.CAFile != "" {
+		ca, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no valid certificates found in ca file '%s'", cfg.CAFile)
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &restClient{
+		server:    strings.TrimSuffix(cfg.Server, "/"),
+		namespace: cfg.Namespace,
+		tokenFile: cfg.TokenFile,
+		http:      &http.Client{Transport: transport},
+	}, nil
+}
+
+func (c *restClient) GetConfigMap(ctx context.Context, name string) (*ConfigMap, error) {
+	var cm ConfigMap
+	err := c.do(ctx, http.MethodGet, c.configMapsPath(name), nil, &cm)
+	if err != nil {
+		return nil, err
+	}
+	return &cm, nil
+}
+
+func (c *restClient) CreateConfigMap(ctx context.Context, cm *ConfigMap) (*ConfigMap, error) {
+	var res ConfigMap
+	err := c.do(ctx, http.MethodPost, c.configMapsPath(""), withKind(cm), &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *restClient) PatchConfigMapData(ctx context.Context, name string, resourceVersion string, key string, value string) (*ConfigMap, error) {
+	// The resource version in the patch is used as precondition by the API server
+	patch := map[string]any{
+		"metadata": map[string]string{"resourceVersion": resourceVersion},
+		"data":     map[string]string{key: value},
+	}
+
+	var res ConfigMap
+	err := c.doWithContentType(ctx, http.MethodPatch, c.configMapsPath(name), "application/merge-patch+json", patch, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *restClient) WatchConfigMap(ctx context.Context, name string, resourceVersion string) (<-chan WatchEvent, error) {
+	query := url.Values{}
+	query.Set("watch", "true")
+	query.Set("fieldSelector", "metadata.name="+name)
+	query.Set("timeoutSeconds", fmt.Sprint(watchTimeoutSeconds))
+	if resourceVersion != "" {
+		query.Set("resourceVersion", resourceVersion)
+	}
+
+	res, err := c.request(ctx, http.MethodGet, c.configMapsPath("")+"?"+query.Encode(), "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan WatchEvent)
+	go func() {
+		defer close(events)
+		defer res.Body.Close()
+
+		decoder := json.NewDecoder(res.Body)
+		for {
+			var raw struct {
+				Type   string          `json:"type"`
+				Object json.RawMessage `json:"object"`
+			}
+			if decoder.Decode(&raw) != nil {
+				return
+			}
+
+			event := WatchEvent{Type: raw.Type}
+			if raw.Type == "ERROR" {
+				var s status
+				_ = json.Unmarshal(raw.Object, &s)
+				event.Message = s.Message
+			} else if json.Unmarshal(raw.Object, &event.Object) != nil {
+				return
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+func (c *restClient) CanI(ctx context.Context, verb string, name string) (bool, error) {
+	review := selfSubjectAccessReview{
+		APIVersion: "authorization.k8s.io/v1",
+		Kind:       "SelfSubjectAccessReview",
+	}
+	review.Spec.ResourceAttributes.Namespace = c.namespace
+	review.Spec.ResourceAttributes.Verb = verb
+	review.Spec.ResourceAttributes.Resource = "configmaps"
+	review.Spec.ResourceAttributes.Name = name
+
+	err := c.do(ctx, http.MethodPost, "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews", review, &review)
+	if err != nil {
+		return false, err
+	}
+	return review.Status.Allowed, nil
+}
+
+func (c *restClient) configMapsPath(name string) string {
+	path := "/api/v1/namespaces/" + url.PathEscape(c.namespace) + "/configmaps"
+	if name != "" {
+		path += "/" + url.PathEscape(name)
+	}
+	return path
+}
+
+// Send a request with the body encoded as json and decode the response into result.
+func (c *restClient) do(ctx context.Context, method string, path string, body any, result any) error {
+	return c.doWithContentType(ctx, method, path, "application/json", body, result)
+}
+
+// Like do, but with a different content type for the body, e.g. for patches.
+func (c *restClient) doWithContentType(ctx context.Context, method string, path string, contentType string, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	res, err := c.request(ctx, method, path, contentType, reader)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	err = json.NewDecoder(res.Body).Decode(result)
+	if err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// Send a request and return the response if successful.
+// The caller needs to close the body of the response.
+func (c *restClient) request(ctx context.Context, method string, path string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.server+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.tokenFile != "" {
+		token, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token file: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+
+	var s status
+	_ = json.NewDecoder(res.Body).Decode(&s)
+	if s.Message == "" {
+		s.Message = res.Status
+	}
+
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, s.Message)
+	case http.StatusConflict:
+		return nil, fmt.Errorf("%w: %s", ErrConflict, s.Message)
+	default:
+		return nil, fmt.Errorf("request to api server failed with status %d: %s", res.StatusCode, s.Message)
+	}
+}
+
+// Return a copy of the ConfigMap with apiVersion and kind set, as required by the API server.
+func withKind(cm *ConfigMap) ConfigMap {
+	res := *cm
+	res.APIVersion = "v1"
+	res.Kind = "ConfigMap"
+	return res
+}
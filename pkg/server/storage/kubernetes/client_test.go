@@ -0,0 +1,276 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Return a client for a test server using the handler.
+// The token file contains "test-token".
+func newTestRESTClient(t *testing.T, handler http.HandlerFunc) *restClient {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("test-token\n"), 0600))
+
+	c, err := newRESTClient(KubernetesBackendConfig{
+		Namespace: "test-ns",
+		Server:    srv.URL + "/",
+		TokenFile: tokenFile,
+	})
+	require.NoError(t, err, "Should create client")
+	return c
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestRESTClient(t *testing.T) {
+	t.Run("GetConfigMap", func(t *testing.T) {
+		assert := assert.New(t)
+
+		c := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(http.MethodGet, r.Method)
+			assert.Equal("/api/v1/namespaces/test-ns/configmaps/hosts", r.URL.Path)
+			assert.Equal("Bearer test-token", r.Header.Get("Authorization"), "Should send the token")
+			writeJSON(w, http.StatusOK, ConfigMap{
+				Metadata: ObjectMeta{Name: "hosts", Namespace: "test-ns", ResourceVersion: "42"},
+				Data:     map[string]string{"hosts.yaml": "hosts: []"},
+			})
+		})
+
+		cm, err := c.GetConfigMap(t.Context(), "hosts")
+		require.NoError(t, err, "Should get configmap")
+		assert.Equal("42", cm.Metadata.ResourceVersion)
+		assert.Equal("hosts: []", cm.Data["hosts.yaml"])
+	})
+
+	t.Run("CreateConfigMap", func(t *testing.T) {
+		assert := assert.New(t)
+
+		c := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(http.MethodPost, r.Method)
+			assert.Equal("/api/v1/namespaces/test-ns/configmaps", r.URL.Path)
+
+			var cm ConfigMap
+			assert.NoError(json.NewDecoder(r.Body).Decode(&cm))
+			assert.Equal("v1", cm.APIVersion, "Should set apiVersion")
+			assert.Equal("ConfigMap", cm.Kind, "Should set kind")
+			cm.Metadata.ResourceVersion = "1"
+			writeJSON(w, http.StatusCreated, cm)
+		})
+
+		cm, err := c.CreateConfigMap(t.Context(), &ConfigMap{Metadata: ObjectMeta{Name: "hosts"}})
+		require.NoError(t, err, "Should create configmap")
+		assert.Equal("1", cm.Metadata.ResourceVersion)
+	})
+
+	t.Run("PatchConfigMapData", func(t *testing.T) {
+		assert := assert.New(t)
+
+		// Stored object with fields the backend doesn't know about
+		stored := map[string]any{
+			"metadata": map[string]any{
+				"name":            "hosts",
+				"resourceVersion": "1",
+				"labels":          map[string]any{"app.kubernetes.io/managed-by": "Helm"},
+				"annotations":     map[string]any{"meta.helm.sh/release-name": "go-wol"},
+				"ownerReferences": []any{map[string]any{"kind": "Deployment", "name": "go-wol"}},
+			},
+			"data":       map[string]any{"hosts.yaml": "hosts: []", "other": "value"},
+			"binaryData": map[string]any{"blob": "AAEC"},
+		}
+
+		c := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(http.MethodPatch, r.Method)
+			assert.Equal("/api/v1/namespaces/test-ns/configmaps/hosts", r.URL.Path)
+			assert.Equal("application/merge-patch+json", r.Header.Get("Content-Type"), "Should send a merge patch")
+
+			var patch struct {
+				Metadata map[string]any    `json:"metadata"`
+				Data     map[string]string `json:"data"`
+			}
+			assert.NoError(json.NewDecoder(r.Body).Decode(&patch))
+			assert.Equal(map[string]any{"resourceVersion": "1"}, patch.Metadata, "Should only send the resource version as precondition")
+
+			metadata := stored["metadata"].(map[string]any)
+			if patch.Metadata["resourceVersion"] != metadata["resourceVersion"] {
+				writeJSON(w, http.StatusConflict, map[string]string{"message": "the object has been modified"})
+				return
+			}
+			for key, value := range patch.Data {
+				stored["data"].(map[string]any)[key] = value
+			}
+			metadata["resourceVersion"] = "2"
+			writeJSON(w, http.StatusOK, stored)
+		})
+
+		cm, err := c.PatchConfigMapData(t.Context(), "hosts", "1", "hosts.yaml", "hosts:\n  - mac: AA:BB:CC:DD:EE:FF\n")
+		require.NoError(t, err, "Should patch configmap")
+		assert.Equal("2", cm.Metadata.ResourceVersion)
+		assert.Equal(map[string]string{"app.kubernetes.io/managed-by": "Helm"}, cm.Metadata.Labels, "Should keep the labels")
+		assert.Equal(map[string]string{"meta.helm.sh/release-name": "go-wol"}, cm.Metadata.Annotations, "Should keep the annotations")
+		assert.Equal(map[string]string{"hosts.yaml": "hosts:\n  - mac: AA:BB:CC:DD:EE:FF\n", "other": "value"}, cm.Data, "Should only change the key of the hosts")
+		assert.NotNil(stored["binaryData"], "Should keep the binary data")
+		assert.NotNil(stored["metadata"].(map[string]any)["ownerReferences"], "Should keep the owner references")
+
+		_, err = c.PatchConfigMapData(t.Context(), "hosts", "1", "hosts.yaml", "hosts: []")
+		assert.ErrorIs(err, ErrConflict, "Should return conflict")
+		assert.ErrorContains(err, "the object has been modified", "Should contain the message of the status")
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		tMatrix := []struct {
+			Name   string
+			Status int
+			Error  error
+			Msg    string
+		}{
+			{"NotFound", http.StatusNotFound, ErrNotFound, `configmaps "hosts" not found`},
+			{"Conflict", http.StatusConflict, ErrConflict, "already exists"},
+			{"Forbidden", http.StatusForbidden, nil, "status 403: forbidden"},
+		}
+
+		for _, tCase := range tMatrix {
+			t.Run(tCase.Name, func(t *testing.T) {
+				c := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+					writeJSON(w, tCase.Status, map[string]string{"message": tCase.Msg})
+				})
+
+				_, err := c.GetConfigMap(t.Context(), "hosts")
+				if tCase.Error != nil {
+					assert.ErrorIs(t, err, tCase.Error, "Should return the correct error")
+				}
+				assert.ErrorContains(t, err, tCase.Msg, "Should contain the message")
+			})
+		}
+	})
+
+	t.Run("WatchConfigMap", func(t *testing.T) {
+		assert := assert.New(t)
+
+		c := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			assert.Equal("true", query.Get("watch"))
+			assert.Equal("metadata.name=hosts", query.Get("fieldSelector"))
+			assert.Equal("7", query.Get("resourceVersion"))
+
+			w.WriteHeader(http.StatusOK)
+			_, _ = fmt.Fprintln(w, `{"type":"MODIFIED","object":{"metadata":{"name":"hosts","resourceVersion":"8"},"data":{"hosts.yaml":"hosts: []"}}}`)
+			_, _ = fmt.Fprintln(w, `{"type":"DELETED","object":{"metadata":{"name":"hosts","resourceVersion":"9"}}}`)
+			_, _ = fmt.Fprintln(w, `{"type":"ERROR","object":{"kind":"Status","message":"too old resource version","code":410}}`)
+		})
+
+		events, err := c.WatchConfigMap(t.Context(), "hosts", "7")
+		require.NoError(t, err, "Should start watch")
+
+		var received []WatchEvent
+		for event := range events {
+			received = append(received, event)
+		}
+
+		require.Len(t, received, 3, "Should receive all events")
+		assert.Equal("MODIFIED", received[0].Type)
+		assert.Equal("8", received[0].Object.Metadata.ResourceVersion)
+		assert.Equal("hosts: []", received[0].Object.Data["hosts.yaml"])
+		assert.Equal("DELETED", received[1].Type)
+		assert.Equal("ERROR", received[2].Type)
+		assert.Equal("too old resource version", received[2].Message)
+	})
+
+	t.Run("CanI", func(t *testing.T) {
+		assert := assert.New(t)
+
+		c := newTestRESTClient(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal("/apis/authorization.k8s.io/v1/selfsubjectaccessreviews", r.URL.Path)
+
+			var review selfSubjectAccessReview
+			assert.NoError(json.NewDecoder(r.Body).Decode(&review))
+			attr := review.Spec.ResourceAttributes
+			assert.Equal("test-ns", attr.Namespace)
+			assert.Equal("configmaps", attr.Resource)
+			assert.Equal("hosts", attr.Name)
+
+			review.Status.Allowed = attr.Verb == "get"
+			writeJSON(w, http.StatusCreated, review)
+		})
+
+		allowed, err := c.CanI(t.Context(), "get", "hosts")
+		assert.NoError(err)
+		assert.True(allowed, "Should be allowed to get")
+
+		allowed, err = c.CanI(t.Context(), "update", "hosts")
+		assert.NoError(err)
+		assert.False(allowed, "Should not be allowed to update")
+	})
+}
+
+func TestNewRESTClient(t *testing.T) {
+	t.Run("MissingCAFile", func(t *testing.T) {
+		_, err := newRESTClient(KubernetesBackendConfig{CAFile: filepath.Join(t.TempDir(), "ca.crt")})
+		assert.ErrorContains(t, err, "failed to read ca file")
+	})
+
+	t.Run("InvalidCAFile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ca.crt")
+		require.NoError(t, os.WriteFile(path, []byte("not a certificate"), 0600))
+
+		_, err := newRESTClient(KubernetesBackendConfig{CAFile: path})
+		assert.ErrorContains(t, err, "no valid certificates found")
+	})
+
+	t.Run("MissingTokenFile", func(t *testing.T) {
+		c, err := newRESTClient(KubernetesBackendConfig{Server: "http://localhost", TokenFile: filepath.Join(t.TempDir(), "token")})
+		require.NoError(t, err, "Should create client")
+
+		_, err = c.GetConfigMap(t.Context(), "hosts")
+		assert.ErrorContains(t, err, "failed to read token file", "Should read the token for every request")
+	})
+}
+
+func TestConfigWithDefaults(t *testing.T) {
+	t.Run("InCluster", func(t *testing.T) {
+		t.Setenv("KUBERNETES_SERVICE_HOST", "fd00::1")
+		t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+
+		cfg, err := KubernetesBackendConfig{Namespace: "test-ns"}.withDefaults()
+		require.NoError(t, err)
+		assert.Equal(t, KubernetesBackendConfig{
+			Namespace: "test-ns",
+			ConfigMap: DEFAULT_CONFIGMAP_NAME,
+			Key:       DEFAULT_CONFIGMAP_KEY,
+			Server:    "https://[fd00::1]:443",
+			TokenFile: serviceAccountDir + "/token",
+			CAFile:    serviceAccountDir + "/ca.crt",
+		}, cfg, "Should use the in-cluster configuration")
+	})
+
+	t.Run("ExplicitServer", func(t *testing.T) {
+		t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+		t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+
+		input := KubernetesBackendConfig{
+			Namespace: "test-ns",
+			ConfigMap: "my-hosts",
+			Key:       "data.yaml",
+			Server:    "https://k8s.example.org:6443",
+		}
+		cfg, err := input.withDefaults()
+		require.NoError(t, err)
+		assert.Equal(t, input, cfg, "Should not use the in-cluster configuration")
+	})
+}
@@ -0,0 +1,68 @@
+package kubernetes
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	DEFAULT_CONFIGMAP_NAME = "go-wol-hosts"
+	DEFAULT_CONFIGMAP_KEY  = "hosts.yaml"
+)
+
+// Location of the service account credentials when running inside a pod
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+type KubernetesBackendConfig struct {
+	// Namespace of the ConfigMap, defaults to the namespace of the pod
+	Namespace string `yaml:"namespace,omitempty"`
+	// Name of the ConfigMap, will be created if it does not exist
+	ConfigMap string `yaml:"configmap,omitempty"`
+	// Key in the ConfigMap data containing the hosts
+	Key string `yaml:"key,omitempty"`
+
+	// Options for connecting to the API server, default to the in-cluster configuration.
+	// The token is read again for every request, as service account tokens are rotated.
+	Server    string `yaml:"server,omitempty"`
+	TokenFile string `yaml:"token-file,omitempty"`
+	CAFile    string `yaml:"ca-file,omitempty"`
+}
+
+// Fill unset options with the defaults and the in-cluster configuration.
+func (cfg KubernetesBackendConfig) withDefaults() (KubernetesBackendConfig, error) {
+	if cfg.ConfigMap == "" {
+		cfg.ConfigMap = DEFAULT_CONFIGMAP_NAME
+	}
+	if cfg.Key == "" {
+		cfg.Key = DEFAULT_CONFIGMAP_KEY
+	}
+
+	if cfg.Server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return cfg, fmt.Errorf("missing server and not running inside a kubernetes cluster")
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		cfg.Server = "https://" + host + ":" + port
+
+		if cfg.TokenFile == "" {
+			cfg.TokenFile = serviceAccountDir + "/token"
+		}
+		if cfg.CAFile == "" {
+			cfg.CAFile = serviceAccountDir + "/ca.crt"
+		}
+	}
+
+	if cfg.Namespace == "" {
+		ns, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return cfg, fmt.Errorf("missing namespace and failed to read namespace of the service account: %w", err)
+		}
+		cfg.Namespace = strings.TrimSpace(string(ns))
+	}
+
+	return cfg, nil
+}
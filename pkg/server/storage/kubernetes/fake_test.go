@@ -0,0 +1,172 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strconv"
+	"sync"
+)
+
+// In-memory implementation of Client, behaves like the API server for a single ConfigMap.
+type fakeClient struct {
+	lock     sync.Mutex
+	cm       *ConfigMap
+	version  int
+	watchers map[chan WatchEvent]struct{}
+
+	// Permissions returned by CanI
+	allowed map[string]bool
+	// Number of updates that should fail with a conflict
+	conflicts int
+	// Number of watches that have been started
+	watches int
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		watchers: map[chan WatchEvent]struct{}{},
+		allowed:  map[string]bool{"patch": true, "create": true},
+	}
+}
+
+func (f *fakeClient) GetConfigMap(_ context.Context, name string) (*ConfigMap, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.cm == nil || f.cm.Metadata.Name != name {
+		return nil, fmt.Errorf("%w: configmaps \"%s\" not found", ErrNotFound, name)
+	}
+	return copyConfigMap(f.cm), nil
+}
+
+func (f *fakeClient) CreateConfigMap(_ context.Context, cm *ConfigMap) (*ConfigMap, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.cm != nil {
+		return nil, fmt.Errorf("%w: configmaps \"%s\" already exists", ErrConflict, cm.Metadata.Name)
+	}
+	f.store(cm, "ADDED")
+	return copyConfigMap(f.cm), nil
+}
+
+func (f *fakeClient) PatchConfigMapData(_ context.Context, name string, resourceVersion string, key string, value string) (*ConfigMap, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.cm == nil {
+		return nil, fmt.Errorf("%w: configmaps \"%s\" not found", ErrNotFound, name)
+	}
+	if f.conflicts > 0 || resourceVersion != f.cm.Metadata.ResourceVersion {
+		f.conflicts--
+		// Simulate a concurrent change by someone else
+		f.store(f.cm, "MODIFIED")
+		return nil, fmt.Errorf("%w: the object has been modified", ErrConflict)
+	}
+	cm := copyConfigMap(f.cm)
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[key] = value
+	f.store(cm, "MODIFIED")
+	return copyConfigMap(f.cm), nil
+}
+
+func (f *fakeClient) WatchConfigMap(ctx context.Context, _ string, resourceVersion string) (<-chan WatchEvent, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.watches++
+	events := make(chan WatchEvent, 100)
+	f.watchers[events] = struct{}{}
+	// Like the API server, send the changes since the given version
+	if f.cm != nil && f.cm.Metadata.ResourceVersion != resourceVersion {
+		events <- WatchEvent{Type: "MODIFIED", Object: *copyConfigMap(f.cm)}
+	}
+	go func() {
+		<-ctx.Done()
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		f.closeWatch(events)
+	}()
+	return events, nil
+}
+
+func (f *fakeClient) CanI(_ context.Context, verb string, _ string) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.allowed[verb], nil
+}
+
+// Change the data of the ConfigMap, like an edit with kubectl
+func (f *fakeClient) setData(data map[string]string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.cm == nil {
+		f.store(&ConfigMap{Metadata: ObjectMeta{Name: "hosts"}, Data: data}, "ADDED")
+		return
+	}
+	cm := copyConfigMap(f.cm)
+	cm.Data = data
+	f.store(cm, "MODIFIED")
+}
+
+func (f *fakeClient) delete() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.notify(WatchEvent{Type: "DELETED", Object: *copyConfigMap(f.cm)})
+	f.cm = nil
+}
+
+// End all running watches
+func (f *fakeClient) closeWatches() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for events := range f.watchers {
+		f.closeWatch(events)
+	}
+}
+
+func (f *fakeClient) watchCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.watches
+}
+
+// Store a copy of the ConfigMap with a new resource version and notify the watchers.
+// Caller needs to hold the lock.
+func (f *fakeClient) store(cm *ConfigMap, eventType string) {
+	f.version++
+	f.cm = copyConfigMap(cm)
+	f.cm.Metadata.ResourceVersion = strconv.Itoa(f.version)
+	f.notify(WatchEvent{Type: eventType, Object: *copyConfigMap(f.cm)})
+}
+
+// Caller needs to hold the lock.
+func (f *fakeClient) notify(event WatchEvent) {
+	for events := range f.watchers {
+		events <- event
+	}
+}
+
+// Caller needs to hold the lock.
+func (f *fakeClient) closeWatch(events chan WatchEvent) {
+	if _, ok := f.watchers[events]; ok {
+		delete(f.watchers, events)
+		close(events)
+	}
+}
+
+func copyConfigMap(cm *ConfigMap) *ConfigMap {
+	res := *cm
+	res.Data = maps.Clone(cm.Data)
+	res.Metadata.Labels = maps.Clone(cm.Metadata.Labels)
+	res.Metadata.Annotations = maps.Clone(cm.Metadata.Annotations)
+	return &res
+}
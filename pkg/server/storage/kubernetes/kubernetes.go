@@ -0,0 +1,417 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"go.yaml.in/yaml/v3"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+
+	// How often an update is retried when the ConfigMap was changed concurrently
+	maxConflictRetries = 5
+
+	minWatchBackoff = time.Second
+	maxWatchBackoff = time.Minute
+)
+
+// Store the hosts in a ConfigMap, so they can be edited with kubectl.
+// The hosts are cached and the cache is kept up to date by watching the ConfigMap.
+type KubernetesBackend struct {
+	client Client
+	name   string
+	key    string
+
+	lock            sync.RWMutex
+	hosts           []types.Host
+	resourceVersion string
+
+	// Serializes writes of this instance, to avoid conflicts with ourselves
+	writeLock sync.Mutex
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewKubernetesBackend(cfg KubernetesBackendConfig) (*KubernetesBackend, error) {
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newRESTClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	return newKubernetesBackend(client, cfg.ConfigMap, cfg.Key)
+}
+
+// Create the backend with the given client, reads the ConfigMap and starts watching it.
+func newKubernetesBackend(client Client, name, key string) (*KubernetesBackend, error) {
+	k := &KubernetesBackend{
+		client: client,
+		name:   name,
+		key:    key,
+		hosts:  []types.Host{},
+		done:   make(chan struct{}),
+	}
+
+	err := k.resync()
+	if err != nil {
+		return nil, err
+	}
+
+	var ctx context.Context
+	ctx, k.cancel = context.WithCancel(context.Background())
+	go k.watch(ctx)
+
+	return k, nil
+}
+
+// Add a new host, overwrite existing host name if it already exists.
+// Ensures that the MAC address is unique and uppercase.
+func (k *KubernetesBackend) AddHost(ctx context.Context, host types.Host) error {
+	host.MAC = strings.ToUpper(host.MAC)
+
+	return k.modify(ctx, func(hosts []types.Host) ([]types.Host, error) {
+		for i, h := range hosts {
+			if h.MAC == host.MAC {
+				hosts[i] = host
+				return hosts, nil
+			}
+		}
+		return append(hosts, host), nil
+	})
+}
+
+// Remove a host, ignore if the host does not exist
+func (k *KubernetesBackend) RemoveHost(ctx context.Context, mac string) error {
+	mac = strings.ToUpper(mac)
+
+	return k.modify(ctx, func(hosts []types.Host) ([]types.Host, error) {
+		for i, host := range hosts {
+			if host.MAC == mac {
+				return append(hosts[:i], hosts[i+1:]...), nil
+			}
+		}
+		return nil, errUnchanged
+	})
+}
+
+// Return the host name for a given MAC address, return empty if not found
+func (k *KubernetesBackend) GetHost(_ context.Context, mac string) (types.Host, error) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	mac = strings.ToUpper(mac)
+	for _, host := range k.hosts {
+		if host.MAC == mac {
+			return host, nil
+		}
+	}
+	return types.Host{}, nil
+}
+
+// Return all hosts
+func (k *KubernetesBackend) GetHosts(_ context.Context) ([]types.Host, error) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	return append([]types.Host{}, k.hosts...), nil
+}
+
+// Move a host to the given index, the index is capped to the bounds of the list.
+// Returns ErrHostNotFound if the host does not exist.
+func (k *KubernetesBackend) MoveHost(ctx context.Context, mac string, index int) error {
+	return k.modify(ctx, func(hosts []types.Host) ([]types.Host, error) {
+		order, err := types.MoveToIndex(macs(hosts), mac, index)
+		if err != nil {
+			return nil, err
+		}
+		return sortHosts(hosts, order), nil
+	})
+}
+
+// Sort the hosts by the given list of MAC addresses.
+// Hosts not contained in the list keep their relative order after the listed hosts.
+// Returns ErrHostNotFound if the list contains an unknown host.
+func (k *KubernetesBackend) ReorderHosts(ctx context.Context, order []string) error {
+	return k.modify(ctx, func(hosts []types.Host) ([]types.Host, error) {
+		order, err := types.ApplyOrder(macs(hosts), order)
+		if err != nil {
+			return nil, err
+		}
+		return sortHosts(hosts, order), nil
+	})
+}
+
+// Check if the storage backend is readonly.
+// Asks the API server if the service account may patch, or create if it does not exist, the ConfigMap.
+func (k *KubernetesBackend) Readonly(ctx context.Context) (bool, error) {
+	verb, name := "patch", k.name
+	if k.version() == "" {
+		verb, name = "create", ""
+	}
+
+	allowed, err := k.client.CanI(ctx, verb, name)
+	if err != nil {
+		return true, fmt.Errorf("failed to check permissions for configmap: %w", err)
+	}
+	return !allowed, nil
+}
+
+// Stop watching the ConfigMap
+func (k *KubernetesBackend) Close() {
+	k.cancel()
+	<-k.done
+}
+
+// Returned by modify functions when nothing needs to be written
+var errUnchanged = errors.New("unchanged")
+
+// Apply fn to the current hosts and write the result back to the ConfigMap.
+// Retries when the ConfigMap has been changed concurrently.
+func (k *KubernetesBackend) modify(ctx context.Context, fn func(hosts []types.Host) ([]types.Host, error)) error {
+	k.writeLock.Lock()
+	defer k.writeLock.Unlock()
+
+	for range maxConflictRetries {
+		err := k.tryModify(ctx, fn)
+		if errors.Is(err, errUnchanged) {
+			return nil
+		}
+		if !errors.Is(err, ErrConflict) {
+			return err
+		}
+		slog.Debug("ConfigMap has been changed concurrently, retrying", slog.String("configmap", k.name))
+	}
+	return fmt.Errorf("failed to update configmap after %d conflicts", maxConflictRetries)
+}
+
+func (k *KubernetesBackend) tryModify(ctx context.Context, fn func(hosts []types.Host) ([]types.Host, error)) error {
+	// Always read the latest version, the cache might be behind.
+	cm, err := k.client.GetConfigMap(ctx, k.name)
+	if errors.Is(err, ErrNotFound) {
+		cm = nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get configmap: %w", err)
+	}
+
+	var hosts []types.Host
+	if cm != nil {
+		hosts, err = k.parseHosts(cm)
+		if err != nil {
+			return err
+		}
+	}
+
+	hosts, err = fn(hosts)
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(types.HostsFile{Hosts: hosts})
+	if err != nil {
+		return fmt.Errorf("failed to marshal hosts: %w", err)
+	}
+
+	if cm == nil {
+		cm = &ConfigMap{
+			Metadata: ObjectMeta{Name: k.name},
+			Data:     map[string]string{k.key: string(data)},
+		}
+		cm, err = k.client.CreateConfigMap(ctx, cm)
+		if err != nil {
+			return fmt.Errorf("failed to create configmap: %w", err)
+		}
+		slog.Info("Created configmap for hosts", slog.String("configmap", k.name))
+	} else {
+		// Only patch the key of the hosts, so labels, annotations and other keys are kept
+		cm, err = k.client.PatchConfigMapData(ctx, k.name, cm.Metadata.ResourceVersion, k.key, string(data))
+		if err != nil {
+			return fmt.Errorf("failed to update configmap: %w", err)
+		}
+	}
+
+	k.setHosts(hosts, cm.Metadata.ResourceVersion)
+	return nil
+}
+
+// Read the ConfigMap from the API server and replace the cache.
+func (k *KubernetesBackend) resync() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+
+	cm, err := k.client.GetConfigMap(ctx, k.name)
+	if errors.Is(err, ErrNotFound) {
+		slog.Info("ConfigMap for hosts does not exist yet, it will be created when adding hosts", slog.String("configmap", k.name))
+		k.replaceHosts(nil, "")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get configmap: %w", err)
+	}
+
+	hosts, err := k.parseHosts(cm)
+	if err != nil {
+		return err
+	}
+	k.replaceHosts(hosts, cm.Metadata.ResourceVersion)
+	return nil
+}
+
+// Watch the ConfigMap for changes until the context is canceled.
+// Reconnects with a backoff and reads the ConfigMap again after errors, as events may have been missed.
+func (k *KubernetesBackend) watch(ctx context.Context) {
+	defer close(k.done)
+
+	backoff := minWatchBackoff
+	for {
+		start := time.Now()
+		events, err := k.client.WatchConfigMap(ctx, k.name, k.version())
+		if err == nil {
+			err = k.handleEvents(events)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		// A watch ends regularly after a timeout, restart it right away unless it ended suspiciously fast.
+		if err == nil && time.Since(start) > minWatchBackoff {
+			backoff = minWatchBackoff
+			continue
+		} else if err == nil {
+			err = fmt.Errorf("watch ended after %s", time.Since(start).Round(time.Millisecond))
+		}
+
+		slog.Warn("Watch of configmap failed, retrying", slog.String("configmap", k.name), slog.Duration("backoff", backoff), "err", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxWatchBackoff)
+
+		err = k.resync()
+		if err != nil {
+			slog.Warn("Failed to read configmap after watch failed", slog.String("configmap", k.name), "err", err)
+		}
+	}
+}
+
+// Apply the events to the cache until the channel is closed.
+// Returns an error if the watch failed.
+func (k *KubernetesBackend) handleEvents(events <-chan WatchEvent) error {
+	for event := range events {
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			hosts, err := k.parseHosts(&event.Object)
+			if err != nil {
+				slog.Error("Ignoring invalid change to configmap", slog.String("configmap", k.name), "err", err)
+				continue
+			}
+			if k.setHosts(hosts, event.Object.Metadata.ResourceVersion) {
+				slog.Debug("Hosts changed in configmap", slog.String("configmap", k.name), slog.String("resourceVersion", event.Object.Metadata.ResourceVersion))
+			}
+		case "DELETED":
+			slog.Info("ConfigMap for hosts has been deleted", slog.String("configmap", k.name))
+			k.replaceHosts(nil, "")
+		case "ERROR":
+			return fmt.Errorf("watch returned an error: %s", event.Message)
+		}
+	}
+	return nil
+}
+
+// Parse the hosts from the ConfigMap, ensure that all MAC addresses are uppercase and unique.
+func (k *KubernetesBackend) parseHosts(cm *ConfigMap) ([]types.Host, error) {
+	var file types.HostsFile
+	err := yaml.Unmarshal([]byte(cm.Data[k.key]), &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse hosts from key '%s' of configmap '%s': %w", k.key, k.name, err)
+	}
+
+	seen := make(map[string]bool, len(file.Hosts))
+	hosts := make([]types.Host, 0, len(file.Hosts))
+	for _, host := range file.Hosts {
+		host.MAC = strings.ToUpper(host.MAC)
+		if seen[host.MAC] {
+			continue
+		}
+		seen[host.MAC] = true
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// Update the cache if the resource version is newer than the cached one.
+// Returns true if the cache has been updated.
+func (k *KubernetesBackend) setHosts(hosts []types.Host, resourceVersion string) bool {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if !newerVersion(resourceVersion, k.resourceVersion) {
+		return false
+	}
+	k.hosts = append([]types.Host{}, hosts...)
+	k.resourceVersion = resourceVersion
+	return true
+}
+
+// Replace the cache regardless of the resource version.
+func (k *KubernetesBackend) replaceHosts(hosts []types.Host, resourceVersion string) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	k.hosts = append([]types.Host{}, hosts...)
+	k.resourceVersion = resourceVersion
+}
+
+func (k *KubernetesBackend) version() string {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+
+	return k.resourceVersion
+}
+
+// Resource versions are opaque, but in practice they are increasing integers.
+// Compare them as such when possible, so that delayed watch events don't overwrite newer writes.
+func newerVersion(a, b string) bool {
+	x, errA := strconv.ParseUint(a, 10, 64)
+	y, errB := strconv.ParseUint(b, 10, 64)
+	if errA != nil || errB != nil {
+		return a != b
+	}
+	return x > y
+}
+
+// Return the MAC addresses of the hosts in their current order.
+func macs(hosts []types.Host) []string {
+	res := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		res = append(res, host.MAC)
+	}
+	return res
+}
+
+// Sort the hosts by the given order of MAC addresses.
+func sortHosts(hosts []types.Host, order []string) []types.Host {
+	byMAC := make(map[string]types.Host, len(hosts))
+	for _, host := range hosts {
+		byMAC[host.MAC] = host
+	}
+
+	sorted := make([]types.Host, 0, len(order))
+	for _, mac := range order {
+		sorted = append(sorted, byMAC[mac])
+	}
+	return sorted
+}
@@ -0,0 +1,243 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/testsuite"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKey = "hosts.yaml"
+
+func newTestBackend(t *testing.T, client *fakeClient) *KubernetesBackend {
+	t.Helper()
+
+	k, err := newKubernetesBackend(client, "hosts", testKey)
+	require.NoError(t, err, "Failed to create kubernetes backend")
+	t.Cleanup(k.Close)
+
+	return k
+}
+
+var newFakeBackend testsuite.StorageBackendFactory = func(t *testing.T, _ string) types.StorageBackend {
+	t.Helper()
+
+	return newTestBackend(t, newFakeClient())
+}
+
+// Wait until the backend returns the expected hosts
+func assertEventuallyHosts(t *testing.T, k *KubernetesBackend, expected []types.Host, msg string) {
+	t.Helper()
+
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		hosts, err := k.GetHosts(t.Context())
+		assert.NoError(c, err)
+		assert.Equal(c, expected, hosts)
+	}, 5*time.Second, 10*time.Millisecond, msg)
+}
+
+func TestNewKubernetesBackend(t *testing.T) {
+	t.Run("MissingConfigMap", func(t *testing.T) {
+		client := newFakeClient()
+		k := newTestBackend(t, client)
+
+		hosts, err := k.GetHosts(t.Context())
+		assert.NoError(t, err, "Should get hosts")
+		assert.Empty(t, hosts, "Should start without hosts")
+
+		require.NoError(t, k.AddHost(t.Context(), types.Host{MAC: "aa:bb:cc:dd:ee:ff", Name: "TestHost"}))
+
+		cm, err := client.GetConfigMap(t.Context(), "hosts")
+		require.NoError(t, err, "Should create the configmap")
+		assert.Equal(t, "hosts:\n    - mac: AA:BB:CC:DD:EE:FF\n      name: TestHost\n", cm.Data[testKey], "Should store the hosts as yaml")
+	})
+
+	t.Run("ExistingConfigMap", func(t *testing.T) {
+		client := newFakeClient()
+		client.setData(map[string]string{
+			testKey: "hosts:\n  - mac: aa:bb:cc:dd:ee:ff\n    name: TestHost\n  - mac: AA:BB:CC:DD:EE:FF\n    name: Duplicate\n",
+			"other": "value",
+		})
+		k := newTestBackend(t, client)
+
+		hosts, err := k.GetHosts(t.Context())
+		assert.NoError(t, err, "Should get hosts")
+		assert.Equal(t, []types.Host{{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"}}, hosts, "Should read unique, uppercase hosts")
+
+		require.NoError(t, k.AddHost(t.Context(), types.Host{MAC: "11:22:33:44:55:66", Name: "NewHost"}))
+
+		cm, err := client.GetConfigMap(t.Context(), "hosts")
+		require.NoError(t, err)
+		assert.Equal(t, "value", cm.Data["other"], "Should keep other keys of the configmap")
+	})
+
+	t.Run("InvalidData", func(t *testing.T) {
+		client := newFakeClient()
+		client.setData(map[string]string{testKey: "hosts: {"})
+
+		k, err := newKubernetesBackend(client, "hosts", testKey)
+		assert.ErrorContains(t, err, "failed to parse hosts", "Should fail to parse hosts")
+		assert.Nil(t, k, "Should not return backend")
+	})
+
+	t.Run("NotInCluster", func(t *testing.T) {
+		t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+		k, err := NewKubernetesBackend(KubernetesBackendConfig{})
+		assert.ErrorContains(t, err, "not running inside a kubernetes cluster", "Should require a server")
+		assert.Nil(t, k, "Should not return backend")
+	})
+}
+
+func TestWatch(t *testing.T) {
+	t.Run("ExternalChange", func(t *testing.T) {
+		client := newFakeClient()
+		k := newTestBackend(t, client)
+
+		client.setData(map[string]string{testKey: "hosts:\n  - mac: aa:bb:cc:dd:ee:ff\n    name: Edited\n"})
+		assertEventuallyHosts(t, k, []types.Host{{MAC: "AA:BB:CC:DD:EE:FF", Name: "Edited"}}, "Should pick up changes made with kubectl")
+
+		client.delete()
+		assertEventuallyHosts(t, k, []types.Host{}, "Should remove hosts when the configmap is deleted")
+
+		require.NoError(t, k.AddHost(t.Context(), types.Host{MAC: "11:22:33:44:55:66", Name: "TestHost"}), "Should recreate the configmap")
+		assertEventuallyHosts(t, k, []types.Host{{MAC: "11:22:33:44:55:66", Name: "TestHost"}}, "Should use the new configmap")
+	})
+
+	t.Run("InvalidChange", func(t *testing.T) {
+		client := newFakeClient()
+		k := newTestBackend(t, client)
+		require.NoError(t, k.AddHost(t.Context(), types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"}))
+
+		client.setData(map[string]string{testKey: "hosts: {"})
+		client.setData(map[string]string{testKey: "hosts: {"})
+
+		hosts, err := k.GetHosts(t.Context())
+		assert.NoError(t, err)
+		assert.Equal(t, []types.Host{{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"}}, hosts, "Should keep the last valid hosts")
+
+		err = k.AddHost(t.Context(), types.Host{MAC: "11:22:33:44:55:66", Name: "NewHost"})
+		assert.ErrorContains(t, err, "failed to parse hosts", "Should not overwrite invalid configmap")
+	})
+
+	t.Run("Reconnect", func(t *testing.T) {
+		client := newFakeClient()
+		k := newTestBackend(t, client)
+
+		require.Eventually(t, func() bool { return client.watchCount() == 1 }, time.Second, 10*time.Millisecond, "Should start watching")
+		client.closeWatches()
+		require.Eventually(t, func() bool { return client.watchCount() == 2 }, 5*time.Second, 10*time.Millisecond, "Should restart the watch")
+
+		client.setData(map[string]string{testKey: "hosts:\n  - mac: aa:bb:cc:dd:ee:ff\n    name: Edited\n"})
+		assertEventuallyHosts(t, k, []types.Host{{MAC: "AA:BB:CC:DD:EE:FF", Name: "Edited"}}, "Should pick up changes after reconnecting")
+	})
+}
+
+func TestConflicts(t *testing.T) {
+	t.Run("Retry", func(t *testing.T) {
+		client := newFakeClient()
+		k := newTestBackend(t, client)
+		require.NoError(t, k.AddHost(t.Context(), types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost1"}))
+
+		client.conflicts = maxConflictRetries - 1
+		assert.NoError(t, k.AddHost(t.Context(), types.Host{MAC: "11:22:33:44:55:66", Name: "TestHost2"}), "Should retry on conflicts")
+
+		hosts, err := k.GetHosts(t.Context())
+		assert.NoError(t, err)
+		assert.Len(t, hosts, 2, "Should contain both hosts")
+	})
+
+	t.Run("TooManyConflicts", func(t *testing.T) {
+		client := newFakeClient()
+		k := newTestBackend(t, client)
+		require.NoError(t, k.AddHost(t.Context(), types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost1"}))
+
+		client.conflicts = maxConflictRetries
+		assert.ErrorContains(t, k.AddHost(t.Context(), types.Host{MAC: "11:22:33:44:55:66", Name: "TestHost2"}), "conflicts", "Should give up eventually")
+	})
+
+	t.Run("ConcurrentInstances", func(t *testing.T) {
+		client := newFakeClient()
+		a := newTestBackend(t, client)
+		b := newTestBackend(t, client)
+
+		require.NoError(t, a.AddHost(t.Context(), types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost1"}))
+		require.NoError(t, b.AddHost(t.Context(), types.Host{MAC: "11:22:33:44:55:66", Name: "TestHost2"}))
+
+		expected := []types.Host{{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost1"}, {MAC: "11:22:33:44:55:66", Name: "TestHost2"}}
+		assertEventuallyHosts(t, a, expected, "Should see hosts of the other instance")
+		assertEventuallyHosts(t, b, expected, "Should not lose hosts of the other instance")
+	})
+}
+
+func TestKeepMetadata(t *testing.T) {
+	client := newFakeClient()
+	client.setData(map[string]string{testKey: "hosts: []\n", "other": "value"})
+	client.cm.Metadata.Labels = map[string]string{"app.kubernetes.io/managed-by": "Helm"}
+	client.cm.Metadata.Annotations = map[string]string{"meta.helm.sh/release-name": "go-wol"}
+	k := newTestBackend(t, client)
+
+	require.NoError(t, k.AddHost(t.Context(), types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"}))
+
+	cm, err := client.GetConfigMap(t.Context(), "hosts")
+	require.NoError(t, err, "Should get configmap")
+	assert := assert.New(t)
+	assert.Equal(map[string]string{"app.kubernetes.io/managed-by": "Helm"}, cm.Metadata.Labels, "Should keep the labels")
+	assert.Equal(map[string]string{"meta.helm.sh/release-name": "go-wol"}, cm.Metadata.Annotations, "Should keep the annotations")
+	assert.Equal("value", cm.Data["other"], "Should keep the other keys")
+	assert.Contains(cm.Data[testKey], "TestHost", "Should update the hosts")
+}
+
+func TestReadonly(t *testing.T) {
+	client := newFakeClient()
+	k := newTestBackend(t, client)
+
+	readonly, err := k.Readonly(t.Context())
+	assert.NoError(t, err, "Should check if readonly")
+	assert.False(t, readonly, "Should be writable")
+
+	client.allowed["create"] = false
+	readonly, err = k.Readonly(t.Context())
+	assert.NoError(t, err, "Should check if readonly")
+	assert.True(t, readonly, "Should need permission to create the configmap")
+
+	require.NoError(t, k.AddHost(t.Context(), types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"}))
+	readonly, err = k.Readonly(t.Context())
+	assert.NoError(t, err, "Should check if readonly")
+	assert.False(t, readonly, "Should only need permission to update existing configmap")
+
+	client.allowed["patch"] = false
+	readonly, err = k.Readonly(t.Context())
+	assert.NoError(t, err, "Should check if readonly")
+	assert.True(t, readonly, "Should be readonly without permission to update")
+}
+
+func TestNewerVersion(t *testing.T) {
+	tMatrix := []struct {
+		A, B   string
+		Result bool
+	}{
+		{"2", "1", true},
+		{"10", "9", true},
+		{"1", "2", false},
+		{"1", "1", false},
+		{"1", "", true},
+		{"", "", false},
+		{"abc", "def", true},
+	}
+
+	for _, tCase := range tMatrix {
+		assert.Equal(t, tCase.Result, newerVersion(tCase.A, tCase.B), "newerVersion(%q, %q)", tCase.A, tCase.B)
+	}
+}
+
+func TestKubernetesTestsuiteBasic(t *testing.T) {
+	testsuite.RunStorageBackendTests(t, newFakeBackend)
+}
+
+func TestKubernetesTestsuiteRace(t *testing.T) {
+	testsuite.RunStorageBackendRaceTests(t, newFakeBackend)
+}
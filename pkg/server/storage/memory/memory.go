@@ -0,0 +1,145 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+)
+
+// Keeps the hosts only in memory, they are lost when the process exits.
+type MemoryBackend struct {
+	hosts []types.Host
+	lock  sync.RWMutex
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	slog.Info("Using in-memory storage, all changes to the hosts are lost on restart")
+
+	return &MemoryBackend{
+		hosts: []types.Host{},
+	}
+}
+
+// Add a new host, overwrite existing host name if it already exists.
+// Ensures that the MAC address is unique and uppercase.
+func (m *MemoryBackend) AddHost(_ context.Context, host types.Host) error {
+	host = host.Clone()
+	host.MAC = strings.ToUpper(host.MAC)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for i, h := range m.hosts {
+		if h.MAC == host.MAC {
+			m.hosts[i] = host
+			return nil
+		}
+	}
+	m.hosts = append(m.hosts, host)
+	return nil
+}
+
+// Remove a host, ignore if the host does not exist
+func (m *MemoryBackend) RemoveHost(_ context.Context, mac string) error {
+	uppercaseMAC := strings.ToUpper(mac)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for i, host := range m.hosts {
+		if host.MAC == uppercaseMAC {
+			m.hosts = append(m.hosts[:i], m.hosts[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// Return the host name for a given MAC address, return empty if not found
+func (m *MemoryBackend) GetHost(_ context.Context, mac string) (types.Host, error) {
+	uppercaseMAC := strings.ToUpper(mac)
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for _, host := range m.hosts {
+		if host.MAC == uppercaseMAC {
+			return host.Clone(), nil
+		}
+	}
+	return types.Host{}, nil
+}
+
+// Return all hosts
+func (m *MemoryBackend) GetHosts(_ context.Context) ([]types.Host, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	hosts := make([]types.Host, 0, len(m.hosts))
+	for _, host := range m.hosts {
+		hosts = append(hosts, host.Clone())
+	}
+	return hosts, nil
+}
+
+// Move a host to the given index, the index is capped to the bounds of the list.
+// Returns ErrHostNotFound if the host does not exist.
+func (m *MemoryBackend) MoveHost(_ context.Context, mac string, index int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	order, err := types.MoveToIndex(m.macs(), mac, index)
+	if err != nil {
+		return err
+	}
+	m.sortHosts(order)
+	return nil
+}
+
+// Sort the hosts by the given list of MAC addresses.
+// Hosts not contained in the list keep their relative order after the listed hosts.
+// Returns ErrHostNotFound if the list contains an unknown host.
+func (m *MemoryBackend) ReorderHosts(_ context.Context, macs []string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	order, err := types.ApplyOrder(m.macs(), macs)
+	if err != nil {
+		return err
+	}
+	m.sortHosts(order)
+	return nil
+}
+
+// Check if the storage backend is readonly, which is never the case
+func (m *MemoryBackend) Readonly(_ context.Context) (bool, error) {
+	return false, nil
+}
+
+// Return the MAC addresses of all hosts in their current order.
+// Caller needs to hold the lock.
+func (m *MemoryBackend) macs() []string {
+	macs := make([]string, 0, len(m.hosts))
+	for _, host := range m.hosts {
+		macs = append(macs, host.MAC)
+	}
+	return macs
+}
+
+// Sort the hosts by the given order.
+// Caller needs to hold the lock.
+func (m *MemoryBackend) sortHosts(order []string) {
+	hosts := make(map[string]types.Host, len(m.hosts))
+	for _, host := range m.hosts {
+		hosts[host.MAC] = host
+	}
+
+	sorted := make([]types.Host, 0, len(order))
+	for _, mac := range order {
+		sorted = append(sorted, hosts[mac])
+	}
+	m.hosts = sorted
+}
@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/testsuite"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var newMemoryBackend testsuite.StorageBackendFactory = func(t *testing.T, _ string) types.StorageBackend {
+	return NewMemoryBackend()
+}
+
+func TestGetHostsCopy(t *testing.T) {
+	m := NewMemoryBackend()
+	added := types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost", Tags: []string{"tag"}, Labels: map[string]string{"key": "value"}}
+	require.NoError(t, m.AddHost(t.Context(), added))
+	added.Tags[0] = "changed"
+	added.Labels["key"] = "changed"
+
+	hosts, err := m.GetHosts(t.Context())
+	require.NoError(t, err)
+	hosts[0].Name = "Changed"
+	hosts[0].Tags[0] = "changed"
+	hosts[0].Labels["key"] = "changed"
+
+	host, err := m.GetHost(t.Context(), "AA:BB:CC:DD:EE:FF")
+	assert.NoError(t, err)
+	assert.Equal(t, "TestHost", host.Name, "Should not be affected by changes to the returned hosts")
+	assert.Equal(t, []string{"tag"}, host.Tags, "Should not share tags")
+	assert.Equal(t, map[string]string{"key": "value"}, host.Labels, "Should not share labels")
+}
+
+func TestMemoryTestsuiteBasic(t *testing.T) {
+	testsuite.RunStorageBackendTests(t, newMemoryBackend)
+}
+
+func TestMemoryTestsuiteRace(t *testing.T) {
+	testsuite.RunStorageBackendRaceTests(t, newMemoryBackend)
+}
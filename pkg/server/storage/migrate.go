@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+)
+
+type MigrateOptions struct {
+	// Only check if the migration is possible, without changing the target
+	DryRun bool
+	// Read the hosts back from the target afterwards and compare them with the source
+	Verify bool
+	// Replace the hosts of a target that is not empty, hosts not contained in the source are removed
+	Force bool
+}
+
+type MigrateResult struct {
+	DryRun bool
+	// MAC addresses of the copied hosts, in order
+	Copied []string
+	// MAC addresses of the hosts removed from the target
+	Removed []string
+	// If the target has been verified
+	Verified bool
+}
+
+// Copy all hosts from one backend to another, keeping their order and all fields.
+// The target needs to be empty, unless opts.Force is set.
+func Migrate(ctx context.Context, from, to types.StorageBackend, opts MigrateOptions) (MigrateResult, error) {
+	result := MigrateResult{DryRun: opts.DryRun}
+
+	hosts, err := from.GetHosts(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to get hosts from source: %w", err)
+	}
+	existing, err := to.GetHosts(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to get hosts from target: %w", err)
+	}
+	readonly, err := to.Readonly(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to check if target is readonly: %w", err)
+	}
+	if readonly {
+		return result, fmt.Errorf("target storage is readonly")
+	}
+	if len(existing) > 0 && !opts.Force {
+		return result, fmt.Errorf("target storage already contains %d hosts, use force to replace them", len(existing))
+	}
+
+	order := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		order = append(order, host.MAC)
+	}
+	result.Copied = order
+	for _, host := range existing {
+		if !slices.Contains(order, host.MAC) {
+			result.Removed = append(result.Removed, host.MAC)
+		}
+	}
+
+	if opts.DryRun {
+		return result, nil
+	}
+
+	for _, mac := range result.Removed {
+		err = to.RemoveHost(ctx, mac)
+		if err != nil {
+			return result, fmt.Errorf("failed to remove host '%s' from target: %w", mac, err)
+		}
+	}
+	for _, host := range hosts {
+		slog.Debug("Copying host", slog.String("mac", host.MAC), slog.String("name", host.Name))
+		err = to.AddHost(ctx, host)
+		if err != nil {
+			return result, fmt.Errorf("failed to add host '%s' to target: %w", host.MAC, err)
+		}
+	}
+	// Hosts that already existed in the target keep their position when added
+	if len(existing) > 0 && len(order) > 0 {
+		err = to.ReorderHosts(ctx, order)
+		if err != nil {
+			return result, fmt.Errorf("failed to restore order of hosts in target: %w", err)
+		}
+	}
+
+	if opts.Verify {
+		err = verifyMigration(ctx, hosts, to)
+		if err != nil {
+			return result, err
+		}
+		result.Verified = true
+	}
+
+	return result, nil
+}
+
+// Check that the target contains exactly the given hosts in the same order
+func verifyMigration(ctx context.Context, hosts []types.Host, to types.StorageBackend) error {
+	migrated, err := to.GetHosts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get hosts from target for verification: %w", err)
+	}
+	if len(migrated) != len(hosts) {
+		return fmt.Errorf("verification failed: target contains %d hosts instead of %d", len(migrated), len(hosts))
+	}
+	for i := range hosts {
+		if !hosts[i].Equal(migrated[i]) {
+			return fmt.Errorf("verification failed: host %d differs, expected %+v but target contains %+v", i+1, hosts[i], migrated[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/file"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/memory"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/sqlite"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/valkey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var testMigrateHosts = []types.Host{
+	{MAC: "00:00:00:00:00:33", Name: "Host3", Address: "192.0.2.3"},
+	{MAC: "00:00:00:00:00:11", Name: "Host1"},
+	{MAC: "00:00:00:00:00:22", Name: "Host2", Address: "host2.example.org"},
+}
+
+// Create a file backend containing the given hosts in order
+func newMigrateFileBackend(t *testing.T, hosts []types.Host) types.StorageBackend {
+	t.Helper()
+
+	backend, err := file.NewFileBackend(file.FileBackendConfig{Path: filepath.Join(t.TempDir(), "hosts.yaml")})
+	require.NoError(t, err, "Should create file backend")
+	t.Cleanup(backend.Close)
+
+	for _, host := range hosts {
+		require.NoError(t, backend.AddHost(t.Context(), host))
+	}
+	return backend
+}
+
+func newMigrateValkeyBackend(t *testing.T, hosts []types.Host) types.StorageBackend {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	backend, err := valkey.NewValkeyBackend(valkey.ValkeyConfig{Addrs: []string{mr.Addr()}})
+	require.NoError(t, err, "Should create valkey backend")
+
+	for _, host := range hosts {
+		require.NoError(t, backend.AddHost(t.Context(), host))
+	}
+	return backend
+}
+
+func TestMigrate(t *testing.T) {
+	t.Run("FileToValkey", func(t *testing.T) {
+		assert := assert.New(t)
+
+		from := newMigrateFileBackend(t, testMigrateHosts)
+		to := newMigrateValkeyBackend(t, nil)
+
+		result, err := Migrate(t.Context(), from, to, MigrateOptions{Verify: true})
+		require.NoError(t, err, "Should migrate hosts")
+		assert.Equal([]string{"00:00:00:00:00:33", "00:00:00:00:00:11", "00:00:00:00:00:22"}, result.Copied, "Should copy all hosts")
+		assert.Empty(result.Removed, "Should not remove hosts")
+		assert.True(result.Verified, "Should verify target")
+
+		hosts, err := to.GetHosts(t.Context())
+		require.NoError(t, err)
+		assert.Equal(testMigrateHosts, hosts, "Should keep order and fields")
+	})
+
+	t.Run("ValkeyToFile", func(t *testing.T) {
+		from := newMigrateValkeyBackend(t, testMigrateHosts)
+		to := newMigrateFileBackend(t, nil)
+
+		_, err := Migrate(t.Context(), from, to, MigrateOptions{Verify: true})
+		require.NoError(t, err, "Should migrate hosts")
+
+		hosts, err := to.GetHosts(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, testMigrateHosts, hosts, "Should keep order and fields")
+	})
+
+	t.Run("TaggedToSQLite", func(t *testing.T) {
+		// Hosts added through the API can contain empty instead of nil tags and labels
+		tagged := []types.Host{
+			{MAC: "00:00:00:00:00:33", Name: "Host3", Location: "Office", Tags: []string{"linux", "server"}, Labels: map[string]string{"rack": "2"}},
+			{MAC: "00:00:00:00:00:11", Name: "Host1", Tags: []string{}, Labels: map[string]string{}},
+			{MAC: "00:00:00:00:00:22", Name: "Host2", Tags: []string{"nas"}},
+		}
+		from := memory.NewMemoryBackend()
+		for _, host := range tagged {
+			require.NoError(t, from.AddHost(t.Context(), host))
+		}
+		to, err := sqlite.NewSQLiteBackend(sqlite.SQLiteBackendConfig{Path: filepath.Join(t.TempDir(), "hosts.db")})
+		require.NoError(t, err, "Should create sqlite backend")
+		t.Cleanup(func() {
+			_ = to.Close()
+		})
+
+		result, err := Migrate(t.Context(), from, to, MigrateOptions{Verify: true})
+		require.NoError(t, err, "Should migrate hosts")
+		assert.True(t, result.Verified, "Should verify target")
+
+		hosts, err := to.GetHosts(t.Context())
+		require.NoError(t, err)
+		require.Len(t, hosts, len(tagged))
+		for i := range tagged {
+			assert.True(t, tagged[i].Equal(hosts[i]), "Should keep order and fields of host %d", i+1)
+		}
+	})
+
+	t.Run("FileToMemory", func(t *testing.T) {
+		from := newMigrateFileBackend(t, testMigrateHosts)
+		to := memory.NewMemoryBackend()
+
+		_, err := Migrate(t.Context(), from, to, MigrateOptions{Verify: true})
+		require.NoError(t, err, "Should migrate hosts")
+
+		hosts, err := to.GetHosts(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, testMigrateHosts, hosts, "Should keep order and fields")
+	})
+
+	t.Run("DryRun", func(t *testing.T) {
+		assert := assert.New(t)
+
+		from := newMigrateFileBackend(t, testMigrateHosts)
+		to := newMigrateFileBackend(t, nil)
+
+		result, err := Migrate(t.Context(), from, to, MigrateOptions{DryRun: true, Verify: true})
+		require.NoError(t, err, "Should check migration")
+		assert.True(result.DryRun, "Should be a dry run")
+		assert.Len(result.Copied, 3, "Should report hosts to copy")
+		assert.False(result.Verified, "Should not verify during dry run")
+
+		hosts, err := to.GetHosts(t.Context())
+		require.NoError(t, err)
+		assert.Empty(hosts, "Should not change target")
+	})
+
+	t.Run("TargetNotEmpty", func(t *testing.T) {
+		from := newMigrateFileBackend(t, testMigrateHosts)
+		to := newMigrateFileBackend(t, []types.Host{{MAC: "00:00:00:00:00:44", Name: "Host4"}})
+
+		_, err := Migrate(t.Context(), from, to, MigrateOptions{})
+		assert.ErrorContains(t, err, "target storage already contains 1 hosts", "Should not overwrite target")
+
+		hosts, err := to.GetHosts(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, []types.Host{{MAC: "00:00:00:00:00:44", Name: "Host4"}}, hosts, "Should not change target")
+	})
+
+	t.Run("Force", func(t *testing.T) {
+		assert := assert.New(t)
+
+		from := newMigrateFileBackend(t, testMigrateHosts)
+		to := newMigrateFileBackend(t, []types.Host{
+			{MAC: "00:00:00:00:00:22", Name: "Old", Address: "192.0.2.22"},
+			{MAC: "00:00:00:00:00:44", Name: "Host4"},
+		})
+
+		result, err := Migrate(t.Context(), from, to, MigrateOptions{Force: true, Verify: true})
+		require.NoError(t, err, "Should replace hosts")
+		assert.Equal([]string{"00:00:00:00:00:44"}, result.Removed, "Should remove hosts missing in source")
+
+		hosts, err := to.GetHosts(t.Context())
+		require.NoError(t, err)
+		assert.Equal(testMigrateHosts, hosts, "Should contain the hosts of the source in order")
+	})
+
+	t.Run("ReadonlyTarget", func(t *testing.T) {
+		to := new(MockBackend)
+		to.On("GetHosts").Return([]types.Host{}, nil)
+		to.On("Readonly").Return(true, nil)
+
+		_, err := Migrate(t.Context(), newMigrateFileBackend(t, testMigrateHosts), to, MigrateOptions{})
+		assert.ErrorContains(t, err, "target storage is readonly")
+		to.AssertNotCalled(t, "AddHost", mock.Anything)
+	})
+
+	t.Run("VerificationFailed", func(t *testing.T) {
+		to := new(MockBackend)
+		to.On("GetHosts").Return([]types.Host{}, nil).Once()
+		to.On("Readonly").Return(false, nil)
+		to.On("AddHost", mock.Anything).Return(nil)
+		changed := []types.Host{testMigrateHosts[0], {MAC: "00:00:00:00:00:11", Name: "Other"}, testMigrateHosts[2]}
+		to.On("GetHosts").Return(changed, nil).Once()
+
+		result, err := Migrate(t.Context(), newMigrateFileBackend(t, testMigrateHosts), to, MigrateOptions{Verify: true})
+		assert.ErrorContains(t, err, "verification failed: host 2 differs", "Should detect changed host")
+		assert.False(t, result.Verified, "Should not be verified")
+	})
+
+	t.Run("SourceError", func(t *testing.T) {
+		from := new(MockBackend)
+		from.On("GetHosts").Return([]types.Host(nil), assert.AnError)
+
+		_, err := Migrate(t.Context(), from, newMigrateFileBackend(t, nil), MigrateOptions{})
+		assert.ErrorContains(t, err, "failed to get hosts from source")
+	})
+}
@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+type PostgresBackendConfig struct {
+	// Connection string, either as URL or as keyword/value pairs
+	DSN string `yaml:"dsn,omitempty"`
+
+	// TLS options, override the matching options in the DSN when set
+	SSLMode     string `yaml:"ssl-mode,omitempty"`
+	SSLRootCert string `yaml:"ssl-root-cert,omitempty"`
+	SSLCert     string `yaml:"ssl-cert,omitempty"`
+	SSLKey      string `yaml:"ssl-key,omitempty"`
+
+	// Connection pool options, the defaults of pgx are used when not set
+	MaxConns        int32         `yaml:"max-conns,omitempty"`
+	MinConns        int32         `yaml:"min-conns,omitempty"`
+	MaxConnLifetime time.Duration `yaml:"max-conn-lifetime,omitempty"`
+	MaxConnIdleTime time.Duration `yaml:"max-conn-idle-time,omitempty"`
+	ConnectTimeout  time.Duration `yaml:"connect-timeout,omitempty"`
+}
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// Return the DSN with the TLS options of the config applied
+func (cfg PostgresBackendConfig) connString() (string, error) {
+	if cfg.SSLMode != "" && !slices.Contains(sslModes, cfg.SSLMode) {
+		return "", fmt.Errorf("unknown ssl-mode '%s', must be one of %s", cfg.SSLMode, strings.Join(sslModes, ", "))
+	}
+
+	params := [][2]string{
+		{"sslmode", cfg.SSLMode},
+		{"sslrootcert", cfg.SSLRootCert},
+		{"sslcert", cfg.SSLCert},
+		{"sslkey", cfg.SSLKey},
+	}
+
+	return addParams(cfg.DSN, params)
+}
+
+// Add the parameters with a non-empty value to the DSN, overriding existing ones
+func addParams(dsn string, params [][2]string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse dsn: %w", err)
+		}
+		query := u.Query()
+		for _, param := range params {
+			if param[1] != "" {
+				query.Set(param[0], param[1])
+			}
+		}
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+
+	// Later keywords take precedence over earlier ones.
+	for _, param := range params {
+		if param[1] != "" {
+			dsn += fmt.Sprintf(" %s='%s'", param[0], escapeValue(param[1]))
+		}
+	}
+	return strings.TrimSpace(dsn), nil
+}
+
+// Escape a value for a keyword/value connection string
+func escapeValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return strings.ReplaceAll(value, `'`, `\'`)
+}
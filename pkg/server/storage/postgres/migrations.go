@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Key of the advisory lock held while migrating, prevents multiple instances from migrating at the same time.
+// The value is "go-wol" in hex.
+const migrationLockID int64 = 0x676f2d776f6c
+
+// Schema migrations, the version of a migration is its index + 1.
+// Existing migrations must never be changed, only new ones appended.
+var migrations = []string{
+	`CREATE TABLE hosts (
+		mac TEXT PRIMARY KEY NOT NULL,
+		name TEXT NOT NULL,
+		address TEXT NOT NULL DEFAULT '',
+		position INTEGER NOT NULL
+	);
+	CREATE INDEX hosts_position ON hosts (position);`,
+	// Tags and labels are stored as JSON, empty when unset
+	`ALTER TABLE hosts
+		ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+		ADD COLUMN description TEXT NOT NULL DEFAULT '',
+		ADD COLUMN tags TEXT NOT NULL DEFAULT '',
+		ADD COLUMN icon TEXT NOT NULL DEFAULT '',
+		ADD COLUMN location TEXT NOT NULL DEFAULT '',
+		ADD COLUMN labels TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE hosts ADD COLUMN site TEXT NOT NULL DEFAULT '';`,
+}
+
+// Bring the database schema to the latest version.
+// Every migration runs in its own transaction.
+// On a read-only server the schema is only checked, as it needs to be migrated on the primary.
+func migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Release()
+
+	readonly, err := serverReadonly(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if readonly {
+		return checkSchema(ctx, conn)
+	}
+
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID)
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		_, _ = conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+	}()
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	current, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		slog.Info("Migrating database schema", slog.Int("version", version))
+
+		err = applyMigration(ctx, conn, version, migrations[i])
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+// Ensure the schema of a database that can't be migrated is up to date.
+func checkSchema(ctx context.Context, conn *pgxpool.Conn) error {
+	var exists bool
+	err := conn.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check for migrations table: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("database is read-only and has not been initialized")
+	}
+
+	current, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if current < len(migrations) {
+		return fmt.Errorf("database is read-only and schema version %d is older than the latest version %d", current, len(migrations))
+	}
+	return nil
+}
+
+// Return the current schema version, fails if it is newer than the known migrations.
+func schemaVersion(ctx context.Context, conn *pgxpool.Conn) (int, error) {
+	var current int
+	err := conn.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	if current > len(migrations) {
+		return 0, fmt.Errorf("database schema version %d is newer than the latest known version %d", current, len(migrations))
+	}
+	return current, nil
+}
+
+func applyMigration(ctx context.Context, conn *pgxpool.Conn, version int, migration string) error {
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, migration)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", version)
+		return err
+	})
+}
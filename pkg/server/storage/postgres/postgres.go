@@ -0,0 +1,283 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Columns read by scanHost
+const hostColumns = "mac, name, address, display_name, description, tags, icon, location, labels, site"
+
+type PostgresBackend struct {
+	pool *pgxpool.Pool
+}
+
+// Interface for everything that can run queries, e.g. a connection, the pool or a transaction.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func NewPostgresBackend(cfg PostgresBackendConfig) (*PostgresBackend, error) {
+	if cfg.DSN == "" {
+		return nil, fmt.Errorf("missing dsn for the database")
+	}
+
+	connString, err := cfg.connString()
+	if err != nil {
+		return nil, err
+	}
+
+	poolCfg, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dsn: %w", err)
+	}
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		poolCfg.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnLifetime > 0 {
+		poolCfg.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.ConnectTimeout > 0 {
+		poolCfg.ConnConfig.ConnectTimeout = cfg.ConnectTimeout
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+	}
+
+	err = migrate(context.Background(), pool)
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to migrate database schema: %w", err)
+	}
+
+	return &PostgresBackend{
+		pool: pool,
+	}, nil
+}
+
+// Add a new host, overwrite existing host name if it already exists.
+// Ensures that the MAC address is unique and uppercase.
+func (p *PostgresBackend) AddHost(ctx context.Context, host types.Host) error {
+	host.MAC = strings.ToUpper(host.MAC)
+
+	return p.transaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `INSERT INTO hosts (mac, name, address, display_name, description, tags, icon, location, labels, site, position)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, (SELECT COALESCE(MAX(position), -1) + 1 FROM hosts))
+			ON CONFLICT (mac) DO UPDATE SET name = excluded.name, address = excluded.address,
+				display_name = excluded.display_name, description = excluded.description, tags = excluded.tags,
+				icon = excluded.icon, location = excluded.location, labels = excluded.labels, site = excluded.site`,
+			host.MAC, host.Name, host.Address, host.DisplayName, host.Description, types.EncodeTags(host.Tags), host.Icon, host.Location, types.EncodeLabels(host.Labels), host.Site,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to add host: %w", err)
+		}
+		return nil
+	})
+}
+
+// Remove a host, ignore if the host does not exist
+func (p *PostgresBackend) RemoveHost(ctx context.Context, mac string) error {
+	mac = strings.ToUpper(mac)
+
+	return p.transaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		var position int
+		err := tx.QueryRow(ctx, "DELETE FROM hosts WHERE mac = $1 RETURNING position", mac).Scan(&position)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to remove host: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, "UPDATE hosts SET position = position - 1 WHERE position > $1", position)
+		if err != nil {
+			return fmt.Errorf("failed to update position of remaining hosts: %w", err)
+		}
+		return nil
+	})
+}
+
+// Return the host name for a given MAC address, return empty if not found
+func (p *PostgresBackend) GetHost(ctx context.Context, mac string) (types.Host, error) {
+	host, err := scanHost(p.pool.QueryRow(ctx, "SELECT "+hostColumns+" FROM hosts WHERE mac = $1", strings.ToUpper(mac)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return types.Host{}, nil
+	} else if err != nil {
+		return types.Host{}, fmt.Errorf("failed to get host: %w", err)
+	}
+	return host, nil
+}
+
+// Return all hosts
+func (p *PostgresBackend) GetHosts(ctx context.Context) ([]types.Host, error) {
+	rows, err := p.pool.Query(ctx, "SELECT "+hostColumns+" FROM hosts ORDER BY position")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hosts: %w", err)
+	}
+
+	hosts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (types.Host, error) {
+		return scanHost(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hosts: %w", err)
+	}
+	return hosts, nil
+}
+
+// Move a host to the given index, the index is capped to the bounds of the list.
+// Returns ErrHostNotFound if the host does not exist.
+func (p *PostgresBackend) MoveHost(ctx context.Context, mac string, index int) error {
+	return p.transaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		macs, err := hostsList(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		order, err := types.MoveToIndex(macs, mac, index)
+		if err != nil {
+			return err
+		}
+		return setHostsOrder(ctx, tx, order)
+	})
+}
+
+// Sort the hosts by the given list of MAC addresses.
+// Hosts not contained in the list keep their relative order after the listed hosts.
+// Returns ErrHostNotFound if the list contains an unknown host.
+func (p *PostgresBackend) ReorderHosts(ctx context.Context, macs []string) error {
+	return p.transaction(ctx, func(ctx context.Context, tx pgx.Tx) error {
+		current, err := hostsList(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		order, err := types.ApplyOrder(current, macs)
+		if err != nil {
+			return err
+		}
+		return setHostsOrder(ctx, tx, order)
+	})
+}
+
+// Check if the storage backend is readonly.
+// This is the case for read-only replicas, read-only sessions and users without write permissions on the hosts table.
+func (p *PostgresBackend) Readonly(ctx context.Context) (bool, error) {
+	readonly, err := serverReadonly(ctx, p.pool)
+	if err != nil || readonly {
+		return readonly, err
+	}
+
+	var writable bool
+	err = p.pool.QueryRow(ctx, `SELECT has_table_privilege('hosts', 'INSERT')
+		AND has_table_privilege('hosts', 'UPDATE')
+		AND has_table_privilege('hosts', 'DELETE')`,
+	).Scan(&writable)
+	if err != nil {
+		return true, fmt.Errorf("failed to check permissions on hosts table: %w", err)
+	}
+	return !writable, nil
+}
+
+// Close all connections to the database
+func (p *PostgresBackend) Close() {
+	p.pool.Close()
+}
+
+// Run the function in a transaction, commit if it succeeds and roll back otherwise.
+// The hosts table is locked against concurrent writes, as positions depend on the existing rows.
+func (p *PostgresBackend) transaction(ctx context.Context, fn func(ctx context.Context, tx pgx.Tx) error) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer func() {
+		// Roll back even when ctx is canceled, so the connection can be reused
+		_ = tx.Rollback(context.WithoutCancel(ctx))
+	}()
+
+	_, err = tx.Exec(ctx, "LOCK TABLE hosts IN EXCLUSIVE MODE")
+	if err != nil {
+		return fmt.Errorf("failed to lock hosts table: %w", err)
+	}
+
+	err = fn(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Check if the server is a replica in recovery or the session only allows read-only transactions.
+func serverReadonly(ctx context.Context, q querier) (bool, error) {
+	var recovery bool
+	var readonly string
+	err := q.QueryRow(ctx, "SELECT pg_is_in_recovery(), current_setting('transaction_read_only')").Scan(&recovery, &readonly)
+	if err != nil {
+		return true, fmt.Errorf("failed to check if server is read-only: %w", err)
+	}
+	return recovery || readonly == "on", nil
+}
+
+// Return the MAC addresses of all hosts in their current order.
+func hostsList(ctx context.Context, tx pgx.Tx) ([]string, error) {
+	rows, err := tx.Query(ctx, "SELECT mac FROM hosts ORDER BY position")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get known hosts list: %w", err)
+	}
+	macs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known hosts list: %w", err)
+	}
+	return macs, nil
+}
+
+// Set the position of every host to its index in order.
+func setHostsOrder(ctx context.Context, tx pgx.Tx, order []string) error {
+	_, err := tx.Exec(ctx, `UPDATE hosts SET position = o.position - 1
+		FROM unnest($1::text[]) WITH ORDINALITY AS o(mac, position)
+		WHERE hosts.mac = o.mac`,
+		order,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update order of hosts: %w", err)
+	}
+	return nil
+}
+
+// Read a host from a row containing the hostColumns
+func scanHost(row pgx.Row) (types.Host, error) {
+	var host types.Host
+	var tags, labels string
+	err := row.Scan(&host.MAC, &host.Name, &host.Address, &host.DisplayName, &host.Description, &tags, &host.Icon, &host.Location, &labels, &host.Site)
+	if err != nil {
+		return types.Host{}, err
+	}
+
+	host.Tags, err = types.DecodeTags(tags)
+	if err != nil {
+		return types.Host{}, fmt.Errorf("invalid tags of host '%s': %w", host.MAC, err)
+	}
+	host.Labels, err = types.DecodeLabels(labels)
+	if err != nil {
+		return types.Host{}, fmt.Errorf("invalid labels of host '%s': %w", host.MAC, err)
+	}
+	return host, nil
+}
@@ -0,0 +1,15 @@
+package sqlite
+
+const (
+	DEFAULT_DATABASE_PATH = "hosts.db"
+)
+
+type SQLiteBackendConfig struct {
+	Path string `yaml:"path,omitempty"`
+}
+
+func NewDefaultSQLiteBackendConfig() SQLiteBackendConfig {
+	return SQLiteBackendConfig{
+		Path: DEFAULT_DATABASE_PATH,
+	}
+}
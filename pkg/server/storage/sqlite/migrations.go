@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Schema migrations, the version of a migration is its index + 1.
+// Existing migrations must never be changed, only new ones appended.
+var migrations = []string{
+	`CREATE TABLE hosts (
+		mac TEXT PRIMARY KEY NOT NULL,
+		name TEXT NOT NULL,
+		address TEXT NOT NULL DEFAULT '',
+		position INTEGER NOT NULL
+	);
+	CREATE INDEX hosts_position ON hosts (position);`,
+	// Tags and labels are stored as JSON, empty when unset
+	`ALTER TABLE hosts ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+	ALTER TABLE hosts ADD COLUMN description TEXT NOT NULL DEFAULT '';
+	ALTER TABLE hosts ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+	ALTER TABLE hosts ADD COLUMN icon TEXT NOT NULL DEFAULT '';
+	ALTER TABLE hosts ADD COLUMN location TEXT NOT NULL DEFAULT '';
+	ALTER TABLE hosts ADD COLUMN labels TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE hosts ADD COLUMN site TEXT NOT NULL DEFAULT '';`,
+}
+
+// Bring the database schema to the latest version.
+// Every migration runs in its own transaction.
+func migrate(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY NOT NULL,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var current int
+	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than the latest known version %d", current, len(migrations))
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		slog.Info("Migrating database schema", slog.Int("version", version))
+
+		err = applyMigration(db, version, migrations[i])
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, version int, migration string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(migration)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)", version, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
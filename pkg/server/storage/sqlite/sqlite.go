@@ -0,0 +1,260 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	_ "modernc.org/sqlite"
+)
+
+const busyTimeoutMilliseconds = 5000
+
+// Columns read by scanHost
+const hostColumns = "mac, name, address, display_name, description, tags, icon, location, labels, site"
+
+type SQLiteBackend struct {
+	path string
+	db   *sql.DB
+}
+
+func NewSQLiteBackend(cfg SQLiteBackendConfig) (*SQLiteBackend, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("missing path to the database file")
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", busyTimeoutMilliseconds))
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_txlock", "immediate")
+
+	db, err := sql.Open("sqlite", "file:"+cfg.Path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// SQLite only supports a single writer, so serialize all access instead of failing with busy errors.
+	db.SetMaxOpenConns(1)
+
+	err = migrate(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to migrate database schema: %w", err)
+	}
+
+	return &SQLiteBackend{
+		path: cfg.Path,
+		db:   db,
+	}, nil
+}
+
+// Add a new host, overwrite existing host name if it already exists.
+// Ensures that the MAC address is unique and uppercase.
+func (s *SQLiteBackend) AddHost(ctx context.Context, host types.Host) error {
+	host.MAC = strings.ToUpper(host.MAC)
+
+	return s.transaction(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO hosts (mac, name, address, display_name, description, tags, icon, location, labels, site, position)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, (SELECT COALESCE(MAX(position), -1) + 1 FROM hosts))
+			ON CONFLICT (mac) DO UPDATE SET name = excluded.name, address = excluded.address,
+				display_name = excluded.display_name, description = excluded.description, tags = excluded.tags,
+				icon = excluded.icon, location = excluded.location, labels = excluded.labels, site = excluded.site`,
+			host.MAC, host.Name, host.Address, host.DisplayName, host.Description, types.EncodeTags(host.Tags), host.Icon, host.Location, types.EncodeLabels(host.Labels), host.Site,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to add host: %w", err)
+		}
+		return nil
+	})
+}
+
+// Remove a host, ignore if the host does not exist
+func (s *SQLiteBackend) RemoveHost(ctx context.Context, mac string) error {
+	mac = strings.ToUpper(mac)
+
+	return s.transaction(ctx, func(tx *sql.Tx) error {
+		var position int
+		err := tx.QueryRowContext(ctx, "DELETE FROM hosts WHERE mac = ? RETURNING position", mac).Scan(&position)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to remove host: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE hosts SET position = position - 1 WHERE position > ?", position)
+		if err != nil {
+			return fmt.Errorf("failed to update position of remaining hosts: %w", err)
+		}
+		return nil
+	})
+}
+
+// Return the host name for a given MAC address, return empty if not found
+func (s *SQLiteBackend) GetHost(ctx context.Context, mac string) (types.Host, error) {
+	host, err := scanHost(s.db.QueryRowContext(ctx, "SELECT "+hostColumns+" FROM hosts WHERE mac = ?", strings.ToUpper(mac)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.Host{}, nil
+	} else if err != nil {
+		return types.Host{}, fmt.Errorf("failed to get host: %w", err)
+	}
+	return host, nil
+}
+
+// Return all hosts
+func (s *SQLiteBackend) GetHosts(ctx context.Context) ([]types.Host, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+hostColumns+" FROM hosts ORDER BY position")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hosts: %w", err)
+	}
+	defer rows.Close()
+
+	hosts := make([]types.Host, 0)
+	for rows.Next() {
+		host, err := scanHost(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read host: %w", err)
+		}
+		hosts = append(hosts, host)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read hosts: %w", err)
+	}
+	return hosts, nil
+}
+
+// Move a host to the given index, the index is capped to the bounds of the list.
+// Returns ErrHostNotFound if the host does not exist.
+func (s *SQLiteBackend) MoveHost(ctx context.Context, mac string, index int) error {
+	return s.transaction(ctx, func(tx *sql.Tx) error {
+		macs, err := hostsList(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		order, err := types.MoveToIndex(macs, mac, index)
+		if err != nil {
+			return err
+		}
+		return setHostsOrder(ctx, tx, order)
+	})
+}
+
+// Sort the hosts by the given list of MAC addresses.
+// Hosts not contained in the list keep their relative order after the listed hosts.
+// Returns ErrHostNotFound if the list contains an unknown host.
+func (s *SQLiteBackend) ReorderHosts(ctx context.Context, macs []string) error {
+	return s.transaction(ctx, func(tx *sql.Tx) error {
+		current, err := hostsList(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		order, err := types.ApplyOrder(current, macs)
+		if err != nil {
+			return err
+		}
+		return setHostsOrder(ctx, tx, order)
+	})
+}
+
+// Check if the storage backend is readonly
+func (s *SQLiteBackend) Readonly(_ context.Context) (bool, error) {
+	//#nosec G302 -- The file does not contain sensitive data, so it can be world readable. Additionally final permissions are determined by the umask.
+	f, err := os.OpenFile(s.path, os.O_RDWR, 0644)
+	if err != nil {
+		return true, nil
+	}
+	_ = f.Close()
+	return false, nil
+}
+
+// Close the database
+func (s *SQLiteBackend) Close() error {
+	return s.db.Close()
+}
+
+// Run the function in a transaction, commit if it succeeds and roll back otherwise.
+func (s *SQLiteBackend) transaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Return the MAC addresses of all hosts in their current order.
+func hostsList(ctx context.Context, tx *sql.Tx) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT mac FROM hosts ORDER BY position")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get known hosts list: %w", err)
+	}
+	defer rows.Close()
+
+	var macs []string
+	for rows.Next() {
+		var mac string
+		err = rows.Scan(&mac)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read known hosts list: %w", err)
+		}
+		macs = append(macs, mac)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read known hosts list: %w", err)
+	}
+	return macs, nil
+}
+
+// Set the position of every host to its index in order.
+func setHostsOrder(ctx context.Context, tx *sql.Tx, order []string) error {
+	stmt, err := tx.PrepareContext(ctx, "UPDATE hosts SET position = ? WHERE mac = ?")
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for i, mac := range order {
+		_, err = stmt.ExecContext(ctx, i, mac)
+		if err != nil {
+			return fmt.Errorf("failed to update order of hosts: %w", err)
+		}
+	}
+	return nil
+}
+
+// Read a host from a row containing the hostColumns
+func scanHost(row interface{ Scan(dest ...any) error }) (types.Host, error) {
+	var host types.Host
+	var tags, labels string
+	err := row.Scan(&host.MAC, &host.Name, &host.Address, &host.DisplayName, &host.Description, &tags, &host.Icon, &host.Location, &labels, &host.Site)
+	if err != nil {
+		return types.Host{}, err
+	}
+
+	host.Tags, err = types.DecodeTags(tags)
+	if err != nil {
+		return types.Host{}, fmt.Errorf("invalid tags of host '%s': %w", host.MAC, err)
+	}
+	host.Labels, err = types.DecodeLabels(labels)
+	if err != nil {
+		return types.Host{}, fmt.Errorf("invalid labels of host '%s': %w", host.MAC, err)
+	}
+	return host, nil
+}
@@ -0,0 +1,205 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/testsuite"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var newSQLiteBackend testsuite.StorageBackendFactory = func(t *testing.T, name string) types.StorageBackend {
+	t.Helper()
+
+	s, err := NewSQLiteBackend(SQLiteBackendConfig{Path: filepath.Join(t.TempDir(), name+".db")})
+	require.NoError(t, err, "Failed to create sqlite backend")
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+
+	return s
+}
+
+func TestNewSQLiteBackend(t *testing.T) {
+	t.Run("NewDatabase", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		path := filepath.Join(t.TempDir(), "hosts.db")
+
+		s, err := NewSQLiteBackend(SQLiteBackendConfig{Path: path})
+		require.NoError(err, "Should create sqlite backend")
+		t.Cleanup(func() {
+			_ = s.Close()
+		})
+
+		assert.FileExists(path, "Should create database file")
+
+		var version int
+		require.NoError(s.db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version))
+		assert.Equal(len(migrations), version, "Should apply all migrations")
+	})
+
+	t.Run("ExistingDatabase", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		path := filepath.Join(t.TempDir(), "hosts.db")
+
+		s, err := NewSQLiteBackend(SQLiteBackendConfig{Path: path})
+		require.NoError(err, "Should create sqlite backend")
+		require.NoError(s.AddHost(t.Context(), types.Host{MAC: "aa:bb:cc:dd:ee:ff", Name: "TestHost"}))
+		require.NoError(s.Close())
+
+		s, err = NewSQLiteBackend(SQLiteBackendConfig{Path: path})
+		require.NoError(err, "Should open existing database")
+		t.Cleanup(func() {
+			_ = s.Close()
+		})
+
+		hosts, err := s.GetHosts(t.Context())
+		require.NoError(err, "Should get hosts")
+		assert.Equal([]types.Host{{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"}}, hosts, "Should keep hosts")
+	})
+
+	t.Run("NewerSchema", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "hosts.db")
+
+		s, err := NewSQLiteBackend(SQLiteBackendConfig{Path: path})
+		require.NoError(t, err, "Should create sqlite backend")
+		_, err = s.db.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, '')", len(migrations)+1)
+		require.NoError(t, err)
+		require.NoError(t, s.Close())
+
+		s, err = NewSQLiteBackend(SQLiteBackendConfig{Path: path})
+		assert.ErrorContains(t, err, "is newer than the latest known version", "Should not open database from a newer version")
+		assert.Nil(t, s, "Should not return backend")
+	})
+
+	t.Run("MissingPath", func(t *testing.T) {
+		s, err := NewSQLiteBackend(SQLiteBackendConfig{})
+		assert.Error(t, err, "Should fail without path")
+		assert.Nil(t, s, "Should not return backend")
+	})
+
+	t.Run("InvalidPath", func(t *testing.T) {
+		s, err := NewSQLiteBackend(SQLiteBackendConfig{Path: filepath.Join(t.TempDir(), "missing", "hosts.db")})
+		assert.Error(t, err, "Should fail when the directory does not exist")
+		assert.Nil(t, s, "Should not return backend")
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "hosts.db"))
+	require.NoError(t, err, "Should open database")
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	require.NoError(t, migrate(db), "Should migrate database")
+	require.NoError(t, migrate(db), "Should do nothing when already migrated")
+
+	var count int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&count))
+	assert.Equal(t, len(migrations), count, "Should apply every migration once")
+}
+
+func TestMigrateHostMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.db")
+	db, err := sql.Open("sqlite", "file:"+path)
+	require.NoError(t, err, "Should open database")
+
+	_, err = db.Exec("CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY NOT NULL, applied_at TEXT NOT NULL)")
+	require.NoError(t, err, "Should create migrations table")
+	require.NoError(t, applyMigration(db, 1, migrations[0]), "Should create the initial schema")
+	_, err = db.Exec("INSERT INTO hosts (mac, name, address, position) VALUES ('AA:BB:CC:DD:EE:FF', 'TestHost', 'host.example.org', 0)")
+	require.NoError(t, err, "Should add host")
+	require.NoError(t, db.Close())
+
+	s, err := NewSQLiteBackend(SQLiteBackendConfig{Path: path})
+	require.NoError(t, err, "Should migrate database")
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+
+	hosts, err := s.GetHosts(t.Context())
+	require.NoError(t, err, "Should get hosts")
+	assert.Equal(t, []types.Host{{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost", Address: "host.example.org"}}, hosts, "Should keep existing hosts without metadata")
+}
+
+func TestRemoveHostKeepsPositions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := newSQLiteBackend(t, "positions").(*SQLiteBackend)
+	for _, mac := range []string{"00:00:00:00:00:01", "00:00:00:00:00:02", "00:00:00:00:00:03"} {
+		require.NoError(s.AddHost(t.Context(), types.Host{MAC: mac, Name: "host"}))
+	}
+
+	require.NoError(s.RemoveHost(t.Context(), "00:00:00:00:00:02"))
+	require.NoError(s.AddHost(t.Context(), types.Host{MAC: "00:00:00:00:00:04", Name: "host"}))
+
+	rows, err := s.db.Query("SELECT position FROM hosts ORDER BY position")
+	require.NoError(err)
+	defer rows.Close()
+
+	var positions []int
+	for rows.Next() {
+		var position int
+		require.NoError(rows.Scan(&position))
+		positions = append(positions, position)
+	}
+	assert.Equal([]int{0, 1, 2}, positions, "Should not leave gaps in the positions")
+}
+
+func TestReadonly(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("Root can write to the file regardless of its permissions")
+	}
+
+	path := filepath.Join(t.TempDir(), "hosts.db")
+	s, err := NewSQLiteBackend(SQLiteBackendConfig{Path: path})
+	require.NoError(t, err, "Should create sqlite backend")
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+
+	readonly, err := s.Readonly(t.Context())
+	assert.NoError(t, err, "Should check if readonly")
+	assert.False(t, readonly, "Should be writable")
+
+	require.NoError(t, os.Chmod(path, 0444))
+
+	readonly, err = s.Readonly(t.Context())
+	assert.NoError(t, err, "Should check if readonly")
+	assert.True(t, readonly, "Should be readonly")
+}
+
+func TestSQLiteTestsuiteBasic(t *testing.T) {
+	testsuite.RunStorageBackendTests(t, newSQLiteBackend)
+}
+
+func TestSQLiteTestsuiteRace(t *testing.T) {
+	testsuite.RunStorageBackendRaceTests(t, newSQLiteBackend)
+}
+
+func TestCanceledContext(t *testing.T) {
+	s := newSQLiteBackend(t, "hosts")
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	err := s.AddHost(ctx, types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"})
+	assert.ErrorIs(t, err, context.Canceled, "Should not add host")
+
+	_, err = s.GetHosts(ctx)
+	assert.ErrorIs(t, err, context.Canceled, "Should not get hosts")
+
+	hosts, err := s.GetHosts(t.Context())
+	assert.NoError(t, err, "Should get hosts")
+	assert.Empty(t, hosts, "Should not have added host")
+}
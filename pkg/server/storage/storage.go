@@ -2,14 +2,21 @@ package storage
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"html/template"
 	"log/slog"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/heathcliff26/go-wol/pkg/server/storage/file"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/kubernetes"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/memory"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/postgres"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/sqlite"
 	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
 	"github.com/heathcliff26/go-wol/pkg/server/storage/valkey"
 	"github.com/heathcliff26/go-wol/pkg/version"
@@ -21,82 +28,158 @@ import (
 type Storage struct {
 	backend  types.StorageBackend
 	readonly bool
+	events   broker
+	// Maximum duration of a single operation of the backend
+	timeout time.Duration
 }
 
 func NewStorage(cfg StorageConfig) (*Storage, error) {
-	var backend types.StorageBackend
-	var err error
-	switch cfg.Type {
-	case "file":
-		backend, err = file.NewFileBackend(cfg.File)
-	case "valkey":
-		backend, err = valkey.NewValkeyBackend(cfg.Valkey)
-	default:
-		return nil, fmt.Errorf("unknown storage backend type: %s", cfg.Type)
+	if cfg.Timeout < 0 {
+		return nil, fmt.Errorf("timeout can't be negative")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DEFAULT_TIMEOUT
 	}
+
+	backend, err := NewBackend(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create storage backend: %w", err)
+		return nil, err
 	}
 
 	s := &Storage{
 		backend:  backend,
 		readonly: cfg.Readonly,
+		timeout:  cfg.Timeout,
 	}
+	ctx := context.Background()
 
 	if !s.readonly {
-		s.readonly, err = s.backend.Readonly()
+		err = s.do(ctx, func(ctx context.Context) error {
+			s.readonly, err = s.backend.Readonly(ctx)
+			return err
+		})
 		if err != nil {
+			CloseBackend(backend)
 			return nil, fmt.Errorf("failed to check if storage backend is readonly: %w", err)
 		}
 	}
 
 	if cfg.SeededHosts != "" {
-		if s.readonly {
-			return nil, fmt.Errorf("cannot seed hosts in readonly mode")
-		}
-
-		f, err := os.ReadFile(cfg.SeededHosts)
+		err = s.seed(ctx, cfg.SeededHosts)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read seeded hosts file: %w", err)
+			CloseBackend(backend)
+			return nil, err
 		}
-		var seededHosts types.HostsFile
-		err = yaml.Unmarshal(f, &seededHosts)
+	}
+
+	return s, nil
+}
+
+// Add the hosts from the seeded hosts file to the storage
+func (s *Storage) seed(ctx context.Context, path string) error {
+	if s.readonly {
+		return fmt.Errorf("cannot seed hosts in readonly mode")
+	}
+
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read seeded hosts file: %w", err)
+	}
+	var seededHosts types.HostsFile
+	err = yaml.Unmarshal(f, &seededHosts)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal seeded hosts file: %w", err)
+	}
+
+	for _, host := range seededHosts.Hosts {
+		slog.Debug("Adding seeded host", "mac", host.MAC, "name", host.Name)
+		err := s.do(ctx, func(ctx context.Context) error {
+			return s.backend.AddHost(ctx, host)
+		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal seeded hosts file: %w", err)
+			return fmt.Errorf("failed to add seeded host '%s': %w", host.MAC, err)
 		}
+	}
+	return nil
+}
+
+// Stop the background tasks of the backend, like watching the file for changes, and close its connections.
+// The channels of all subscribers are closed as well.
+func (s *Storage) Close() {
+	s.events.close()
+	CloseBackend(s.backend)
+}
 
-		for _, host := range seededHosts.Hosts {
-			slog.Debug("Adding seeded host", "mac", host.MAC, "name", host.Name)
-			err := s.backend.AddHost(host)
-			if err != nil {
-				return nil, fmt.Errorf("failed to add seeded host '%s': %w", host.MAC, err)
-			}
+// Close the backend, if it has anything to close
+func CloseBackend(backend types.StorageBackend) {
+	switch b := backend.(type) {
+	case interface{ Close() }:
+		b.Close()
+	case interface{ Close() error }:
+		err := b.Close()
+		if err != nil {
+			slog.Warn("Failed to close storage backend", "err", err)
 		}
 	}
+}
 
-	return s, nil
+// Create the backend configured by cfg, without checking if it is readonly or seeding hosts.
+func NewBackend(cfg StorageConfig) (types.StorageBackend, error) {
+	var backend types.StorageBackend
+	var err error
+	switch cfg.Type {
+	case "file":
+		backend, err = file.NewFileBackend(cfg.File)
+	case "sqlite":
+		backend, err = sqlite.NewSQLiteBackend(cfg.SQLite)
+	case "postgres":
+		backend, err = postgres.NewPostgresBackend(cfg.Postgres)
+	case "valkey":
+		backend, err = valkey.NewValkeyBackend(cfg.Valkey)
+	case "kubernetes":
+		backend, err = kubernetes.NewKubernetesBackend(cfg.Kubernetes)
+	case "memory":
+		backend = memory.NewMemoryBackend()
+	default:
+		return nil, fmt.Errorf("unknown storage backend type: %s", cfg.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage backend: %w", err)
+	}
+	return backend, nil
 }
 
 type indexValues struct {
-	Readonly bool
-	Hosts    []types.Host
-	Version  string
-	Name     string
+	Readonly  bool
+	Hosts     []types.Host
+	Icons     []string
+	Tags      []string
+	Locations []string
+	Version   string
+	Name      string
 }
 
 // Generate the index.html file from the template and the current hosts.
 // Returns the generated HTML and its checksum.
-func (s *Storage) GetIndexHTML() (string, string, error) {
-	hosts, err := s.backend.GetHosts()
+func (s *Storage) GetIndexHTML(ctx context.Context) (string, string, error) {
+	var hosts []types.Host
+	err := s.do(ctx, func(ctx context.Context) error {
+		var err error
+		hosts, err = s.backend.GetHosts(ctx)
+		return err
+	})
 	if err != nil {
 		return "", "", fmt.Errorf("failed to get hosts: %w", err)
 	}
 
 	values := indexValues{
-		Readonly: s.readonly,
-		Hosts:    hosts,
-		Version:  version.Version(),
-		Name:     version.Name,
+		Readonly:  s.readonly,
+		Hosts:     hosts,
+		Icons:     types.HostIcons,
+		Tags:      types.HostTags(hosts),
+		Locations: types.HostLocations(hosts),
+		Version:   version.Version(),
+		Name:      version.Name,
 	}
 
 	tmpl, err := template.New("index.html").Parse(string(static.IndexTemplate))
@@ -122,38 +205,108 @@ func (s *Storage) Readonly() bool {
 }
 
 // Get all hosts from the storage
-func (s *Storage) GetHosts() ([]types.Host, error) {
-	hosts, err := s.backend.GetHosts()
+func (s *Storage) GetHosts(ctx context.Context) ([]types.Host, error) {
+	var hosts []types.Host
+	err := s.do(ctx, func(ctx context.Context) error {
+		var err error
+		hosts, err = s.backend.GetHosts(ctx)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get hosts: %w", err)
 	}
 	return hosts, nil
 }
 
+// Get the host with the MAC address, returns an empty host if it does not exist
+func (s *Storage) GetHost(ctx context.Context, mac string) (types.Host, error) {
+	var host types.Host
+	err := s.do(ctx, func(ctx context.Context) error {
+		var err error
+		host, err = s.backend.GetHost(ctx, mac)
+		return err
+	})
+	if err != nil {
+		return types.Host{}, fmt.Errorf("failed to get host: %w", err)
+	}
+	return host, nil
+}
+
 // Add a new host and update the index.html
-func (s *Storage) AddHost(host types.Host) error {
+func (s *Storage) AddHost(ctx context.Context, host types.Host) error {
 	if s.readonly {
 		return fmt.Errorf("storage is readonly")
 	}
 
-	err := s.backend.AddHost(host)
+	err := s.do(ctx, func(ctx context.Context) error {
+		return s.backend.AddHost(ctx, host)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to add host: %w", err)
 	}
 
+	host.MAC = strings.ToUpper(host.MAC)
+	s.publish(types.NewEvent(types.EventHostUpdated, host.MAC, &host))
 	return nil
 }
 
 // Remove a host and update the index.html
-func (s *Storage) RemoveHost(mac string) error {
+func (s *Storage) RemoveHost(ctx context.Context, mac string) error {
 	if s.readonly {
 		return fmt.Errorf("storage is readonly")
 	}
 
-	err := s.backend.RemoveHost(mac)
+	err := s.do(ctx, func(ctx context.Context) error {
+		return s.backend.RemoveHost(ctx, mac)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to remove host: %w", err)
 	}
 
+	s.publish(types.NewEvent(types.EventHostRemoved, strings.ToUpper(mac), nil))
 	return nil
 }
+
+// Move a host to the given index
+func (s *Storage) MoveHost(ctx context.Context, mac string, index int) error {
+	if s.readonly {
+		return fmt.Errorf("storage is readonly")
+	}
+
+	err := s.do(ctx, func(ctx context.Context) error {
+		return s.backend.MoveHost(ctx, mac, index)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to move host: %w", err)
+	}
+
+	s.publish(types.NewEvent(types.EventHostsReordered, strings.ToUpper(mac), nil))
+	return nil
+}
+
+// Sort the hosts by the given list of MAC addresses
+func (s *Storage) ReorderHosts(ctx context.Context, macs []string) error {
+	if s.readonly {
+		return fmt.Errorf("storage is readonly")
+	}
+
+	err := s.do(ctx, func(ctx context.Context) error {
+		return s.backend.ReorderHosts(ctx, macs)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reorder hosts: %w", err)
+	}
+
+	s.publish(types.NewEvent(types.EventHostsReordered, "", nil))
+	return nil
+}
+
+// Run a single operation of the backend, limited to the configured timeout.
+func (s *Storage) do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	return fn(ctx)
+}
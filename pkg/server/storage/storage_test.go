@@ -1,11 +1,15 @@
 package storage
 
 import (
+	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/heathcliff26/go-wol/pkg/server/storage/file"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/memory"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/sqlite"
 	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
 	"github.com/heathcliff26/go-wol/pkg/server/storage/valkey"
 	"github.com/stretchr/testify/assert"
@@ -18,27 +22,37 @@ type MockBackend struct {
 	types.StorageBackend
 }
 
-func (m *MockBackend) AddHost(host types.Host) error {
+func (m *MockBackend) AddHost(_ context.Context, host types.Host) error {
 	args := m.Called(host)
 	return args.Error(0)
 }
 
-func (m *MockBackend) RemoveHost(mac string) error {
+func (m *MockBackend) RemoveHost(_ context.Context, mac string) error {
 	args := m.Called(mac)
 	return args.Error(0)
 }
 
-func (m *MockBackend) GetHost(mac string) (types.Host, error) {
+func (m *MockBackend) GetHost(_ context.Context, mac string) (types.Host, error) {
 	args := m.Called(mac)
 	return args.Get(0).(types.Host), args.Error(1)
 }
 
-func (m *MockBackend) GetHosts() ([]types.Host, error) {
+func (m *MockBackend) GetHosts(_ context.Context) ([]types.Host, error) {
 	args := m.Called()
 	return args.Get(0).([]types.Host), args.Error(1)
 }
 
-func (m *MockBackend) Readonly() (bool, error) {
+func (m *MockBackend) MoveHost(_ context.Context, mac string, index int) error {
+	args := m.Called(mac, index)
+	return args.Error(0)
+}
+
+func (m *MockBackend) ReorderHosts(_ context.Context, macs []string) error {
+	args := m.Called(macs)
+	return args.Error(0)
+}
+
+func (m *MockBackend) Readonly(_ context.Context) (bool, error) {
 	args := m.Called()
 	return args.Bool(0), args.Error(1)
 }
@@ -62,6 +76,31 @@ func TestNewStorage(t *testing.T) {
 		assert.Equal(cfg.Readonly, s.readonly, "Readonly should match config")
 	})
 
+	t.Run("SQLiteBackend", func(t *testing.T) {
+		assert := assert.New(t)
+
+		cfg := StorageConfig{
+			Type: "sqlite",
+			SQLite: sqlite.SQLiteBackendConfig{
+				Path: t.TempDir() + "/hosts.db",
+			},
+		}
+
+		s, err := NewStorage(cfg)
+		assert.NoError(err, "Should not return an error")
+		assert.NotNil(s, "Storage should not be nil")
+		assert.IsType(&sqlite.SQLiteBackend{}, s.backend, "Should have sqlite as backend type")
+		assert.False(s.readonly, "Should be writable")
+	})
+
+	t.Run("PostgresBackend", func(t *testing.T) {
+		assert := assert.New(t)
+
+		s, err := NewStorage(StorageConfig{Type: "postgres"})
+		assert.ErrorContains(err, "missing dsn", "Should use the postgres backend")
+		assert.Nil(s, "Storage should be nil")
+	})
+
 	t.Run("ValkeyBackend", func(t *testing.T) {
 		assert := assert.New(t)
 
@@ -82,6 +121,29 @@ func TestNewStorage(t *testing.T) {
 		assert.IsType(&valkey.ValkeyBackend{}, s.backend, "Should have valkey as backend type")
 	})
 
+	t.Run("KubernetesBackend", func(t *testing.T) {
+		assert := assert.New(t)
+		t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+		s, err := NewStorage(StorageConfig{Type: "kubernetes"})
+		assert.ErrorContains(err, "not running inside a kubernetes cluster", "Should use the kubernetes backend")
+		assert.Nil(s, "Storage should be nil")
+	})
+
+	t.Run("MemoryBackend", func(t *testing.T) {
+		assert := assert.New(t)
+
+		s, err := NewStorage(StorageConfig{Type: "memory", SeededHosts: "file/testdata/basic.yaml"})
+		assert.NoError(err, "Should not return an error")
+		assert.NotNil(s, "Storage should not be nil")
+		assert.IsType(&memory.MemoryBackend{}, s.backend, "Should have memory as backend type")
+		assert.False(s.readonly, "Should be writable")
+
+		hosts, err := s.GetHosts(t.Context())
+		assert.NoError(err, "Should get hosts")
+		assert.Len(hosts, 2, "Should contain the seeded hosts")
+	})
+
 	t.Run("UnknownBackend", func(t *testing.T) {
 		assert := assert.New(t)
 
@@ -197,12 +259,34 @@ func TestNewStorage(t *testing.T) {
 		assert.NotNil(s, "Storage should not be nil")
 		assert.NoError(err, "Should create storage")
 
-		hosts, err := s.backend.GetHosts()
+		hosts, err := s.backend.GetHosts(t.Context())
 		assert.NoError(err, "Should get hosts without error")
 		assert.Len(hosts, 2, "Should have 2 hosts from seeding")
 	})
 }
 
+func TestStorageClose(t *testing.T) {
+	path := t.TempDir() + "/hosts.yaml"
+	s, err := NewStorage(StorageConfig{
+		Type: "file",
+		File: file.FileBackendConfig{Path: path, ReloadInterval: 10 * time.Millisecond},
+	})
+	require.NoError(t, err, "Should create storage")
+	events, unsubscribe := s.Subscribe()
+
+	s.Close()
+	unsubscribe()
+
+	_, ok := <-events
+	assert.False(t, ok, "Should close the channels of the subscribers")
+
+	require.NoError(t, os.WriteFile(path, []byte("hosts:\n  - mac: AA:BB:CC:DD:EE:FF\n    name: External\n"), 0644))
+	time.Sleep(50 * time.Millisecond)
+	hosts, err := s.GetHosts(t.Context())
+	assert.NoError(t, err)
+	assert.Empty(t, hosts, "Should not reload the file after closing")
+}
+
 func TestStorageReadonly(t *testing.T) {
 	assert := assert.New(t)
 
@@ -216,6 +300,25 @@ func TestStorageReadonly(t *testing.T) {
 	assert.False(s.Readonly())
 }
 
+func TestGetIndexHTML(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewStorage(StorageConfig{Type: "memory"})
+	require.NoError(t, err, "Should create storage")
+	require.NoError(t, s.AddHost(t.Context(), types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "desktop", Tags: []string{"gaming", "windows"}, Location: "Living room"}), "Should add host")
+	require.NoError(t, s.AddHost(t.Context(), types.Host{MAC: "11:22:33:44:55:66", Name: "nas", DisplayName: "Storage", Address: "192.0.2.2"}), "Should add host")
+
+	html, checksum, err := s.GetIndexHTML(t.Context())
+	require.NoError(t, err, "Should render index")
+	assert.NotEmpty(checksum, "Should return a checksum")
+
+	assert.Contains(html, `id="hostSearch"`, "Should contain the search box")
+	assert.Contains(html, `data-location="Living room" aria-pressed="false"`, "Should contain a chip for the location")
+	assert.Contains(html, `data-tag="windows"`, "Should contain a chip for the tags")
+	assert.Contains(html, `data-search="nas Storage 11:22:33:44:55:66 192.0.2.2"`, "Should contain the searchable text of the host")
+	assert.Contains(html, `data-tags="gaming;windows"`, "Should contain the tags of the host")
+}
+
 func TestStorageAddHost(t *testing.T) {
 	mockBackend := new(MockBackend)
 	s := &Storage{
@@ -227,7 +330,7 @@ func TestStorageAddHost(t *testing.T) {
 		assert := assert.New(t)
 
 		s.readonly = true
-		err := s.AddHost(types.Host{MAC: "00:11:22:33:44:55", Name: "test"})
+		err := s.AddHost(t.Context(), types.Host{MAC: "00:11:22:33:44:55", Name: "test"})
 		assert.Error(err)
 		assert.Contains(err.Error(), "storage is readonly")
 	})
@@ -238,7 +341,7 @@ func TestStorageAddHost(t *testing.T) {
 		s.readonly = false
 		mockBackend.On("AddHost", types.Host{MAC: "00:11:22:33:44:55", Name: "test"}).Return(nil)
 
-		err := s.AddHost(types.Host{MAC: "00:11:22:33:44:55", Name: "test"})
+		err := s.AddHost(t.Context(), types.Host{MAC: "00:11:22:33:44:55", Name: "test"})
 		assert.NoError(err, "Should add host without error")
 		mockBackend.AssertExpectations(t)
 	})
@@ -255,7 +358,7 @@ func TestStorageRemoveHost(t *testing.T) {
 		assert := assert.New(t)
 
 		s.readonly = true
-		err := s.RemoveHost("00:11:22:33:44:55")
+		err := s.RemoveHost(t.Context(), "00:11:22:33:44:55")
 		assert.Error(err)
 		assert.Contains(err.Error(), "storage is readonly")
 	})
@@ -266,8 +369,118 @@ func TestStorageRemoveHost(t *testing.T) {
 		s.readonly = false
 		mockBackend.On("RemoveHost", "00:11:22:33:44:55").Return(nil)
 
-		err := s.RemoveHost("00:11:22:33:44:55")
+		err := s.RemoveHost(t.Context(), "00:11:22:33:44:55")
 		assert.NoError(err, "Should remove host without error")
 		mockBackend.AssertExpectations(t)
 	})
 }
+
+func TestStorageMoveHost(t *testing.T) {
+	mockBackend := new(MockBackend)
+	s := &Storage{
+		backend:  mockBackend,
+		readonly: false,
+	}
+
+	t.Run("ReadonlyStorage", func(t *testing.T) {
+		assert := assert.New(t)
+
+		s.readonly = true
+		err := s.MoveHost(t.Context(), "00:11:22:33:44:55", 1)
+		assert.Error(err)
+		assert.Contains(err.Error(), "storage is readonly")
+	})
+
+	t.Run("SuccessfulMove", func(t *testing.T) {
+		assert := assert.New(t)
+
+		s.readonly = false
+		mockBackend.On("MoveHost", "00:11:22:33:44:55", 1).Return(nil)
+
+		err := s.MoveHost(t.Context(), "00:11:22:33:44:55", 1)
+		assert.NoError(err, "Should move host without error")
+		mockBackend.AssertExpectations(t)
+	})
+}
+
+func TestStorageReorderHosts(t *testing.T) {
+	mockBackend := new(MockBackend)
+	s := &Storage{
+		backend:  mockBackend,
+		readonly: false,
+	}
+	order := []string{"00:11:22:33:44:55", "AA:BB:CC:DD:EE:FF"}
+
+	t.Run("ReadonlyStorage", func(t *testing.T) {
+		assert := assert.New(t)
+
+		s.readonly = true
+		err := s.ReorderHosts(t.Context(), order)
+		assert.Error(err)
+		assert.Contains(err.Error(), "storage is readonly")
+	})
+
+	t.Run("SuccessfulReorder", func(t *testing.T) {
+		assert := assert.New(t)
+
+		s.readonly = false
+		mockBackend.On("ReorderHosts", order).Return(nil)
+
+		err := s.ReorderHosts(t.Context(), order)
+		assert.NoError(err, "Should reorder hosts without error")
+		mockBackend.AssertExpectations(t)
+	})
+}
+
+// Backend that only returns once the context is done
+type BlockingBackend struct {
+	types.StorageBackend
+}
+
+func (b *BlockingBackend) GetHosts(ctx context.Context) ([]types.Host, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (b *BlockingBackend) AddHost(ctx context.Context, _ types.Host) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestStorageTimeout(t *testing.T) {
+	s := &Storage{
+		backend: &BlockingBackend{},
+		timeout: 10 * time.Millisecond,
+	}
+
+	t.Run("Timeout", func(t *testing.T) {
+		_, err := s.GetHosts(t.Context())
+		assert.ErrorIs(t, err, context.DeadlineExceeded, "Should stop after the timeout")
+
+		err = s.AddHost(t.Context(), types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"})
+		assert.ErrorIs(t, err, context.DeadlineExceeded, "Should stop after the timeout")
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		s := &Storage{
+			backend: &BlockingBackend{},
+			timeout: time.Minute,
+		}
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		_, err := s.GetHosts(ctx)
+		assert.ErrorIs(t, err, context.Canceled, "Should stop when the context is canceled")
+	})
+
+	t.Run("NegativeTimeout", func(t *testing.T) {
+		_, err := NewStorage(StorageConfig{Type: "memory", Timeout: -time.Second})
+		assert.ErrorContains(t, err, "timeout can't be negative", "Should not accept negative timeout")
+	})
+
+	t.Run("DefaultTimeout", func(t *testing.T) {
+		s, err := NewStorage(StorageConfig{Type: "memory"})
+		require.NoError(t, err, "Should create storage")
+		assert.Equal(t, DEFAULT_TIMEOUT, s.timeout, "Should use the default timeout when unset")
+	})
+}
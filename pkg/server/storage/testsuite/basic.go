@@ -2,6 +2,7 @@ package testsuite
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
@@ -15,7 +16,7 @@ func RunStorageBackendTests(t *testing.T, factory StorageBackendFactory) {
 	t.Run("AddHost", func(t *testing.T) {
 		backend := factory(t, "add-host")
 
-		err := backend.AddHost(testHosts[0])
+		err := backend.AddHost(t.Context(), testHosts[0])
 		require.NoError(t, err, "AddHost failed")
 	})
 
@@ -23,7 +24,7 @@ func RunStorageBackendTests(t *testing.T, factory StorageBackendFactory) {
 		backend := factory(t, "get-host")
 		addHosts(t, backend)
 
-		host, err := backend.GetHost(testHosts[0].MAC)
+		host, err := backend.GetHost(t.Context(), testHosts[0].MAC)
 		require.NoError(t, err, "GetHost failed")
 		assert.Equal(t, testHosts[0], host, "Failed to retrieve host")
 	})
@@ -52,9 +53,9 @@ func RunStorageBackendTests(t *testing.T, factory StorageBackendFactory) {
 				backend := factory(t, fmt.Sprintf("remove-host-%d", i))
 				addHosts(t, backend)
 
-				err := backend.RemoveHost(testHosts[tCase.index].MAC)
+				err := backend.RemoveHost(t.Context(), testHosts[tCase.index].MAC)
 				require.NoError(t, err, "RemoveHost failed")
-				host, _ := backend.GetHost(testHosts[tCase.index].MAC)
+				host, _ := backend.GetHost(t.Context(), testHosts[tCase.index].MAC)
 				assert.Empty(t, host, "Expected empty host")
 			})
 		}
@@ -63,7 +64,7 @@ func RunStorageBackendTests(t *testing.T, factory StorageBackendFactory) {
 	t.Run("RemoveHostNonExistent", func(t *testing.T) {
 		backend := factory(t, "remove-host-non-existent")
 
-		err := backend.RemoveHost("00:11:22:33:44:55")
+		err := backend.RemoveHost(t.Context(), "00:11:22:33:44:55")
 		require.NoError(t, err, "RemoveHost for non-existent host failed")
 	})
 
@@ -71,7 +72,7 @@ func RunStorageBackendTests(t *testing.T, factory StorageBackendFactory) {
 		backend := factory(t, "get-hosts")
 		addHosts(t, backend)
 
-		hosts, err := backend.GetHosts()
+		hosts, err := backend.GetHosts(t.Context())
 		require.NoError(t, err, "GetHosts failed")
 		assert.Equal(t, testHosts, hosts, "Expected result to match testHosts")
 	})
@@ -81,15 +82,15 @@ func RunStorageBackendTests(t *testing.T, factory StorageBackendFactory) {
 		require := require.New(t)
 		backend := factory(t, "case-insensitive-mac")
 
-		err := backend.AddHost(types.Host{MAC: "aa:bb:cc:dd:ee:ff", Name: "LowerCase"})
+		err := backend.AddHost(t.Context(), types.Host{MAC: "aa:bb:cc:dd:ee:ff", Name: "LowerCase"})
 
 		require.NoError(err, "Should add host")
 
-		host, err := backend.GetHost("AA:BB:CC:dd:ee:ff")
+		host, err := backend.GetHost(t.Context(), "AA:BB:CC:dd:ee:ff")
 		require.NoError(err, "Should get host regardless of case")
 		assert.Equal("LowerCase", host.Name, "Should get correct host name")
 
-		hosts, err := backend.GetHosts()
+		hosts, err := backend.GetHosts(t.Context())
 		require.NoError(err, "Should get hosts")
 
 		require.Len(hosts, 1, "Should have one host")
@@ -102,20 +103,40 @@ func RunStorageBackendTests(t *testing.T, factory StorageBackendFactory) {
 		require := require.New(t)
 		backend := factory(t, "add-host-overwrite")
 
-		err := backend.AddHost(testHosts[0])
+		err := backend.AddHost(t.Context(), testHosts[0])
 		require.NoError(err, "Should add host")
 
 		host := testHosts[0]
 		host.Name = "NewName"
-		err = backend.AddHost(host)
+		err = backend.AddHost(t.Context(), host)
 		require.NoError(err, "Should overwrite host")
 
-		hosts, err := backend.GetHosts()
+		hosts, err := backend.GetHosts(t.Context())
 		require.NoError(err, "Should get hosts")
 		require.Len(hosts, 1, "Should have one host")
 		assert.Equal("NewName", hosts[0].Name, "Should have new name")
 	})
 
+	t.Run("HostMetadata", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		backend := factory(t, "host-metadata")
+
+		err := backend.AddHost(t.Context(), testHosts[2])
+		require.NoError(err, "Should add host")
+
+		host, err := backend.GetHost(t.Context(), testHosts[2].MAC)
+		require.NoError(err, "Should get host")
+		assert.Equal(testHosts[2], host, "Should keep all metadata")
+
+		err = backend.AddHost(t.Context(), types.Host{MAC: testHosts[2].MAC, Name: testHosts[2].Name})
+		require.NoError(err, "Should overwrite host")
+
+		host, err = backend.GetHost(t.Context(), testHosts[2].MAC)
+		require.NoError(err, "Should get host")
+		assert.Equal(types.Host{MAC: testHosts[2].MAC, Name: testHosts[2].Name}, host, "Should remove metadata that is not set anymore")
+	})
+
 	t.Run("HostOverwriteShouldKeepOrder", func(t *testing.T) {
 		assert := assert.New(t)
 		require := require.New(t)
@@ -124,10 +145,10 @@ func RunStorageBackendTests(t *testing.T, factory StorageBackendFactory) {
 
 		testHost := testHosts[0]
 		testHost.Name = "NewName"
-		err := backend.AddHost(testHost)
+		err := backend.AddHost(t.Context(), testHost)
 		require.NoError(err, "Should overwrite host")
 
-		hosts, err := backend.GetHosts()
+		hosts, err := backend.GetHosts(t.Context())
 		require.NoError(err, "Should get hosts")
 		require.Len(hosts, len(testHosts), "Should have same number of hosts")
 		assert.Equal("NewName", hosts[0].Name, "Should have new name")
@@ -136,4 +157,151 @@ func RunStorageBackendTests(t *testing.T, factory StorageBackendFactory) {
 			assert.Equal(testHosts[i].MAC, host.MAC, "Should keep order")
 		}
 	})
+	t.Run("MoveHost", func(t *testing.T) {
+		tMatrix := []struct {
+			name  string
+			mac   string
+			index int
+			order []int
+		}{
+			{
+				name:  "ToFront",
+				mac:   testHosts[2].MAC,
+				index: 0,
+				order: []int{2, 0, 1, 3, 4},
+			},
+			{
+				name:  "ToEnd",
+				mac:   testHosts[0].MAC,
+				index: len(testHosts) - 1,
+				order: []int{1, 2, 3, 4, 0},
+			},
+			{
+				name:  "ToMiddle",
+				mac:   testHosts[4].MAC,
+				index: 1,
+				order: []int{0, 4, 1, 2, 3},
+			},
+			{
+				name:  "IndexOutOfBounds",
+				mac:   testHosts[1].MAC,
+				index: 100,
+				order: []int{0, 2, 3, 4, 1},
+			},
+			{
+				name:  "NegativeIndex",
+				mac:   testHosts[3].MAC,
+				index: -1,
+				order: []int{3, 0, 1, 2, 4},
+			},
+			{
+				name:  "LowercaseMAC",
+				mac:   strings.ToLower(testHosts[1].MAC),
+				index: 0,
+				order: []int{1, 0, 2, 3, 4},
+			},
+		}
+
+		for i, tCase := range tMatrix {
+			t.Run(tCase.name, func(t *testing.T) {
+				backend := factory(t, fmt.Sprintf("move-host-%d", i))
+				addHosts(t, backend)
+
+				err := backend.MoveHost(t.Context(), tCase.mac, tCase.index)
+				require.NoError(t, err, "MoveHost failed")
+
+				assertHostOrder(t, backend, tCase.order)
+			})
+		}
+
+		t.Run("NotFound", func(t *testing.T) {
+			backend := factory(t, "move-host-not-found")
+			addHosts(t, backend)
+
+			err := backend.MoveHost(t.Context(), "00:11:22:33:44:55", 0)
+			assert.ErrorIs(t, err, types.ErrHostNotFound, "Should return not found error")
+
+			assertHostOrder(t, backend, []int{0, 1, 2, 3, 4})
+		})
+	})
+
+	t.Run("ReorderHosts", func(t *testing.T) {
+		tMatrix := []struct {
+			name  string
+			macs  []string
+			order []int
+		}{
+			{
+				name:  "Full",
+				macs:  []string{testHosts[4].MAC, testHosts[3].MAC, testHosts[2].MAC, testHosts[1].MAC, testHosts[0].MAC},
+				order: []int{4, 3, 2, 1, 0},
+			},
+			{
+				name:  "Partial",
+				macs:  []string{testHosts[3].MAC, testHosts[1].MAC},
+				order: []int{3, 1, 0, 2, 4},
+			},
+			{
+				name:  "Empty",
+				macs:  []string{},
+				order: []int{0, 1, 2, 3, 4},
+			},
+			{
+				name:  "LowercaseMAC",
+				macs:  []string{strings.ToLower(testHosts[2].MAC)},
+				order: []int{2, 0, 1, 3, 4},
+			},
+		}
+
+		for i, tCase := range tMatrix {
+			t.Run(tCase.name, func(t *testing.T) {
+				backend := factory(t, fmt.Sprintf("reorder-hosts-%d", i))
+				addHosts(t, backend)
+
+				err := backend.ReorderHosts(t.Context(), tCase.macs)
+				require.NoError(t, err, "ReorderHosts failed")
+
+				assertHostOrder(t, backend, tCase.order)
+			})
+		}
+
+		t.Run("NotFound", func(t *testing.T) {
+			backend := factory(t, "reorder-hosts-not-found")
+			addHosts(t, backend)
+
+			err := backend.ReorderHosts(t.Context(), []string{testHosts[1].MAC, "00:11:22:33:44:55"})
+			assert.ErrorIs(t, err, types.ErrHostNotFound, "Should return not found error")
+
+			assertHostOrder(t, backend, []int{0, 1, 2, 3, 4})
+		})
+
+		t.Run("Duplicate", func(t *testing.T) {
+			backend := factory(t, "reorder-hosts-duplicate")
+			addHosts(t, backend)
+
+			err := backend.ReorderHosts(t.Context(), []string{testHosts[1].MAC, testHosts[1].MAC})
+			assert.Error(t, err, "Should not accept duplicate hosts")
+
+			assertHostOrder(t, backend, []int{0, 1, 2, 3, 4})
+		})
+
+		t.Run("NewHostsAfterReorder", func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			backend := factory(t, "reorder-hosts-add-after")
+			addHosts(t, backend)
+
+			err := backend.ReorderHosts(t.Context(), []string{testHosts[4].MAC})
+			require.NoError(err, "ReorderHosts failed")
+
+			newHost := types.Host{MAC: "00:11:22:33:44:55", Name: "NewHost"}
+			require.NoError(backend.AddHost(t.Context(), newHost), "Should add host")
+
+			hosts, err := backend.GetHosts(t.Context())
+			require.NoError(err, "Should get hosts")
+			require.Len(hosts, len(testHosts)+1, "Should have all hosts")
+			assert.Equal(testHosts[4], hosts[0], "Should keep new order")
+			assert.Equal(newHost, hosts[len(hosts)-1], "Should append new host")
+		})
+	})
 }
@@ -0,0 +1,41 @@
+package testsuite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Runs tests ensuring that backends created with different names do not see each others hosts,
+// even when they share the same underlying storage.
+func RunStorageBackendIsolationTests(t *testing.T, factory StorageBackendFactory) {
+	t.Run("AddHost", func(t *testing.T) {
+		a := factory(t, "isolation-add-a")
+		b := factory(t, "isolation-add-b")
+		addHosts(t, a)
+
+		hosts, err := b.GetHosts(t.Context())
+		require.NoError(t, err, "GetHosts failed")
+		assert.Empty(t, hosts, "Should not see hosts of the other backend")
+
+		host, err := b.GetHost(t.Context(), testHosts[0].MAC)
+		require.NoError(t, err, "GetHost failed")
+		assert.Empty(t, host, "Should not get host of the other backend")
+	})
+
+	t.Run("SameHost", func(t *testing.T) {
+		a := factory(t, "isolation-same-a")
+		b := factory(t, "isolation-same-b")
+		addHosts(t, a)
+		addHosts(t, b)
+
+		renamed := testHosts[0]
+		renamed.Name = "Renamed"
+		require.NoError(t, b.AddHost(t.Context(), renamed), "AddHost failed")
+		require.NoError(t, b.RemoveHost(t.Context(), testHosts[1].MAC), "RemoveHost failed")
+		require.NoError(t, b.MoveHost(t.Context(), testHosts[4].MAC, 0), "MoveHost failed")
+
+		assertHostOrder(t, a, []int{0, 1, 2, 3, 4})
+	})
+}
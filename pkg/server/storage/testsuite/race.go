@@ -23,7 +23,7 @@ func RunStorageBackendRaceTests(t *testing.T, factory StorageBackendFactory) {
 
 				mac := fmt.Sprintf("AA:BB:CC:DD:EE:%02X", i)
 				host := fmt.Sprintf("TestHost%d", i)
-				_ = backend.AddHost(types.Host{
+				_ = backend.AddHost(t.Context(), types.Host{
 					MAC:  mac,
 					Name: host,
 				})
@@ -42,7 +42,7 @@ func RunStorageBackendRaceTests(t *testing.T, factory StorageBackendFactory) {
 			go func() {
 				defer wg.Done()
 
-				_, _ = backend.GetHost(testHosts[0].MAC)
+				_, _ = backend.GetHost(t.Context(), testHosts[0].MAC)
 			}()
 		}
 		wg.Wait()
@@ -58,7 +58,7 @@ func RunStorageBackendRaceTests(t *testing.T, factory StorageBackendFactory) {
 			go func() {
 				defer wg.Done()
 
-				_ = backend.RemoveHost(testHosts[0].MAC)
+				_ = backend.RemoveHost(t.Context(), testHosts[0].MAC)
 			}()
 		}
 		wg.Wait()
@@ -74,7 +74,7 @@ func RunStorageBackendRaceTests(t *testing.T, factory StorageBackendFactory) {
 			go func() {
 				defer wg.Done()
 
-				_, _ = backend.GetHosts()
+				_, _ = backend.GetHosts(t.Context())
 			}()
 		}
 		wg.Wait()
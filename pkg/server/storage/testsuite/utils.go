@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -20,8 +21,15 @@ var testHosts = []types.Host{
 		Address: "host.example.com",
 	},
 	{
-		MAC:  "77:88:99:AA:BB:CC",
-		Name: "TestHost3",
+		MAC:         "77:88:99:AA:BB:CC",
+		Name:        "TestHost3",
+		DisplayName: "Test host 3",
+		Description: "Host with all metadata;\nsecond line",
+		Tags:        []string{"test", "with \"quotes\""},
+		Icon:        "server",
+		Location:    "Server room",
+		Labels:      map[string]string{"owner": "alice", "rack": "1;2=3"},
+		Site:        "building-b",
 	},
 	{
 		MAC:  "FF:88:99:AA:BB:CC",
@@ -37,7 +45,21 @@ func addHosts(t *testing.T, backend types.StorageBackend) {
 	t.Helper()
 
 	for _, host := range testHosts {
-		err := backend.AddHost(host)
+		err := backend.AddHost(t.Context(), host)
 		require.NoError(t, err, "AddHost failed for %s", host.Name)
 	}
 }
+
+// Verify that the backend returns the testHosts in the order given by their indexes.
+func assertHostOrder(t *testing.T, backend types.StorageBackend, order []int) {
+	t.Helper()
+
+	hosts, err := backend.GetHosts(t.Context())
+	require.NoError(t, err, "GetHosts failed")
+
+	expected := make([]types.Host, 0, len(order))
+	for _, i := range order {
+		expected = append(expected, testHosts[i])
+	}
+	assert.Equal(t, expected, hosts, "Hosts should be in the expected order")
+}
@@ -0,0 +1,51 @@
+package types
+
+import (
+	"context"
+	"crypto/rand"
+	"time"
+)
+
+// Type of a change to the hosts.
+type EventType string
+
+const (
+	// A host has been added or updated
+	EventHostUpdated EventType = "host-updated"
+	// A host has been removed
+	EventHostRemoved EventType = "host-removed"
+	// The order of the hosts has been changed
+	EventHostsReordered EventType = "hosts-reordered"
+)
+
+// Change to the hosts, delivered to clients and other instances sharing the storage.
+type Event struct {
+	// Unique ID of the event, the same on all instances
+	ID   string    `json:"id" example:"JBSWY3DPEHPK3PXPJBSWY3DPEH"`
+	Type EventType `json:"type" example:"host-updated"`
+	// MAC address of the changed host, empty when multiple hosts have been changed
+	MAC string `json:"mac,omitempty" example:"AA:BB:CC:DD:EE:FF"`
+	// The new host, only set when a host has been added or updated
+	Host *Host     `json:"host,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// Create a new event with a unique ID
+func NewEvent(eventType EventType, mac string, host *Host) Event {
+	return Event{
+		ID:   rand.Text(),
+		Type: eventType,
+		MAC:  mac,
+		Host: host,
+		Time: time.Now().UTC(),
+	}
+}
+
+// Implemented by storage backends that can be shared between multiple instances,
+// to notify the other instances about changes.
+type EventBackend interface {
+	// Send the event to all other instances
+	PublishEvent(ctx context.Context, event Event) error
+	// Call handler for all events published by other instances, blocks until ctx is canceled
+	SubscribeEvents(ctx context.Context, handler func(Event))
+}
@@ -0,0 +1,210 @@
+package types
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Icons that can be chosen for a host, they are served from /icons/hosts/<name>.svg
+var HostIcons = []string{"desktop", "laptop", "server", "nas", "router", "tv", "console", "printer"}
+
+// Criteria for selecting hosts, empty fields match all hosts.
+type HostFilter struct {
+	// Text contained in the name, display name, MAC or address, case insensitive
+	Search string
+	// Hosts need to have all of the tags, case insensitive
+	Tags []string
+	// Location of the hosts, case insensitive
+	Location string
+	// Location or tag of the hosts, case insensitive
+	Group string
+	// Hosts need to have all of the labels with the exact value, an empty value only matches labels with an empty value
+	Labels map[string]string
+	// Hosts need to have labels with all of the keys, with any value
+	LabelKeys []string
+}
+
+// Return the name to show for the host, the display name if set and the hostname otherwise.
+func (h Host) Title() string {
+	if h.DisplayName != "" {
+		return h.DisplayName
+	}
+	return h.Name
+}
+
+// Return a copy of the host that does not share tags or labels with the original.
+func (h Host) Clone() Host {
+	h.Tags = slices.Clone(h.Tags)
+	h.Labels = maps.Clone(h.Labels)
+	return h
+}
+
+// Check if both hosts have the same values, empty and missing tags or labels are treated as equal.
+func (h Host) Equal(other Host) bool {
+	return h.MAC == other.MAC && h.Name == other.Name && h.Address == other.Address &&
+		h.DisplayName == other.DisplayName && h.Description == other.Description &&
+		h.Icon == other.Icon && h.Location == other.Location && h.Site == other.Site &&
+		slices.Equal(h.Tags, other.Tags) && maps.Equal(h.Labels, other.Labels)
+}
+
+// Check if the host has the given tag, case insensitive
+func (h Host) HasTag(tag string) bool {
+	return slices.ContainsFunc(h.Tags, func(t string) bool {
+		return strings.EqualFold(t, tag)
+	})
+}
+
+// Check if the host is part of the group, which are its location and tags, case insensitive
+func (h Host) InGroup(group string) bool {
+	return strings.EqualFold(h.Location, group) || h.HasTag(group)
+}
+
+// Check if the name, display name, MAC or address of the host contain the text, case insensitive.
+// MAC addresses also match when the text uses a different separator or none at all.
+func (h Host) Contains(text string) bool {
+	text = strings.ToLower(text)
+	for _, field := range []string{h.Name, h.DisplayName, h.MAC, h.Address} {
+		if strings.Contains(strings.ToLower(field), text) {
+			return true
+		}
+	}
+	mac := strings.NewReplacer(":", "", "-", "", ".", "")
+	search := mac.Replace(text)
+	return search != "" && strings.Contains(strings.ToLower(mac.Replace(h.MAC)), search)
+}
+
+// Check if the host matches all criteria of the filter
+func (f HostFilter) Match(host Host) bool {
+	if f.Search != "" && !host.Contains(f.Search) {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !host.HasTag(tag) {
+			return false
+		}
+	}
+	if f.Location != "" && !strings.EqualFold(f.Location, host.Location) {
+		return false
+	}
+	if f.Group != "" && !host.InGroup(f.Group) {
+		return false
+	}
+	for key, value := range f.Labels {
+		v, ok := host.Labels[key]
+		if !ok || v != value {
+			return false
+		}
+	}
+	for _, key := range f.LabelKeys {
+		if _, ok := host.Labels[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the hosts matching the filter, keeping their order
+func FilterHosts(hosts []Host, filter HostFilter) []Host {
+	result := make([]Host, 0, len(hosts))
+	for _, host := range hosts {
+		if filter.Match(host) {
+			result = append(result, host)
+		}
+	}
+	return result
+}
+
+// Return the host with the given MAC address or name, case insensitive.
+// MAC addresses may use any separator, names match the hostname or the display name.
+func FindHost(hosts []Host, nameOrMAC string) (Host, bool) {
+	mac := strings.NewReplacer(":", "", "-", "", ".", "")
+	search := strings.ToLower(mac.Replace(nameOrMAC))
+	for _, host := range hosts {
+		if search != "" && strings.ToLower(mac.Replace(host.MAC)) == search {
+			return host, true
+		}
+	}
+	for _, host := range hosts {
+		if strings.EqualFold(host.Name, nameOrMAC) || (host.DisplayName != "" && strings.EqualFold(host.DisplayName, nameOrMAC)) {
+			return host, true
+		}
+	}
+	return Host{}, false
+}
+
+// Encode tags for backends storing them in a single text field.
+// Returns an empty string when there are no tags.
+func EncodeTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	// Encoding a list of strings can't fail
+	data, _ := json.Marshal(tags)
+	return string(data)
+}
+
+// Decode tags encoded by EncodeTags
+func DecodeTags(data string) ([]string, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var tags []string
+	err := json.Unmarshal([]byte(data), &tags)
+	if err != nil || len(tags) == 0 {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// Encode labels for backends storing them in a single text field.
+// Returns an empty string when there are no labels.
+func EncodeLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	// Encoding a map of strings can't fail
+	data, _ := json.Marshal(labels)
+	return string(data)
+}
+
+// Decode labels encoded by EncodeLabels
+func DecodeLabels(data string) (map[string]string, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var labels map[string]string
+	err := json.Unmarshal([]byte(data), &labels)
+	if err != nil || len(labels) == 0 {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// Return all tags used by the hosts, sorted and without case insensitive duplicates
+func HostTags(hosts []Host) []string {
+	var tags []string
+	for _, host := range hosts {
+		tags = append(tags, host.Tags...)
+	}
+	return uniqueSorted(tags)
+}
+
+// Return all locations of the hosts, sorted and without case insensitive duplicates
+func HostLocations(hosts []Host) []string {
+	var locations []string
+	for _, host := range hosts {
+		if host.Location != "" {
+			locations = append(locations, host.Location)
+		}
+	}
+	return uniqueSorted(locations)
+}
+
+func uniqueSorted(values []string) []string {
+	slices.SortStableFunc(values, func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	})
+	return slices.CompactFunc(values, strings.EqualFold)
+}
@@ -0,0 +1,243 @@
+package types
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFilterHosts = []Host{
+	{MAC: "AA:BB:CC:DD:EE:FF", Name: "desktop", Tags: []string{"Gaming", "windows"}, Location: "Living room", Labels: map[string]string{"owner": "alice", "rack": ""}},
+	{MAC: "11:22:33:44:55:66", Name: "nas", Tags: []string{"storage"}, Location: "Basement", Labels: map[string]string{"owner": "bob", "rack": "1"}},
+	{MAC: "77:88:99:AA:BB:CC", Name: "laptop"},
+}
+
+func TestHostTitle(t *testing.T) {
+	assert := assert.New(t)
+
+	host := Host{Name: "living-room-pc"}
+	assert.Equal("living-room-pc", host.Title(), "Should fall back to the hostname")
+
+	host.DisplayName = "Living room PC"
+	assert.Equal("Living room PC", host.Title(), "Should use the display name")
+}
+
+func TestHostClone(t *testing.T) {
+	assert := assert.New(t)
+
+	host := testFilterHosts[0].Clone()
+	assert.Equal(testFilterHosts[0], host, "Should be equal to the original")
+
+	host.Tags[0] = "changed"
+	host.Labels["owner"] = "changed"
+	assert.Equal("Gaming", testFilterHosts[0].Tags[0], "Should not share tags")
+	assert.Equal("alice", testFilterHosts[0].Labels["owner"], "Should not share labels")
+
+	assert.Equal(Host{MAC: "77:88:99:AA:BB:CC", Name: "laptop"}, testFilterHosts[2].Clone(), "Should keep empty tags and labels nil")
+}
+
+func TestHostEqual(t *testing.T) {
+	assert := assert.New(t)
+
+	host := testFilterHosts[0]
+	assert.True(host.Equal(host.Clone()), "Should equal its copy")
+
+	other := host.Clone()
+	other.Labels["owner"] = "bob"
+	assert.False(host.Equal(other), "Should compare labels")
+
+	other = host.Clone()
+	other.Tags = append(other.Tags, "new")
+	assert.False(host.Equal(other), "Should compare tags")
+
+	other = host.Clone()
+	other.DisplayName = "Desktop"
+	assert.False(host.Equal(other), "Should compare display name")
+
+	empty := Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "host"}
+	assert.True(empty.Equal(Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "host", Tags: []string{}, Labels: map[string]string{}}), "Should treat empty and missing tags and labels as equal")
+}
+
+func TestFilterHosts(t *testing.T) {
+	tMatrix := []struct {
+		Name   string
+		Filter HostFilter
+		Result []string
+	}{
+		{
+			Name:   "Empty",
+			Result: []string{"desktop", "nas", "laptop"},
+		},
+		{
+			Name:   "Tag",
+			Filter: HostFilter{Tags: []string{"gaming"}},
+			Result: []string{"desktop"},
+		},
+		{
+			Name:   "AllTags",
+			Filter: HostFilter{Tags: []string{"gaming", "storage"}},
+			Result: []string{},
+		},
+		{
+			Name:   "Location",
+			Filter: HostFilter{Location: "basement"},
+			Result: []string{"nas"},
+		},
+		{
+			Name:   "Label",
+			Filter: HostFilter{Labels: map[string]string{"owner": "alice"}},
+			Result: []string{"desktop"},
+		},
+		{
+			Name:   "LabelKey",
+			Filter: HostFilter{LabelKeys: []string{"owner"}},
+			Result: []string{"desktop", "nas"},
+		},
+		{
+			Name:   "LabelEmptyValue",
+			Filter: HostFilter{Labels: map[string]string{"rack": ""}},
+			Result: []string{"desktop"},
+		},
+		{
+			Name:   "GroupLocation",
+			Filter: HostFilter{Group: "basement"},
+			Result: []string{"nas"},
+		},
+		{
+			Name:   "GroupTag",
+			Filter: HostFilter{Group: "gaming"},
+			Result: []string{"desktop"},
+		},
+		{
+			Name:   "Combined",
+			Filter: HostFilter{Tags: []string{"storage"}, Labels: map[string]string{"rack": "1"}, Location: "Basement"},
+			Result: []string{"nas"},
+		},
+		{
+			Name:   "SearchName",
+			Filter: HostFilter{Search: "LAP"},
+			Result: []string{"laptop"},
+		},
+		{
+			Name:   "SearchMAC",
+			Filter: HostFilter{Search: "aa:bb"},
+			Result: []string{"desktop", "laptop"},
+		},
+		{
+			Name:   "SearchMACWithoutSeparator",
+			Filter: HostFilter{Search: "445566"},
+			Result: []string{"nas"},
+		},
+		{
+			Name:   "SearchAndTag",
+			Filter: HostFilter{Search: "aa:bb", Tags: []string{"windows"}},
+			Result: []string{"desktop"},
+		},
+		{
+			Name:   "NoMatch",
+			Filter: HostFilter{Labels: map[string]string{"owner": "carol"}},
+			Result: []string{},
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			names := []string{}
+			for _, host := range FilterHosts(testFilterHosts, tCase.Filter) {
+				names = append(names, host.Name)
+			}
+			assert.Equal(t, tCase.Result, names)
+		})
+	}
+}
+
+func TestHostContains(t *testing.T) {
+	assert := assert.New(t)
+
+	host := Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "living-room-pc", DisplayName: "Gaming PC", Address: "192.0.2.10"}
+
+	assert.True(host.Contains("room"), "Should search the name")
+	assert.True(host.Contains("gaming"), "Should search the display name")
+	assert.True(host.Contains("192.0.2"), "Should search the address")
+	assert.True(host.Contains("cc-dd-ee"), "Should search the MAC with different separators")
+	assert.True(host.Contains("ccddee"), "Should search the MAC without separators")
+	assert.False(host.Contains("server"), "Should not match unrelated text")
+	assert.False(host.Contains("--"), "Should not match only separators in the MAC")
+}
+
+func TestFindHost(t *testing.T) {
+	assert := assert.New(t)
+
+	hosts := []Host{
+		{MAC: "AA:BB:CC:DD:EE:FF", Name: "living-room-pc", DisplayName: "Gaming PC"},
+		{MAC: "11:22:33:44:55:66", Name: "nas"},
+	}
+
+	host, ok := FindHost(hosts, "aa-bb-cc-dd-ee-ff")
+	assert.True(ok, "Should find the host by MAC with a different separator")
+	assert.Equal("living-room-pc", host.Name)
+
+	host, ok = FindHost(hosts, "NAS")
+	assert.True(ok, "Should find the host by name")
+	assert.Equal("11:22:33:44:55:66", host.MAC)
+
+	host, ok = FindHost(hosts, "gaming pc")
+	assert.True(ok, "Should find the host by display name")
+	assert.Equal("AA:BB:CC:DD:EE:FF", host.MAC)
+
+	_, ok = FindHost(hosts, "server")
+	assert.False(ok, "Should not find unknown hosts")
+	_, ok = FindHost(hosts, "")
+	assert.False(ok, "Should not find a host for an empty name")
+}
+
+func TestHostTagsAndLocations(t *testing.T) {
+	assert := assert.New(t)
+
+	hosts := append(slices.Clone(testFilterHosts), Host{MAC: "00:00:00:00:00:01", Name: "pc", Tags: []string{"gaming"}, Location: "living room"})
+
+	assert.Equal([]string{"Gaming", "storage", "windows"}, HostTags(hosts), "Should return sorted tags without duplicates")
+	assert.Equal([]string{"Basement", "Living room"}, HostLocations(hosts), "Should return sorted locations without duplicates")
+	assert.Empty(HostTags(nil), "Should return no tags without hosts")
+}
+
+func TestEncodeMetadata(t *testing.T) {
+	t.Run("Tags", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Empty(EncodeTags(nil), "Should encode no tags as empty string")
+		assert.Empty(EncodeTags([]string{}), "Should encode no tags as empty string")
+
+		tags := []string{"gaming", "with \"quotes\", and commas"}
+		result, err := DecodeTags(EncodeTags(tags))
+		require.NoError(t, err, "Should decode tags")
+		assert.Equal(tags, result, "Should keep tags")
+
+		result, err = DecodeTags("")
+		assert.NoError(err, "Should decode empty string")
+		assert.Nil(result, "Should return nil for no tags")
+
+		_, err = DecodeTags("not json")
+		assert.Error(err, "Should fail to decode invalid data")
+	})
+
+	t.Run("Labels", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Empty(EncodeLabels(nil), "Should encode no labels as empty string")
+
+		labels := map[string]string{"owner": "alice", "rack": "1;2=3"}
+		result, err := DecodeLabels(EncodeLabels(labels))
+		require.NoError(t, err, "Should decode labels")
+		assert.Equal(labels, result, "Should keep labels")
+
+		result, err = DecodeLabels("{}")
+		assert.NoError(err, "Should decode empty object")
+		assert.Nil(result, "Should return nil for no labels")
+
+		_, err = DecodeLabels("[]")
+		assert.Error(err, "Should fail to decode invalid data")
+	})
+}
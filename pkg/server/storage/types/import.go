@@ -0,0 +1,30 @@
+package types
+
+// Determines how imported hosts are combined with the existing hosts.
+type ImportMode string
+
+const (
+	// Add new hosts and overwrite existing ones, keep all other hosts.
+	ImportModeMerge ImportMode = "merge"
+	// Replace all existing hosts with the imported ones.
+	ImportModeReplace ImportMode = "replace"
+)
+
+// Result of importing hosts.
+// Contains the MAC addresses of the affected hosts.
+type ImportResult struct {
+	DryRun    bool          `json:"dryRun" yaml:"dryRun"`
+	Added     []string      `json:"added" yaml:"added"`
+	Updated   []string      `json:"updated" yaml:"updated"`
+	Unchanged []string      `json:"unchanged" yaml:"unchanged"`
+	Removed   []string      `json:"removed" yaml:"removed"`
+	Errors    []ImportError `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// Validation error of a single imported host.
+type ImportError struct {
+	// Position of the host in the imported list, starting at 1
+	Row   int    `json:"row" yaml:"row"`
+	MAC   string `json:"mac,omitempty" yaml:"mac,omitempty"`
+	Error string `json:"error" yaml:"error"`
+}
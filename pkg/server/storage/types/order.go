@@ -0,0 +1,66 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Return the given list of MAC addresses with mac moved to index.
+// The index is capped to the bounds of the list.
+// MAC addresses are compared case-insensitive, the result is uppercase.
+func MoveToIndex(current []string, mac string, index int) ([]string, error) {
+	mac = strings.ToUpper(mac)
+
+	result := make([]string, 0, len(current))
+	found := false
+	for _, m := range current {
+		m = strings.ToUpper(m)
+		if m == mac {
+			found = true
+			continue
+		}
+		result = append(result, m)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrHostNotFound, mac)
+	}
+
+	index = max(0, min(index, len(result)))
+
+	result = append(result, "")
+	copy(result[index+1:], result[index:])
+	result[index] = mac
+	return result, nil
+}
+
+// Return the given list of MAC addresses sorted by order.
+// Entries not contained in order keep their relative order after the ordered entries.
+// MAC addresses are compared case-insensitive, the result is uppercase.
+func ApplyOrder(current, order []string) ([]string, error) {
+	known := make(map[string]bool, len(current))
+	for _, mac := range current {
+		known[strings.ToUpper(mac)] = true
+	}
+
+	result := make([]string, 0, len(current))
+	seen := make(map[string]bool, len(order))
+	for _, mac := range order {
+		mac = strings.ToUpper(mac)
+		if !known[mac] {
+			return nil, fmt.Errorf("%w: %s", ErrHostNotFound, mac)
+		}
+		if seen[mac] {
+			return nil, fmt.Errorf("duplicate host in order: %s", mac)
+		}
+		seen[mac] = true
+		result = append(result, mac)
+	}
+
+	for _, mac := range current {
+		mac = strings.ToUpper(mac)
+		if !seen[mac] {
+			result = append(result, mac)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,122 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testOrder = []string{"AA:BB:CC:DD:EE:FF", "11:22:33:44:55:66", "77:88:99:AA:BB:CC"}
+
+func TestMoveToIndex(t *testing.T) {
+	tMatrix := []struct {
+		Name   string
+		MAC    string
+		Index  int
+		Result []string
+	}{
+		{
+			Name:   "ToFront",
+			MAC:    "77:88:99:AA:BB:CC",
+			Index:  0,
+			Result: []string{"77:88:99:AA:BB:CC", "AA:BB:CC:DD:EE:FF", "11:22:33:44:55:66"},
+		},
+		{
+			Name:   "ToEnd",
+			MAC:    "AA:BB:CC:DD:EE:FF",
+			Index:  2,
+			Result: []string{"11:22:33:44:55:66", "77:88:99:AA:BB:CC", "AA:BB:CC:DD:EE:FF"},
+		},
+		{
+			Name:   "SameIndex",
+			MAC:    "11:22:33:44:55:66",
+			Index:  1,
+			Result: testOrder,
+		},
+		{
+			Name:   "IndexTooLarge",
+			MAC:    "AA:BB:CC:DD:EE:FF",
+			Index:  10,
+			Result: []string{"11:22:33:44:55:66", "77:88:99:AA:BB:CC", "AA:BB:CC:DD:EE:FF"},
+		},
+		{
+			Name:   "NegativeIndex",
+			MAC:    "11:22:33:44:55:66",
+			Index:  -5,
+			Result: []string{"11:22:33:44:55:66", "AA:BB:CC:DD:EE:FF", "77:88:99:AA:BB:CC"},
+		},
+		{
+			Name:   "Lowercase",
+			MAC:    "77:88:99:aa:bb:cc",
+			Index:  1,
+			Result: []string{"AA:BB:CC:DD:EE:FF", "77:88:99:AA:BB:CC", "11:22:33:44:55:66"},
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			result, err := MoveToIndex(testOrder, tCase.MAC, tCase.Index)
+			assert.NoError(err, "Should move host")
+			assert.Equal(tCase.Result, result, "Should return new order")
+		})
+	}
+
+	t.Run("NotFound", func(t *testing.T) {
+		result, err := MoveToIndex(testOrder, "00:00:00:00:00:00", 0)
+		assert.ErrorIs(t, err, ErrHostNotFound, "Should return not found error")
+		assert.Nil(t, result, "Should not return a result")
+	})
+}
+
+func TestApplyOrder(t *testing.T) {
+	tMatrix := []struct {
+		Name   string
+		Order  []string
+		Result []string
+	}{
+		{
+			Name:   "Full",
+			Order:  []string{"77:88:99:AA:BB:CC", "AA:BB:CC:DD:EE:FF", "11:22:33:44:55:66"},
+			Result: []string{"77:88:99:AA:BB:CC", "AA:BB:CC:DD:EE:FF", "11:22:33:44:55:66"},
+		},
+		{
+			Name:   "Partial",
+			Order:  []string{"77:88:99:AA:BB:CC"},
+			Result: []string{"77:88:99:AA:BB:CC", "AA:BB:CC:DD:EE:FF", "11:22:33:44:55:66"},
+		},
+		{
+			Name:   "Empty",
+			Order:  nil,
+			Result: testOrder,
+		},
+		{
+			Name:   "Lowercase",
+			Order:  []string{"11:22:33:44:55:66", "aa:bb:cc:dd:ee:ff"},
+			Result: []string{"11:22:33:44:55:66", "AA:BB:CC:DD:EE:FF", "77:88:99:AA:BB:CC"},
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			result, err := ApplyOrder(testOrder, tCase.Order)
+			assert.NoError(err, "Should apply order")
+			assert.Equal(tCase.Result, result, "Should return new order")
+		})
+	}
+
+	t.Run("NotFound", func(t *testing.T) {
+		result, err := ApplyOrder(testOrder, []string{"00:00:00:00:00:00"})
+		assert.ErrorIs(t, err, ErrHostNotFound, "Should return not found error")
+		assert.Nil(t, result, "Should not return a result")
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		result, err := ApplyOrder(testOrder, []string{"AA:BB:CC:DD:EE:FF", "aa:bb:cc:dd:ee:ff"})
+		assert.Error(t, err, "Should not accept duplicates")
+		assert.Nil(t, result, "Should not return a result")
+	})
+}
@@ -1,10 +1,30 @@
 package types
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Returned by backends when an operation references a host that does not exist.
+var ErrHostNotFound = errors.New("host not found")
+
 // Host on the network.
 type Host struct {
 	MAC     string `json:"mac" yaml:"mac" validate:"required" example:"AA:BB:CC:DD:EE:FF"`
 	Name    string `json:"name" yaml:"name" validate:"required" example:"my-host"`
 	Address string `json:"address,omitempty" yaml:"address,omitempty" validate:"optional" example:"host.example.org"`
+	// Free-form name shown instead of the hostname
+	DisplayName string   `json:"displayName,omitempty" yaml:"displayName,omitempty" validate:"optional" example:"Living room PC"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty" validate:"optional" example:"Gaming PC below the TV"`
+	Tags        []string `json:"tags,omitempty" yaml:"tags,omitempty" validate:"optional" example:"gaming,windows"`
+	// One of HostIcons
+	Icon     string `json:"icon,omitempty" yaml:"icon,omitempty" validate:"optional" example:"desktop"`
+	Location string `json:"location,omitempty" yaml:"location,omitempty" validate:"optional" example:"Living room"`
+	// Arbitrary key/value pairs
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty" validate:"optional"`
+	// Remote site of the host, wakes are forwarded to the relay agent of the site instead of being sent locally
+	Site string `json:"site,omitempty" yaml:"site,omitempty" validate:"optional" example:"building-b"`
 }
 
 // Status of a host.
@@ -13,21 +33,31 @@ type HostStatus struct {
 	Address string `json:"address"`
 	Online  bool   `json:"online"`
 	Error   string `json:"error,omitempty"`
+	// Last time the host was seen online by this server, unset if it has not been seen yet
+	LastSeen time.Time `json:"lastSeen,omitzero"`
 }
 
 // StorageBackend is a concurrency safe interface for different methods of storing the configured hosts.
+// All methods should stop waiting for the storage when ctx is canceled.
 type StorageBackend interface {
 	// Add a new host, overwrite existing host name if it already exists.
 	// Ensures that the MAC address is unique and uppercase.
-	AddHost(host Host) error
+	AddHost(ctx context.Context, host Host) error
 	// Remove a host, ignore if the host does not exist
-	RemoveHost(mac string) error
+	RemoveHost(ctx context.Context, mac string) error
 	// Return the host name for a given MAC address, return empty if not found
-	GetHost(mac string) (Host, error)
+	GetHost(ctx context.Context, mac string) (Host, error)
 	// Return all hosts
-	GetHosts() ([]Host, error)
+	GetHosts(ctx context.Context) ([]Host, error)
+	// Move a host to the given index, the index is capped to the bounds of the list.
+	// Returns ErrHostNotFound if the host does not exist.
+	MoveHost(ctx context.Context, mac string, index int) error
+	// Sort the hosts by the given list of MAC addresses.
+	// Hosts not contained in the list keep their relative order after the listed hosts.
+	// Returns ErrHostNotFound if the list contains an unknown host.
+	ReorderHosts(ctx context.Context, macs []string) error
 	// Check if the storage backend is readonly
-	Readonly() (bool, error)
+	Readonly(ctx context.Context) (bool, error)
 }
 
 // Struct for reading hosts from a yaml file.
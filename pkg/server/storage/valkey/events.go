@@ -0,0 +1,84 @@
+package valkey
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/valkey-io/valkey-go"
+)
+
+const eventsChannel = "events"
+
+// Delay before subscribing again after losing the connection
+const (
+	minResubscribeDelay = time.Second
+	maxResubscribeDelay = time.Minute
+)
+
+// Message sent on the events channel
+type eventMessage struct {
+	// Instance that made the change
+	Origin string      `json:"origin"`
+	Event  types.Event `json:"event"`
+}
+
+// Send the event to all other instances using the same valkey server and prefix
+func (v *ValkeyBackend) PublishEvent(ctx context.Context, event types.Event) error {
+	data, err := json.Marshal(eventMessage{Origin: v.instance, Event: event})
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	err = v.client.Do(ctx, v.client.B().Publish().Channel(v.eventsChannel()).Message(string(data)).Build()).Error()
+	if err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+// Call handler for all events published by other instances, blocks until ctx is canceled.
+// Subscribes again after losing the connection, events sent in the meantime are lost.
+func (v *ValkeyBackend) SubscribeEvents(ctx context.Context, handler func(types.Event)) {
+	delay := minResubscribeDelay
+	for {
+		start := time.Now()
+		// Use a separate connection, so the subscription does not block other commands
+		err := v.client.Dedicated(func(c valkey.DedicatedClient) error {
+			return c.Receive(ctx, c.B().Subscribe().Channel(v.eventsChannel()).Build(), func(msg valkey.PubSubMessage) {
+				var message eventMessage
+				err := json.Unmarshal([]byte(msg.Message), &message)
+				if err != nil {
+					slog.Warn("Received invalid event from valkey", "err", err)
+					return
+				}
+				if message.Origin == v.instance {
+					return
+				}
+				handler(message.Event)
+			})
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(start) > maxResubscribeDelay {
+			delay = minResubscribeDelay
+		}
+		slog.Warn("Lost subscription to changes of other instances, subscribing again", slog.Duration("delay", delay), "err", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, maxResubscribeDelay)
+	}
+}
+
+// Return the channel for the events of all instances with the same prefix
+func (v *ValkeyBackend) eventsChannel() string {
+	return v.prefix + eventsChannel
+}
@@ -0,0 +1,58 @@
+package valkey
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvents(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	newBackend := func(prefix string) *ValkeyBackend {
+		v, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}, Prefix: prefix})
+		require.NoError(t, err, "Failed to create valkey backend")
+		return v
+	}
+	a := newBackend("")
+	b := newBackend("")
+	other := newBackend("other:")
+
+	// Subscribe all instances and collect the received events
+	ctx, cancel := context.WithCancel(t.Context())
+	received := make(map[*ValkeyBackend]chan types.Event)
+	for _, v := range []*ValkeyBackend{a, b, other} {
+		events := make(chan types.Event, 10)
+		received[v] = events
+		go v.SubscribeEvents(ctx, func(event types.Event) {
+			events <- event
+		})
+	}
+	t.Cleanup(cancel)
+	require.Eventually(t, func() bool {
+		return mr.PubSubNumSub("events")["events"] == 2 && mr.PubSubNumSub("other:events")["other:events"] == 1
+	}, 5*time.Second, 10*time.Millisecond, "Should subscribe")
+
+	event := types.NewEvent(types.EventHostUpdated, "AA:BB:CC:DD:EE:FF", &types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"})
+	require.NoError(t, a.PublishEvent(t.Context(), event), "Should publish event")
+
+	select {
+	case res := <-received[b]:
+		assert.Equal(t, event.ID, res.ID)
+		assert.Equal(t, event.Type, res.Type)
+		assert.Equal(t, event.Host, res.Host)
+		assert.True(t, event.Time.Equal(res.Time))
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "Other instance should receive the event")
+	}
+
+	// Give the remaining instances time to receive the event, should they wrongly do so
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, received[a], "Should ignore own events")
+	assert.Empty(t, received[other], "Should not receive events for other prefixes")
+}
@@ -0,0 +1,263 @@
+package valkey
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Certificates for a private CA, written to a temporary directory
+type testPKI struct {
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ca         *x509.Certificate
+	caKey      *ecdsa.PrivateKey
+	ServerCert tls.Certificate
+}
+
+// Create a CA with a server certificate for valkey.example.org and a client certificate.
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "go-wol test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	pki := &testPKI{ca: ca, caKey: caKey}
+	dir := t.TempDir()
+
+	pki.CAFile = filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(pki.CAFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600))
+
+	certPEM, keyPEM := pki.issue(t, 2, "valkey.example.org", x509.ExtKeyUsageServerAuth)
+	pki.ServerCert, err = tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+
+	certPEM, keyPEM = pki.issue(t, 3, "go-wol", x509.ExtKeyUsageClientAuth)
+	pki.CertFile = filepath.Join(dir, "client.crt")
+	pki.KeyFile = filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(pki.CertFile, certPEM, 0600))
+	require.NoError(t, os.WriteFile(pki.KeyFile, keyPEM, 0600))
+
+	return pki
+}
+
+// Issue a certificate signed by the CA, returns the PEM encoded certificate and key
+func (pki *testPKI) issue(t *testing.T, serial int64, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, pki.ca, &key.PublicKey, pki.caKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// Start a miniredis server with TLS, optionally requiring a client certificate signed by the CA
+func (pki *testPKI) runServer(t *testing.T, requireClientCert bool) *miniredis.Miniredis {
+	t.Helper()
+
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{pki.ServerCert},
+	}
+	if requireClientCert {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = x509.NewCertPool()
+		cfg.ClientCAs.AddCert(pki.ca)
+	}
+
+	mr, err := miniredis.RunTLS(cfg)
+	require.NoError(t, err, "Should start miniredis with tls")
+	t.Cleanup(mr.Close)
+	return mr
+}
+
+func TestTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	mr := pki.runServer(t, false)
+	mrClientCert := pki.runServer(t, true)
+
+	tMatrix := []struct {
+		Name   string
+		Server *miniredis.Miniredis
+		Config ValkeyConfig
+		Error  string
+	}{
+		{
+			Name:   "CAFile",
+			Server: mr,
+			Config: ValkeyConfig{TLS: true, TLSCAFile: pki.CAFile, TLSServerName: "valkey.example.org"},
+		},
+		{
+			Name:   "ClientCert",
+			Server: mrClientCert,
+			Config: ValkeyConfig{TLS: true, TLSCAFile: pki.CAFile, TLSServerName: "valkey.example.org", TLSCertFile: pki.CertFile, TLSKeyFile: pki.KeyFile},
+		},
+		{
+			Name:   "InsecureSkipVerify",
+			Server: mr,
+			Config: ValkeyConfig{TLS: true, TLSInsecureSkipVerify: true},
+		},
+		{
+			Name:   "UnknownCA",
+			Server: mr,
+			Config: ValkeyConfig{TLS: true, TLSServerName: "valkey.example.org"},
+			Error:  "failed to connect to valkey server",
+		},
+		{
+			Name:   "WrongServerName",
+			Server: mr,
+			Config: ValkeyConfig{TLS: true, TLSCAFile: pki.CAFile},
+			Error:  "failed to connect to valkey server",
+		},
+		{
+			Name:   "MissingClientCert",
+			Server: mrClientCert,
+			Config: ValkeyConfig{TLS: true, TLSCAFile: pki.CAFile, TLSServerName: "valkey.example.org"},
+			Error:  "failed to connect to valkey server",
+		},
+		{
+			Name:   "WithoutTLS",
+			Server: mr,
+			Error:  "failed to connect to valkey server",
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			cfg := tCase.Config
+			cfg.Addrs = []string{tCase.Server.Addr()}
+
+			v, err := NewValkeyBackend(cfg)
+			if tCase.Error != "" {
+				assert.ErrorContains(t, err, tCase.Error, "Should fail to connect")
+				assert.Nil(t, v, "Should not return backend")
+				return
+			}
+			require.NoError(t, err, "Should connect with tls")
+			t.Cleanup(v.client.Close)
+
+			assert.NoError(t, v.AddHost(t.Context(), types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"}), "Should use the connection")
+		})
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	pki := newTestPKI(t)
+	invalidFile := filepath.Join(t.TempDir(), "invalid.pem")
+	require.NoError(t, os.WriteFile(invalidFile, []byte("not a certificate"), 0600))
+	missingFile := filepath.Join(t.TempDir(), "missing.pem")
+
+	tMatrix := []struct {
+		Name   string
+		Config ValkeyConfig
+		Error  string
+	}{
+		{"Disabled", ValkeyConfig{}, ""},
+		{"OptionsWithoutTLS", ValkeyConfig{TLSCAFile: pki.CAFile}, "tls is not enabled"},
+		{"InsecureWithoutTLS", ValkeyConfig{TLSInsecureSkipVerify: true}, "tls is not enabled"},
+		{"MissingCAFile", ValkeyConfig{TLS: true, TLSCAFile: missingFile}, "failed to read tls ca file"},
+		{"InvalidCAFile", ValkeyConfig{TLS: true, TLSCAFile: invalidFile}, "no valid certificates found"},
+		{"CertWithoutKey", ValkeyConfig{TLS: true, TLSCertFile: pki.CertFile}, "both tls-cert-file and tls-key-file are needed"},
+		{"KeyWithoutCert", ValkeyConfig{TLS: true, TLSKeyFile: pki.KeyFile}, "both tls-cert-file and tls-key-file are needed"},
+		{"InvalidKey", ValkeyConfig{TLS: true, TLSCertFile: pki.CertFile, TLSKeyFile: invalidFile}, "failed to load tls client certificate"},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			tlsConfig, err := tCase.Config.tlsConfig()
+			if tCase.Error != "" {
+				assert.ErrorContains(t, err, tCase.Error, "Should return error")
+			} else {
+				assert.NoError(t, err, "Should not return error")
+			}
+			assert.Nil(t, tlsConfig, "Should not return tls config")
+		})
+	}
+
+	t.Run("Full", func(t *testing.T) {
+		assert := assert.New(t)
+
+		cfg := ValkeyConfig{TLS: true, TLSCAFile: pki.CAFile, TLSCertFile: pki.CertFile, TLSKeyFile: pki.KeyFile, TLSServerName: "valkey.example.org"}
+		tlsConfig, err := cfg.tlsConfig()
+		require.NoError(t, err, "Should create tls config")
+
+		assert.Equal(uint16(tls.VersionTLS12), tlsConfig.MinVersion, "Should require at least TLS 1.2")
+		assert.Equal("valkey.example.org", tlsConfig.ServerName, "Should set server name")
+		assert.False(tlsConfig.InsecureSkipVerify, "Should verify the server")
+		assert.NotNil(tlsConfig.RootCAs, "Should use the ca file")
+		assert.Len(tlsConfig.Certificates, 1, "Should contain the client certificate")
+	})
+}
+
+func TestPasswordFile(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireAuth("secret")
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("secret\n"), 0600))
+
+	t.Run("Success", func(t *testing.T) {
+		v, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}, PasswordFile: passwordFile})
+		require.NoError(t, err, "Should authenticate with the password from the file")
+		t.Cleanup(v.client.Close)
+	})
+
+	t.Run("WrongPassword", func(t *testing.T) {
+		wrongFile := filepath.Join(t.TempDir(), "password")
+		require.NoError(t, os.WriteFile(wrongFile, []byte("wrong"), 0600))
+
+		_, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}, PasswordFile: wrongFile})
+		assert.ErrorContains(t, err, "failed to connect to valkey server", "Should fail to authenticate")
+	})
+
+	t.Run("MissingFile", func(t *testing.T) {
+		_, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}, PasswordFile: filepath.Join(t.TempDir(), "missing")})
+		assert.ErrorContains(t, err, "failed to read password file", "Should return error")
+	})
+
+	t.Run("BothSet", func(t *testing.T) {
+		_, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}, Password: "secret", PasswordFile: passwordFile})
+		assert.ErrorContains(t, err, "only one of password and password-file can be set", "Should return error")
+	})
+}
@@ -1,7 +1,6 @@
 package valkey
 
 import (
-	"fmt"
 	"log/slog"
 	"strings"
 
@@ -9,21 +8,86 @@ import (
 )
 
 const (
-	keyName    = "name"
-	keyAddress = "address"
+	keyName        = "name"
+	keyAddress     = "address"
+	keyDisplayName = "displayName"
+	keyDescription = "description"
+	keyTags        = "tags"
+	keyIcon        = "icon"
+	keyLocation    = "location"
+	keyLabels      = "labels"
+	keySite        = "site"
 )
 
-// serialize the Host so it can be stored as a single value in Valkey.
-func serializeHost(host types.Host) string {
-	result := fmt.Sprintf("%s=%s;", keyName, host.Name)
-	if host.Address != "" {
-		result += fmt.Sprintf("%s=%s;", keyAddress, host.Address)
+// Serialize the Host into the field-value pairs of its hash in Valkey.
+// Empty fields are omitted, tags and labels are encoded as JSON.
+func serializeHost(host types.Host) []string {
+	fields := []string{keyName, host.Name}
+	for _, field := range [][2]string{
+		{keyAddress, host.Address},
+		{keyDisplayName, host.DisplayName},
+		{keyDescription, host.Description},
+		{keyTags, types.EncodeTags(host.Tags)},
+		{keyIcon, host.Icon},
+		{keyLocation, host.Location},
+		{keyLabels, types.EncodeLabels(host.Labels)},
+		{keySite, host.Site},
+	} {
+		if field[1] != "" {
+			fields = append(fields, field[0], field[1])
+		}
+	}
+	return fields
+}
+
+// Deserialize host back into it's parameters from the fields of its hash.
+// Falls back to the legacy value written by older versions when the hash does not exist,
+// in which case legacy is true and the host should be migrated.
+func deserializeHost(mac string, fields map[string]string, value string) (host types.Host, legacy bool) {
+	if len(fields) == 0 {
+		return deserializeLegacyHost(mac, value), true
+	}
+
+	host = types.Host{
+		MAC: mac,
+	}
+	for key, val := range fields {
+		switch key {
+		case keyName:
+			host.Name = val
+		case keyAddress:
+			host.Address = val
+		case keyDisplayName:
+			host.DisplayName = val
+		case keyDescription:
+			host.Description = val
+		case keyTags:
+			tags, err := types.DecodeTags(val)
+			if err != nil {
+				slog.Warn("Received invalid tags in host data from valkey", slog.String("mac", mac), "err", err)
+			}
+			host.Tags = tags
+		case keyIcon:
+			host.Icon = val
+		case keyLocation:
+			host.Location = val
+		case keyLabels:
+			labels, err := types.DecodeLabels(val)
+			if err != nil {
+				slog.Warn("Received invalid labels in host data from valkey", slog.String("mac", mac), "err", err)
+			}
+			host.Labels = labels
+		case keySite:
+			host.Site = val
+		default:
+			slog.Warn("Received unknown field in host data from valkey", slog.String("mac", mac), slog.String("field", key))
+		}
 	}
-	return result
+	return host, false
 }
 
-// Deserialize host back into it's parameters.
-func deserializeHost(mac, data string) types.Host {
+// Deserialize the legacy format, where the host was stored as a single value of key=value pairs separated by semicolons.
+func deserializeLegacyHost(mac, data string) types.Host {
 	keyvalues := strings.Split(data, ";")
 
 	host := types.Host{
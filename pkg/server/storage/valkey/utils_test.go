@@ -9,13 +9,94 @@ import (
 )
 
 func TestDeserializeHostBackwardsCompatibility(t *testing.T) {
+	tMatrix := []struct {
+		Name   string
+		Value  string
+		Result types.Host
+	}{
+		{
+			Name:   "NameOnly",
+			Value:  "TestHost",
+			Result: types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"},
+		},
+		{
+			Name:   "KeyValuePairs",
+			Value:  "name=TestHost;address=host.example.org;",
+			Result: types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost", Address: "host.example.org"},
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			result, legacy := deserializeHost(tCase.Result.MAC, nil, tCase.Value)
+			assert.Equal(tCase.Result, result, "Deserialized host should match original host")
+			assert.True(legacy, "Should report legacy format")
+		})
+	}
+}
+
+func TestSerializeHost(t *testing.T) {
 	assert := assert.New(t)
 
 	host := types.Host{
-		MAC:  "AA:BB:CC:DD:EE:FF",
-		Name: "TestHost",
+		MAC:     "AA:BB:CC:DD:EE:FF",
+		Name:    "Test;Host=1",
+		Address: "host.example.org;",
+	}
+
+	fields := serializeHost(host)
+	assert.Equal([]string{keyName, host.Name, keyAddress, host.Address}, fields, "Should serialize to field-value pairs")
+
+	fieldMap := make(map[string]string, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		fieldMap[fields[i]] = fields[i+1]
+	}
+	result, legacy := deserializeHost(host.MAC, fieldMap, "")
+	assert.Equal(host, result, "Should keep semicolons and equal signs in values")
+	assert.False(legacy, "Should not report legacy format")
+
+	host.Address = ""
+	assert.Equal([]string{keyName, host.Name}, serializeHost(host), "Should omit empty address")
+}
+
+func TestSerializeHostMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	host := types.Host{
+		MAC:         "AA:BB:CC:DD:EE:FF",
+		Name:        "TestHost",
+		DisplayName: "Test host",
+		Description: "Description",
+		Tags:        []string{"a", "b"},
+		Icon:        "server",
+		Location:    "Basement",
+		Labels:      map[string]string{"owner": "alice"},
+		Site:        "building-b",
+	}
+
+	fields := serializeHost(host)
+	assert.Equal([]string{
+		keyName, "TestHost",
+		keyDisplayName, "Test host",
+		keyDescription, "Description",
+		keyTags, `["a","b"]`,
+		keyIcon, "server",
+		keyLocation, "Basement",
+		keyLabels, `{"owner":"alice"}`,
+		keySite, "building-b",
+	}, fields, "Should serialize all metadata")
+
+	fieldMap := make(map[string]string, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		fieldMap[fields[i]] = fields[i+1]
 	}
+	result, _ := deserializeHost(host.MAC, fieldMap, "")
+	assert.Equal(host, result, "Should deserialize all metadata")
 
-	result := deserializeHost(host.MAC, host.Name)
-	assert.Equal(host, result, "Deserialized host should match original host")
+	fieldMap[keyTags] = "invalid"
+	result, _ = deserializeHost(host.MAC, fieldMap, "")
+	assert.Nil(result.Tags, "Should ignore invalid tags")
+	assert.Equal(host.Labels, result.Labels, "Should keep other fields")
 }
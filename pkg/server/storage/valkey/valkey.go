@@ -2,8 +2,12 @@ package valkey
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"log/slog"
+	"os"
 	"strings"
 	"time"
 
@@ -17,14 +21,32 @@ const defaultTimeout = 5 * time.Second
 
 type ValkeyBackend struct {
 	client valkey.Client
+	prefix string
+	// Random ID of this instance, to ignore its own events
+	instance string
 }
 
 type ValkeyConfig struct {
 	Addrs    []string `yaml:"addresses,omitempty"`
 	Username string   `yaml:"username,omitempty"`
 	Password string   `yaml:"password,omitempty"`
-	DB       int      `yaml:"db,omitempty"`
-	TLS      bool     `yaml:"tls,omitempty"`
+	// Read the password from a file instead, e.g. a mounted secret
+	PasswordFile string `yaml:"password-file,omitempty"`
+	DB           int    `yaml:"db,omitempty"`
+
+	// Options for TLS, the files need to be PEM encoded.
+	// Without a CA file, the system trust store is used.
+	TLS                   bool   `yaml:"tls,omitempty"`
+	TLSCAFile             string `yaml:"tls-ca-file,omitempty"`
+	TLSCertFile           string `yaml:"tls-cert-file,omitempty"`
+	TLSKeyFile            string `yaml:"tls-key-file,omitempty"`
+	TLSServerName         string `yaml:"tls-server-name,omitempty"`
+	TLSInsecureSkipVerify bool   `yaml:"tls-insecure-skip-verify,omitempty"`
+	// Prefix for all keys, allows multiple instances to share a database or cluster
+	Prefix string `yaml:"prefix,omitempty"`
+	// Move the hosts stored without a prefix to the prefix on startup, unless it is already in use.
+	// Only enable it when no other instance uses the database without a prefix, as their hosts are moved as well.
+	MigrateUnprefixed bool `yaml:"migrate-unprefixed,omitempty"`
 
 	// Options for sentinel
 	Sentinel  bool   `yaml:"sentinel,omitempty"`
@@ -32,19 +54,22 @@ type ValkeyConfig struct {
 }
 
 func NewValkeyBackend(cfg ValkeyConfig) (*ValkeyBackend, error) {
-	var client valkey.Client
-	var tlsConfig *tls.Config
-
-	if cfg.TLS {
-		tlsConfig = &tls.Config{
-			MinVersion: tls.VersionTLS12,
-		}
+	if cfg.MigrateUnprefixed && cfg.Prefix == "" {
+		return nil, fmt.Errorf("migrate-unprefixed needs a prefix to migrate the hosts to")
+	}
+	password, err := cfg.password()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
 	}
 
 	opt := valkey.ClientOption{
 		InitAddress: cfg.Addrs,
 		Username:    cfg.Username,
-		Password:    cfg.Password,
+		Password:    password,
 		SelectDB:    cfg.DB,
 		TLSConfig:   tlsConfig,
 
@@ -55,7 +80,8 @@ func NewValkeyBackend(cfg ValkeyConfig) (*ValkeyBackend, error) {
 		opt.Sentinel = valkey.SentinelOption{
 			MasterSet: cfg.MasterSet,
 			Username:  cfg.Username,
-			Password:  cfg.Password,
+			Password:  password,
+			TLSConfig: tlsConfig,
 		}
 	}
 
@@ -63,114 +89,433 @@ func NewValkeyBackend(cfg ValkeyConfig) (*ValkeyBackend, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to valkey server: %w", err)
 	}
+	// The client connects to a cluster automatically, which only supports the default database
+	if client.Mode() == valkey.ClientModeCluster && cfg.DB != 0 {
+		client.Close()
+		return nil, fmt.Errorf("valkey cluster does not support selecting a database")
+	}
 
-	return &ValkeyBackend{
-		client: client,
-	}, nil
-}
+	v := &ValkeyBackend{
+		client:   client,
+		prefix:   cfg.Prefix,
+		instance: rand.Text(),
+	}
 
-// Add a new host, overwrite existing host name if it already exists.
-// Ensures that the MAC address is unique and uppercase.
-func (v *ValkeyBackend) AddHost(host types.Host) error {
-	host.MAC = strings.ToUpper(host.MAC)
-	value := serializeHost(host)
+	if cfg.MigrateUnprefixed {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		defer cancel()
 
-	cmdAdd := v.client.B().Set().Key(host.MAC).Value(value).Build()
-	cmdZadd := v.client.B().Zadd().Key(hostsListKey).Nx().ScoreMember().ScoreMember(float64(time.Now().UnixNano()), host.MAC).Build()
+		err = v.migrateUnprefixed(ctx)
+		if err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed to migrate hosts to prefix: %w", err)
+		}
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
-	defer cancel()
+	return v, nil
+}
+
+// Return the configured password, read from the password file if given.
+func (cfg ValkeyConfig) password() (string, error) {
+	if cfg.PasswordFile == "" {
+		return cfg.Password, nil
+	}
+	if cfg.Password != "" {
+		return "", fmt.Errorf("only one of password and password-file can be set")
+	}
 
-	err := v.client.Do(ctx, cmdAdd).Error()
+	data, err := os.ReadFile(cfg.PasswordFile)
 	if err != nil {
-		return fmt.Errorf("failed to set host: %w", err)
+		return "", fmt.Errorf("failed to read password file: %w", err)
 	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Return the TLS configuration, nil when TLS is disabled.
+func (cfg ValkeyConfig) tlsConfig() (*tls.Config, error) {
+	if !cfg.TLS {
+		if cfg.TLSCAFile != "" || cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" || cfg.TLSServerName != "" || cfg.TLSInsecureSkipVerify {
+			return nil, fmt.Errorf("tls options are set, but tls is not enabled")
+		}
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.TLSServerName,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify, // #nosec G402 -- Needs to be enabled explicitly by the user.
+	}
+	if cfg.TLSInsecureSkipVerify {
+		slog.Warn("Not verifying the certificate of the valkey server, the connection is not secure")
+	}
+
+	if cfg.TLSCAFile != "" {
+		ca, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls ca file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no valid certificates found in tls ca file '%s'", cfg.TLSCAFile)
+		}
+	}
+
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+			return nil, fmt.Errorf("both tls-cert-file and tls-key-file are needed for a client certificate")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tls client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// Add a new host, overwrite existing host name if it already exists.
+// Ensures that the MAC address is unique and uppercase.
+func (v *ValkeyBackend) AddHost(ctx context.Context, host types.Host) error {
+	host.MAC = strings.ToUpper(host.MAC)
 
-	err = v.client.Do(ctx, cmdZadd).Error()
+	// Replace the hash instead of updating it, so that unset fields are removed
+	err := v.transaction(ctx,
+		v.client.B().Del().Key(v.hostKey(host.MAC)).Build(),
+		v.hsetHost(v.client.B(), host),
+		v.client.B().Zadd().Key(v.listKey()).Nx().ScoreMember().ScoreMember(float64(time.Now().UnixNano()), host.MAC).Build(),
+	)
 	if err != nil {
-		return fmt.Errorf("failed to add host to list: %w", err)
+		return fmt.Errorf("failed to add host: %w", err)
 	}
 
+	v.deleteLegacyHost(ctx, host.MAC)
 	return nil
 }
 
 // Remove a host, ignore if the host does not exist
-func (v *ValkeyBackend) RemoveHost(mac string) error {
+func (v *ValkeyBackend) RemoveHost(ctx context.Context, mac string) error {
 	mac = strings.ToUpper(mac)
 
-	cmdDel := v.client.B().Del().Key(mac).Build()
-	cmdZrem := v.client.B().Zrem().Key(hostsListKey).Member(mac).Build()
+	err := v.transaction(ctx,
+		v.client.B().Zrem().Key(v.listKey()).Member(mac).Build(),
+		v.client.B().Del().Key(v.hostKey(mac)).Build(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to remove host: %w", err)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
-	defer cancel()
+	v.deleteLegacyHost(ctx, mac)
+	return nil
+}
 
-	err := v.client.Do(ctx, cmdZrem).Error()
-	if err != nil {
-		return fmt.Errorf("failed to remove host from list: %w", err)
+// Return the host name for a given MAC address, return empty if not found
+func (v *ValkeyBackend) GetHost(ctx context.Context, mac string) (types.Host, error) {
+	mac = strings.ToUpper(mac)
+
+	hosts, err := v.getHostsData(ctx, []string{mac})
+	if err != nil || len(hosts) == 0 {
+		return types.Host{}, err
 	}
+	return hosts[0], nil
+}
 
-	err = v.client.Do(ctx, cmdDel).Error()
+// Return all hosts
+func (v *ValkeyBackend) GetHosts(ctx context.Context) ([]types.Host, error) {
+	macs, err := v.getHostsList(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to delete host, but already removed host from list: %w", err)
+		return nil, err
 	}
 
-	return nil
+	return v.getHostsData(ctx, macs)
 }
 
-// Return the host name for a given MAC address, return empty if not found
-func (v *ValkeyBackend) GetHost(mac string) (types.Host, error) {
-	mac = strings.ToUpper(mac)
+// Move a host to the given index, the index is capped to the bounds of the list.
+// Returns ErrHostNotFound if the host does not exist.
+func (v *ValkeyBackend) MoveHost(ctx context.Context, mac string, index int) error {
+	macs, err := v.getHostsList(ctx)
+	if err != nil {
+		return err
+	}
 
-	cmdGet := v.client.B().Get().Key(mac).Build()
+	order, err := types.MoveToIndex(macs, mac, index)
+	if err != nil {
+		return err
+	}
+	return v.setHostsOrder(ctx, order)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
-	defer cancel()
+// Sort the hosts by the given list of MAC addresses.
+// Hosts not contained in the list keep their relative order after the listed hosts.
+// Returns ErrHostNotFound if the list contains an unknown host.
+func (v *ValkeyBackend) ReorderHosts(ctx context.Context, macs []string) error {
+	current, err := v.getHostsList(ctx)
+	if err != nil {
+		return err
+	}
 
-	val, err := v.client.Do(ctx, cmdGet).ToString()
+	order, err := types.ApplyOrder(current, macs)
 	if err != nil {
-		return types.Host{}, fmt.Errorf("failed to get host: %w", err)
+		return err
 	}
-	return deserializeHost(mac, val), nil
+	return v.setHostsOrder(ctx, order)
 }
 
-// Return all hosts
-func (v *ValkeyBackend) GetHosts() ([]types.Host, error) {
-	cmdZrange := v.client.B().Zrange().Key(hostsListKey).Min("0").Max("-1").Build()
+// Check if the storage backend is readonly
+func (v *ValkeyBackend) Readonly(_ context.Context) (bool, error) {
+	// You can configure valkey to be readonly via ACL, or connect against a replica.
+	// However i do not know how to reliably check if the connection is readonly.
+	// Instead of hoping that no network error occurs on startup, we just default to assume we can write.
+	return false, nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
-	defer cancel()
+// Return the MAC addresses of all hosts in their current order.
+func (v *ValkeyBackend) getHostsList(ctx context.Context) ([]string, error) {
+	cmdZrange := v.client.B().Zrange().Key(v.listKey()).Min("0").Max("-1").Build()
 
 	macs, err := v.client.Do(ctx, cmdZrange).AsStrSlice()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get known hosts list: %w", err)
 	}
+	return macs, nil
+}
 
-	res, err := valkey.MGet(v.client, ctx, macs)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get host names: %w", err)
+// Return the data of the given hosts, skipping hosts without any data.
+// Hosts stored in the legacy format are migrated to a hash.
+func (v *ValkeyBackend) getHostsData(ctx context.Context, macs []string) ([]types.Host, error) {
+	if len(macs) == 0 {
+		return []types.Host{}, nil
 	}
 
-	hosts := make([]types.Host, 0, len(macs))
+	// Read the legacy value first, so a concurrent migration can't hide the host.
+	// Older versions did not support a prefix, so there are no legacy values with one.
+	cmds := make(valkey.Commands, 0, 2*len(macs))
 	for _, mac := range macs {
-		val, ok := res[mac]
-		if !ok {
-			return nil, fmt.Errorf("MAC address '%s' is in list but no value is found", mac)
+		if v.prefix == "" {
+			cmds = append(cmds, v.client.B().Get().Key(mac).Build())
 		}
+		cmds = append(cmds, v.client.B().Hgetall().Key(v.hostKey(mac)).Build())
+	}
+	res := v.client.DoMulti(ctx, cmds...)
 
-		hostStr, err := val.ToString()
+	hosts := make([]types.Host, 0, len(macs))
+	for _, mac := range macs {
+		var value string
+		if v.prefix == "" {
+			var err error
+			value, err = res[0].ToString()
+			if err != nil && !valkey.IsValkeyNil(err) {
+				return nil, fmt.Errorf("failed to get host: %w", err)
+			}
+			res = res[1:]
+		}
+		fields, err := res[0].AsStrMap()
 		if err != nil {
-			return nil, fmt.Errorf("failed to convert response value value to string: %w", err)
+			return nil, fmt.Errorf("failed to get host: %w", err)
 		}
+		res = res[1:]
 
-		hosts = append(hosts, deserializeHost(mac, hostStr))
+		if len(fields) == 0 && value == "" {
+			slog.Debug("Host has no data, it might have been removed", slog.String("mac", mac))
+			continue
+		}
+
+		host, legacy := deserializeHost(mac, fields, value)
+		if legacy {
+			v.migrateHost(ctx, host)
+		}
+		hosts = append(hosts, host)
 	}
 	return hosts, nil
 }
 
-// Check if the storage backend is readonly
-func (v *ValkeyBackend) Readonly() (bool, error) {
-	// You can configure valkey to be readonly via ACL, or connect against a replica.
-	// However i do not know how to reliably check if the connection is readonly.
-	// Instead of hoping that no network error occurs on startup, we just default to assume we can write.
-	return false, nil
+// Store the host as a hash instead of the legacy value.
+// Skipped when the host has been changed or removed in the meantime.
+// Failures are only logged, the host is migrated again on the next read.
+func (v *ValkeyBackend) migrateHost(ctx context.Context, host types.Host) {
+	aborted, removed := false, false
+	err := v.client.Dedicated(func(c valkey.DedicatedClient) error {
+		for _, key := range []string{v.hostKey(host.MAC), v.listKey()} {
+			err := c.Do(ctx, c.B().Watch().Key(key).Build()).Error()
+			if err != nil {
+				return err
+			}
+		}
+
+		res := c.DoMulti(ctx,
+			c.B().Exists().Key(v.hostKey(host.MAC)).Build(),
+			c.B().Zscore().Key(v.listKey()).Member(host.MAC).Build(),
+		)
+		exists, err := res[0].AsBool()
+		if err != nil {
+			return err
+		}
+		err = res[1].Error()
+		if exists || valkey.IsValkeyNil(err) {
+			removed = !exists
+			return c.Do(ctx, c.B().Unwatch().Build()).Error()
+		} else if err != nil {
+			return err
+		}
+
+		// The transaction is aborted on concurrent changes
+		res = c.DoMulti(ctx,
+			c.B().Multi().Build(),
+			v.hsetHost(c.B(), host),
+			c.B().Exec().Build(),
+		)
+		err = res[len(res)-1].Error()
+		if valkey.IsValkeyNil(err) {
+			aborted = true
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		slog.Warn("Failed to migrate host from legacy format", slog.String("mac", host.MAC), "err", err)
+		return
+	} else if aborted {
+		slog.Debug("Host has been changed while migrating from legacy format", slog.String("mac", host.MAC))
+		return
+	} else if removed {
+		slog.Debug("Host has been removed while migrating from legacy format", slog.String("mac", host.MAC))
+		return
+	}
+
+	v.deleteLegacyHost(ctx, host.MAC)
+	slog.Debug("Migrated host from legacy format", slog.String("mac", host.MAC))
+}
+
+// Delete the value of the host written by older versions.
+// It is ignored when the hash of the host exists, so failures are only logged.
+func (v *ValkeyBackend) deleteLegacyHost(ctx context.Context, mac string) {
+	if v.prefix != "" {
+		return
+	}
+
+	err := v.client.Do(ctx, v.client.B().Del().Key(mac).Build()).Error()
+	if err != nil {
+		slog.Warn("Failed to delete host in legacy format", slog.String("mac", mac), "err", err)
+	}
+}
+
+// Move the hosts stored without a prefix to the prefix, unless it is already in use by another instance.
+// The hosts keep their order.
+func (v *ValkeyBackend) migrateUnprefixed(ctx context.Context) error {
+	unprefixed := &ValkeyBackend{client: v.client}
+
+	macs, err := unprefixed.getHostsList(ctx)
+	if err != nil || len(macs) == 0 {
+		return err
+	}
+	hosts, err := unprefixed.getHostsData(ctx, macs)
+	if err != nil {
+		return err
+	}
+
+	migrated := false
+	err = v.client.Dedicated(func(c valkey.DedicatedClient) error {
+		err := c.Do(ctx, c.B().Watch().Key(v.listKey()).Build()).Error()
+		if err != nil {
+			return err
+		}
+		exists, err := c.Do(ctx, c.B().Exists().Key(v.listKey()).Build()).AsBool()
+		if err != nil {
+			return err
+		}
+		if exists {
+			return c.Do(ctx, c.B().Unwatch().Build()).Error()
+		}
+
+		cmds := make(valkey.Commands, 0, 2*len(hosts)+3)
+		cmds = append(cmds, c.B().Multi().Build())
+		zadd := c.B().Zadd().Key(v.listKey()).ScoreMember()
+		for i, host := range hosts {
+			cmds = append(cmds, c.B().Del().Key(v.hostKey(host.MAC)).Build(), v.hsetHost(c.B(), host))
+			zadd = zadd.ScoreMember(float64(i), host.MAC)
+		}
+		cmds = append(cmds, zadd.Build(), c.B().Exec().Build())
+
+		// The transaction is aborted when another instance migrates the hosts at the same time
+		err = c.DoMulti(ctx, cmds...)[len(cmds)-1].Error()
+		if valkey.IsValkeyNil(err) {
+			return nil
+		}
+		migrated = err == nil
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !migrated {
+		slog.Info("Prefix is already in use, ignoring hosts stored without prefix", slog.String("prefix", v.prefix))
+		return nil
+	}
+
+	for _, host := range hosts {
+		err = unprefixed.RemoveHost(ctx, host.MAC)
+		if err != nil {
+			return err
+		}
+	}
+	slog.Info("Migrated hosts stored without prefix", slog.String("prefix", v.prefix), slog.Int("count", len(hosts)))
+	return nil
+}
+
+// Overwrite the scores of the hosts in the list with their index in order.
+// Only updates existing members, so hosts removed in the meantime are not added again.
+// New hosts are scored by their creation time and will therefore be sorted after the reordered hosts.
+func (v *ValkeyBackend) setHostsOrder(ctx context.Context, order []string) error {
+	if len(order) == 0 {
+		return nil
+	}
+
+	cmd := v.client.B().Zadd().Key(v.listKey()).Xx().ScoreMember()
+	for i, mac := range order {
+		cmd = cmd.ScoreMember(float64(i), mac)
+	}
+
+	err := v.client.Do(ctx, cmd.Build()).Error()
+	if err != nil {
+		return fmt.Errorf("failed to update order of hosts: %w", err)
+	}
+	return nil
+}
+
+// Run the commands atomically in a MULTI/EXEC block
+func (v *ValkeyBackend) transaction(ctx context.Context, cmds ...valkey.Completed) error {
+	multi := make(valkey.Commands, 0, len(cmds)+2)
+	multi = append(multi, v.client.B().Multi().Build())
+	multi = append(multi, cmds...)
+	multi = append(multi, v.client.B().Exec().Build())
+
+	for _, res := range v.client.DoMulti(ctx, multi...) {
+		err := res.Error()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Build the command to store the host in its hash
+func (v *ValkeyBackend) hsetHost(b valkey.Builder, host types.Host) valkey.Completed {
+	cmd := b.Hset().Key(v.hostKey(host.MAC)).FieldValue()
+	fields := serializeHost(host)
+	for i := 0; i < len(fields); i += 2 {
+		cmd = cmd.FieldValue(fields[i], fields[i+1])
+	}
+	return cmd.Build()
+}
+
+// Return the key of the sorted set containing the MAC addresses of all hosts
+func (v *ValkeyBackend) listKey() string {
+	return v.prefix + hostsListKey
+}
+
+// Return the key of the hash containing the data of the host.
+// Older versions stored it as a string under the MAC address itself.
+// The hash tag ensures that it is in the same slot as the hosts list, so both can be changed in a transaction in a cluster.
+func (v *ValkeyBackend) hostKey(mac string) string {
+	return "{" + v.listKey() + "}:host:" + mac
 }
@@ -1,6 +1,8 @@
 package valkey
 
 import (
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/alicebob/miniredis/v2"
@@ -8,6 +10,7 @@ import (
 	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/valkey-io/valkey-go"
 )
 
 var newMiniredis testsuite.StorageBackendFactory = func(t *testing.T, _ string) types.StorageBackend {
@@ -51,6 +54,198 @@ func TestNewValkeyBackend(t *testing.T) {
 	})
 }
 
+func TestHashSchema(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	mr := miniredis.RunT(t)
+
+	v, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}})
+	require.NoError(err, "Failed to create valkey backend")
+
+	host := types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "Test;Host", Address: "host.example.org"}
+	require.NoError(v.AddHost(t.Context(), host))
+
+	assert.Equal(host.Name, mr.HGet(v.hostKey(host.MAC), keyName), "Should store the name in the hash")
+	assert.Equal(host.Address, mr.HGet(v.hostKey(host.MAC), keyAddress), "Should store the address in the hash")
+
+	host.Address = ""
+	require.NoError(v.AddHost(t.Context(), host))
+	fields, err := mr.HKeys(v.hostKey(host.MAC))
+	require.NoError(err)
+	assert.Equal([]string{keyName}, fields, "Should remove fields that are no longer set")
+
+	require.NoError(v.RemoveHost(t.Context(), host.MAC))
+	assert.Empty(mr.Keys(), "Should remove all keys of the host")
+}
+
+func TestLegacyMigration(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	mr := miniredis.RunT(t)
+
+	require.NoError(mr.Set("AA:BB:CC:DD:EE:FF", "TestHost1"))
+	require.NoError(mr.Set("11:22:33:44:55:66", "name=TestHost2;address=host.example.org;"))
+	_, err := mr.ZAdd(hostsListKey, 1, "AA:BB:CC:DD:EE:FF")
+	require.NoError(err)
+	_, err = mr.ZAdd(hostsListKey, 2, "11:22:33:44:55:66")
+	require.NoError(err)
+	// Orphan left behind by older versions that did not change the data atomically
+	_, err = mr.ZAdd(hostsListKey, 3, "77:88:99:AA:BB:CC")
+	require.NoError(err)
+
+	v, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}})
+	require.NoError(err, "Failed to create valkey backend")
+
+	expected := []types.Host{
+		{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost1"},
+		{MAC: "11:22:33:44:55:66", Name: "TestHost2", Address: "host.example.org"},
+	}
+	hosts, err := v.GetHosts(t.Context())
+	require.NoError(err, "Should read legacy hosts and ignore hosts without data")
+	assert.Equal(expected, hosts, "Should return the legacy hosts")
+
+	assert.False(mr.Exists("AA:BB:CC:DD:EE:FF"), "Should remove the legacy value")
+	assert.False(mr.Exists("11:22:33:44:55:66"), "Should remove the legacy value")
+	assert.Equal("host.example.org", mr.HGet(v.hostKey("11:22:33:44:55:66"), keyAddress), "Should migrate the host to a hash")
+
+	hosts, err = v.GetHosts(t.Context())
+	require.NoError(err)
+	assert.Equal(expected, hosts, "Should return the migrated hosts")
+
+	host, err := v.GetHost(t.Context(), "aa:bb:cc:dd:ee:ff")
+	require.NoError(err)
+	assert.Equal(expected[0], host, "Should get a single migrated host")
+}
+
+func TestLegacyMigrationRemovedHost(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	mr := miniredis.RunT(t)
+
+	v, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}})
+	require.NoError(err, "Failed to create valkey backend")
+
+	// The host has been removed from the list after it was read
+	require.NoError(mr.Set("AA:BB:CC:DD:EE:FF", "TestHost"))
+	v.migrateHost(t.Context(), types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"})
+
+	assert.False(mr.Exists(v.hostKey("AA:BB:CC:DD:EE:FF")), "Should not migrate the removed host")
+	assert.True(mr.Exists("AA:BB:CC:DD:EE:FF"), "Should not touch the legacy value of the removed host")
+}
+
+func TestPrefix(t *testing.T) {
+	t.Run("Keys", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		mr := miniredis.RunT(t)
+
+		v, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}, Prefix: "go-wol:"})
+		require.NoError(err, "Failed to create valkey backend")
+		require.NoError(v.AddHost(t.Context(), types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"}))
+
+		assert.ElementsMatch([]string{"go-wol:hosts", "{go-wol:hosts}:host:AA:BB:CC:DD:EE:FF"}, mr.Keys(), "Should prefix all keys")
+	})
+
+	t.Run("MigrateUnprefixed", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		mr := miniredis.RunT(t)
+
+		unprefixed, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}})
+		require.NoError(err, "Failed to create valkey backend")
+		require.NoError(unprefixed.AddHost(t.Context(), types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost1"}))
+		require.NoError(mr.Set("11:22:33:44:55:66", "name=TestHost2;address=host.example.org;"))
+		_, err = mr.ZAdd(hostsListKey, 0, "11:22:33:44:55:66")
+		require.NoError(err)
+
+		v, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}, Prefix: "go-wol:", MigrateUnprefixed: true})
+		require.NoError(err, "Should migrate hosts to the prefix")
+
+		expected := []types.Host{
+			{MAC: "11:22:33:44:55:66", Name: "TestHost2", Address: "host.example.org"},
+			{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost1"},
+		}
+		hosts, err := v.GetHosts(t.Context())
+		require.NoError(err)
+		assert.Equal(expected, hosts, "Should keep the hosts and their order")
+
+		for _, key := range mr.Keys() {
+			assert.True(strings.HasPrefix(key, "go-wol:") || strings.HasPrefix(key, "{go-wol:"), "Should remove key %s without prefix", key)
+		}
+
+		other, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}, Prefix: "other:", MigrateUnprefixed: true})
+		require.NoError(err, "Failed to create valkey backend")
+		hosts, err = other.GetHosts(t.Context())
+		require.NoError(err)
+		assert.Empty(hosts, "Should only migrate the hosts once")
+	})
+
+	t.Run("KeepUnprefixedByDefault", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		mr := miniredis.RunT(t)
+
+		unprefixed, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}})
+		require.NoError(err, "Failed to create valkey backend")
+		require.NoError(unprefixed.AddHost(t.Context(), types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost1"}))
+
+		v, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}, Prefix: "go-wol:"})
+		require.NoError(err, "Failed to create valkey backend")
+		hosts, err := v.GetHosts(t.Context())
+		require.NoError(err)
+		assert.Empty(hosts, "Should not migrate without migrate-unprefixed")
+
+		hosts, err = unprefixed.GetHosts(t.Context())
+		require.NoError(err)
+		assert.Equal([]types.Host{{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost1"}}, hosts, "Should keep the hosts of the instance without prefix")
+	})
+
+	t.Run("MigrateWithoutPrefix", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+
+		v, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}, MigrateUnprefixed: true})
+		assert.ErrorContains(t, err, "needs a prefix", "Should require a prefix")
+		assert.Nil(t, v)
+	})
+
+	t.Run("PrefixInUse", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		mr := miniredis.RunT(t)
+
+		v, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}, Prefix: "go-wol:"})
+		require.NoError(err, "Failed to create valkey backend")
+		require.NoError(v.AddHost(t.Context(), types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost1"}))
+
+		unprefixed, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}})
+		require.NoError(err, "Failed to create valkey backend")
+		require.NoError(unprefixed.AddHost(t.Context(), types.Host{MAC: "11:22:33:44:55:66", Name: "TestHost2"}))
+
+		v, err = NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}, Prefix: "go-wol:", MigrateUnprefixed: true})
+		require.NoError(err, "Failed to create valkey backend")
+		hosts, err := v.GetHosts(t.Context())
+		require.NoError(err)
+		assert.Equal([]types.Host{{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost1"}}, hosts, "Should not merge hosts without prefix")
+
+		hosts, err = unprefixed.GetHosts(t.Context())
+		require.NoError(err)
+		assert.Len(hosts, 1, "Should keep hosts without prefix")
+	})
+}
+
+func TestCluster(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	// miniredis reports itself as a single node cluster
+	v, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}})
+	require.NoError(t, err, "Failed to create valkey backend")
+	assert.Equal(t, valkey.ClientModeCluster, v.client.Mode(), "Should connect to a cluster")
+
+	v, err = NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}, DB: 1})
+	assert.ErrorContains(t, err, "valkey cluster does not support selecting a database")
+	assert.Nil(t, v, "Should not return backend")
+}
+
 func TestFileTestsuiteBasic(t *testing.T) {
 	testsuite.RunStorageBackendTests(t, newMiniredis)
 }
@@ -58,3 +253,31 @@ func TestFileTestsuiteBasic(t *testing.T) {
 func TestFileTestsuiteRace(t *testing.T) {
 	testsuite.RunStorageBackendRaceTests(t, newMiniredis)
 }
+
+func TestValkeyTestsuiteIsolation(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	testsuite.RunStorageBackendIsolationTests(t, func(t *testing.T, name string) types.StorageBackend {
+		t.Helper()
+
+		v, err := NewValkeyBackend(ValkeyConfig{Addrs: []string{mr.Addr()}, Prefix: name + ":"})
+		require.NoError(t, err, "Failed to create valkey backend")
+		return v
+	})
+}
+
+func TestCanceledContext(t *testing.T) {
+	v := newMiniredis(t, "").(*ValkeyBackend)
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	err := v.AddHost(ctx, types.Host{MAC: "AA:BB:CC:DD:EE:FF", Name: "TestHost"})
+	assert.ErrorIs(t, err, context.Canceled, "Should not add host")
+
+	_, err = v.GetHosts(ctx)
+	assert.ErrorIs(t, err, context.Canceled, "Should not get hosts")
+
+	hosts, err := v.GetHosts(t.Context())
+	assert.NoError(t, err, "Should get hosts")
+	assert.Empty(t, hosts, "Should not have added host")
+}
@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/heathcliff26/go-wol/pkg/version"
+)
+
+const (
+	// Header containing the HMAC-SHA256 signature of the body, when a secret is configured
+	SignatureHeader = "X-Go-Wol-Signature"
+	// Header containing the type of the event
+	EventHeader = "X-Go-Wol-Event"
+
+	requestTimeout = 10 * time.Second
+)
+
+// Webhook receiving all changes to the hosts
+type Config struct {
+	URL string `yaml:"url"`
+	// Sign the body with HMAC-SHA256, the signature is sent as "sha256=<hex>" in the X-Go-Wol-Signature header
+	Secret string `yaml:"secret,omitempty"`
+}
+
+// Sends events to the configured webhooks
+type Sender struct {
+	hooks  []Config
+	client *http.Client
+}
+
+func NewSender(hooks []Config) (*Sender, error) {
+	for i, hook := range hooks {
+		u, err := url.Parse(hook.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url for webhook %d: %w", i, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid url for webhook %d: needs to be an absolute http or https url", i)
+		}
+	}
+
+	return &Sender{
+		hooks: hooks,
+		client: &http.Client{
+			Timeout: requestTimeout,
+		},
+	}, nil
+}
+
+// Send all events to the webhooks until the channel is closed.
+// Failed deliveries are logged and not retried.
+func (s *Sender) Run(events <-chan types.Event) {
+	for event := range events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			slog.Error("Failed to marshal event for webhooks", "err", err)
+			continue
+		}
+
+		for _, hook := range s.hooks {
+			err := s.send(hook, event, body)
+			if err != nil {
+				slog.Warn("Failed to send event to webhook", slog.String("url", hook.URL), slog.String("type", string(event.Type)), "err", err)
+			}
+		}
+	}
+}
+
+// Post the event to the webhook
+func (s *Sender) send(hook Config, event types.Event, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", version.Name+"/"+version.Version())
+	req.Header.Set(EventHeader, string(event.Type))
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// Return the signature of the body for the X-Go-Wol-Signature header
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
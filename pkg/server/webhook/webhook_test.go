@@ -0,0 +1,128 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type request struct {
+	Header http.Header
+	Body   []byte
+}
+
+// Start a webhook receiver returning the given status code
+func newReceiver(t *testing.T, status int) (string, <-chan request) {
+	t.Helper()
+
+	requests := make(chan request, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{Header: r.Header, Body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.URL, requests
+}
+
+func receive(t *testing.T, requests <-chan request) request {
+	t.Helper()
+
+	select {
+	case req := <-requests:
+		return req
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "Should receive request")
+		return request{}
+	}
+}
+
+func TestNewSender(t *testing.T) {
+	tMatrix := []struct {
+		Name  string
+		URL   string
+		Error bool
+	}{
+		{"HTTP", "http://example.org/hook", false},
+		{"HTTPS", "https://example.org:8443/hook?token=abc", false},
+		{"Relative", "/hook", true},
+		{"MissingHost", "http:///hook", true},
+		{"OtherScheme", "ftp://example.org/hook", true},
+		{"Invalid", "http://[::1", true},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			s, err := NewSender([]Config{{URL: "http://example.org"}, {URL: tCase.URL}})
+			if tCase.Error {
+				assert.ErrorContains(t, err, "invalid url for webhook 1", "Should return error")
+				assert.Nil(t, s, "Should not return sender")
+			} else {
+				assert.NoError(t, err, "Should accept url")
+				assert.NotNil(t, s, "Should return sender")
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+
+	failingURL, failing := newReceiver(t, http.StatusInternalServerError)
+	unsignedURL, unsigned := newReceiver(t, http.StatusOK)
+	signedURL, signed := newReceiver(t, http.StatusNoContent)
+
+	s, err := NewSender([]Config{
+		{URL: failingURL},
+		{URL: unsignedURL},
+		{URL: signedURL, Secret: "secret"},
+	})
+	require.NoError(t, err, "Should create sender")
+
+	events := make(chan types.Event, 2)
+	done := make(chan struct{})
+	go func() {
+		s.Run(events)
+		close(done)
+	}()
+
+	first := types.NewEvent(types.EventHostRemoved, "AA:BB:CC:DD:EE:FF", nil)
+	second := types.NewEvent(types.EventHostsReordered, "", nil)
+	events <- first
+	events <- second
+	close(events)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "Should stop after the channel is closed")
+	}
+
+	for _, expected := range []types.Event{first, second} {
+		receive(t, failing)
+
+		req := receive(t, unsigned)
+		var event types.Event
+		assert.NoError(json.Unmarshal(req.Body, &event), "Should send the event as json")
+		assert.Equal(expected.ID, event.ID, "Should send events in order, even after failures")
+		assert.Equal("application/json", req.Header.Get("Content-Type"))
+		assert.Equal(string(expected.Type), req.Header.Get(EventHeader), "Should send the event type")
+		assert.Empty(req.Header.Get(SignatureHeader), "Should not sign without secret")
+
+		req = receive(t, signed)
+		assert.Equal(Sign("secret", req.Body), req.Header.Get(SignatureHeader), "Should sign the body")
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '{"test":true}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=3d286aded37566af78d3a9e37d83623c3abd9e7af955e386232717707db10ba8", Sign("secret", []byte(`{"test":true}`)))
+}
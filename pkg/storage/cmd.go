@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+const flagNameEnv = "env"
+
+// Create new command for managing the storage of the server
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "storage",
+		Short: "Manage the storage backends of the server",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.Help()
+		},
+	}
+
+	cmd.PersistentFlags().Bool(flagNameEnv, false, "Expand enviroment variables in the config files")
+
+	cmd.AddCommand(
+		newMigrateCommand(),
+	)
+
+	return cmd
+}
+
+// Print the error information on stderr and exit with code 1
+func exitError(cmd *cobra.Command, err error) {
+	fmt.Fprintln(cmd.Root().ErrOrStderr(), "Fatal: "+err.Error())
+	os.Exit(1)
+}
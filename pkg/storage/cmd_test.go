@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testHostsYAML = `hosts:
+    - mac: "00:00:00:00:00:22"
+      name: Host2
+      address: 192.0.2.2
+    - mac: "00:00:00:00:00:11"
+      name: Host1
+`
+
+// Create a server config using the given storage configuration
+func newTestConfig(t *testing.T, storage string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("storage:\n"+storage), 0644), "Should write config file")
+	return path
+}
+
+// Create a config using a file storage with the given content, returns the path of the config and the storage file.
+func newFileConfig(t *testing.T, hosts string) (string, string) {
+	t.Helper()
+
+	storagePath := filepath.Join(t.TempDir(), "hosts.yaml")
+	if hosts != "" {
+		require.NoError(t, os.WriteFile(storagePath, []byte(hosts), 0644), "Should write storage file")
+	}
+	return newTestConfig(t, "  type: file\n  file:\n    path: "+storagePath+"\n"), storagePath
+}
+
+// Find the subcommand for the given args and parse the flags, without executing it
+func parseCommand(t *testing.T, args ...string) (*cobra.Command, *bytes.Buffer) {
+	t.Helper()
+
+	root := NewCommand()
+	cmd, flags, err := root.Find(args)
+	require.NoError(t, err, "Should find command")
+	require.NoError(t, cmd.ParseFlags(flags), "Should parse flags")
+
+	out := &bytes.Buffer{}
+	root.SetOut(out)
+	root.SetErr(out)
+	return cmd, out
+}
+
+func TestCMD(t *testing.T) {
+	tMatrix := []struct {
+		Name          string
+		Args          []string
+		ExitWithError bool
+	}{
+		{
+			Name: "Help",
+		},
+		{
+			Name: "MigrateHelp",
+			Args: []string{"migrate", "--help"},
+		},
+		{
+			Name:          "MigrateMissingFlags",
+			Args:          []string{"migrate"},
+			ExitWithError: true,
+		},
+		{
+			Name:          "MigrateMissingConfig",
+			Args:          []string{"migrate", "--from", "not-a-file.yaml", "--to", "not-a-file.yaml"},
+			ExitWithError: true,
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			if os.Getenv("RUN_CRASH_TEST") == "1" {
+				cmd := NewCommand()
+				cmd.SetArgs(tCase.Args)
+
+				err := cmd.Execute()
+				if err != nil {
+					t.Logf("Execute failed: %v", err)
+					os.Exit(2)
+				}
+
+				os.Exit(0)
+			}
+			execExitTest(t, "TestCMD/"+tCase.Name, tCase.ExitWithError)
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	t.Run("FileToSQLite", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		from, _ := newFileConfig(t, testHostsYAML)
+		to := newTestConfig(t, "  type: sqlite\n  sqlite:\n    path: "+filepath.Join(t.TempDir(), "hosts.db")+"\n")
+
+		cmd, out := parseCommand(t, "migrate", "--from", from, "--to", to, "--verify")
+		require.NoError(runMigrate(cmd), "Should migrate hosts")
+		assert.Contains(out.String(), "2 hosts copied, 0 removed", "Should print summary")
+		assert.Contains(out.String(), "Verified", "Should verify the target")
+
+		// Migrate back to check the content of the sqlite database
+		back, storagePath := newFileConfig(t, "")
+		cmd, _ = parseCommand(t, "migrate", "--from", to, "--to", back)
+		require.NoError(runMigrate(cmd), "Should migrate hosts back")
+
+		data, err := os.ReadFile(storagePath)
+		require.NoError(err)
+		assert.Equal(testHostsYAML, string(data), "Should keep order and all fields")
+	})
+
+	t.Run("DryRun", func(t *testing.T) {
+		assert := assert.New(t)
+
+		from, _ := newFileConfig(t, testHostsYAML)
+		to, storagePath := newFileConfig(t, "hosts:\n    - mac: \"00:00:00:00:00:33\"\n      name: Host3\n")
+
+		cmd, out := parseCommand(t, "migrate", "--from", from, "--to", to, "--dry-run", "--force")
+		require.NoError(t, runMigrate(cmd), "Should check migration")
+		assert.Contains(out.String(), "Dry run", "Should print dry run")
+		assert.Contains(out.String(), "Removed: 00:00:00:00:00:33", "Should print removed hosts")
+		assert.Contains(out.String(), "2 hosts copied, 1 removed", "Should print summary")
+
+		data, err := os.ReadFile(storagePath)
+		require.NoError(t, err)
+		assert.Contains(string(data), "Host3", "Should not change the target")
+	})
+
+	t.Run("TargetNotEmpty", func(t *testing.T) {
+		from, _ := newFileConfig(t, testHostsYAML)
+		to, _ := newFileConfig(t, testHostsYAML)
+
+		cmd, _ := parseCommand(t, "migrate", "--from", from, "--to", to)
+		assert.ErrorContains(t, runMigrate(cmd), "failed to migrate from file to file: target storage already contains 2 hosts")
+	})
+
+	t.Run("SameStorage", func(t *testing.T) {
+		from, _ := newFileConfig(t, testHostsYAML)
+
+		cmd, _ := parseCommand(t, "migrate", "--from", from, "--to", from)
+		assert.ErrorContains(t, runMigrate(cmd), "source and target use the same storage")
+	})
+
+	t.Run("InvalidTarget", func(t *testing.T) {
+		from, _ := newFileConfig(t, testHostsYAML)
+		to := newTestConfig(t, "  type: unknown\n")
+
+		cmd, _ := parseCommand(t, "migrate", "--from", from, "--to", to)
+		assert.ErrorContains(t, runMigrate(cmd), "failed to open target storage")
+	})
+}
+
+func execExitTest(t *testing.T, test string, exitsError bool) {
+	cmd := exec.Command(os.Args[0], "-test.run="+test)
+	cmd.Env = append(os.Environ(), "RUN_CRASH_TEST=1")
+	err := cmd.Run()
+	if exitsError && err == nil {
+		t.Fatal("Process exited without error")
+	} else if !exitsError && err == nil {
+		return
+	}
+	if e, ok := err.(*exec.ExitError); ok && !e.Success() {
+		return
+	}
+	t.Fatalf("process ran with err %v, want exit status 1", err)
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/heathcliff26/go-wol/pkg/server/config"
+	"github.com/heathcliff26/go-wol/pkg/server/storage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	flagNameFrom   = "from"
+	flagNameTo     = "to"
+	flagNameDryRun = "dry-run"
+	flagNameVerify = "verify"
+	flagNameForce  = "force"
+)
+
+func newMigrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Copy all hosts from the storage of one server config to another, keeping their order",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			err := runMigrate(cmd)
+			if err != nil {
+				exitError(cmd, err)
+			}
+		},
+	}
+
+	cmd.Flags().String(flagNameFrom, "", "Config file of the server with the storage to copy from")
+	cmd.Flags().String(flagNameTo, "", "Config file of the server with the storage to copy to")
+	cmd.Flags().Bool(flagNameDryRun, false, "Only show the changes without applying them")
+	cmd.Flags().Bool(flagNameVerify, false, "Read the hosts back from the target and compare them with the source")
+	cmd.Flags().Bool(flagNameForce, false, "Replace the hosts if the target is not empty")
+	_ = cmd.MarkFlagRequired(flagNameFrom)
+	_ = cmd.MarkFlagRequired(flagNameTo)
+
+	return cmd
+}
+
+func runMigrate(cmd *cobra.Command) error {
+	from, err := cmd.Flags().GetString(flagNameFrom)
+	if err != nil {
+		return fmt.Errorf("failed to get from flag: %w", err)
+	}
+	to, err := cmd.Flags().GetString(flagNameTo)
+	if err != nil {
+		return fmt.Errorf("failed to get to flag: %w", err)
+	}
+	env, err := cmd.Flags().GetBool(flagNameEnv)
+	if err != nil {
+		return fmt.Errorf("failed to get env flag: %w", err)
+	}
+	var opts storage.MigrateOptions
+	opts.DryRun, err = cmd.Flags().GetBool(flagNameDryRun)
+	if err != nil {
+		return fmt.Errorf("failed to get dry-run flag: %w", err)
+	}
+	opts.Verify, err = cmd.Flags().GetBool(flagNameVerify)
+	if err != nil {
+		return fmt.Errorf("failed to get verify flag: %w", err)
+	}
+	opts.Force, err = cmd.Flags().GetBool(flagNameForce)
+	if err != nil {
+		return fmt.Errorf("failed to get force flag: %w", err)
+	}
+
+	fromCfg, err := config.LoadConfig(from, env, "")
+	if err != nil {
+		return fmt.Errorf("failed to load source config: %w", err)
+	}
+	toCfg, err := config.LoadConfig(to, env, "")
+	if err != nil {
+		return fmt.Errorf("failed to load target config: %w", err)
+	}
+	if reflect.DeepEqual(fromCfg.Storage, toCfg.Storage) {
+		return fmt.Errorf("source and target use the same storage")
+	}
+
+	source, err := storage.NewBackend(fromCfg.Storage)
+	if err != nil {
+		return fmt.Errorf("failed to open source storage: %w", err)
+	}
+	defer storage.CloseBackend(source)
+	target, err := storage.NewBackend(toCfg.Storage)
+	if err != nil {
+		return fmt.Errorf("failed to open target storage: %w", err)
+	}
+	defer storage.CloseBackend(target)
+
+	result, err := storage.Migrate(context.Background(), source, target, opts)
+	if err != nil {
+		return fmt.Errorf("failed to migrate from %s to %s: %w", fromCfg.Storage.Type, toCfg.Storage.Type, err)
+	}
+
+	printMigrateResult(cmd.OutOrStdout(), result)
+	return nil
+}
+
+// Print a summary of the migration
+func printMigrateResult(out io.Writer, result storage.MigrateResult) {
+	if result.DryRun {
+		fmt.Fprintln(out, "Dry run, no changes have been made")
+	}
+	if len(result.Removed) > 0 {
+		fmt.Fprintf(out, "Removed: %s\n", strings.Join(result.Removed, ", "))
+	}
+	fmt.Fprintf(out, "%d hosts copied, %d removed\n", len(result.Copied), len(result.Removed))
+	if result.Verified {
+		fmt.Fprintln(out, "Verified that the target contains all hosts")
+	}
+}
@@ -1,13 +1,32 @@
 package utils
 
 import (
+	"fmt"
 	"net"
 	"regexp"
+	"slices"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
 )
 
 var hostnameValidCharsRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?$`)
 
+var labelKeyRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9._-]{0,61}[a-zA-Z0-9])?$`)
+
+// Limits for the metadata of a host
+const (
+	maxDisplayNameLength = 100
+	maxDescriptionLength = 1000
+	maxLocationLength    = 100
+	maxTags              = 20
+	maxTagLength         = 50
+	maxLabels            = 20
+	maxLabelValueLength  = 253
+)
+
 // ValidateMACAddress checks if the given string is a valid MAC address.
 func ValidateMACAddress(macAddrStr string) bool {
 	_, err := net.ParseMAC(macAddrStr)
@@ -35,3 +54,77 @@ func ValidateHostname(hostname string) bool {
 
 	return true
 }
+
+// Validate that the host has a valid MAC address and hostname.
+func ValidateHost(host types.Host) error {
+	if !ValidateMACAddress(host.MAC) {
+		return fmt.Errorf("invalid MAC address '%s'", host.MAC)
+	}
+	if !ValidateHostname(host.Name) {
+		return fmt.Errorf("invalid hostname '%s'", host.Name)
+	}
+	return ValidateHostMetadata(host)
+}
+
+// Check if the name of a site is valid, it uses the same rules as label keys
+func ValidateSite(site string) bool {
+	return labelKeyRegexp.MatchString(site)
+}
+
+// Validate the optional metadata of the host, like display name, tags and labels.
+func ValidateHostMetadata(host types.Host) error {
+	if !validText(host.DisplayName, maxDisplayNameLength, false) {
+		return fmt.Errorf("invalid display name, needs to be a single line of at most %d characters", maxDisplayNameLength)
+	}
+	if !validText(host.Description, maxDescriptionLength, true) {
+		return fmt.Errorf("invalid description, needs to be at most %d characters", maxDescriptionLength)
+	}
+	if !validText(host.Location, maxLocationLength, false) {
+		return fmt.Errorf("invalid location, needs to be a single line of at most %d characters", maxLocationLength)
+	}
+	if host.Site != "" && !ValidateSite(host.Site) {
+		return fmt.Errorf("invalid site '%s', needs to be alphanumeric with '-', '_' or '.' in between and at most 63 characters", host.Site)
+	}
+	if host.Icon != "" && !slices.Contains(types.HostIcons, host.Icon) {
+		return fmt.Errorf("unknown icon '%s', needs to be one of %s", host.Icon, strings.Join(types.HostIcons, ", "))
+	}
+
+	if len(host.Tags) > maxTags {
+		return fmt.Errorf("too many tags, at most %d are allowed", maxTags)
+	}
+	for i, tag := range host.Tags {
+		if tag == "" || tag != strings.TrimSpace(tag) || strings.Contains(tag, ";") || !validText(tag, maxTagLength, false) {
+			return fmt.Errorf("invalid tag '%s', needs to be at most %d characters without semicolons or surrounding whitespace", tag, maxTagLength)
+		}
+		if slices.ContainsFunc(host.Tags[:i], func(t string) bool { return strings.EqualFold(t, tag) }) {
+			return fmt.Errorf("duplicate tag '%s'", tag)
+		}
+	}
+
+	if len(host.Labels) > maxLabels {
+		return fmt.Errorf("too many labels, at most %d are allowed", maxLabels)
+	}
+	for key, value := range host.Labels {
+		if !labelKeyRegexp.MatchString(key) {
+			return fmt.Errorf("invalid label key '%s', needs to be alphanumeric with '-', '_' or '.' in between and at most 63 characters", key)
+		}
+		if !validText(value, maxLabelValueLength, false) {
+			return fmt.Errorf("invalid value for label '%s', needs to be a single line of at most %d characters", key, maxLabelValueLength)
+		}
+	}
+	return nil
+}
+
+// Check that the text is valid UTF-8 of at most maxLength characters without control characters.
+// When multiline is set, line breaks are allowed.
+func validText(text string, maxLength int, multiline bool) bool {
+	if !utf8.ValidString(text) || utf8.RuneCountInString(text) > maxLength {
+		return false
+	}
+	for _, r := range text {
+		if unicode.IsControl(r) && !(multiline && r == '\n') {
+			return false
+		}
+	}
+	return true
+}
@@ -1,9 +1,11 @@
 package utils
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -84,3 +86,95 @@ func TestValidateHostname(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateHost(t *testing.T) {
+	tMatrix := []struct {
+		name  string
+		host  types.Host
+		valid bool
+	}{
+		{"Valid", types.Host{MAC: "01:23:45:67:89:AB", Name: "host.example.org"}, true},
+		{"ValidWithAddress", types.Host{MAC: "01:23:45:67:89:AB", Name: "host", Address: "192.0.2.1"}, true},
+		{"InvalidMAC", types.Host{MAC: "not-a-mac", Name: "host"}, false},
+		{"MissingMAC", types.Host{Name: "host"}, false},
+		{"InvalidName", types.Host{MAC: "01:23:45:67:89:AB", Name: "not a hostname"}, false},
+		{"MissingName", types.Host{MAC: "01:23:45:67:89:AB"}, false},
+		{"InvalidMetadata", types.Host{MAC: "01:23:45:67:89:AB", Name: "host", Icon: "unknown"}, false},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.name, func(t *testing.T) {
+			err := ValidateHost(tCase.host)
+			if tCase.valid {
+				assert.NoError(t, err, "Host should be valid")
+			} else {
+				assert.Error(t, err, "Host should be invalid")
+			}
+		})
+	}
+}
+
+func TestValidateHostMetadata(t *testing.T) {
+	host := func(fn func(host *types.Host)) types.Host {
+		host := types.Host{MAC: "01:23:45:67:89:AB", Name: "host"}
+		fn(&host)
+		return host
+	}
+
+	tMatrix := []struct {
+		name  string
+		host  types.Host
+		error string
+	}{
+		{"Empty", host(func(h *types.Host) {}), ""},
+		{"Full", host(func(h *types.Host) {
+			h.DisplayName = "Living room PC"
+			h.Description = "Gaming PC below the TV.\nTurn on the TV first."
+			h.Tags = []string{"gaming", "Windows 11"}
+			h.Icon = "desktop"
+			h.Location = "Living room"
+			h.Labels = map[string]string{"owner": "alice", "rack": "1"}
+			h.Site = "building-b"
+		}), ""},
+		{"ValidLabels", host(func(h *types.Host) { h.Labels = map[string]string{"owner": "alice", "asset.id": "A-1", "empty": ""} }), ""},
+		{"DisplayNameTooLong", host(func(h *types.Host) { h.DisplayName = strings.Repeat("a", 101) }), "invalid display name"},
+		{"DisplayNameMultiline", host(func(h *types.Host) { h.DisplayName = "Living\nroom" }), "invalid display name"},
+		{"DisplayNameUnicode", host(func(h *types.Host) { h.DisplayName = strings.Repeat("ü", 100) }), ""},
+		{"DescriptionTooLong", host(func(h *types.Host) { h.Description = strings.Repeat("a", 1001) }), "invalid description"},
+		{"DescriptionControlChar", host(func(h *types.Host) { h.Description = "a\x00b" }), "invalid description"},
+		{"LocationMultiline", host(func(h *types.Host) { h.Location = "a\nb" }), "invalid location"},
+		{"InvalidSite", host(func(h *types.Host) { h.Site = "building b" }), "invalid site"},
+		{"UnknownIcon", host(func(h *types.Host) { h.Icon = "toaster" }), "unknown icon"},
+		{"EmptyTag", host(func(h *types.Host) { h.Tags = []string{""} }), "invalid tag"},
+		{"TagWhitespace", host(func(h *types.Host) { h.Tags = []string{" gaming"} }), "invalid tag"},
+		{"TagSemicolon", host(func(h *types.Host) { h.Tags = []string{"a;b"} }), "invalid tag"},
+		{"TagTooLong", host(func(h *types.Host) { h.Tags = []string{strings.Repeat("a", 51)} }), "invalid tag"},
+		{"DuplicateTag", host(func(h *types.Host) { h.Tags = []string{"gaming", "Gaming"} }), "duplicate tag"},
+		{"TooManyTags", host(func(h *types.Host) {
+			for i := range 21 {
+				h.Tags = append(h.Tags, fmt.Sprintf("tag%d", i))
+			}
+		}), "too many tags"},
+		{"InvalidLabelKey", host(func(h *types.Host) { h.Labels = map[string]string{"-owner": "alice"} }), "invalid label key"},
+		{"LabelKeySlash", host(func(h *types.Host) { h.Labels = map[string]string{"example.org/rack": "1"} }), "invalid label key"},
+		{"LabelKeyTooLong", host(func(h *types.Host) { h.Labels = map[string]string{strings.Repeat("a", 64): ""} }), "invalid label key"},
+		{"LabelValueTooLong", host(func(h *types.Host) { h.Labels = map[string]string{"owner": strings.Repeat("a", 254)} }), "invalid value for label"},
+		{"TooManyLabels", host(func(h *types.Host) {
+			h.Labels = map[string]string{}
+			for i := range 21 {
+				h.Labels[fmt.Sprintf("label%d", i)] = ""
+			}
+		}), "too many labels"},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.name, func(t *testing.T) {
+			err := ValidateHostMetadata(tCase.host)
+			if tCase.error == "" {
+				assert.NoError(t, err, "Metadata should be valid")
+			} else {
+				assert.ErrorContains(t, err, tCase.error, "Metadata should be invalid")
+			}
+		})
+	}
+}
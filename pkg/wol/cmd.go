@@ -1,56 +1,187 @@
 package wol
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"time"
 
+	"github.com/heathcliff26/go-wol/pkg/client"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
 	"github.com/spf13/cobra"
 )
 
 const (
 	flagNameBroadcastAddress = "broadcast"
+	flagNameServer           = "server"
+	flagNameToken            = "token"
+	flagNameFile             = "file"
+	flagNameStagger          = "stagger"
 )
 
+// Exit code when some, but not all of the hosts could be woken
+const exitCodePartialFailure = 2
+
+// Options of the wol command
+type options struct {
+	bcAddr  string
+	server  string
+	token   string
+	file    string
+	stagger time.Duration
+}
+
 // Create new Wake-on-Lan command
 func NewCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "wol",
+		Use:   "wol <mac|name|group>...",
 		Short: "Send a magic packet to the given mac address",
-		Args:  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		Long: "Send a magic packet to the given mac addresses.\n" +
+			"With --server the hosts are woken by a go-wol server instead.\n" +
+			"Names and groups are resolved through the hosts in the file given with --file, or the known hosts of the server.\n" +
+			"Groups are the locations and tags of the hosts. Use - to read the targets from stdin, one per line.\n" +
+			"Without targets, all hosts in the file are woken.\n" +
+			"Hosts assigned to a site can only be woken with --server, which relays the magic packet into the network of the site.\n" +
+			"Exits with code 1 if no host could be woken and with code 2 if only some of them failed.",
+		Args: cobra.ArbitraryArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			bcAddr, err := cmd.Flags().GetString(flagNameBroadcastAddress)
+			opts, err := optionsFromFlags(cmd)
 			if err != nil {
 				exitError(cmd, err)
 			}
 
-			err = run(args[0], bcAddr)
+			results, err := run(cmd.Context(), cmd.InOrStdin(), opts, args)
 			if err != nil {
 				exitError(cmd, err)
 			}
+
+			failed := printResults(cmd.OutOrStdout(), cmd.ErrOrStderr(), results, opts.server)
+			if failed == len(results) {
+				exitError(cmd, fmt.Errorf("failed to wake any of the hosts"))
+			} else if failed > 0 {
+				exitErrorWithCode(cmd, fmt.Errorf("failed to wake %d of %d hosts", failed, len(results)), exitCodePartialFailure)
+			}
 		},
 	}
 
 	cmd.Flags().StringP(flagNameBroadcastAddress, "b", DEFAULT_BROADCAST_ADDRESS, "The broadcast ip address to use")
+	cmd.Flags().StringP(flagNameServer, "s", "", "URL of a go-wol server to wake the hosts instead of sending the magic packets locally")
+	cmd.Flags().String(flagNameToken, "", "Bearer token for authenticating against the server")
+	cmd.Flags().StringP(flagNameFile, "f", "", "Hosts file (yaml, json or csv) to resolve names and groups, or to wake all of its hosts")
+	cmd.Flags().Duration(flagNameStagger, 0, "Wake the hosts one after another with the given delay in between, instead of all at once")
 
 	return cmd
 }
 
-func run(macAddress, bcAddr string) error {
-	packet, err := CreatePacket(macAddress)
+func optionsFromFlags(cmd *cobra.Command) (options, error) {
+	var opts options
+	for name, value := range map[string]*string{
+		flagNameBroadcastAddress: &opts.bcAddr,
+		flagNameServer:           &opts.server,
+		flagNameToken:            &opts.token,
+		flagNameFile:             &opts.file,
+	} {
+		var err error
+		*value, err = cmd.Flags().GetString(name)
+		if err != nil {
+			return options{}, fmt.Errorf("failed to get %s flag: %w", name, err)
+		}
+	}
+
+	var err error
+	opts.stagger, err = cmd.Flags().GetDuration(flagNameStagger)
+	if err != nil {
+		return options{}, fmt.Errorf("failed to get %s flag: %w", flagNameStagger, err)
+	}
+	if opts.stagger < 0 {
+		return options{}, fmt.Errorf("the stagger delay can't be negative")
+	}
+	return opts, nil
+}
+
+// Resolve the targets to hosts and wake them, either locally or through the server
+func run(ctx context.Context, in io.Reader, opts options, args []string) ([]result, error) {
+	var c *client.Client
+	if opts.server != "" {
+		var err error
+		c, err = client.NewClient(opts.server, opts.token)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	targets, err := readTargets(in, args)
+	if err != nil {
+		return nil, err
+	}
+
+	knownHosts := func() ([]types.Host, error) {
+		switch {
+		case opts.file != "":
+			return readHostsFile(opts.file)
+		case c != nil:
+			hosts, err := c.GetHosts(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get hosts: %w", err)
+			}
+			return hosts, nil
+		default:
+			return nil, fmt.Errorf("names and groups can only be used with --file or --server")
+		}
+	}
+
+	var hosts []types.Host
+	if len(targets) == 0 {
+		if opts.file == "" {
+			return nil, fmt.Errorf("no hosts given, either as arguments, from stdin or with --file")
+		}
+		hosts, err = knownHosts()
+	} else {
+		hosts, err = resolveTargets(targets, knownHosts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts to wake")
+	}
+
+	wake := func(host types.Host) error {
+		// The magic packet would only reach the local network, not the one of the site
+		if host.Site != "" {
+			return fmt.Errorf("host is assigned to site '%s', it can only be woken with --server", host.Site)
+		}
+		return sendMagicPacket(host.MAC, opts.bcAddr)
+	}
+	if c != nil {
+		wake = func(host types.Host) error {
+			return c.Wake(ctx, host.MAC)
+		}
+	}
+	return wakeAll(hosts, wake, opts.stagger), nil
+}
+
+func sendMagicPacket(mac, bcAddr string) error {
+	packet, err := CreatePacket(mac)
 	if err != nil {
-		return fmt.Errorf("invalid MAC address '%s': %w", macAddress, err)
+		return fmt.Errorf("invalid MAC address '%s': %w", mac, err)
 	}
 
 	err = packet.Send(bcAddr)
 	if err != nil {
 		return fmt.Errorf("failed to send magic packet: %w", err)
 	}
-	fmt.Printf("Magic packet sent to %s\n", macAddress)
 	return nil
 }
 
 // Print the error information on stderr and exit with code 1
 func exitError(cmd *cobra.Command, err error) {
+	exitErrorWithCode(cmd, err, 1)
+}
+
+// Print the error information on stderr and exit with the given code
+func exitErrorWithCode(cmd *cobra.Command, err error, code int) {
 	fmt.Fprintln(cmd.Root().ErrOrStderr(), "Fatal: "+err.Error())
-	os.Exit(1)
+	os.Exit(code)
 }
@@ -1,9 +1,22 @@
 package wol
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCMD(t *testing.T) {
@@ -72,6 +85,225 @@ func TestCMD(t *testing.T) {
 	}
 }
 
+// Start a fake go-wol server knowing a few hosts, waking 22:22:22:22:22:22 fails
+func newTestServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	var lock sync.Mutex
+	woken := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer token" {
+			res.WriteHeader(http.StatusUnauthorized)
+			_, _ = res.Write([]byte(`{"status":"error","reason":"Invalid token"}`))
+			return
+		}
+		if req.URL.Path == "/api/v1/hosts" {
+			_, _ = res.Write([]byte(`[{"mac":"AA:BB:CC:DD:EE:FF","name":"nas","tags":["storage"]},{"mac":"11:22:33:44:55:66","name":"pc","displayName":"Gaming PC","location":"Office"},{"mac":"22:22:22:22:22:22","name":"remote","location":"Office"}]`))
+			return
+		}
+		mac, ok := strings.CutPrefix(req.URL.Path, "/api/v1/wake/")
+		if !ok || mac == "22:22:22:22:22:22" {
+			res.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = res.Write([]byte(`{"status":"error","reason":"No relay agent available for site 'building-b'"}`))
+			return
+		}
+		lock.Lock()
+		woken = append(woken, mac)
+		lock.Unlock()
+		_, _ = res.Write([]byte(`{"status":"ok"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &woken
+}
+
+func TestRunRemote(t *testing.T) {
+	server, woken := newTestServer(t)
+
+	tMatrix := []struct {
+		Name   string
+		Token  string
+		Args   []string
+		Stdin  string
+		Output string
+		Errors string
+		Error  string
+	}{
+		{
+			Name:   "MAC",
+			Args:   []string{"aa-bb-cc-dd-ee-ff"},
+			Output: "Magic packet sent to AA:BB:CC:DD:EE:FF via " + server.URL + "\n",
+		},
+		{
+			Name:   "Names",
+			Args:   []string{"NAS", "gaming pc"},
+			Output: "Magic packet sent to nas (AA:BB:CC:DD:EE:FF) via " + server.URL + "\nMagic packet sent to Gaming PC (11:22:33:44:55:66) via " + server.URL + "\nWoke 2 of 2 hosts\n",
+		},
+		{
+			Name:   "GroupWithPartialFailure",
+			Args:   []string{"office", "pc"},
+			Output: "Magic packet sent to Gaming PC (11:22:33:44:55:66) via " + server.URL + "\nWoke 1 of 2 hosts\n",
+			Errors: "Failed to wake remote (22:22:22:22:22:22): server responded with status 503: No relay agent available for site 'building-b'\n",
+		},
+		{
+			Name:   "Stdin",
+			Args:   []string{"-"},
+			Stdin:  "# hosts to wake\nstorage\n\n00:00:00:00:00:01\n",
+			Output: "Magic packet sent to nas (AA:BB:CC:DD:EE:FF) via " + server.URL + "\nMagic packet sent to 00:00:00:00:00:01 via " + server.URL + "\nWoke 2 of 2 hosts\n",
+		},
+		{
+			Name:  "Unknown",
+			Args:  []string{"nas", "server"},
+			Error: "no host or group 'server' found",
+		},
+		{
+			Name:  "WrongToken",
+			Token: "other",
+			Args:  []string{"nas"},
+			Error: "server responded with status 401: Invalid token",
+		},
+		{
+			Name:  "NoTargets",
+			Error: "no hosts given",
+		},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			*woken = (*woken)[:0]
+			token := tCase.Token
+			if token == "" {
+				token = "token"
+			}
+
+			results, err := run(t.Context(), strings.NewReader(tCase.Stdin), options{server: server.URL, token: token}, tCase.Args)
+			if tCase.Error != "" {
+				assert.ErrorContains(t, err, tCase.Error, "Should fail")
+				return
+			}
+			require.NoError(t, err, "Should wake hosts")
+
+			out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+			printResults(out, errOut, results, server.URL)
+			assert.Equal(t, tCase.Output, out.String(), "Should print the result of every host")
+			assert.Equal(t, tCase.Errors, errOut.String(), "Should print the failures to stderr")
+		})
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	hostsFile := filepath.Join(t.TempDir(), "hosts.yaml")
+	require.NoError(t, os.WriteFile(hostsFile, []byte("hosts:\n  - mac: \"AA:BB:CC:DD:EE:FF\"\n    name: nas\n    tags: [storage]\n  - mac: \"11:22:33:44:55:66\"\n    name: pc\n  - mac: \"22:22:22:22:22:22\"\n    name: remote\n    site: building-b\n"), 0644), "Should write hosts file")
+
+	t.Run("AllHosts", func(t *testing.T) {
+		results, err := run(t.Context(), strings.NewReader(""), options{file: hostsFile, bcAddr: "127.0.0.1"}, nil)
+		require.NoError(t, err, "Should wake hosts")
+		require.Len(t, results, 3, "Should wake all hosts of the file")
+		assert.NoError(t, results[0].err, "Should send the magic packet")
+		assert.NoError(t, results[1].err, "Should send the magic packet")
+		assert.ErrorContains(t, results[2].err, "host is assigned to site 'building-b', it can only be woken with --server", "Should not broadcast the host of a remote site locally")
+	})
+	t.Run("Group", func(t *testing.T) {
+		results, err := run(t.Context(), strings.NewReader(""), options{file: hostsFile, bcAddr: "127.0.0.1"}, []string{"storage"})
+		require.NoError(t, err, "Should wake hosts")
+		require.Len(t, results, 1, "Should only wake the hosts of the group")
+		assert.Equal(t, "nas", results[0].host.Name)
+	})
+	t.Run("MissingFile", func(t *testing.T) {
+		_, err := run(t.Context(), strings.NewReader(""), options{file: filepath.Join(t.TempDir(), "missing.yaml")}, nil)
+		assert.ErrorContains(t, err, "failed to open hosts file", "Should fail")
+	})
+	t.Run("NameWithoutHosts", func(t *testing.T) {
+		_, err := run(t.Context(), strings.NewReader(""), options{}, []string{"nas"})
+		assert.ErrorContains(t, err, "names and groups can only be used with --file or --server", "Should fail")
+	})
+}
+
+func TestResolveTargets(t *testing.T) {
+	assert := assert.New(t)
+
+	loads := 0
+	knownHosts := func() ([]types.Host, error) {
+		loads++
+		return []types.Host{
+			{MAC: "AA:BB:CC:DD:EE:FF", Name: "nas", Tags: []string{"storage"}},
+			{MAC: "11:22:33:44:55:66", Name: "pc", Tags: []string{"Storage"}},
+		}, nil
+	}
+
+	hosts, err := resolveTargets([]string{"ff:ff:ff:ff:ff:ff", "ff-ff-ff-ff-ff-ff"}, knownHosts)
+	require.NoError(t, err)
+	assert.Equal([]types.Host{{MAC: "FF:FF:FF:FF:FF:FF"}}, hosts, "Should remove duplicate MAC addresses")
+	assert.Zero(loads, "Should not load the hosts for MAC addresses")
+
+	hosts, err = resolveTargets([]string{"nas", "storage", "aa:bb:cc:dd:ee:ff"}, knownHosts)
+	require.NoError(t, err)
+	assert.Len(hosts, 2, "Should wake every host only once")
+	assert.Equal("pc", hosts[1].Name, "Should expand the group")
+	assert.Equal(1, loads, "Should load the hosts only once")
+}
+
+func TestWakeAll(t *testing.T) {
+	hosts := []types.Host{{MAC: "00:00:00:00:00:01"}, {MAC: "00:00:00:00:00:02"}, {MAC: "00:00:00:00:00:03"}}
+	wake := func(host types.Host) error {
+		if host.MAC == "00:00:00:00:00:02" {
+			return errors.New("failed")
+		}
+		return nil
+	}
+
+	t.Run("Parallel", func(t *testing.T) {
+		results := wakeAll(hosts, wake, 0)
+		require.Len(t, results, 3)
+		for i, r := range results {
+			assert.Equal(t, hosts[i], r.host, "Should keep the order of the hosts")
+		}
+		assert.Error(t, results[1].err, "Should return the error of the host")
+		assert.Equal(t, 1, printResults(io.Discard, io.Discard, results, ""), "Should count the failed hosts")
+	})
+	t.Run("Stagger", func(t *testing.T) {
+		start := time.Now()
+		results := wakeAll(hosts, wake, 20*time.Millisecond)
+		assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond, "Should wait between the hosts")
+		require.Len(t, results, 3)
+		assert.NoError(t, results[2].err)
+	})
+}
+
+func TestExitCode(t *testing.T) {
+	if os.Getenv("RUN_CRASH_TEST") == "1" {
+		cmd := NewCommand()
+		cmd.SetArgs(strings.Split(os.Getenv("TEST_ARGS"), " "))
+		_ = cmd.Execute()
+		os.Exit(0)
+	}
+
+	server, _ := newTestServer(t)
+
+	tMatrix := []struct {
+		Name, Args string
+		Code       int
+	}{
+		{"Success", "nas pc", 0},
+		{"PartialFailure", "office", exitCodePartialFailure},
+		{"Failure", "remote", 1},
+	}
+
+	for _, tCase := range tMatrix {
+		t.Run(tCase.Name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=TestExitCode$")
+			cmd.Env = append(os.Environ(), "RUN_CRASH_TEST=1", "TEST_ARGS=--server "+server.URL+" --token token "+tCase.Args)
+			err := cmd.Run()
+			if tCase.Code == 0 {
+				assert.NoError(t, err, "Should exit without error")
+				return
+			}
+			var exitErr *exec.ExitError
+			require.ErrorAs(t, err, &exitErr, "Should exit with error")
+			assert.Equal(t, tCase.Code, exitErr.ExitCode(), "Should exit with the correct code")
+		})
+	}
+}
+
 func execExitTest(t *testing.T, test string, exitsError bool) {
 	cmd := exec.Command(os.Args[0], "-test.run="+test)
 	cmd.Env = append(os.Environ(), "RUN_CRASH_TEST=1")
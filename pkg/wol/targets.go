@@ -0,0 +1,175 @@
+package wol
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heathcliff26/go-wol/pkg/server/storage/format"
+	"github.com/heathcliff26/go-wol/pkg/server/storage/types"
+	"github.com/heathcliff26/go-wol/pkg/utils"
+)
+
+// Maximum number of hosts woken at the same time
+const maxParallel = 16
+
+// Result of waking a single host
+type result struct {
+	host types.Host
+	err  error
+}
+
+// Return the targets from the arguments, reading them from stdin for "-".
+// Empty lines and lines starting with # are ignored.
+func readTargets(in io.Reader, args []string) ([]string, error) {
+	targets := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg != "-" {
+			targets = append(targets, arg)
+			continue
+		}
+
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				targets = append(targets, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read targets from stdin: %w", err)
+		}
+	}
+	return targets, nil
+}
+
+// Read the hosts from a hosts file, the format is detected from the file name and defaults to yaml
+func readHostsFile(path string) ([]types.Host, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open hosts file: %w", err)
+	}
+	defer f.Close()
+
+	hostsFormat := format.FromFilename(path)
+	if hostsFormat == "" {
+		hostsFormat = format.FormatYAML
+	}
+	hosts, err := format.Decode(f, hostsFormat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hosts file '%s': %w", path, err)
+	}
+	return hosts, nil
+}
+
+// Resolve the targets to the hosts to wake, without duplicates.
+// Targets are MAC addresses, names or display names of hosts, or groups, which are the locations and tags of the hosts.
+// The known hosts are only loaded when a target is not a MAC address.
+func resolveTargets(targets []string, knownHosts func() ([]types.Host, error)) ([]types.Host, error) {
+	var hosts []types.Host
+	loaded := false
+
+	result := make([]types.Host, 0, len(targets))
+	seen := make(map[string]bool, len(targets))
+	add := func(host types.Host) {
+		hwAddr, err := net.ParseMAC(host.MAC)
+		if err == nil {
+			host.MAC = strings.ToUpper(hwAddr.String())
+		}
+		if !seen[host.MAC] {
+			seen[host.MAC] = true
+			result = append(result, host)
+		}
+	}
+
+	for _, target := range targets {
+		if !loaded && !utils.ValidateMACAddress(target) {
+			var err error
+			hosts, err = knownHosts()
+			if err != nil {
+				return nil, fmt.Errorf("can't resolve '%s': %w", target, err)
+			}
+			loaded = true
+		}
+
+		if host, ok := types.FindHost(hosts, target); ok {
+			add(host)
+			continue
+		}
+		if utils.ValidateMACAddress(target) {
+			add(types.Host{MAC: target})
+			continue
+		}
+
+		found := false
+		for _, host := range hosts {
+			if host.InGroup(target) {
+				add(host)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no host or group '%s' found", target)
+		}
+	}
+	return result, nil
+}
+
+// Wake all hosts, either in parallel or one after another with the stagger delay in between.
+// The results are returned in the order of the hosts.
+func wakeAll(hosts []types.Host, wake func(host types.Host) error, stagger time.Duration) []result {
+	results := make([]result, len(hosts))
+	if stagger > 0 {
+		for i, host := range hosts {
+			if i > 0 {
+				time.Sleep(stagger)
+			}
+			results[i] = result{host: host, err: wake(host)}
+		}
+		return results
+	}
+
+	sem := make(chan struct{}, maxParallel)
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = result{host: host, err: wake(host)}
+		})
+	}
+	wg.Wait()
+	return results
+}
+
+// Print the result for every host and a summary when waking multiple hosts.
+// Failures are printed to errOut. Returns the number of hosts that failed.
+func printResults(out, errOut io.Writer, results []result, server string) int {
+	via := ""
+	if server != "" {
+		via = " via " + server
+	}
+
+	failed := 0
+	for _, r := range results {
+		name := r.host.MAC
+		if r.host.Name != "" {
+			name = fmt.Sprintf("%s (%s)", r.host.Title(), r.host.MAC)
+		}
+		if r.err != nil {
+			fmt.Fprintf(errOut, "Failed to wake %s: %v\n", name, r.err)
+			failed++
+		} else {
+			fmt.Fprintf(out, "Magic packet sent to %s%s\n", name, via)
+		}
+	}
+	if len(results) > 1 {
+		fmt.Fprintf(out, "Woke %d of %d hosts\n", len(results)-failed, len(results))
+	}
+	return failed
+}
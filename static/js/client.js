@@ -66,7 +66,43 @@ async function addHost() {
         host.Address = address;
     }
 
+    const displayName = document.getElementById('displayName').value.trim();
+    if (displayName != "") {
+        host.displayName = displayName;
+    }
+    const description = document.getElementById('description').value.trim();
+    if (description != "") {
+        host.description = description;
+    }
+    const icon = document.getElementById('icon').value;
+    if (icon != "") {
+        host.icon = icon;
+    }
+    const hostLocation = document.getElementById('location').value.trim();
+    if (hostLocation != "") {
+        host.location = hostLocation;
+    }
+    const site = document.getElementById('site').value.trim();
+    if (site != "") {
+        host.site = site;
+    }
+    const tags = document.getElementById('tags').value.split(",").map(tag => tag.trim()).filter(tag => tag != "");
+    if (tags.length > 0) {
+        host.tags = tags;
+    }
+    const labels = {};
+    for (const line of document.getElementById('labels').value.split("\n")) {
+        const index = line.indexOf("=");
+        if (index > 0) {
+            labels[line.slice(0, index).trim()] = line.slice(index + 1).trim();
+        }
+    }
+    if (Object.keys(labels).length > 0) {
+        host.labels = labels;
+    }
+
     modal.hide();
+    lastLocalChange = Date.now();
     try {
         const response = await fetch('/api/v1/hosts', {
             method: 'PUT',
@@ -95,6 +131,7 @@ async function deleteHost(macAddr, name) {
         return;
     }
 
+    lastLocalChange = Date.now();
     try {
         const response = await fetch(`/api/v1/hosts/${macAddr}`, {
             method: 'DELETE',
@@ -114,6 +151,81 @@ async function deleteHost(macAddr, name) {
     }
 }
 
+async function saveHostOrder(order) {
+    lastLocalChange = Date.now();
+    try {
+        const response = await fetch('/api/v1/hosts/order', {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ order: order })
+        });
+
+        const responseBody = await response.json();
+
+        if (!response.ok) {
+            appendAlert(`Failed to save order of hosts: ${responseBody.reason}`, "warning");
+            location.reload();
+        }
+    } catch (error) {
+        console.error(error.message);
+        appendAlert("Failed to save order of hosts", "danger");
+    }
+}
+
+async function discoverHosts(refresh) {
+    const refreshButton = document.getElementById("discoverRefreshButton");
+    refreshButton.disabled = true;
+    setDiscoverStatus("Scanning the network...");
+
+    try {
+        const response = await fetch(`/api/v1/hosts/discover?refresh=${refresh}`);
+
+        const responseBody = await response.json();
+
+        if (response.ok) {
+            renderDiscoveredHosts(responseBody);
+        } else {
+            setDiscoverStatus(`Failed to discover hosts: ${responseBody.reason}`);
+        }
+    } catch (error) {
+        console.error(error.message);
+        setDiscoverStatus("Failed to discover hosts");
+    } finally {
+        refreshButton.disabled = false;
+    }
+}
+
+async function addDiscoveredHost(host, button) {
+    button.disabled = true;
+
+    lastLocalChange = Date.now();
+    try {
+        const response = await fetch('/api/v1/hosts', {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ mac: host.mac, name: host.name, address: host.address })
+        });
+
+        const responseBody = await response.json();
+
+        if (response.ok) {
+            button.innerText = "✅ Added";
+            discoveredHostAdded = true;
+        } else {
+            button.disabled = false;
+            appendAlert(`Failed to add host: ${responseBody.reason}`, "warning");
+        }
+    } catch (error) {
+        console.error(error.message);
+        button.disabled = false;
+        appendAlert("Failed to add host " + host.name, "danger");
+    }
+}
+
 async function hostStatus() {
     try {
         const response = await fetch(`/api/v1/hosts/status`);
@@ -47,6 +47,67 @@ function showAddHostModal() {
     modal.show();
 }
 
+let discoverModal = null;
+let discoveredHostAdded = false;
+
+function showDiscoverModal() {
+    if (!discoverModal) {
+        const element = document.getElementById('discoverModal');
+        discoverModal = new bootstrap.Modal(element);
+        // Reload to show the added hosts
+        element.addEventListener('hidden.bs.modal', () => {
+            if (discoveredHostAdded) {
+                location.reload();
+            }
+        });
+    }
+    discoverModal.show();
+    discoverHosts(false);
+}
+
+function setDiscoverStatus(message) {
+    document.getElementById('discoverStatus').textContent = message;
+}
+
+function renderDiscoveredHosts(result) {
+    const list = document.getElementById('discoveredHosts');
+    list.replaceChildren();
+
+    const lastScan = new Date(result.time).toLocaleString();
+    if (result.hosts.length === 0) {
+        setDiscoverStatus(`No new hosts found, last scan: ${lastScan}`);
+        return;
+    }
+    setDiscoverStatus(`Found ${result.hosts.length} new hosts, last scan: ${lastScan}`);
+
+    for (const host of result.hosts) {
+        const item = document.createElement('li');
+        item.className = "list-group-item d-flex justify-content-between align-items-center";
+
+        const details = document.createElement('div');
+        details.className = "text-start";
+        const name = document.createElement('div');
+        name.className = "fw-bold";
+        name.textContent = host.name;
+        const addresses = document.createElement('small');
+        addresses.className = "text-muted";
+        addresses.textContent = `${host.mac} - ${host.address}`;
+        details.append(name, addresses);
+
+        const button = document.createElement('button');
+        button.type = "button";
+        button.className = "btn btn-success btn-sm";
+        button.textContent = "Add";
+        button.setAttribute("aria-label", `Add ${host.name} to go-wol`);
+        button.onclick = function () {
+            addDiscoveredHost(host, button);
+        };
+
+        item.append(details, button);
+        list.append(item);
+    }
+}
+
 function formatAndValidateMAC(input) {
     // Remove all non-hexadecimal characters
     let value = input.value.replace(/[^a-fA-F0-9]/g, '').toUpperCase();
@@ -117,12 +178,132 @@ function updateHostStatus(statuses) {
             continue;
         }
         addressElement.innerHTML = status.online ? "🟢 " + status.address : "🔴 " + status.address;
+        addressElement.title = status.lastSeen ? "Last seen " + new Date(status.lastSeen).toLocaleString() : "Not seen online yet";
         if (status.error) {
             appendAlert(`Failed to fetch status for host ${status.mac}: ${status.error}`, "warning");
         }
     }
 }
 
+// Remove separators from MAC addresses, so they can be searched with any separator
+function stripMACSeparators(text) {
+    return text.replace(/[:.-]/g, '');
+}
+
+// Show only the hosts matching the search box and all active filter chips.
+// Location chips act as groups, only one of them can be active at a time.
+function filterHosts() {
+    const search = document.getElementById("hostSearch")?.value.trim().toLowerCase() || "";
+    const activeTags = Array.from(document.querySelectorAll("#hostFilterChips [data-tag].active"), chip => chip.dataset.tag.toLowerCase());
+    const activeLocation = document.querySelector("#hostFilterChips [data-location].active")?.dataset.location.toLowerCase();
+
+    let visible = 0;
+    for (const host of document.querySelectorAll("#hostList > li[data-mac]")) {
+        const text = host.dataset.search.toLowerCase();
+        const tags = host.dataset.tags.toLowerCase().split(";");
+
+        let match = search === "" || text.includes(search) || (stripMACSeparators(search) !== "" && stripMACSeparators(text).includes(stripMACSeparators(search)));
+        match = match && activeTags.every(tag => tags.includes(tag));
+        match = match && (!activeLocation || host.dataset.location.toLowerCase() === activeLocation);
+
+        host.classList.toggle("d-none", !match);
+        if (match) {
+            visible++;
+        }
+    }
+
+    document.getElementById("noMatchingHosts")?.classList.toggle("d-none", visible > 0);
+}
+
+function toggleFilterChip(chip) {
+    const active = !chip.classList.contains("active");
+    if (active && chip.dataset.location !== undefined) {
+        for (const other of document.querySelectorAll("#hostFilterChips [data-location].active")) {
+            other.classList.remove("active");
+            other.setAttribute("aria-pressed", "false");
+        }
+    }
+    chip.classList.toggle("active", active);
+    chip.setAttribute("aria-pressed", active ? "true" : "false");
+    filterHosts();
+}
+
+let draggedHost = null;
+let hostOrderBeforeDrag = [];
+
+// Return the MAC addresses of all hosts in the order they are displayed
+function getHostOrder() {
+    const hosts = document.querySelectorAll("#hostList > li[data-mac]");
+    return Array.from(hosts, host => host.dataset.mac);
+}
+
+function hostDragStart(event) {
+    draggedHost = event.currentTarget;
+    hostOrderBeforeDrag = getHostOrder();
+
+    event.dataTransfer.effectAllowed = "move";
+    event.dataTransfer.setData("text/plain", draggedHost.dataset.mac);
+    draggedHost.classList.add("opacity-50");
+}
+
+function hostDragOver(event) {
+    const target = event.currentTarget;
+    if (!draggedHost || target === draggedHost) {
+        return;
+    }
+    event.preventDefault();
+    event.dataTransfer.dropEffect = "move";
+
+    // Insert the dragged host before or after the target, depending on which half of the target the cursor is in
+    const rect = target.getBoundingClientRect();
+    if (event.clientY > rect.top + rect.height / 2) {
+        target.after(draggedHost);
+    } else {
+        target.before(draggedHost);
+    }
+}
+
+function hostDragEnd(event) {
+    if (!draggedHost) {
+        return;
+    }
+    draggedHost.classList.remove("opacity-50");
+    draggedHost = null;
+
+    const order = getHostOrder();
+    if (order.join(",") !== hostOrderBeforeDrag.join(",")) {
+        saveHostOrder(order);
+    }
+}
+
 hostStatus();
 // Update host status every 30 seconds
 setInterval(hostStatus, 30000);
+
+// Time of the last change made on this page, the resulting events are ignored as the page already handles them.
+let lastLocalChange = 0;
+
+// Reload the page when the hosts are changed by someone else, unless the user is currently busy with them.
+function subscribeEvents() {
+    if (!window.EventSource) {
+        return;
+    }
+
+    const onChange = function () {
+        if (Date.now() - lastLocalChange < 2000) {
+            return;
+        }
+        if (draggedHost || document.querySelector(".modal.show")) {
+            appendAlert("The hosts have been changed, reload the page to see the changes", "warning");
+            return;
+        }
+        location.reload();
+    };
+
+    const events = new EventSource("/api/v1/events");
+    for (const type of ["host-updated", "host-removed", "hosts-reordered"]) {
+        events.addEventListener(type, onChange);
+    }
+}
+
+subscribeEvents();